@@ -1,11 +1,20 @@
 #!/bin/bash
 set -euo pipefail
 
+# The optional argument is the name of the lab the service is for. Each lab
+# other than the default one has its own socket and network identifier, so
+# that the VMs of different labs don't share a network.
+LAB="${1:-default}"
+SUFFIX=""
+if [ "${LAB}" != "default" ]; then
+    SUFFIX=".${LAB}"
+fi
+
 # Generate a UUID for the vmnet network identifier.
 # The identifier is stored in a file to persist across restarts of the service.
 # This ensures that the same network identifier is used until the file is removed.
 STATE_DIR="/var/run/pvmlab"
-IDENTIFIER_FILE="${STATE_DIR}/socket_vmnet_network_identifier"
+IDENTIFIER_FILE="${STATE_DIR}/socket_vmnet_network_identifier${SUFFIX}"
 
 mkdir -p "${STATE_DIR}"
 
@@ -18,4 +27,4 @@ NETWORK_IDENTIFIER=$(cat "${IDENTIFIER_FILE}")
 exec /opt/homebrew/opt/socket_vmnet/bin/socket_vmnet \
     --vmnet-mode=host \
     --vmnet-network-identifier="${NETWORK_IDENTIFIER}" \
-    /var/run/vmlab.socket_vmnet
\ No newline at end of file
+    "/var/run/vmlab.socket_vmnet${SUFFIX}"
\ No newline at end of file
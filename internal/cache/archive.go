@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"pvmlab/internal/util"
+)
+
+// Export writes the cache to w as a tar archive, with the index first and
+// then the artifacts, for Import on another machine.
+func (c *Cache) Export(w io.Writer) error {
+	entries, err := c.List()
+	if err != nil {
+		return err
+	}
+	index, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    indexFile,
+		Mode:    0644,
+		Size:    int64(len(index)),
+		ModTime: time.Now(),
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(index); err != nil {
+		return err
+	}
+
+	written := map[string]bool{}
+	for _, e := range entries {
+		if written[e.SHA256] {
+			continue
+		}
+		written[e.SHA256] = true
+		if err := c.exportBlob(tw, &e); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func (c *Cache) exportBlob(tw *tar.Writer, e *Entry) error {
+	f, err := os.Open(c.BlobPath(e))
+	if err != nil {
+		return fmt.Errorf("failed to read %s from the cache: %w", e.Name, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    path.Join("blobs", "sha256", e.SHA256),
+		Mode:    0444,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("failed to export %s: %w", e.Name, err)
+	}
+	return nil
+}
+
+// Import adds the artifacts of an archive written by Export, optionally
+// gzip-compressed, to the cache and returns their entries. The artifacts are
+// verified against their digest. Like with Add, the blobs of the replaced
+// entries are kept until Prune.
+func (c *Cache) Import(r io.Reader) ([]Entry, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	unlock, err := c.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var imported []Entry
+	blobs := map[string]bool{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the cache archive: %w", err)
+		}
+		switch dir, name := path.Split(hdr.Name); {
+		case hdr.Name == indexFile:
+			if err := json.NewDecoder(tr).Decode(&imported); err != nil {
+				return nil, fmt.Errorf("failed to parse the index of the cache archive: %w", err)
+			}
+			for _, e := range imported {
+				if err := checkEntry(&e); err != nil {
+					return nil, fmt.Errorf("invalid entry in the index of the cache archive: %w", err)
+				}
+			}
+		case dir == "blobs/sha256/" && isDigest(name) && hdr.Typeflag == tar.TypeReg:
+			if !util.FileExists(filepath.Join(c.blobsDir(), name)) {
+				if err := c.copyBlob(tr, name); err != nil {
+					return nil, fmt.Errorf("failed to import %s: %w", name, err)
+				}
+			}
+			blobs[name] = true
+		default:
+			return nil, fmt.Errorf("unexpected file %s in the cache archive", hdr.Name)
+		}
+	}
+
+	entries, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	byKey := map[string]int{}
+	for i, e := range entries {
+		byKey[e.Key] = i
+	}
+	var added []Entry
+	for _, e := range imported {
+		if !blobs[e.SHA256] && !util.FileExists(c.BlobPath(&e)) {
+			return nil, fmt.Errorf("the cache archive is missing %s", e.Name)
+		}
+		if i, ok := byKey[e.Key]; ok {
+			entries[i] = e
+		} else {
+			byKey[e.Key] = len(entries)
+			entries = append(entries, e)
+		}
+		added = append(added, e)
+	}
+	if err := c.writeIndex(entries); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// checkEntry checks an entry read from a cache archive, whose digest and name
+// are used in paths.
+func checkEntry(e *Entry) error {
+	if e.Key == "" {
+		return errors.New("missing key")
+	}
+	if !isDigest(e.SHA256) {
+		return fmt.Errorf("%s has an invalid digest %q", e.Key, e.SHA256)
+	}
+	if !filepath.IsLocal(e.Name) {
+		return fmt.Errorf("%s has an invalid name %q", e.Key, e.Name)
+	}
+	return nil
+}
+
+func isDigest(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == sha256.Size && hex.EncodeToString(b) == s
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	src := New(t.TempDir())
+	dir := t.TempDir()
+	image, err := src.Add(Entry{Key: "https://example.com/image.qcow2", Kind: KindImage}, writeFile(t, dir, "image.qcow2", "image"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.Add(Entry{Key: PxeBootStackKey, Kind: KindContainer}, writeFile(t, dir, "pxeboot_stack.tar", "stack")); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	if err := src.Export(&archive); err != nil {
+		t.Fatalf("Export() failed: %v", err)
+	}
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(archive.Bytes())
+	gz.Close()
+
+	for name, data := range map[string][]byte{"plain": archive.Bytes(), "gzip": compressed.Bytes()} {
+		t.Run(name, func(t *testing.T) {
+			dst := New(t.TempDir())
+			imported, err := dst.Import(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Import() failed: %v", err)
+			}
+			if len(imported) != 2 {
+				t.Errorf("expected 2 imported entries, got %+v", imported)
+			}
+			e, err := dst.Lookup(image.Key)
+			if err != nil || e == nil || *e != *image {
+				t.Fatalf("expected %+v, got %+v, %v", image, e, err)
+			}
+			if content, err := os.ReadFile(dst.BlobPath(e)); err != nil || string(content) != "image" {
+				t.Errorf("unexpected content %q, %v", content, err)
+			}
+		})
+	}
+}
+
+func TestImport_Invalid(t *testing.T) {
+	digest := strings.Repeat("ab", 32)
+	imageDigest := fmt.Sprintf("%x", sha256.Sum256([]byte("image")))
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"corrupted blob", map[string]string{"blobs/sha256/" + digest: "image"}},
+		{"unexpected file", map[string]string{"../index.json": "[]"}},
+		{"missing blob", map[string]string{indexFile: `[{"key": "k", "kind": "image", "name": "image.qcow2", "sha256": "` + digest + `"}]`}},
+		// The lock file of the cache exists, but is not a blob.
+		{"invalid digest", map[string]string{indexFile: `[{"key": "k", "kind": "image", "name": "image.qcow2", "sha256": "../../.lock"}]`}},
+		{"invalid name", map[string]string{
+			indexFile:                     `[{"key": "k", "kind": "container", "name": "../pxeboot_stack.tar", "sha256": "` + imageDigest + `"}]`,
+			"blobs/sha256/" + imageDigest: "image",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var archive bytes.Buffer
+			tw := tar.NewWriter(&archive)
+			for name, content := range tt.files {
+				tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+				tw.Write([]byte(content))
+			}
+			tw.Close()
+
+			c := New(t.TempDir())
+			if _, err := c.Import(&archive); err == nil {
+				t.Error("expected an error")
+			}
+			if entries, err := c.List(); err != nil || len(entries) != 0 {
+				t.Errorf("expected an empty cache, got %+v, %v", entries, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,348 @@
+// Package cache implements the content-addressed cache of the artifacts
+// pvmlab downloads or builds, so that they can be reused offline.
+//
+// The cache stores each artifact once under its SHA-256 digest in
+// blobs/sha256/<digest>, and index.json maps the key of each artifact, such
+// as the URL it was downloaded from, to its digest.
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"pvmlab/internal/config"
+	"pvmlab/internal/downloader"
+	"pvmlab/internal/util"
+)
+
+// Kinds of artifacts.
+const (
+	// KindImage is a downloaded disk image, keyed by its URL.
+	KindImage = "image"
+	// KindRootfs is a rootfs tarball created from an image, keyed by
+	// RootfsKey.
+	KindRootfs = "rootfs"
+	// KindContainer is a docker image tarball.
+	KindContainer = "container"
+)
+
+// PxeBootStackKey is the key of the pxeboot stack docker image tarball.
+const PxeBootStackKey = "pxeboot_stack"
+
+const (
+	indexFile = "index.json"
+	// lockFile is locked while the index or the blobs are changed.
+	lockFile = ".lock"
+)
+
+// Entry is an artifact in the cache.
+type Entry struct {
+	Key  string `json:"key"`
+	Kind string `json:"kind"`
+	// Name is the file name of the artifact.
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	// From is the digest of the image a rootfs tarball was created from.
+	From    string    `json:"from,omitempty"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// Cache is a content-addressed cache in a directory.
+type Cache struct {
+	dir string
+}
+
+// New returns the cache in dir.
+func New(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+// Open returns the cache shared by all the labs, in ~/.pvmlab/cache.
+func Open(cfg *config.Config) *Cache {
+	return New(filepath.Join(cfg.GetSharedDir(), "cache"))
+}
+
+// RootfsKey returns the key of the rootfs tarball created by the extractor
+// of the distro family distroName from the image with the given digest.
+func RootfsKey(distroName, imageDigest string) string {
+	return fmt.Sprintf("rootfs:%s:%s", distroName, imageDigest)
+}
+
+func (c *Cache) blobsDir() string {
+	return filepath.Join(c.dir, "blobs", "sha256")
+}
+
+// BlobPath returns the path of the artifact of e in the cache.
+func (c *Cache) BlobPath(e *Entry) string {
+	return filepath.Join(c.blobsDir(), e.SHA256)
+}
+
+// List returns the entries of the cache, sorted by key.
+func (c *Cache) List() ([]Entry, error) {
+	data, err := os.ReadFile(filepath.Join(c.dir, indexFile))
+	if os.IsNotExist(err) {
+		return []Entry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the cache index: %w", err)
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse the cache index: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, nil
+}
+
+// lock takes an exclusive lock on the cache, creating its directory if
+// needed, so that concurrent pvmlab commands don't lose each other's entries
+// nor remove each other's blobs. The returned function releases the lock.
+func (c *Cache) lock() (func(), error) {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create the cache directory: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(c.dir, lockFile), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the cache lock: %w", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock the cache: %w", err)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// writeIndex replaces the index of the cache. The caller must hold the cache
+// lock.
+func (c *Cache) writeIndex(entries []Entry) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create the cache directory: %w", err)
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(c.dir, indexFile+".tmp")
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write the cache index: %w", err)
+	}
+	return os.Rename(tmp, filepath.Join(c.dir, indexFile))
+}
+
+// Lookup returns the entry of key, or nil if the cache doesn't have it.
+func (c *Cache) Lookup(key string) (*Entry, error) {
+	entries, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.Key == key && util.FileExists(c.BlobPath(&e)) {
+			return &e, nil
+		}
+	}
+	return nil, nil
+}
+
+// Contains returns whether path is the artifact of e in the cache, as placed
+// by Place or added by Add.
+func (c *Cache) Contains(e *Entry, path string) bool {
+	blob, err := os.Stat(c.BlobPath(e))
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && os.SameFile(blob, info)
+}
+
+// Add adds the file at path to the cache as e, replacing the previous entry
+// of e.Key. The file is hard linked into the cache when possible: it must
+// not be written to afterwards, only removed. The blob of the previous entry
+// is kept until Prune, since VM disks may be backed on it.
+func (c *Cache) Add(e Entry, path string) (*Entry, error) {
+	digest, err := downloader.FileSHA256(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	e.SHA256, e.Size, e.AddedAt = digest, info.Size(), time.Now().UTC()
+	if e.Name == "" {
+		e.Name = filepath.Base(path)
+	}
+
+	unlock, err := c.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := os.MkdirAll(c.blobsDir(), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create the cache directory: %w", err)
+	}
+	blob := c.BlobPath(&e)
+	if !util.FileExists(blob) {
+		if err := os.Link(path, blob); err != nil {
+			tmp := blob + ".tmp"
+			if err := util.CopyFile(path, tmp, 0444); err != nil {
+				os.Remove(tmp)
+				return nil, fmt.Errorf("failed to copy %s to the cache: %w", path, err)
+			}
+			if err := os.Rename(tmp, blob); err != nil {
+				return nil, err
+			}
+		}
+		// Writing to a cached artifact would corrupt it.
+		if err := os.Chmod(blob, 0444); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	var kept []Entry
+	for _, old := range entries {
+		if old.Key != e.Key {
+			kept = append(kept, old)
+		}
+	}
+	if err := c.writeIndex(append(kept, e)); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// BaseImage returns the entry of the image at imagePath, downloaded from key,
+// adding it to the cache if needed. VM disks are backed on the blob of the
+// entry rather than on imagePath, which is replaced when the image is updated
+// upstream.
+func (c *Cache) BaseImage(key, imagePath string) (*Entry, error) {
+	entry, err := c.Lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil && c.Contains(entry, imagePath) {
+		return entry, nil
+	}
+	return c.Add(Entry{Key: key, Kind: KindImage}, imagePath)
+}
+
+// Place makes the artifact of e available at dest, as a hard link to the
+// cache when possible, or a copy.
+func (c *Cache) Place(e *Entry, dest string) error {
+	if c.Contains(e, dest) {
+		return nil
+	}
+	if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", dest, err)
+	}
+	if err := os.Link(c.BlobPath(e), dest); err == nil {
+		return nil
+	}
+	if err := util.CopyFile(c.BlobPath(e), dest, 0644); err != nil {
+		os.Remove(dest)
+		return fmt.Errorf("failed to copy %s from the cache: %w", e.Name, err)
+	}
+	return nil
+}
+
+// Prune removes the entries for which keep returns false, and returns them,
+// and the blobs no entry references anymore. The entries and blobs whose
+// digest is in inUse, such as the base images of VM disks, are kept.
+func (c *Cache) Prune(keep func(Entry) bool, inUse map[string]bool) ([]Entry, error) {
+	unlock, err := c.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	entries, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	var kept, removed []Entry
+	for _, e := range entries {
+		if keep(e) || inUse[e.SHA256] {
+			kept = append(kept, e)
+		} else {
+			removed = append(removed, e)
+		}
+	}
+	if len(removed) > 0 {
+		if err := c.writeIndex(kept); err != nil {
+			return nil, err
+		}
+	}
+	return removed, c.removeOrphans(kept, inUse)
+}
+
+// removeOrphans removes the blobs that neither an entry references nor are
+// in inUse, and the leftovers of interrupted copies. The caller must hold the
+// cache lock.
+func (c *Cache) removeOrphans(entries []Entry, inUse map[string]bool) error {
+	used := map[string]bool{}
+	for digest := range inUse {
+		used[digest] = true
+	}
+	for _, e := range entries {
+		used[e.SHA256] = true
+	}
+	files, err := os.ReadDir(c.blobsDir())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if !used[file.Name()] {
+			if err := os.Remove(filepath.Join(c.blobsDir(), file.Name())); err != nil {
+				return fmt.Errorf("failed to remove %s from the cache: %w", file.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// copyBlob writes the content of r to a new blob and checks its digest. The
+// caller must hold the cache lock.
+func (c *Cache) copyBlob(r io.Reader, digest string) error {
+	if err := os.MkdirAll(c.blobsDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create the cache directory: %w", err)
+	}
+	blob := filepath.Join(c.blobsDir(), digest)
+	tmp := blob + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0444)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	got, err := downloader.FileSHA256(tmp)
+	if err != nil {
+		return err
+	}
+	if got != digest {
+		return fmt.Errorf("checksum mismatch for blob %s: got %s", digest, got)
+	}
+	return os.Rename(tmp, blob)
+}
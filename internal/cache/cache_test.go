@@ -0,0 +1,215 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// writeFile writes a file with the given content in dir and returns its path.
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAddLookupPlace(t *testing.T) {
+	c := New(t.TempDir())
+	dir := t.TempDir()
+
+	if e, err := c.Lookup("https://example.com/image.qcow2"); err != nil || e != nil {
+		t.Fatalf("expected no entry in an empty cache, got %+v, %v", e, err)
+	}
+
+	path := writeFile(t, dir, "image.qcow2", "image v1")
+	e, err := c.Add(Entry{Key: "https://example.com/image.qcow2", Kind: KindImage}, path)
+	if err != nil {
+		t.Fatalf("Add() failed: %v", err)
+	}
+	if e.Name != "image.qcow2" || e.Size != int64(len("image v1")) || len(e.SHA256) != 64 {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if !c.Contains(e, path) {
+		t.Error("expected the added file to be linked to the cache")
+	}
+	if info, err := os.Stat(c.BlobPath(e)); err != nil || info.Mode().Perm()&0222 != 0 {
+		t.Errorf("expected a read-only blob, got %v, %v", info.Mode(), err)
+	}
+
+	got, err := c.Lookup("https://example.com/image.qcow2")
+	if err != nil || got == nil || *got != *e {
+		t.Fatalf("expected %+v, got %+v, %v", e, got, err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "image.qcow2")
+	writeFile(t, filepath.Dir(dest), "image.qcow2", "stale")
+	if err := c.Place(e, dest); err != nil {
+		t.Fatalf("Place() failed: %v", err)
+	}
+	if content, err := os.ReadFile(dest); err != nil || string(content) != "image v1" {
+		t.Errorf("expected the cached content, got %q, %v", content, err)
+	}
+
+	// A new version of the image replaces the previous one.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	path = writeFile(t, dir, "image.qcow2", "image v2")
+	e2, err := c.Add(Entry{Key: "https://example.com/image.qcow2", Kind: KindImage}, path)
+	if err != nil {
+		t.Fatalf("Add() failed: %v", err)
+	}
+	entries, err := c.List()
+	if err != nil || len(entries) != 1 || entries[0].SHA256 != e2.SHA256 {
+		t.Errorf("expected only the new version, got %+v, %v", entries, err)
+	}
+	if _, err := os.Stat(c.BlobPath(e)); err != nil {
+		t.Errorf("expected the blob of the previous version to be kept until Prune: %v", err)
+	}
+	if content, err := os.ReadFile(dest); err != nil || string(content) != "image v1" {
+		t.Errorf("expected the placed copy to be kept, got %q, %v", content, err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	c := New(t.TempDir())
+	dir := t.TempDir()
+	image, err := c.Add(Entry{Key: "https://example.com/image.qcow2", Kind: KindImage}, writeFile(t, dir, "image.qcow2", "image"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Add(Entry{Key: RootfsKey("ubuntu", image.SHA256), Kind: KindRootfs, From: image.SHA256}, writeFile(t, dir, "rootfs.tar.gz", "rootfs")); err != nil {
+		t.Fatal(err)
+	}
+	// Same content under another key.
+	if _, err := c.Add(Entry{Key: "https://mirror.example.com/image.qcow2", Kind: KindImage}, writeFile(t, dir, "mirror.qcow2", "image")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(c.blobsDir(), "leftover.tmp"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := c.Prune(func(e Entry) bool { return e.Key != "https://example.com/image.qcow2" }, nil)
+	if err != nil {
+		t.Fatalf("Prune() failed: %v", err)
+	}
+	if len(removed) != 1 || removed[0].Key != "https://example.com/image.qcow2" {
+		t.Errorf("unexpected removed entries %+v", removed)
+	}
+	if _, err := os.Stat(c.BlobPath(image)); err != nil {
+		t.Errorf("expected the blob still used by the mirror entry to be kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(c.blobsDir(), "leftover.tmp")); !os.IsNotExist(err) {
+		t.Errorf("expected the leftover to be removed, got %v", err)
+	}
+
+	// A superseded image that a VM disk is backed on is kept, without its
+	// entry.
+	old, err := c.Add(Entry{Key: "https://example.com/other.qcow2", Kind: KindImage}, writeFile(t, dir, "other.qcow2", "other v1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Add(Entry{Key: "https://example.com/other.qcow2", Kind: KindImage}, writeFile(t, dir, "other.qcow2.new", "other v2")); err != nil {
+		t.Fatal(err)
+	}
+	inUse := map[string]bool{old.SHA256: true, image.SHA256: true}
+	if removed, err = c.Prune(func(Entry) bool { return false }, inUse); err != nil || len(removed) != 2 {
+		t.Fatalf("expected 2 removed entries, got %+v, %v", removed, err)
+	}
+	entries, err := c.List()
+	if err != nil || len(entries) != 1 || entries[0].Key != "https://mirror.example.com/image.qcow2" {
+		t.Errorf("expected the entry of the image in use to be kept, got %+v, %v", entries, err)
+	}
+	for _, e := range []*Entry{old, image} {
+		if _, err := os.Stat(c.BlobPath(e)); err != nil {
+			t.Errorf("expected the blob in use %s to be kept: %v", e.Name, err)
+		}
+	}
+
+	if removed, err = c.Prune(func(Entry) bool { return false }, nil); err != nil || len(removed) != 1 {
+		t.Fatalf("expected 1 removed entry, got %+v, %v", removed, err)
+	}
+	if files, err := os.ReadDir(c.blobsDir()); err != nil || len(files) != 0 {
+		t.Errorf("expected no blobs, got %v, %v", files, err)
+	}
+}
+
+func TestBaseImage(t *testing.T) {
+	c := New(t.TempDir())
+	dir := t.TempDir()
+	const key = "https://example.com/image.qcow2"
+
+	path := writeFile(t, dir, "image.qcow2", "image v1")
+	e, err := c.BaseImage(key, path)
+	if err != nil {
+		t.Fatalf("BaseImage() failed: %v", err)
+	}
+	if !c.Contains(e, path) {
+		t.Error("expected the image to be added to the cache")
+	}
+	if got, err := c.BaseImage(key, path); err != nil || *got != *e {
+		t.Errorf("expected the cached entry %+v, got %+v, %v", e, got, err)
+	}
+
+	// The image is replaced by a new version, which doesn't change the blob
+	// of the previous one.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dir, "image.qcow2", "image v2")
+	e2, err := c.BaseImage(key, path)
+	if err != nil {
+		t.Fatalf("BaseImage() failed: %v", err)
+	}
+	if e2.SHA256 == e.SHA256 || !c.Contains(e2, path) {
+		t.Errorf("expected the new version to be added, got %+v", e2)
+	}
+	if content, err := os.ReadFile(c.BlobPath(e)); err != nil || string(content) != "image v1" {
+		t.Errorf("expected the blob of the previous version to be unchanged, got %q, %v", content, err)
+	}
+
+	if _, err := c.BaseImage(key, filepath.Join(dir, "missing.qcow2")); err == nil {
+		t.Error("expected an error for a missing image")
+	}
+}
+
+func TestAdd_Concurrent(t *testing.T) {
+	c := New(t.TempDir())
+	dir := t.TempDir()
+
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := range n {
+		path := writeFile(t, dir, fmt.Sprintf("image%d.qcow2", i), fmt.Sprintf("image %d", i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Add(Entry{Key: fmt.Sprintf("https://example.com/image%d.qcow2", i), Kind: KindImage}, path)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Add() failed: %v", err)
+		}
+	}
+
+	// No entry is lost, and no blob is removed as an orphan.
+	entries, err := c.List()
+	if err != nil || len(entries) != n {
+		t.Fatalf("expected %d entries, got %d, %v", n, len(entries), err)
+	}
+	for _, e := range entries {
+		if _, err := os.Stat(c.BlobPath(&e)); err != nil {
+			t.Errorf("expected the blob of %s: %v", e.Key, err)
+		}
+	}
+}
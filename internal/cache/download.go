@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+
+	"pvmlab/internal/downloader"
+
+	"github.com/fatih/color"
+)
+
+// Download downloads an image like downloader.DownloadVerifiedImage, through
+// the cache. The cached image is used if it is still the one upstream, by
+// checksum or else by size, or if that can't be checked, e.g. offline.
+// Downloaded images are added to the cache.
+func (c *Cache) Download(ctx context.Context, imagePath, imageUrl string, v downloader.Verification) error {
+	entry, err := c.Lookup(imageUrl)
+	if err != nil {
+		return err
+	}
+	if entry != nil {
+		current, err := c.current(ctx, entry, v)
+		switch {
+		case err != nil:
+			color.Yellow("! Could not check for updates of %s (%v), using the cached image.", entry.Name, err)
+			return c.Place(entry, imagePath)
+		case current:
+			color.Cyan("i Using the cached image %s.", entry.Name)
+			return c.Place(entry, imagePath)
+		}
+		// Downloads write to the image in place, which must not be the
+		// cached one.
+		if c.Contains(entry, imagePath) {
+			if err := os.Remove(imagePath); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := downloader.DownloadVerifiedImage(ctx, imagePath, imageUrl, v); err != nil {
+		return err
+	}
+	if _, err := c.Add(Entry{Key: imageUrl, Kind: KindImage}, imagePath); err != nil {
+		color.Yellow("! Failed to add %s to the cache: %v", filepath.Base(imagePath), err)
+	}
+	return nil
+}
+
+// current returns whether the cached image of entry is still the one
+// upstream.
+func (c *Cache) current(ctx context.Context, entry *Entry, v downloader.Verification) (bool, error) {
+	expected, err := v.ExpectedSHA256(ctx, path.Base(entry.Key))
+	if err != nil {
+		return false, err
+	}
+	if expected != "" {
+		return expected == entry.SHA256, nil
+	}
+	size, err := downloader.RemoteSize(ctx, entry.Key)
+	if err != nil {
+		return false, err
+	}
+	return size < 0 || size == entry.Size, nil
+}
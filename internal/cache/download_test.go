@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pvmlab/internal/downloader"
+)
+
+func TestDownload(t *testing.T) {
+	image := "image v1"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "image.qcow2", time.Time{}, strings.NewReader(image))
+	}))
+	url := server.URL + "/image.qcow2"
+	c := New(t.TempDir())
+	imagePath := filepath.Join(t.TempDir(), "image.qcow2")
+
+	if err := c.Download(context.Background(), imagePath, url, downloader.Verification{}); err != nil {
+		t.Fatalf("Download() failed: %v", err)
+	}
+	e, err := c.Lookup(url)
+	if err != nil || e == nil || !c.Contains(e, imagePath) {
+		t.Fatalf("expected the image to be cached, got %+v, %v", e, err)
+	}
+
+	// The image was updated upstream: the cached one isn't written to.
+	image = "image v2, bigger"
+	if err := c.Download(context.Background(), imagePath, url, downloader.Verification{}); err != nil {
+		t.Fatalf("Download() failed: %v", err)
+	}
+	if content, err := os.ReadFile(imagePath); err != nil || string(content) != image {
+		t.Errorf("expected the updated image, got %q, %v", content, err)
+	}
+	if e, err = c.Lookup(url); err != nil || e == nil || e.Size != int64(len(image)) {
+		t.Fatalf("expected the updated image to be cached, got %+v, %v", e, err)
+	}
+
+	// Offline, the cached image is used.
+	server.Close()
+	otherPath := filepath.Join(t.TempDir(), "image.qcow2")
+	if err := c.Download(context.Background(), otherPath, url, downloader.Verification{}); err != nil {
+		t.Fatalf("Download() failed offline: %v", err)
+	}
+	if content, err := os.ReadFile(otherPath); err != nil || string(content) != image {
+		t.Errorf("expected the cached image, got %q, %v", content, err)
+	}
+
+	// A pinned checksum that the cached image doesn't match requires the
+	// network, retried until the context expires.
+	sum := sha256.Sum256([]byte("image v3"))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := c.Download(ctx, otherPath, url, downloader.Verification{SHA256: hex.EncodeToString(sum[:])}); err == nil {
+		t.Error("expected an error offline for an image that isn't cached")
+	}
+}
@@ -7,9 +7,9 @@ import (
 	"fmt"
 	"net"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"pvmlab/internal/config"
+	"pvmlab/internal/iso9660"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -323,7 +323,39 @@ func buildTargetNetworkConfig(mac string) *NetplanConfig {
 	return cfg
 }
 
-var execCommand = exec.Command
+// DHCPRange returns the first and last addresses of the dynamic range the
+// provisioner's DHCP server leases in an IPv4 subnet: .100 to .200 of its
+// first /24.
+func DHCPRange(subnet *net.IPNet) (string, string) {
+	networkIP := subnet.IP.To4()
+	start := fmt.Sprintf("%d.%d.%d.100", networkIP[0], networkIP[1], networkIP[2])
+	end := fmt.Sprintf("%d.%d.%d.200", networkIP[0], networkIP[1], networkIP[2])
+	return start, end
+}
+
+// DHCPRangeV6 returns the dynamic range the provisioner's DHCPv6 server
+// leases, as interface identifiers combined with the prefix of its subnet:
+// ::64 to ::c8.
+func DHCPRangeV6() (string, string) {
+	startIP := net.ParseIP("::").To16()
+	startIP[len(startIP)-1] = 100 // ::64 in hex
+	endIP := net.ParseIP("::").To16()
+	endIP[len(endIP)-1] = 200 // ::c8 in hex
+	return startIP.String(), endIP.String()
+}
+
+// LoadMetaData reads the meta-data generated by CreateISO for a VM.
+var LoadMetaData = func(appDir, vmName string) (*MetaData, error) {
+	data, err := os.ReadFile(filepath.Join(appDir, "configs", "cloud-init", vmName, "meta-data"))
+	if err != nil {
+		return nil, err
+	}
+	var metaData MetaData
+	if err := yaml.Unmarshal(data, &metaData); err != nil {
+		return nil, fmt.Errorf("failed to parse meta-data of %s: %w", vmName, err)
+	}
+	return &metaData, nil
+}
 
 var CreateISO = func(ctx context.Context, vmName, role, appDir, isoPath, ip, ipv6, mac, tar, image string) error {
 	sshKeyPath := filepath.Join(appDir, "ssh", "vm_rsa.pub")
@@ -362,12 +394,7 @@ var CreateISO = func(ctx context.Context, vmName, role, appDir, isoPath, ip, ipv
 			provisionerIpV6 = parsedIPV6.String()
 			subnetV6 = ipv6
 
-			startIP := net.ParseIP("::").To16()
-			startIP[len(startIP)-1] = 100 // ::64 in hex
-			endIP := net.ParseIP("::").To16()
-			endIP[len(endIP)-1] = 200 // ::c8 in hex
-			dhcpV6Start = startIP.String()
-			dhcpV6End = endIP.String()
+			dhcpV6Start, dhcpV6End = DHCPRangeV6()
 		}
 
 		ip4 := parsedIP.To4()
@@ -375,9 +402,7 @@ var CreateISO = func(ctx context.Context, vmName, role, appDir, isoPath, ip, ipv
 			return fmt.Errorf("only IPv4 is supported")
 		}
 		prefixLen, _ := ipNet.Mask.Size()
-		networkIP := ipNet.IP.To4()
-		dhcpStart := fmt.Sprintf("%d.%d.%d.100", networkIP[0], networkIP[1], networkIP[2])
-		dhcpEnd := fmt.Sprintf("%d.%d.%d.200", networkIP[0], networkIP[1], networkIP[2])
+		dhcpStart, dhcpEnd := DHCPRange(ipNet)
 
 		metaData := buildProvisionerMetaData(
 			sshKey, tar, image, parsedIP.String(), dhcpStart, dhcpEnd,
@@ -418,9 +443,21 @@ var CreateISO = func(ctx context.Context, vmName, role, appDir, isoPath, ip, ipv
 		if err != nil {
 			return fmt.Errorf("failed to marshal user-data: %w", err)
 		}
+		// Merge the user-data and vendor-data supplied with 'vm create'.
+		vmsDir := filepath.Join(appDir, "vms")
+		if userDataBytes, err = mergeStored(UserDataPath(vmsDir, vmName), userDataBytes); err != nil {
+			return err
+		}
 		// Prepend the jinja template directive
 		userDataBytes = append([]byte("## template: jinja\n#cloud-config\n"), userDataBytes...)
 
+		if vendorDataBytes, err = mergeStored(VendorDataPath(vmsDir, vmName), nil); err != nil {
+			return err
+		}
+		if len(vendorDataBytes) > 0 {
+			vendorDataBytes = append([]byte("#cloud-config\n"), vendorDataBytes...)
+		}
+
 		networkConfig := buildTargetNetworkConfig(mac)
 		networkConfigBytes, err = marshal(networkConfig)
 		if err != nil {
@@ -441,6 +478,6 @@ var CreateISO = func(ctx context.Context, vmName, role, appDir, isoPath, ip, ipv
 		return err
 	}
 
-	cmd := execCommand("mkisofs", "-o", isoPath, "-V", "cidata", "-r", "-J", configDir)
-	return cmd.Run()
+	// The NoCloud datasource looks for a volume labelled cidata.
+	return iso9660.WriteDir(isoPath, "cidata", configDir)
 }
@@ -1,9 +1,9 @@
 package cloudinit
 
 import (
+	"bytes"
 	"context"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -65,22 +65,25 @@ func TestCreateISO(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			// Mock execCommand to avoid actual execution of mkisofs
-			execCommand = func(command string, args ...string) *exec.Cmd {
-				assert.Equal(t, "mkisofs", command)
-				cmd := exec.Command("true") // Use a command that exists and does nothing
-				return cmd
-			}
 			isoPath := filepath.Join(appDir, tc.vmName+".iso")
 			err := CreateISO(context.Background(), tc.vmName, tc.role, appDir, isoPath, tc.ip, tc.ipv6, tc.mac, tc.tar, tc.image)
 			assert.NoError(t, err)
 
 			configDir := filepath.Join(appDir, "configs", "cloud-init", tc.vmName)
+			validateISO(t, isoPath, configDir)
 
 			// Validate that the generated files are valid YAML
 			validateYamlFile(t, filepath.Join(configDir, "meta-data"), false)
 			validateYamlFile(t, filepath.Join(configDir, "user-data"), true)
 			validateYamlFile(t, filepath.Join(configDir, "network-config"), false)
+
+			if tc.role == "provisioner" {
+				metaData, err := LoadMetaData(appDir, tc.vmName)
+				if assert.NoError(t, err) {
+					assert.Equal(t, "192.168.1.100", metaData.DhcpRangeStart)
+					assert.Equal(t, "192.168.1.200", metaData.DhcpRangeEnd)
+				}
+			}
 		})
 	}
 }
@@ -125,12 +128,6 @@ func TestCreateISOWithGoldenFiles(t *testing.T) {
 	}
 
 	t.Run(tc.name, func(t *testing.T) {
-		// Mock execCommand to avoid actual execution of mkisofs
-		execCommand = func(command string, args ...string) *exec.Cmd {
-			assert.Equal(t, "mkisofs", command)
-			cmd := exec.Command("true") // Use a command that exists and does nothing
-			return cmd
-		}
 		isoPath := filepath.Join(appDir, tc.vmName+".iso")
 		err := CreateISO(context.Background(), tc.vmName, tc.role, appDir, isoPath, tc.ip, tc.ipv6, tc.mac, tc.tar, tc.image)
 		assert.NoError(t, err)
@@ -225,4 +222,24 @@ func validateYamlFile(t *testing.T, path string, hasHeader bool) {
 	err = yaml.Unmarshal(yamlBytes, &obj)
 	assert.NoError(t, err, "%s should be valid YAML", path)
 	assert.NotNil(t, obj, "%s should not be empty", path)
-}
\ No newline at end of file
+}
+
+// validateISO checks that the NoCloud ISO is labelled cidata and holds the
+// files of the cloud-init config directory.
+func validateISO(t *testing.T, isoPath, configDir string) {
+	t.Helper()
+	image, err := os.ReadFile(isoPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	// The volume identifier of the primary volume descriptor, at sector 16.
+	pvd := image[16*2048:]
+	assert.Equal(t, "CD001", string(pvd[1:6]))
+	assert.Equal(t, "cidata", strings.TrimSpace(string(pvd[40:72])))
+	for _, name := range []string{"meta-data", "user-data", "network-config", "vendor-data"} {
+		data, err := os.ReadFile(filepath.Join(configDir, name))
+		if assert.NoError(t, err) && len(data) > 0 {
+			assert.True(t, bytes.Contains(image, data), "the ISO should contain %s", name)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package cloudinit
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UserDataPath returns the path of the user-data supplied for a target VM
+// with 'vm create --user-data'. It is stored in the vms directory, so that
+// the boot handler of the provisioner can serve it to PXE installs too.
+func UserDataPath(vmsDir, vmName string) string {
+	return filepath.Join(vmsDir, vmName+"-user-data.yaml")
+}
+
+// VendorDataPath returns the path of the vendor-data supplied for a target
+// VM with 'vm create --vendor-data', see UserDataPath.
+func VendorDataPath(vmsDir, vmName string) string {
+	return filepath.Join(vmsDir, vmName+"-vendor-data.yaml")
+}
+
+// ValidateCloudConfig checks that data is a #cloud-config document that can
+// be merged with the generated configuration, i.e. a YAML mapping. Empty
+// documents are valid.
+func ValidateCloudConfig(data []byte) error {
+	_, err := parseCloudConfig(data)
+	return err
+}
+
+// StoreUserData saves the user-data and vendor-data supplied for a VM after
+// validating them. Empty ones remove the files left by a previous VM of the
+// same name, which would otherwise be merged into its configuration.
+func StoreUserData(vmsDir, vmName string, userData, vendorData []byte) error {
+	files := []struct {
+		kind, path string
+		data       []byte
+	}{
+		{"user-data", UserDataPath(vmsDir, vmName), userData},
+		{"vendor-data", VendorDataPath(vmsDir, vmName), vendorData},
+	}
+	for _, f := range files {
+		if len(f.data) == 0 {
+			if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove the previous %s: %w", f.kind, err)
+			}
+			continue
+		}
+		if err := ValidateCloudConfig(f.data); err != nil {
+			return fmt.Errorf("invalid %s: %w", f.kind, err)
+		}
+		if err := os.MkdirAll(vmsDir, 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(f.path, f.data, 0644); err != nil {
+			return fmt.Errorf("failed to save %s: %w", f.kind, err)
+		}
+	}
+	return nil
+}
+
+// MergeCloudConfig deep-merges the override #cloud-config document into the
+// base one: mappings are merged key by key, lists are appended to (so that
+// users, packages, write_files or runcmd entries are added to the generated
+// ones) and other values are replaced. The formatting of the base document
+// is kept, which matters for its jinja templates.
+func MergeCloudConfig(base, override []byte) ([]byte, error) {
+	overrideNode, err := parseCloudConfig(override)
+	if err != nil {
+		return nil, err
+	}
+	if overrideNode == nil {
+		return base, nil
+	}
+	baseNode, err := parseCloudConfig(base)
+	if err != nil {
+		return nil, fmt.Errorf("invalid generated configuration: %w", err)
+	}
+	if baseNode == nil {
+		baseNode = &yaml.Node{Kind: yaml.MappingNode}
+	}
+	return marshal(mergeNodes(baseNode, overrideNode))
+}
+
+// mergeStored merges the #cloud-config document stored at path, if any, into
+// generated.
+func mergeStored(path string, generated []byte) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return generated, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	merged, err := MergeCloudConfig(generated, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge %s: %w", filepath.Base(path), err)
+	}
+	return merged, nil
+}
+
+// parseCloudConfig returns the top-level mapping of a #cloud-config
+// document, or nil if the document is empty.
+func parseCloudConfig(data []byte) (*yaml.Node, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("not a valid #cloud-config YAML document: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	node := doc.Content[0]
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("not a #cloud-config document: expected a YAML mapping at the top level")
+	}
+	// Drop the #cloud-config header, which is added back to the merged
+	// document.
+	header := []*yaml.Node{&doc, node}
+	if len(node.Content) > 0 {
+		header = append(header, node.Content[0])
+	}
+	for _, n := range header {
+		n.HeadComment = strings.TrimSpace(strings.TrimPrefix(n.HeadComment, "#cloud-config"))
+	}
+	return node, nil
+}
+
+func mergeNodes(base, override *yaml.Node) *yaml.Node {
+	switch {
+	case base.Kind == yaml.MappingNode && override.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(override.Content); i += 2 {
+			key, value := override.Content[i], override.Content[i+1]
+			found := false
+			for j := 0; j+1 < len(base.Content); j += 2 {
+				if base.Content[j].Value == key.Value {
+					base.Content[j+1] = mergeNodes(base.Content[j+1], value)
+					found = true
+					break
+				}
+			}
+			if !found {
+				base.Content = append(base.Content, key, value)
+			}
+		}
+		return base
+	case base.Kind == yaml.SequenceNode && override.Kind == yaml.SequenceNode:
+		base.Content = append(base.Content, override.Content...)
+		return base
+	default:
+		return override
+	}
+}
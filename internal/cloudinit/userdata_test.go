@@ -0,0 +1,139 @@
+package cloudinit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMergeCloudConfig(t *testing.T) {
+	base := []byte("ssh_pwauth: true\nusers:\n  - name: ubuntu\nchpasswd:\n  expire: false\nruncmd:\n  - 'echo base'\n")
+
+	tests := []struct {
+		name        string
+		override    string
+		expected    map[string]any
+		expectedErr string
+	}{
+		{
+			name:     "empty override",
+			override: "#cloud-config\n",
+			expected: map[string]any{
+				"ssh_pwauth": true,
+				"users":      []any{map[string]any{"name": "ubuntu"}},
+				"chpasswd":   map[string]any{"expire": false},
+				"runcmd":     []any{"echo base"},
+			},
+		},
+		{
+			name:     "lists are appended, mappings merged, scalars replaced",
+			override: "#cloud-config\nssh_pwauth: false\nusers:\n  - name: alice\nchpasswd:\n  expire: true\nruncmd:\n  - echo user\npackages:\n  - htop\n",
+			expected: map[string]any{
+				"ssh_pwauth": false,
+				"users":      []any{map[string]any{"name": "ubuntu"}, map[string]any{"name": "alice"}},
+				"chpasswd":   map[string]any{"expire": true},
+				"runcmd":     []any{"echo base", "echo user"},
+				"packages":   []any{"htop"},
+			},
+		},
+		{
+			name:        "not a mapping",
+			override:    "#!/bin/sh\necho hello\n",
+			expectedErr: "expected a YAML mapping",
+		},
+		{
+			name:        "invalid yaml",
+			override:    "users: [",
+			expectedErr: "not a valid #cloud-config YAML document",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := MergeCloudConfig(base, []byte(tt.override))
+			if tt.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+					t.Fatalf("expected error containing '%s', got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MergeCloudConfig() failed: %v", err)
+			}
+			var got map[string]any
+			if err := yaml.Unmarshal(merged, &got); err != nil {
+				t.Fatalf("merged configuration is not valid YAML: %v", err)
+			}
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestCreateISO_UserData(t *testing.T) {
+	appDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(appDir, "ssh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(appDir, "ssh", "vm_rsa.pub"), []byte("ssh-rsa AAAA..."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	vmsDir := filepath.Join(appDir, "vms")
+	userData := []byte("#cloud-config\npackages:\n  - htop\nruncmd:\n  - touch /root/done\n")
+	vendorData := []byte("#cloud-config\ntimezone: Europe/Dublin\n")
+	if err := StoreUserData(vmsDir, "vm1", userData, vendorData); err != nil {
+		t.Fatalf("StoreUserData() failed: %v", err)
+	}
+	if err := StoreUserData(vmsDir, "vm2", []byte("- not a mapping"), nil); err == nil {
+		t.Error("expected an error for invalid user-data")
+	}
+
+	isoPath := filepath.Join(appDir, "vm1.iso")
+	if err := CreateISO(context.Background(), "vm1", "target", appDir, isoPath, "", "", "52:54:00:12:34:56", "", ""); err != nil {
+		t.Fatalf("CreateISO() failed: %v", err)
+	}
+
+	configDir := filepath.Join(appDir, "configs", "cloud-init", "vm1")
+	generated, err := os.ReadFile(filepath.Join(configDir, "user-data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"## template: jinja\n#cloud-config\n",
+		"ssh_authorized_keys: |",
+		"- htop",
+		"- touch /root/done",
+		"- 'systemctl restart systemd-networkd'",
+	} {
+		if !strings.Contains(string(generated), expected) {
+			t.Errorf("expected the user-data to contain %q, got:\n%s", expected, generated)
+		}
+	}
+
+	vendor, err := os.ReadFile(filepath.Join(configDir, "vendor-data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "#cloud-config\ntimezone: Europe/Dublin\n", string(vendor))
+}
+
+func TestStoreUserData_Empty(t *testing.T) {
+	vmsDir := t.TempDir()
+	if err := StoreUserData(vmsDir, "vm1", []byte("#cloud-config\npackages: [htop]\n"), []byte("#cloud-config\ntimezone: UTC\n")); err != nil {
+		t.Fatalf("StoreUserData() failed: %v", err)
+	}
+
+	// A VM recreated without user-data doesn't get the one of the previous VM.
+	if err := StoreUserData(vmsDir, "vm1", nil, nil); err != nil {
+		t.Fatalf("StoreUserData() failed: %v", err)
+	}
+	for _, path := range []string{UserDataPath(vmsDir, "vm1"), VendorDataPath(vmsDir, "vm1")} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %v", path, err)
+		}
+	}
+}
@@ -1,10 +1,13 @@
 package config
 
 import (
+	"bytes"
 	_ "embed"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -29,25 +32,42 @@ type Distro struct {
 	Name string `yaml:"name"`
 	// DistroName is the "family" name of the distribution (e.g., "ubuntu", "fedora").
 	// This is used by the extractor factory to determine which extraction logic to use.
-	DistroName string              `yaml:"distro_name"`
-	Version    string              `yaml:"version"`
-	Arch       map[string]ArchInfo `yaml:"arch"`
+	DistroName string `yaml:"distro_name"`
+	Version    string `yaml:"version,omitempty"`
+	// Mirrors are base URLs serving the same files, e.g. the base URL of
+	// qcow2_url and its mirrors. The downloads of the URLs starting with one
+	// of them fall back to the others.
+	Mirrors []string            `yaml:"mirrors,omitempty"`
+	Arch    map[string]ArchInfo `yaml:"arch"`
 }
 
 // ArchInfo contains architecture-specific information for a distribution.
 type ArchInfo struct {
-	Qcow2URL   string `yaml:"qcow2_url"`
-	KernelPath string `yaml:"kernel_path"`
-	InitrdPath string `yaml:"initrd_path"`
+	// Qcow2URL is the URL of the qcow2 image. The images imported by 'distro
+	// import' have a file:// URL, or none if imported from a rootfs tarball.
+	Qcow2URL string `yaml:"qcow2_url,omitempty"`
+	// SHA256 is the expected SHA-256 checksum of the qcow2 image. SHA256URL
+	// is the URL of a checksum file listing it instead, such as SHA256SUMS.
+	SHA256    string `yaml:"sha256,omitempty"`
+	SHA256URL string `yaml:"sha256_url,omitempty"`
+	// GPGKeyURL is the URL of the GPG key that signs the checksum file of
+	// SHA256URL, either clearsigned or with the detached signature of
+	// SHA256SigURL.
+	GPGKeyURL    string `yaml:"gpg_key_url,omitempty"`
+	SHA256SigURL string `yaml:"sha256_sig_url,omitempty"`
+	// KernelPath and InitrdPath optionally pin the kernel and initrd to boot,
+	// by their path in the image. By default the newest kernel is used.
+	KernelPath string `yaml:"kernel_path,omitempty"`
+	InitrdPath string `yaml:"initrd_path,omitempty"`
 }
 
 // LoadOrCreateDistros loads the distro configurations from the user's app directory.
 // If the config file doesn't exist, it's created from the embedded default.
 func (c *Config) LoadOrCreateDistros() error {
-	distrosPath := filepath.Join(c.GetAppDir(), "distros.yaml")
+	distrosPath := filepath.Join(c.GetSharedDir(), "distros.yaml")
 
 	if _, err := os.Stat(distrosPath); os.IsNotExist(err) {
-		if err := os.MkdirAll(c.GetAppDir(), 0755); err != nil {
+		if err := os.MkdirAll(c.GetSharedDir(), 0755); err != nil {
 			return fmt.Errorf("failed to create app directory: %w", err)
 		}
 		if err := os.WriteFile(distrosPath, defaultDistrosYAML, 0644); err != nil {
@@ -74,6 +94,178 @@ func (c *Config) LoadOrCreateDistros() error {
 	return nil
 }
 
+// IsImported tells whether the architecture was imported by 'distro import'
+// rather than pulled from a URL.
+func (a ArchInfo) IsImported() bool {
+	return a.Qcow2URL == "" || strings.HasPrefix(a.Qcow2URL, "file://")
+}
+
+// RegisterDistro adds an architecture of a distro imported by 'distro
+// import' to distros.yaml, replacing the previous import of that architecture,
+// and reloads the distros. The rest of the file is kept, including its
+// comments but not its blank lines if the distro was already imported.
+func (c *Config) RegisterDistro(name, family, arch string, info ArchInfo) error {
+	data, doc, err := c.readDistrosDoc()
+	if err != nil {
+		return err
+	}
+	list := doc.Content[0]
+
+	var distroNode *yaml.Node
+	for _, node := range list.Content {
+		if nameNode := mappingValue(node, "name"); nameNode != nil && nameNode.Value == name {
+			distroNode = node
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if distroNode == nil {
+		// Append the new distro, leaving the file as is.
+		buf.Write(bytes.TrimRight(data, "\n"))
+		buf.WriteString("\n\n")
+		err = enc.Encode([]Distro{{Name: name, DistroName: family, Arch: map[string]ArchInfo{arch: info}}})
+	} else {
+		var archNode yaml.Node
+		if err := archNode.Encode(info); err != nil {
+			return err
+		}
+		archsNode := mappingValue(distroNode, "arch")
+		if archsNode == nil || archsNode.Kind != yaml.MappingNode {
+			archsNode = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			setMappingValue(distroNode, "arch", archsNode)
+		}
+		archsNode.Style &^= yaml.FlowStyle
+		setMappingValue(archsNode, arch, &archNode)
+		err = enc.Encode(doc)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode distros config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return c.writeDistros(buf.Bytes())
+}
+
+// UnregisterDistro removes an architecture of a distro imported by 'distro
+// import' from distros.yaml, and the distro once it has no architecture left,
+// and reloads the distros. Like with RegisterDistro, the comments of the file
+// are kept but not its blank lines.
+func (c *Config) UnregisterDistro(name, arch string) error {
+	_, doc, err := c.readDistrosDoc()
+	if err != nil {
+		return err
+	}
+	list := doc.Content[0]
+
+	changed := false
+	for i := 0; i < len(list.Content); i++ {
+		node := list.Content[i]
+		if nameNode := mappingValue(node, "name"); nameNode == nil || nameNode.Value != name {
+			continue
+		}
+		archsNode := mappingValue(node, "arch")
+		if archsNode == nil || archsNode.Kind != yaml.MappingNode || !deleteMappingValue(archsNode, arch) {
+			continue
+		}
+		changed = true
+		if len(archsNode.Content) == 0 {
+			list.Content = append(list.Content[:i], list.Content[i+1:]...)
+			i--
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode distros config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return c.writeDistros(buf.Bytes())
+}
+
+// readDistrosDoc returns the content of distros.yaml, or of the default
+// distros if it doesn't exist yet, and its YAML document, whose content is
+// the list of distros.
+func (c *Config) readDistrosDoc() ([]byte, *yaml.Node, error) {
+	data, err := os.ReadFile(filepath.Join(c.GetSharedDir(), "distros.yaml"))
+	if os.IsNotExist(err) {
+		data = defaultDistrosYAML
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("failed to read distros config: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse distros config: %w", err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.SequenceNode, Tag: "!!seq"}}}
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.SequenceNode {
+		return nil, nil, fmt.Errorf("failed to parse distros config: not a list of distros")
+	}
+	return data, &doc, nil
+}
+
+// writeDistros atomically replaces distros.yaml with data and reloads the
+// distros.
+func (c *Config) writeDistros(data []byte) error {
+	distrosPath := filepath.Join(c.GetSharedDir(), "distros.yaml")
+	tmp := distrosPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write distros config: %w", err)
+	}
+	if err := os.Rename(tmp, distrosPath); err != nil {
+		return fmt.Errorf("failed to write distros config: %w", err)
+	}
+	return c.LoadOrCreateDistros()
+}
+
+// mappingValue returns the value of key in a YAML mapping, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue sets the value of key in a YAML mapping.
+func setMappingValue(node *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = value
+			return
+		}
+	}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+// deleteMappingValue removes key from a YAML mapping, and reports whether it
+// was there.
+func deleteMappingValue(node *yaml.Node, key string) bool {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return true
+		}
+	}
+	return false
+}
+
 // GetDistro returns the configuration for a specific distro and architecture.
 var GetDistro = func(distroName, arch string) (*ArchInfo, error) {
 	distro, ok := Distros[distroName]
@@ -87,6 +279,35 @@ var GetDistro = func(distroName, arch string) (*ArchInfo, error) {
 	return &archInfo, nil
 }
 
+// MirrorURLs returns the URLs of url on the mirrors of the distros, in the
+// order of their mirrors.
+func MirrorURLs(url string) []string {
+	names := make([]string, 0, len(Distros))
+	for name := range Distros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var urls []string
+	seen := map[string]bool{url: true}
+	for _, name := range names {
+		mirrors := Distros[name].Mirrors
+		for _, base := range mirrors {
+			path, ok := strings.CutPrefix(url, base)
+			if !ok {
+				continue
+			}
+			for _, mirror := range mirrors {
+				if !seen[mirror+path] {
+					seen[mirror+path] = true
+					urls = append(urls, mirror+path)
+				}
+			}
+		}
+	}
+	return urls
+}
+
 // GetProvisionerImageURL returns the URL for the provisioner image based on the
 // application version and architecture.
 func GetProvisionerImageURL(arch string) (string, string) {
@@ -130,6 +351,7 @@ func GetPxeBootStackImageName() (string, string) {
 // Config holds the application's configuration.
 type Config struct {
 	homeDir string
+	lab     string
 }
 
 // New creates a new Config instance.
@@ -154,11 +376,23 @@ var New = func() (*Config, error) {
 		return nil, fmt.Errorf("failed to load distro configurations: %w", err)
 	}
 
+	if cfg.lab, err = cfg.resolveLab(); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
 
-// GetAppDir returns the path to the application's hidden directory.
+// GetAppDir returns the directory of the selected lab, holding its VMs and
+// their runtime state. See GetLabDir.
 func (c *Config) GetAppDir() string {
+	return c.GetLabDir(c.lab)
+}
+
+// GetSharedDir returns the path to the application's hidden directory, which
+// holds the data shared by all labs: the images, the docker images and the
+// distro configurations.
+func (c *Config) GetSharedDir() string {
 	return filepath.Join(c.homeDir, "."+AppName)
 }
 
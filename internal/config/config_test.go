@@ -3,6 +3,8 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -144,3 +146,103 @@ func TestNew(t *testing.T) {
 		t.Errorf("New() without PVMLAB_HOME: got %s, want %s", cfg.homeDir, userHome)
 	}
 }
+
+func TestMirrorURLs(t *testing.T) {
+	originalDistros := Distros
+	defer func() { Distros = originalDistros }()
+	Distros = map[string]Distro{
+		"fedora-40": {Mirrors: []string{
+			"https://download.fedoraproject.org/pub/fedora/linux/",
+			"https://dl.fedoraproject.org/pub/fedora/linux/",
+			"https://archives.fedoraproject.org/pub/archive/fedora/linux/",
+		}},
+		"fedora-41": {Mirrors: []string{
+			"https://download.fedoraproject.org/pub/fedora/linux/",
+			"https://mirror.example.com/fedora/",
+		}},
+	}
+
+	got := MirrorURLs("https://dl.fedoraproject.org/pub/fedora/linux/releases/40/CHECKSUM")
+	expected := []string{
+		"https://download.fedoraproject.org/pub/fedora/linux/releases/40/CHECKSUM",
+		"https://archives.fedoraproject.org/pub/archive/fedora/linux/releases/40/CHECKSUM",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("MirrorURLs() = %v, want %v", got, expected)
+	}
+
+	got = MirrorURLs("https://download.fedoraproject.org/pub/fedora/linux/releases/41/CHECKSUM")
+	if len(got) != 3 || got[2] != "https://mirror.example.com/fedora/releases/41/CHECKSUM" {
+		t.Errorf("expected the mirrors of both distros, got %v", got)
+	}
+
+	if got := MirrorURLs("https://cloud-images.ubuntu.com/noble/current/SHA256SUMS"); len(got) != 0 {
+		t.Errorf("expected no mirrors, got %v", got)
+	}
+}
+
+func TestRegisterDistro(t *testing.T) {
+	originalDistros := Distros
+	defer func() { Distros = originalDistros }()
+	cfg := &Config{}
+	cfg.SetHomeDir(t.TempDir())
+	if err := cfg.LoadOrCreateDistros(); err != nil {
+		t.Fatal(err)
+	}
+
+	golden := ArchInfo{Qcow2URL: "file:///srv/golden.qcow2"}
+	if err := cfg.RegisterDistro("myos", "ubuntu", "x86_64", golden); err != nil {
+		t.Fatalf("RegisterDistro() failed: %v", err)
+	}
+	if err := cfg.RegisterDistro("myos", "ubuntu", "aarch64", ArchInfo{}); err != nil {
+		t.Fatalf("RegisterDistro() failed: %v", err)
+	}
+	// A new import of an architecture replaces the previous one.
+	golden.Qcow2URL = "file:///srv/golden-v2.qcow2"
+	if err := cfg.RegisterDistro("myos", "ubuntu", "x86_64", golden); err != nil {
+		t.Fatalf("RegisterDistro() failed: %v", err)
+	}
+
+	expected := Distro{Name: "myos", DistroName: "ubuntu", Arch: map[string]ArchInfo{"x86_64": golden, "aarch64": {}}}
+	if got := Distros["myos"]; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+	if _, ok := Distros["ubuntu-24.04"]; !ok {
+		t.Error("expected the other distros to be kept")
+	}
+	data, err := os.ReadFile(filepath.Join(cfg.GetSharedDir(), "distros.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "# Default distributions for pvmlab.") {
+		t.Errorf("expected the comments to be kept, got:\n%s", data)
+	}
+	pulled := ArchInfo{Qcow2URL: "https://example.com/image.qcow2"}
+	if !Distros["myos"].Arch["aarch64"].IsImported() || pulled.IsImported() {
+		t.Error("unexpected IsImported()")
+	}
+
+	// The distro is removed with its last architecture.
+	if err := cfg.UnregisterDistro("myos", "aarch64"); err != nil {
+		t.Fatalf("UnregisterDistro() failed: %v", err)
+	}
+	expected.Arch = map[string]ArchInfo{"x86_64": golden}
+	if got := Distros["myos"]; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+	if err := cfg.UnregisterDistro("myos", "x86_64"); err != nil {
+		t.Fatalf("UnregisterDistro() failed: %v", err)
+	}
+	if _, ok := Distros["myos"]; ok {
+		t.Error("expected the distro to be removed")
+	}
+	if err := cfg.UnregisterDistro("myos", "x86_64"); err != nil {
+		t.Errorf("expected no error for a missing distro, got %v", err)
+	}
+	if _, ok := Distros["ubuntu-24.04"]; !ok {
+		t.Error("expected the other distros to be kept")
+	}
+	if data, err := os.ReadFile(filepath.Join(cfg.GetSharedDir(), "distros.yaml")); err != nil || !strings.Contains(string(data), "# Default distributions for pvmlab.") {
+		t.Errorf("expected the comments to be kept, got:\n%s, %v", data, err)
+	}
+}
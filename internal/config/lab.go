@@ -0,0 +1,307 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultLab is the name of the lab living directly in the app directory,
+	// used when no other lab is selected.
+	DefaultLab = "default"
+	// labsDirName is the directory of the app directory holding the other labs.
+	labsDirName = "labs"
+	// labFileName is the file describing a lab in its directory.
+	labFileName = "lab.json"
+	// currentLabFileName is the file of the app directory holding the lab
+	// selected by 'pvmlab lab switch'.
+	currentLabFileName = "current-lab"
+)
+
+// labNameRegex restricts lab names to what can safely be used in file,
+// launchd service and network device names.
+var labNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// Lab is an isolated set of VMs with its own provisioner and private network.
+type Lab struct {
+	Name string `json:"name"`
+	// Index numbers the lab's private network: the default lab is 0 and the
+	// other labs get the lowest free index when they are created.
+	Index int `json:"index"`
+	// Subnet and SubnetV6 are the subnets the addresses of the lab's VMs must
+	// belong to. They are empty for the default lab, which has no restriction.
+	Subnet    string    `json:"subnet,omitempty"`
+	SubnetV6  string    `json:"subnetv6,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+}
+
+// ValidateLabName checks that name can be used as the name of a lab.
+func ValidateLabName(name string) error {
+	if !labNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid lab name '%s': must be at most 32 lowercase letters, digits or dashes, starting with a letter or a digit", name)
+	}
+	return nil
+}
+
+// resolveLab returns the lab selected by the PVMLAB_LAB environment variable
+// (set by the global --lab flag), or else by 'pvmlab lab switch'. A current
+// lab that no longer exists falls back to the default lab, so that another
+// lab can still be switched to.
+func (c *Config) resolveLab() (string, error) {
+	name := os.Getenv("PVMLAB_LAB")
+	if name == "" {
+		name = c.CurrentLab()
+		if _, err := c.LoadLab(name); err != nil {
+			return DefaultLab, nil
+		}
+		return name, nil
+	}
+	if _, err := c.LoadLab(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// LabName returns the name of the lab the configuration points to.
+func (c *Config) LabName() string {
+	if c.lab == "" {
+		return DefaultLab
+	}
+	return c.lab
+}
+
+// SetLabName points the configuration to another lab.
+func (c *Config) SetLabName(name string) {
+	c.lab = name
+}
+
+// GetLabDir returns the directory holding the VMs, PIDs, logs, monitors,
+// cloud-init configs and SSH keys of a lab. The default lab lives directly in
+// the app directory, as it did before labs existed.
+func (c *Config) GetLabDir(name string) string {
+	if name == "" || name == DefaultLab {
+		return c.GetSharedDir()
+	}
+	return filepath.Join(c.GetSharedDir(), labsDirName, name)
+}
+
+// Lab returns the lab the configuration points to.
+func (c *Config) Lab() (*Lab, error) {
+	return c.LoadLab(c.LabName())
+}
+
+// LoadLab returns the lab with the given name.
+func (c *Config) LoadLab(name string) (*Lab, error) {
+	if name == DefaultLab {
+		return &Lab{Name: DefaultLab}, nil
+	}
+	if err := ValidateLabName(name); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(c.GetLabDir(name), labFileName))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("lab '%s' does not exist. Create it with 'pvmlab lab create %s'", name, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lab '%s': %w", name, err)
+	}
+	var lab Lab
+	if err := json.Unmarshal(data, &lab); err != nil {
+		return nil, fmt.Errorf("failed to parse lab '%s': %w", name, err)
+	}
+	return &lab, nil
+}
+
+// ListLabs returns all the labs sorted by index, starting with the default lab.
+func (c *Config) ListLabs() ([]*Lab, error) {
+	labs := []*Lab{{Name: DefaultLab}}
+	entries, err := os.ReadDir(filepath.Join(c.GetSharedDir(), labsDirName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read labs directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || ValidateLabName(entry.Name()) != nil {
+			continue
+		}
+		lab, err := c.LoadLab(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		labs = append(labs, lab)
+	}
+	sort.Slice(labs, func(i, j int) bool { return labs[i].Index < labs[j].Index })
+	return labs, nil
+}
+
+// CreateLab creates a new lab with the lowest free index. The subnets are
+// optional, an empty subnet defaults to one derived from the index:
+// 192.168.<100+index>.0/24 and fd00:cafe:babe:<index>::/64.
+func (c *Config) CreateLab(name, subnet, subnetV6 string) (*Lab, error) {
+	if err := ValidateLabName(name); err != nil {
+		return nil, err
+	}
+	if name == DefaultLab {
+		return nil, fmt.Errorf("lab '%s' already exists", name)
+	}
+	labs, err := c.ListLabs()
+	if err != nil {
+		return nil, err
+	}
+
+	used := map[int]bool{}
+	for _, lab := range labs {
+		if lab.Name == name {
+			return nil, fmt.Errorf("lab '%s' already exists", name)
+		}
+		used[lab.Index] = true
+	}
+	index := 1
+	for used[index] {
+		index++
+	}
+	if subnet == "" {
+		if index > 155 {
+			return nil, fmt.Errorf("no default subnet left for lab '%s', please specify one", name)
+		}
+		subnet = fmt.Sprintf("192.168.%d.0/24", 100+index)
+	}
+	if subnetV6 == "" {
+		subnetV6 = fmt.Sprintf("fd00:cafe:babe:%x::/64", index)
+	}
+
+	lab := &Lab{Name: name, Index: index, CreatedAt: time.Now().UTC()}
+	if lab.Subnet, err = normalizeSubnet(subnet, false); err != nil {
+		return nil, err
+	}
+	if lab.SubnetV6, err = normalizeSubnet(subnetV6, true); err != nil {
+		return nil, err
+	}
+	for _, other := range labs {
+		if subnetsOverlap(lab.Subnet, other.Subnet) || subnetsOverlap(lab.SubnetV6, other.SubnetV6) {
+			return nil, fmt.Errorf("the subnets of lab '%s' overlap with lab '%s'", name, other.Name)
+		}
+	}
+
+	dir := c.GetLabDir(name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lab directory: %w", err)
+	}
+	data, err := json.MarshalIndent(lab, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, labFileName), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write lab '%s': %w", name, err)
+	}
+	return lab, nil
+}
+
+// RemoveLab deletes a lab and everything in its directory. If the lab was the
+// current one, the default lab becomes current.
+func (c *Config) RemoveLab(name string) error {
+	if name == DefaultLab {
+		return fmt.Errorf("the default lab can't be removed")
+	}
+	if _, err := c.LoadLab(name); err != nil {
+		return err
+	}
+	if c.CurrentLab() == name {
+		if err := c.SetCurrentLab(DefaultLab); err != nil {
+			return err
+		}
+	}
+	if err := os.RemoveAll(c.GetLabDir(name)); err != nil {
+		return fmt.Errorf("failed to remove lab '%s': %w", name, err)
+	}
+	return nil
+}
+
+// CurrentLab returns the lab selected by 'pvmlab lab switch', used when
+// --lab is not given.
+func (c *Config) CurrentLab() string {
+	data, err := os.ReadFile(filepath.Join(c.GetSharedDir(), currentLabFileName))
+	if err != nil {
+		return DefaultLab
+	}
+	name := strings.TrimSpace(string(data))
+	if name == "" {
+		return DefaultLab
+	}
+	return name
+}
+
+// SetCurrentLab makes the given lab the current one.
+func (c *Config) SetCurrentLab(name string) error {
+	if _, err := c.LoadLab(name); err != nil {
+		return err
+	}
+	path := filepath.Join(c.GetSharedDir(), currentLabFileName)
+	if name == DefaultLab {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to reset the current lab: %w", err)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(c.GetSharedDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create app directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(name+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to set the current lab: %w", err)
+	}
+	return nil
+}
+
+// Contains reports whether the IP address of a CIDR (e.g. 192.168.101.2/24)
+// belongs to the lab's subnets. Labs without a subnet contain any address.
+func (l *Lab) Contains(cidr string) (bool, error) {
+	ip, _, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false, err
+	}
+	subnet := l.Subnet
+	if ip.To4() == nil {
+		subnet = l.SubnetV6
+	}
+	if subnet == "" {
+		return true, nil
+	}
+	_, network, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return false, err
+	}
+	return network.Contains(ip), nil
+}
+
+func normalizeSubnet(subnet string, v6 bool) (string, error) {
+	ip, network, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return "", fmt.Errorf("invalid subnet '%s': %w", subnet, err)
+	}
+	if (ip.To4() == nil) != v6 {
+		family := "IPv4"
+		if v6 {
+			family = "IPv6"
+		}
+		return "", fmt.Errorf("invalid subnet '%s': not an %s subnet", subnet, family)
+	}
+	return network.String(), nil
+}
+
+func subnetsOverlap(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	_, na, errA := net.ParseCIDR(a)
+	_, nb, errB := net.ParseCIDR(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return na.Contains(nb.IP) || nb.Contains(na.IP)
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLabs(t *testing.T) {
+	cfg := &Config{homeDir: t.TempDir()}
+
+	if cfg.LabName() != DefaultLab || cfg.GetAppDir() != cfg.GetSharedDir() {
+		t.Fatalf("expected the default lab to live in the app directory, got %s", cfg.GetAppDir())
+	}
+
+	lab, err := cfg.CreateLab("fedora", "", "")
+	if err != nil {
+		t.Fatalf("CreateLab() failed: %v", err)
+	}
+	if lab.Index != 1 || lab.Subnet != "192.168.101.0/24" || lab.SubnetV6 != "fd00:cafe:babe:1::/64" {
+		t.Errorf("unexpected lab: %+v", lab)
+	}
+	if _, err := cfg.CreateLab("fedora", "", ""); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected an already exists error, got %v", err)
+	}
+	if _, err := cfg.CreateLab("overlap", "192.168.101.128/25", ""); err == nil || !strings.Contains(err.Error(), "overlap with lab 'fedora'") {
+		t.Errorf("expected an overlap error, got %v", err)
+	}
+	if _, err := cfg.CreateLab("v6", "fd00::/64", ""); err == nil || !strings.Contains(err.Error(), "not an IPv4 subnet") {
+		t.Errorf("expected a family error, got %v", err)
+	}
+	if _, err := cfg.CreateLab("Bad_Name", "", ""); err == nil {
+		t.Error("expected an invalid name error")
+	}
+	if _, err := cfg.CreateLab("ubuntu", "10.0.0.1/16", ""); err != nil {
+		t.Fatalf("CreateLab() failed: %v", err)
+	}
+
+	labs, err := cfg.ListLabs()
+	if err != nil {
+		t.Fatalf("ListLabs() failed: %v", err)
+	}
+	var names []string
+	for _, l := range labs {
+		names = append(names, l.Name)
+	}
+	if strings.Join(names, ",") != "default,fedora,ubuntu" {
+		t.Errorf("unexpected labs: %v", names)
+	}
+	if labs[2].Subnet != "10.0.0.0/16" || labs[2].Index != 2 {
+		t.Errorf("unexpected lab: %+v", labs[2])
+	}
+
+	cfg.SetLabName("fedora")
+	if cfg.GetAppDir() != filepath.Join(cfg.GetSharedDir(), "labs", "fedora") {
+		t.Errorf("unexpected lab directory: %s", cfg.GetAppDir())
+	}
+	current, err := cfg.Lab()
+	if err != nil {
+		t.Fatalf("Lab() failed: %v", err)
+	}
+	for addr, want := range map[string]bool{
+		"192.168.101.2/24":        true,
+		"192.168.100.2/24":        false,
+		"fd00:cafe:babe:1::10/64": true,
+		"fd00:cafe:babe::10/64":   false,
+	} {
+		if got, err := current.Contains(addr); err != nil || got != want {
+			t.Errorf("Contains(%s) = %v, %v, want %v", addr, got, err, want)
+		}
+	}
+}
+
+func TestCurrentLab(t *testing.T) {
+	cfg := &Config{homeDir: t.TempDir()}
+	t.Setenv("PVMLAB_LAB", "")
+
+	if err := cfg.SetCurrentLab("missing"); err == nil {
+		t.Error("expected switching to a missing lab to fail")
+	}
+	if _, err := cfg.CreateLab("fedora", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.SetCurrentLab("fedora"); err != nil {
+		t.Fatalf("SetCurrentLab() failed: %v", err)
+	}
+	if name, err := cfg.resolveLab(); err != nil || name != "fedora" {
+		t.Errorf("expected the current lab to be selected, got %s, %v", name, err)
+	}
+
+	t.Setenv("PVMLAB_LAB", DefaultLab)
+	if name, err := cfg.resolveLab(); err != nil || name != DefaultLab {
+		t.Errorf("expected PVMLAB_LAB to win over the current lab, got %s, %v", name, err)
+	}
+	t.Setenv("PVMLAB_LAB", "missing")
+	if _, err := cfg.resolveLab(); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("expected a missing lab error, got %v", err)
+	}
+
+	t.Setenv("PVMLAB_LAB", "")
+	if err := cfg.RemoveLab("fedora"); err != nil {
+		t.Fatalf("RemoveLab() failed: %v", err)
+	}
+	if cfg.CurrentLab() != DefaultLab {
+		t.Errorf("expected removing the current lab to switch to the default lab, got %s", cfg.CurrentLab())
+	}
+	if err := cfg.RemoveLab(DefaultLab); err == nil {
+		t.Error("expected removing the default lab to fail")
+	}
+}
@@ -20,7 +20,7 @@ fi
 echo "Updating container and installing dependencies..."
 export DEBIAN_FRONTEND=noninteractive
 apt-get update > /dev/null
-apt-get install -y libguestfs-tools pv btrfs-progs > /dev/null
+apt-get install -y libguestfs-tools libguestfs-xfs pv btrfs-progs > /dev/null
 
 echo "Available RAM in the container/github runner:"
 free -h
@@ -44,6 +44,25 @@ elif [ "${DISTRO_NAME}" == "ubuntu" ]; then
         SIZE=$(guestfish --ro -a "${IMAGE_PATH}" -m /dev/sda1 du / | awk '{print $1}')
         guestfish --ro -a "${IMAGE_PATH}" -m /dev/sda1 tar-out / - | pv -s "${SIZE}" | gzip > "${ROOTFS_PATH}"
     fi
+elif [ "${DISTRO_NAME}" == "debian" ]; then
+    echo "Using Debian EXT4 layout (/dev/sda1 for root, /boot included)..."
+    SIZE=$(guestfish --ro -a "${IMAGE_PATH}" -m /dev/sda1 du / | awk '{print $1}')
+    guestfish --ro -a "${IMAGE_PATH}" -m /dev/sda1 tar-out / - numericowner:true | pv -s "${SIZE}" | gzip > "${ROOTFS_PATH}"
+elif [ "${DISTRO_NAME}" == "rocky" ] || [ "${DISTRO_NAME}" == "almalinux" ] || [ "${DISTRO_NAME}" == "centos" ]; then
+    # The partition layout of the RHEL-family images (XFS root, with or
+    # without a separate /boot or LVM) varies between distros and releases:
+    # let libguestfs mount them from the image's fstab. The EFI partition is
+    # left out, the installer creates its own.
+    echo "Using the ${DISTRO_NAME} filesystems found by inspection..."
+    el_guestfish() {
+        # The leading - ignores the error if there is no /boot/efi.
+        guestfish --ro -a "${IMAGE_PATH}" -i <<EOF
+-umount /boot/efi
+$1
+EOF
+    }
+    SIZE=$(el_guestfish "du /" | awk '{print $1}')
+    el_guestfish "tar-out / - numericowner:true" | pv -s "${SIZE}" | gzip > "${ROOTFS_PATH}"
 else
     echo "Error: Unsupported distro '${DISTRO_NAME}'" >&2
     exit 1
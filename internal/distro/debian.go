@@ -0,0 +1,8 @@
+package distro
+
+// DebianExtractor implements the Extractor interface for Debian. The Debian
+// cloud images have the same single ext4 partition layout as the Ubuntu
+// ones, so the rootfs and the PXE boot assets are created the same way.
+type DebianExtractor struct {
+	UbuntuExtractor
+}
@@ -21,28 +21,9 @@ func Pull(ctx context.Context, cfg *config.Config, distroName, arch string) erro
 		return fmt.Errorf("docker is not installed. Please install it to create rootfs tarballs")
 	}
 
-	imagesDir := filepath.Join(cfg.GetAppDir(), "images")
-	if err := os.MkdirAll(imagesDir, 0755); err != nil {
-		return fmt.Errorf("failed to create images directory: %w", err)
-	}
-	if err := os.Chmod(imagesDir, 0755); err != nil {
-		return fmt.Errorf("failed to enforce permissions on images directory: %w", err)
-	}
-
-	distroDir := filepath.Join(imagesDir, distroName)
-	if err := os.MkdirAll(distroDir, 0755); err != nil {
-		return fmt.Errorf("failed to create distro directory: %w", err)
-	}
-	if err := os.Chmod(distroDir, 0755); err != nil {
-		return fmt.Errorf("failed to enforce permissions on distro directory: %w", err)
-	}
-
-	distroPath := filepath.Join(distroDir, arch)
-	if err := os.MkdirAll(distroPath, 0755); err != nil {
-		return fmt.Errorf("failed to create arch directory: %w", err)
-	}
-	if err := os.Chmod(distroPath, 0755); err != nil {
-		return fmt.Errorf("failed to enforce permissions on arch directory: %w", err)
+	distroPath, err := prepareDistroPath(cfg, distroName, arch)
+	if err != nil {
+		return err
 	}
 
 	distro, ok := config.Distros[distroName]
@@ -54,13 +35,21 @@ func Pull(ctx context.Context, cfg *config.Config, distroName, arch string) erro
 	if !ok {
 		return fmt.Errorf("architecture '%s' not found for distro '%s'", arch, distroName)
 	}
+	if distroInfo.Qcow2URL == "" {
+		return fmt.Errorf("distro '%s' was imported from a rootfs tarball, import it again with 'pvmlab distro import' instead", distroName)
+	}
 
 	extractor, err := NewExtractor(distro.DistroName)
 	if err != nil {
 		return err
 	}
 
-	if err := extractor.CreateRootfs(ctx, &distroInfo, distro.DistroName, distroPath); err != nil {
+	qcow2Path := filepath.Join(distroPath, filepath.Base(distroInfo.Qcow2URL))
+	if err := DownloadImage(ctx, cfg, &distroInfo, qcow2Path); err != nil {
+		return err
+	}
+
+	if err := createRootfs(ctx, cfg, extractor, &distro, &distroInfo, arch, distroPath); err != nil {
 		return err
 	}
 
@@ -71,4 +60,34 @@ func Pull(ctx context.Context, cfg *config.Config, distroName, arch string) erro
 	color.Green("✔ PXE boot assets prepared successfully (vmlinuz and initrd extracted).\n")
 
 	return nil
-}
\ No newline at end of file
+}
+
+// prepareDistroPath creates the directory of the assets of an architecture of
+// a distro, readable by the provisioner, and returns it.
+func prepareDistroPath(cfg *config.Config, distroName, arch string) (string, error) {
+	imagesDir := filepath.Join(cfg.GetSharedDir(), "images")
+	if err := os.MkdirAll(imagesDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create images directory: %w", err)
+	}
+	if err := os.Chmod(imagesDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to enforce permissions on images directory: %w", err)
+	}
+
+	distroDir := filepath.Join(imagesDir, distroName)
+	if err := os.MkdirAll(distroDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create distro directory: %w", err)
+	}
+	if err := os.Chmod(distroDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to enforce permissions on distro directory: %w", err)
+	}
+
+	distroPath := filepath.Join(distroDir, arch)
+	if err := os.MkdirAll(distroPath, 0755); err != nil {
+		return "", fmt.Errorf("failed to create arch directory: %w", err)
+	}
+	if err := os.Chmod(distroPath, 0755); err != nil {
+		return "", fmt.Errorf("failed to enforce permissions on arch directory: %w", err)
+	}
+
+	return distroPath, nil
+}
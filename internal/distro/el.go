@@ -0,0 +1,9 @@
+package distro
+
+// ELExtractor implements the Extractor interface for the RHEL-family distros:
+// Rocky Linux, AlmaLinux and CentOS Stream. Their cloud images are built like
+// the Fedora ones, so the rootfs and the PXE boot assets are created the same
+// way.
+type ELExtractor struct {
+	FedoraExtractor
+}
@@ -9,7 +9,13 @@ import (
 // Extractor defines the interface for distribution-specific asset extraction.
 type Extractor interface {
 	ExtractKernelAndInitrd(ctx context.Context, cfg *config.Config, distroInfo *config.ArchInfo, distroPath string) error
+	// CreateRootfs creates rootfs.tar.gz in distroPath from the qcow2 image
+	// of distroInfo, downloaded there by Pull.
 	CreateRootfs(ctx context.Context, distroInfo *config.ArchInfo, distroName, distroPath string) error
+	// CreateModules creates modules.cpio.gz in distroPath from the kernel
+	// modules of its rootfs.tar.gz, for the installer's initrd. It is part of
+	// ExtractKernelAndInitrd, for the kernels that don't come from the rootfs.
+	CreateModules(ctx context.Context, distroPath string) error
 }
 
 // NewExtractor is a factory function that returns the correct extractor for a given distro.
@@ -19,6 +25,10 @@ func NewExtractor(distroName string) (Extractor, error) {
 		return &UbuntuExtractor{}, nil
 	case "fedora":
 		return &FedoraExtractor{}, nil
+	case "debian":
+		return &DebianExtractor{}, nil
+	case "rocky", "almalinux", "centos":
+		return &ELExtractor{}, nil
 	default:
 		return nil, fmt.Errorf("no extractor available for distribution: %s", distroName)
 	}
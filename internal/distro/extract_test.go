@@ -24,8 +24,32 @@ func TestNewExtractor(t *testing.T) {
 			expectError: false,
 		},
 		{
-			name:        "unsupported distro",
+			name:        "debian extractor",
 			distroName:  "debian",
+			wantType:    "*distro.DebianExtractor",
+			expectError: false,
+		},
+		{
+			name:        "rocky extractor",
+			distroName:  "rocky",
+			wantType:    "*distro.ELExtractor",
+			expectError: false,
+		},
+		{
+			name:        "almalinux extractor",
+			distroName:  "almalinux",
+			wantType:    "*distro.ELExtractor",
+			expectError: false,
+		},
+		{
+			name:        "centos extractor",
+			distroName:  "centos",
+			wantType:    "*distro.ELExtractor",
+			expectError: false,
+		},
+		{
+			name:        "unsupported distro",
+			distroName:  "arch",
 			wantType:    "",
 			expectError: true,
 		},
@@ -81,3 +105,14 @@ func TestNewExtractor_Fedora(t *testing.T) {
 		t.Errorf("expected *FedoraExtractor, got %T", extractor)
 	}
 }
+
+func TestNewExtractor_Debian(t *testing.T) {
+	extractor, err := NewExtractor("debian")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := extractor.(*DebianExtractor); !ok {
+		t.Errorf("expected *DebianExtractor, got %T", extractor)
+	}
+}
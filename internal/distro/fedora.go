@@ -6,10 +6,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
 
 	"pvmlab/internal/config"
-	"pvmlab/internal/downloader"
 
 	"github.com/fatih/color"
 )
@@ -18,69 +16,14 @@ import (
 type FedoraExtractor struct{}
 
 func (e *FedoraExtractor) ExtractKernelAndInitrd(ctx context.Context, cfg *config.Config, distroInfo *config.ArchInfo, distroPath string) error {
-	color.Cyan("i Extracting PXE boot assets from rootfs...")
-
-	rootfsPath := filepath.Join(distroPath, "rootfs.tar.gz")
-	if _, err := os.Stat(rootfsPath); os.IsNotExist(err) {
-		return fmt.Errorf("rootfs.tar.gz not found at %s", rootfsPath)
-	}
-
-	// --- Extract Kernel and Initrd ---
-	extractDir, err := os.MkdirTemp(distroPath, "extract-")
-	if err != nil {
-		return fmt.Errorf("failed to create temporary extraction directory: %w", err)
-	}
-	defer os.RemoveAll(extractDir)
-
-	// Extract the boot directory to find the kernel and initrd
-	cmd := exec.CommandContext(ctx, "tar", "-xzf", rootfsPath, "-C", extractDir, "./boot")
-	if output, err := cmd.CombinedOutput(); err != nil {
-		if ctx.Err() == context.Canceled {
-			color.Yellow("\nOperation cancelled by user.")
-			return nil
-		}
-		color.Red("! Failed to extract from rootfs.tar.gz. Output:\n%s", string(output))
-		return fmt.Errorf("failed to extract boot directory from rootfs: %w", err)
-	}
-
-	// Find kernel and initrd files
-	bootDir := filepath.Join(extractDir, "boot")
-	files, err := os.ReadDir(bootDir)
-	if err != nil {
-		return fmt.Errorf("failed to read boot directory: %w", err)
-	}
-
-	var kernelPath, initrdPath string
-	for _, file := range files {
-		if strings.HasPrefix(file.Name(), "vmlinuz-") {
-			kernelPath = filepath.Join(bootDir, file.Name())
-		}
-		if strings.HasPrefix(file.Name(), "initramfs-") && strings.HasSuffix(file.Name(), ".img") {
-			initrdPath = filepath.Join(bootDir, file.Name())
-		}
-	}
-
-	if kernelPath == "" || initrdPath == "" {
-		return fmt.Errorf("could not find kernel or initrd in boot directory")
-	}
-
-	// Move kernel
-	finalVmlinuz := filepath.Join(distroPath, filepath.Base(kernelPath))
-	if err := os.Rename(kernelPath, finalVmlinuz); err != nil {
-		return fmt.Errorf("failed to move vmlinuz: %w", err)
-	}
-	if err := os.Chmod(finalVmlinuz, 0644); err != nil {
-		return fmt.Errorf("failed to set permissions on vmlinuz: %w", err)
+	if err := extractKernelAndInitrd(ctx, distroInfo, distroPath); err != nil {
+		return err
 	}
+	return e.CreateModules(ctx, distroPath)
+}
 
-	// Move initrd
-	finalInitrd := filepath.Join(distroPath, filepath.Base(initrdPath))
-	if err := os.Rename(initrdPath, finalInitrd); err != nil {
-		return fmt.Errorf("failed to move initrd.img: %w", err)
-	}
-	if err := os.Chmod(finalInitrd, 0644); err != nil {
-		return fmt.Errorf("failed to set permissions on initrd.img: %w", err)
-	}
+func (e *FedoraExtractor) CreateModules(ctx context.Context, distroPath string) error {
+	rootfsPath := filepath.Join(distroPath, "rootfs.tar.gz")
 
 	// --- Create modules.cpio.gz from rootfs ---
 	color.Cyan("i Creating modules.cpio.gz from rootfs...")
@@ -149,14 +92,9 @@ func (e *FedoraExtractor) ExtractKernelAndInitrd(ctx context.Context, cfg *confi
 }
 
 func (e *FedoraExtractor) CreateRootfs(ctx context.Context, distroInfo *config.ArchInfo, distroName, distroPath string) error {
-	// Step 1: Download the qcow2 image
 	qcow2Name := filepath.Base(distroInfo.Qcow2URL)
-	qcow2Path := filepath.Join(distroPath, qcow2Name)
-	if err := downloader.DownloadImageIfNotExists(ctx, qcow2Path, distroInfo.Qcow2URL); err != nil {
-		return err
-	}
 
-	// Step 2: Create a temporary script file from the embedded script in distroPath
+	// Step 1: Create a temporary script file from the embedded script in distroPath
 	tmpfile, err := os.CreateTemp(distroPath, "create-rootfs-*.sh")
 	if err != nil {
 		return fmt.Errorf("failed to create temporary script file in %s: %w", distroPath, err)
@@ -173,7 +111,7 @@ func (e *FedoraExtractor) CreateRootfs(ctx context.Context, distroInfo *config.A
 		return fmt.Errorf("failed to make temporary script executable: %w", err)
 	}
 
-	// Step 3: Run the Docker container to create the rootfs tarball
+	// Step 2: Run the Docker container to create the rootfs tarball
 	color.Cyan("i Creating rootfs tarball via Docker (press Ctrl+C to cancel)...")
 
 	containerImagePath := filepath.Join("/images", qcow2Name)
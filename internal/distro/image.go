@@ -0,0 +1,101 @@
+package distro
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"pvmlab/internal/cache"
+	"pvmlab/internal/config"
+	"pvmlab/internal/downloader"
+	"pvmlab/internal/util"
+
+	"github.com/fatih/color"
+)
+
+// DownloadImage downloads the qcow2 image of distroInfo to imagePath through
+// the cache, verified against the checksum and signature set in
+// distros.yaml. The image of a distro imported from a file, with a file://
+// URL, is copied from it instead.
+func DownloadImage(ctx context.Context, cfg *config.Config, distroInfo *config.ArchInfo, imagePath string) error {
+	if distroInfo.Qcow2URL == "" {
+		return fmt.Errorf("the distro was imported from a rootfs tarball and has no qcow2 image")
+	}
+	if src, ok := strings.CutPrefix(distroInfo.Qcow2URL, "file://"); ok {
+		return copyImage(cache.Open(cfg), distroInfo.Qcow2URL, src, imagePath)
+	}
+	return cache.Open(cfg).Download(ctx, imagePath, distroInfo.Qcow2URL, downloader.Verification{
+		SHA256:       distroInfo.SHA256,
+		SHA256URL:    distroInfo.SHA256URL,
+		KeyURL:       distroInfo.GPGKeyURL,
+		SignatureURL: distroInfo.SHA256SigURL,
+	})
+}
+
+// copyImage copies the image of an imported distro from src to imagePath and
+// adds it to the cache under key, for the rootfs tarball created from it to be
+// cached too.
+func copyImage(c *cache.Cache, key, src, imagePath string) error {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to read the image to import: %w", err)
+	}
+	if info, err := os.Stat(imagePath); err != nil || !os.SameFile(srcInfo, info) {
+		color.Cyan("i Copying the image %s...", src)
+		// imagePath may be linked to the cache, and must not be written to.
+		if err := os.Remove(imagePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := util.CopyFile(src, imagePath, 0644); err != nil {
+			return fmt.Errorf("failed to copy the image %s: %w", src, err)
+		}
+	}
+	if _, err := c.Add(cache.Entry{Key: key, Kind: cache.KindImage}, imagePath); err != nil {
+		color.Yellow("! Failed to add the image to the cache: %v", err)
+	}
+	return nil
+}
+
+// createRootfs creates the rootfs tarball of the qcow2 image downloaded in
+// distroPath with extractor, or takes it from the cache if it was already
+// created from the same image.
+func createRootfs(ctx context.Context, cfg *config.Config, extractor Extractor, distro *config.Distro, distroInfo *config.ArchInfo, arch, distroPath string) error {
+	c := cache.Open(cfg)
+	rootfsPath := filepath.Join(distroPath, "rootfs.tar.gz")
+
+	image, err := c.Lookup(distroInfo.Qcow2URL)
+	if err != nil {
+		return err
+	}
+	if image != nil && !c.Contains(image, filepath.Join(distroPath, filepath.Base(distroInfo.Qcow2URL))) {
+		image = nil
+	}
+	var key string
+	if image != nil {
+		key = cache.RootfsKey(distro.DistroName, image.SHA256)
+		rootfs, err := c.Lookup(key)
+		if err != nil {
+			return err
+		}
+		if rootfs != nil {
+			color.Cyan("i Using the cached rootfs tarball of %s.", image.Name)
+			return c.Place(rootfs, rootfsPath)
+		}
+	}
+
+	// The rootfs tarball is written in place, and must not be a cached one.
+	if err := os.Remove(rootfsPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := extractor.CreateRootfs(ctx, distroInfo, distro.DistroName, distroPath); err != nil || ctx.Err() != nil || image == nil {
+		return err
+	}
+
+	entry := cache.Entry{Key: key, Kind: cache.KindRootfs, Name: filepath.Join(distro.Name, arch, "rootfs.tar.gz"), From: image.SHA256}
+	if _, err := c.Add(entry, rootfsPath); err != nil {
+		color.Yellow("! Failed to add the rootfs tarball to the cache: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package distro
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"pvmlab/internal/config"
+	"pvmlab/internal/util"
+
+	"github.com/fatih/color"
+)
+
+// ImportOptions describes a custom image to import as a distro.
+type ImportOptions struct {
+	// Name is the name of the distro to register in distros.yaml.
+	Name string
+	// Family is the distro the image is based on, e.g. "ubuntu" or "rocky",
+	// which selects how its rootfs is created and how it is installed.
+	Family string
+	Arch   string
+	// Qcow2 is the path of the qcow2 image to create the rootfs from.
+	Qcow2 string
+	// Rootfs is the path of a rootfs tarball to use instead of a qcow2 image.
+	// Kernel and Initrd are the paths of the kernel and initrd to boot it
+	// with, by default the newest kernel of the rootfs' /boot.
+	Rootfs string
+	Kernel string
+	Initrd string
+}
+
+func (opts *ImportOptions) validate() error {
+	if opts.Name == "" || opts.Name != filepath.Base(opts.Name) || opts.Name == "." || opts.Name == ".." {
+		return fmt.Errorf("invalid distro name '%s'", opts.Name)
+	}
+	if (opts.Qcow2 == "") == (opts.Rootfs == "") {
+		return fmt.Errorf("either a qcow2 image or a rootfs tarball must be imported")
+	}
+	if (opts.Kernel == "") != (opts.Initrd == "") {
+		return fmt.Errorf("the kernel and the initrd must be imported together")
+	}
+	if opts.Kernel != "" && opts.Rootfs == "" {
+		return fmt.Errorf("the kernel and initrd can only be imported with a rootfs tarball")
+	}
+	if opts.Kernel != "" && filepath.Base(opts.Kernel) == filepath.Base(opts.Initrd) {
+		return fmt.Errorf("the kernel and the initrd must have different file names")
+	}
+	if existing, ok := config.Distros[opts.Name]; ok {
+		if existing.DistroName != opts.Family {
+			return fmt.Errorf("distro '%s' already exists with family '%s'", opts.Name, existing.DistroName)
+		}
+		if archInfo, ok := existing.Arch[opts.Arch]; ok && !archInfo.IsImported() {
+			return fmt.Errorf("distro '%s' is pulled from %s, import the image under another name", opts.Name, archInfo.Qcow2URL)
+		}
+	}
+	return nil
+}
+
+// Import creates the PXE boot assets of a custom image like Pull, and
+// registers the image in distros.yaml so that VMs can be created from it. A
+// qcow2 image is registered with its file:// URL, so that pulling the distro
+// imports the image again.
+var Import = func(ctx context.Context, cfg *config.Config, opts ImportOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	extractor, err := NewExtractor(opts.Family)
+	if err != nil {
+		return err
+	}
+
+	var distroInfo config.ArchInfo
+	if opts.Qcow2 != "" {
+		if _, err := exec.LookPath("docker"); err != nil {
+			return fmt.Errorf("docker is not installed. Please install it to create rootfs tarballs")
+		}
+		qcow2Path, err := filepath.Abs(opts.Qcow2)
+		if err != nil {
+			return err
+		}
+		distroInfo.Qcow2URL = "file://" + qcow2Path
+	}
+
+	distroPath, err := prepareDistroPath(cfg, opts.Name, opts.Arch)
+	if err != nil {
+		return err
+	}
+
+	if opts.Qcow2 != "" {
+		distro := config.Distro{Name: opts.Name, DistroName: opts.Family}
+		if err := DownloadImage(ctx, cfg, &distroInfo, filepath.Join(distroPath, filepath.Base(opts.Qcow2))); err != nil {
+			return err
+		}
+		if err := createRootfs(ctx, cfg, extractor, &distro, &distroInfo, opts.Arch, distroPath); err != nil || ctx.Err() != nil {
+			return err
+		}
+	} else {
+		color.Cyan("i Copying the rootfs tarball %s...", opts.Rootfs)
+		rootfsPath := filepath.Join(distroPath, "rootfs.tar.gz")
+		// The rootfs tarball of a previous pull may be linked to the cache.
+		if err := os.Remove(rootfsPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := util.CopyFile(opts.Rootfs, rootfsPath, 0644); err != nil {
+			return fmt.Errorf("failed to copy the rootfs tarball: %w", err)
+		}
+	}
+
+	if opts.Kernel != "" {
+		if err := importKernel(distroPath, opts.Kernel, opts.Initrd); err != nil {
+			return err
+		}
+		if err := extractor.CreateModules(ctx, distroPath); err != nil {
+			return err
+		}
+	} else if err := extractor.ExtractKernelAndInitrd(ctx, cfg, &distroInfo, distroPath); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	if err := cfg.RegisterDistro(opts.Name, opts.Family, opts.Arch, distroInfo); err != nil {
+		return err
+	}
+	color.Green("✔ Distro '%s' (%s) imported. Create VMs from it with 'pvmlab vm create --distro %s --arch %s --pxeboot'.", opts.Name, opts.Arch, opts.Name, opts.Arch)
+	return nil
+}
+
+// importKernel copies a kernel and its initrd to distroPath and records them
+// in its lock file.
+func importKernel(distroPath, kernel, initrd string) error {
+	tmpDir, err := os.MkdirTemp(distroPath, "import-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary import directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	kernelPath := filepath.Join(tmpDir, filepath.Base(kernel))
+	if err := util.CopyFile(kernel, kernelPath, 0644); err != nil {
+		return fmt.Errorf("failed to copy the kernel: %w", err)
+	}
+	initrdPath := filepath.Join(tmpDir, filepath.Base(initrd))
+	if err := util.CopyFile(initrd, initrdPath, 0644); err != nil {
+		return fmt.Errorf("failed to copy the initrd: %w", err)
+	}
+	return installKernel(distroPath, kernelPath, initrdPath, "")
+}
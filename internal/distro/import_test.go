@@ -0,0 +1,103 @@
+package distro
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"pvmlab/internal/cache"
+	"pvmlab/internal/config"
+	"strings"
+	"testing"
+)
+
+func TestImport_Invalid(t *testing.T) {
+	originalDistros := config.Distros
+	defer func() { config.Distros = originalDistros }()
+	config.Distros = map[string]config.Distro{
+		"ubuntu-24.04": {Name: "ubuntu-24.04", DistroName: "ubuntu", Arch: map[string]config.ArchInfo{
+			"x86_64": {Qcow2URL: "https://example.com/noble.img"},
+		}},
+	}
+
+	tests := []struct {
+		name     string
+		opts     ImportOptions
+		expected string
+	}{
+		{"invalid name", ImportOptions{Name: "../myos", Family: "ubuntu", Qcow2: "golden.qcow2"}, "invalid distro name"},
+		{"no image", ImportOptions{Name: "myos", Family: "ubuntu"}, "either a qcow2 image or a rootfs tarball"},
+		{"both images", ImportOptions{Name: "myos", Family: "ubuntu", Qcow2: "golden.qcow2", Rootfs: "rootfs.tar.gz"}, "either a qcow2 image or a rootfs tarball"},
+		{"kernel without initrd", ImportOptions{Name: "myos", Family: "ubuntu", Rootfs: "rootfs.tar.gz", Kernel: "vmlinuz"}, "imported together"},
+		{"kernel with qcow2", ImportOptions{Name: "myos", Family: "ubuntu", Qcow2: "golden.qcow2", Kernel: "vmlinuz", Initrd: "initrd"}, "only be imported with a rootfs"},
+		{"pulled distro", ImportOptions{Name: "ubuntu-24.04", Family: "ubuntu", Arch: "x86_64", Qcow2: "golden.qcow2"}, "is pulled from"},
+		{"other family", ImportOptions{Name: "ubuntu-24.04", Family: "fedora", Arch: "aarch64", Qcow2: "golden.qcow2"}, "already exists"},
+		{"unknown family", ImportOptions{Name: "myos", Family: "gentoo", Qcow2: "golden.qcow2"}, "no extractor"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.SetHomeDir(t.TempDir())
+			err := Import(context.Background(), cfg, tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("expected an error containing %q, got %v", tt.expected, err)
+			}
+			if _, err := os.Stat(filepath.Join(cfg.GetSharedDir(), "images")); !os.IsNotExist(err) {
+				t.Errorf("expected nothing to be created, got %v", err)
+			}
+		})
+	}
+}
+
+func TestImportKernel(t *testing.T) {
+	distroPath := t.TempDir()
+	src := t.TempDir()
+	writeFiles(t, src, "vmlinuz-6.8.0-hardened", "initrd.img-6.8.0-hardened")
+	if err := importKernel(distroPath, filepath.Join(src, "vmlinuz-6.8.0-hardened"), filepath.Join(src, "initrd.img-6.8.0-hardened")); err != nil {
+		t.Fatalf("importKernel() failed: %v", err)
+	}
+	lock, err := ReadLock(distroPath)
+	if err != nil || lock.KernelVersion != "6.8.0-hardened" || lock.Kernel != "vmlinuz-6.8.0-hardened" || lock.Initrd != "initrd.img-6.8.0-hardened" {
+		t.Fatalf("unexpected lock %+v, %v", lock, err)
+	}
+	files, err := os.ReadDir(distroPath)
+	if err != nil || len(files) != 3 {
+		t.Errorf("expected the kernel, initrd and lock file only, got %v, %v", files, err)
+	}
+	if _, err := os.Stat(filepath.Join(src, "vmlinuz-6.8.0-hardened")); err != nil {
+		t.Errorf("expected the imported kernel to be kept: %v", err)
+	}
+}
+
+func TestDownloadImage_Imported(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.SetHomeDir(t.TempDir())
+	src := filepath.Join(t.TempDir(), "golden.qcow2")
+	if err := os.WriteFile(src, []byte("golden v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info := &config.ArchInfo{Qcow2URL: "file://" + src}
+	imagePath := filepath.Join(t.TempDir(), "golden.qcow2")
+	if err := DownloadImage(context.Background(), cfg, info, imagePath); err != nil {
+		t.Fatalf("DownloadImage() failed: %v", err)
+	}
+	c := cache.Open(cfg)
+	e, err := c.Lookup(info.Qcow2URL)
+	if err != nil || e == nil || !c.Contains(e, imagePath) {
+		t.Fatalf("expected the image to be cached, got %+v, %v", e, err)
+	}
+
+	// The image was updated: it is copied again.
+	if err := os.WriteFile(src, []byte("golden v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := DownloadImage(context.Background(), cfg, info, imagePath); err != nil {
+		t.Fatalf("DownloadImage() failed: %v", err)
+	}
+	if content, err := os.ReadFile(imagePath); err != nil || string(content) != "golden v2" {
+		t.Errorf("expected the updated image, got %q, %v", content, err)
+	}
+
+	if err := DownloadImage(context.Background(), cfg, &config.ArchInfo{}, imagePath); err == nil {
+		t.Error("expected an error for a distro without a qcow2 image")
+	}
+}
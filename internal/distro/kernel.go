@@ -0,0 +1,203 @@
+package distro
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"pvmlab/internal/config"
+
+	"github.com/fatih/color"
+)
+
+// extractKernelAndInitrd extracts the kernel and initrd of the rootfs of
+// distroPath next to it and records them in its lock file. The newest kernel
+// of the rootfs' /boot that has an initrd is used, unless distros.yaml pins
+// one with kernel_path and initrd_path.
+func extractKernelAndInitrd(ctx context.Context, distroInfo *config.ArchInfo, distroPath string) error {
+	color.Cyan("i Extracting PXE boot assets from rootfs...")
+
+	rootfsPath := filepath.Join(distroPath, "rootfs.tar.gz")
+	if _, err := os.Stat(rootfsPath); os.IsNotExist(err) {
+		return fmt.Errorf("rootfs.tar.gz not found at %s", rootfsPath)
+	}
+
+	extractDir, err := os.MkdirTemp(distroPath, "extract-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary extraction directory: %w", err)
+	}
+	defer os.RemoveAll(extractDir)
+
+	cmd := exec.CommandContext(ctx, "tar", "-xzf", rootfsPath, "-C", extractDir, "./boot")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() == context.Canceled {
+			color.Yellow("\nOperation cancelled by user.")
+			return nil
+		}
+		color.Red("! Failed to extract from rootfs.tar.gz. Output:\n%s", string(output))
+		return fmt.Errorf("failed to extract boot directory from rootfs: %w", err)
+	}
+
+	kernelPath, initrdPath, err := pinnedKernel(extractDir, distroInfo)
+	if err != nil {
+		color.Yellow("! %v, using the newest kernel of the image instead.", err)
+	}
+	if kernelPath == "" {
+		if kernelPath, initrdPath, err = newestKernel(filepath.Join(extractDir, "boot")); err != nil {
+			return err
+		}
+	}
+	return installKernel(distroPath, kernelPath, initrdPath, distroInfo.Qcow2URL)
+}
+
+// installKernel moves a kernel and its initrd to distroPath, on the same
+// filesystem, and records them in its lock file with the image they come
+// from.
+func installKernel(distroPath, kernelPath, initrdPath, qcow2URL string) error {
+	kernel, initrd := filepath.Base(kernelPath), filepath.Base(initrdPath)
+	color.Cyan("i Using kernel %s and initrd %s", kernel, initrd)
+
+	previous, _ := ReadLock(distroPath)
+
+	finalVmlinuz := filepath.Join(distroPath, kernel)
+	if err := os.Rename(kernelPath, finalVmlinuz); err != nil {
+		return fmt.Errorf("failed to move vmlinuz: %w", err)
+	}
+	if err := os.Chmod(finalVmlinuz, 0644); err != nil {
+		return fmt.Errorf("failed to set permissions on vmlinuz: %w", err)
+	}
+
+	finalInitrd := filepath.Join(distroPath, initrd)
+	if err := os.Rename(initrdPath, finalInitrd); err != nil {
+		return fmt.Errorf("failed to move initrd.img: %w", err)
+	}
+	if err := os.Chmod(finalInitrd, 0644); err != nil {
+		return fmt.Errorf("failed to set permissions on initrd.img: %w", err)
+	}
+
+	// Keep the kernel and initrd of the previous pulls, if the image got a
+	// new kernel since: the VMs created from them boot them until
+	// PruneKernels finds them unused.
+	var retained []string
+	if previous != nil {
+		for _, name := range append(previous.Retained, previous.Kernel, previous.Initrd) {
+			if name != "" && name != kernel && name != initrd && !slices.Contains(retained, name) {
+				retained = append(retained, name)
+			}
+		}
+	}
+
+	return WriteLock(distroPath, &Lock{
+		KernelVersion: strings.TrimPrefix(kernel, "vmlinuz-"),
+		Kernel:        kernel,
+		Initrd:        initrd,
+		Qcow2URL:      qcow2URL,
+		PulledAt:      time.Now().UTC(),
+		Retained:      retained,
+	})
+}
+
+// pinnedKernel returns the paths in extractDir of the kernel and initrd set
+// in distros.yaml, following symlinks such as Ubuntu's /boot/vmlinuz, or
+// empty paths if none is set.
+func pinnedKernel(extractDir string, distroInfo *config.ArchInfo) (string, string, error) {
+	if distroInfo.KernelPath == "" && distroInfo.InitrdPath == "" {
+		return "", "", nil
+	}
+	var paths []string
+	for _, p := range []string{distroInfo.KernelPath, distroInfo.InitrdPath} {
+		if p == "" {
+			return "", "", fmt.Errorf("kernel_path and initrd_path must be set together")
+		}
+		resolved, err := filepath.EvalSymlinks(filepath.Join(extractDir, p))
+		if err != nil {
+			return "", "", fmt.Errorf("%s not found in the rootfs /boot", p)
+		}
+		if rel, err := filepath.Rel(extractDir, resolved); err != nil || strings.HasPrefix(rel, "..") {
+			return "", "", fmt.Errorf("%s is outside of the rootfs /boot", p)
+		}
+		paths = append(paths, resolved)
+	}
+	return paths[0], paths[1], nil
+}
+
+// initrdNames are the names of the initrd of a kernel version: initrd.img-<v>
+// for Debian and Ubuntu, initramfs-<v>.img for Fedora and the RHEL family.
+var initrdNames = []func(version string) string{
+	func(v string) string { return "initrd.img-" + v },
+	func(v string) string { return "initramfs-" + v + ".img" },
+}
+
+// newestKernel returns the paths of the newest kernel of bootDir that has an
+// initrd, e.g. vmlinuz-6.1.0-28-arm64 and initrd.img-6.1.0-28-arm64.
+func newestKernel(bootDir string) (string, string, error) {
+	files, err := os.ReadDir(bootDir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read boot directory: %w", err)
+	}
+
+	names := map[string]bool{}
+	for _, file := range files {
+		if file.Type().IsRegular() {
+			names[file.Name()] = true
+		}
+	}
+
+	var newest, newestInitrd string
+	for name := range names {
+		version, ok := strings.CutPrefix(name, "vmlinuz-")
+		if !ok || (newest != "" && compareVersions(version, newest) <= 0) {
+			continue
+		}
+		for _, initrdName := range initrdNames {
+			if names[initrdName(version)] {
+				newest, newestInitrd = version, initrdName(version)
+				break
+			}
+		}
+	}
+	if newest == "" {
+		return "", "", fmt.Errorf("could not find kernel or initrd in boot directory")
+	}
+	return filepath.Join(bootDir, "vmlinuz-"+newest), filepath.Join(bootDir, newestInitrd), nil
+}
+
+// compareVersions compares kernel versions such as 6.1.0-28-arm64, number
+// by number.
+func compareVersions(a, b string) int {
+	split := func(v string) []string {
+		return strings.FieldsFunc(v, func(r rune) bool { return r == '.' || r == '-' || r == '+' || r == '~' })
+	}
+	pa, pb := split(a), split(b)
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, errA := strconv.Atoi(pa[i])
+		nb, errB := strconv.Atoi(pb[i])
+		switch {
+		case errA == nil && errB == nil:
+			if na != nb {
+				if na < nb {
+					return -1
+				}
+				return 1
+			}
+		case pa[i] != pb[i]:
+			if pa[i] < pb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(pa) < len(pb):
+		return -1
+	case len(pa) > len(pb):
+		return 1
+	}
+	return 0
+}
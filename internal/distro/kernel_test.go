@@ -0,0 +1,203 @@
+package distro
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"pvmlab/internal/config"
+	"reflect"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"6.1.0-28-arm64", "6.1.0-28-arm64", 0},
+		{"6.1.0-28-arm64", "6.1.0-9-arm64", 1},
+		{"6.1.0-9-arm64", "6.1.0-28-arm64", -1},
+		{"6.12.43+deb13-amd64", "6.1.0-28-amd64", 1},
+		{"6.1.0-28-cloud-arm64", "6.1.0-28-arm64", 1},
+		{"6.1", "6.1.0", -1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.expected {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+func writeFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNewestKernel(t *testing.T) {
+	tests := []struct {
+		name           string
+		files          []string
+		expectedKernel string
+		expectedInitrd string
+	}{
+		{
+			name: "debian",
+			files: []string{
+				"vmlinuz-6.1.0-9-arm64", "initrd.img-6.1.0-9-arm64",
+				"vmlinuz-6.1.0-28-arm64", "initrd.img-6.1.0-28-arm64",
+				// No initrd for the newest kernel.
+				"vmlinuz-6.1.0-30-arm64",
+				"config-6.1.0-28-arm64", "System.map-6.1.0-28-arm64",
+			},
+			expectedKernel: "vmlinuz-6.1.0-28-arm64",
+			expectedInitrd: "initrd.img-6.1.0-28-arm64",
+		},
+		{
+			// The rescue kernels are older than any other.
+			name: "rhel family",
+			files: []string{
+				"vmlinuz-0-rescue-0123456789abcdef", "initramfs-0-rescue-0123456789abcdef.img",
+				"vmlinuz-5.14.0-427.13.1.el9_4.x86_64", "initramfs-5.14.0-427.13.1.el9_4.x86_64.img",
+			},
+			expectedKernel: "vmlinuz-5.14.0-427.13.1.el9_4.x86_64",
+			expectedInitrd: "initramfs-5.14.0-427.13.1.el9_4.x86_64.img",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bootDir := t.TempDir()
+			writeFiles(t, bootDir, tt.files...)
+			kernel, initrd, err := newestKernel(bootDir)
+			if err != nil {
+				t.Fatalf("newestKernel() failed: %v", err)
+			}
+			if filepath.Base(kernel) != tt.expectedKernel || filepath.Base(initrd) != tt.expectedInitrd {
+				t.Errorf("expected %s and %s, got %s and %s", tt.expectedKernel, tt.expectedInitrd, kernel, initrd)
+			}
+		})
+	}
+
+	if _, _, err := newestKernel(t.TempDir()); err == nil {
+		t.Error("expected an error for a boot directory without kernels")
+	}
+}
+
+func TestPinnedKernel(t *testing.T) {
+	extractDir := t.TempDir()
+	bootDir := filepath.Join(extractDir, "boot")
+	if err := os.Mkdir(bootDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, bootDir, "vmlinuz-6.8.0-87-generic", "initrd.img-6.8.0-87-generic")
+	if err := os.Symlink("vmlinuz-6.8.0-87-generic", filepath.Join(bootDir, "vmlinuz")); err != nil {
+		t.Fatal(err)
+	}
+
+	kernel, initrd, err := pinnedKernel(extractDir, &config.ArchInfo{})
+	if err != nil || kernel != "" || initrd != "" {
+		t.Errorf("expected no pinned kernel, got %q, %q, %v", kernel, initrd, err)
+	}
+
+	kernel, initrd, err = pinnedKernel(extractDir, &config.ArchInfo{KernelPath: "./boot/vmlinuz", InitrdPath: "./boot/initrd.img-6.8.0-87-generic"})
+	if err != nil {
+		t.Fatalf("pinnedKernel() failed: %v", err)
+	}
+	if filepath.Base(kernel) != "vmlinuz-6.8.0-87-generic" || filepath.Base(initrd) != "initrd.img-6.8.0-87-generic" {
+		t.Errorf("expected the symlink to be followed, got %s and %s", kernel, initrd)
+	}
+
+	for _, info := range []*config.ArchInfo{
+		{KernelPath: "./boot/vmlinuz-6.8.0-86-generic", InitrdPath: "./boot/initrd.img-6.8.0-86-generic"},
+		{KernelPath: "./boot/vmlinuz"},
+		{KernelPath: "../vmlinuz", InitrdPath: "./boot/initrd.img-6.8.0-87-generic"},
+	} {
+		if _, _, err := pinnedKernel(extractDir, info); err == nil {
+			t.Errorf("expected an error for %+v", info)
+		}
+	}
+}
+
+// writeRootfs writes a rootfs.tar.gz with the given files in ./boot.
+func writeRootfs(t *testing.T, distroPath string, names ...string) {
+	t.Helper()
+	f, err := os.Create(filepath.Join(distroPath, "rootfs.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: "./boot/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := tw.WriteHeader(&tar.Header{Name: "./boot/" + name, Typeflag: tar.TypeReg, Mode: 0600, Size: int64(len(name))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractKernelAndInitrd(t *testing.T) {
+	distroPath := t.TempDir()
+	writeRootfs(t, distroPath, "vmlinuz-6.8.0-87-generic", "initrd.img-6.8.0-87-generic")
+	info := &config.ArchInfo{Qcow2URL: "https://example.com/noble.img"}
+	if err := extractKernelAndInitrd(context.Background(), info, distroPath); err != nil {
+		t.Fatalf("extractKernelAndInitrd() failed: %v", err)
+	}
+	lock, err := ReadLock(distroPath)
+	if err != nil {
+		t.Fatalf("ReadLock() failed: %v", err)
+	}
+	if lock.KernelVersion != "6.8.0-87-generic" || lock.Kernel != "vmlinuz-6.8.0-87-generic" || lock.Initrd != "initrd.img-6.8.0-87-generic" || lock.Qcow2URL != info.Qcow2URL {
+		t.Errorf("unexpected lock %+v", lock)
+	}
+
+	// The image got a new kernel: the previous one is retained for the VMs
+	// that boot it.
+	writeRootfs(t, distroPath, "vmlinuz-6.8.0-87-generic", "initrd.img-6.8.0-87-generic", "vmlinuz-6.8.0-90-generic", "initrd.img-6.8.0-90-generic")
+	if err := extractKernelAndInitrd(context.Background(), info, distroPath); err != nil {
+		t.Fatalf("extractKernelAndInitrd() failed: %v", err)
+	}
+	if lock, err = ReadLock(distroPath); err != nil || lock.KernelVersion != "6.8.0-90-generic" {
+		t.Errorf("expected the new kernel to be locked, got %+v, %v", lock, err)
+	}
+	if !reflect.DeepEqual(lock.Retained, []string{"vmlinuz-6.8.0-87-generic", "initrd.img-6.8.0-87-generic"}) {
+		t.Errorf("expected the previous kernel to be retained, got %v", lock.Retained)
+	}
+	for _, name := range []string{"vmlinuz-6.8.0-90-generic", "initrd.img-6.8.0-90-generic", "vmlinuz-6.8.0-87-generic", "initrd.img-6.8.0-87-generic"} {
+		if _, err := os.Stat(filepath.Join(distroPath, name)); err != nil {
+			t.Errorf("expected %s to exist: %v", name, err)
+		}
+	}
+
+	// A pinned kernel that isn't in the image falls back to the newest one.
+	info.KernelPath, info.InitrdPath = "./boot/vmlinuz-6.8.0-86-generic", "./boot/initrd.img-6.8.0-86-generic"
+	if err := extractKernelAndInitrd(context.Background(), info, distroPath); err != nil {
+		t.Fatalf("extractKernelAndInitrd() failed: %v", err)
+	}
+	info.KernelPath, info.InitrdPath = "./boot/vmlinuz-6.8.0-87-generic", "./boot/initrd.img-6.8.0-87-generic"
+	if err := extractKernelAndInitrd(context.Background(), info, distroPath); err != nil {
+		t.Fatalf("extractKernelAndInitrd() failed: %v", err)
+	}
+	if lock, err = ReadLock(distroPath); err != nil || lock.KernelVersion != "6.8.0-87-generic" {
+		t.Errorf("expected the pinned kernel to be locked, got %+v, %v", lock, err)
+	}
+	if !reflect.DeepEqual(lock.Retained, []string{"vmlinuz-6.8.0-90-generic", "initrd.img-6.8.0-90-generic"}) {
+		t.Errorf("expected the kernel it replaced to be retained, got %v", lock.Retained)
+	}
+}
@@ -0,0 +1,100 @@
+package distro
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"pvmlab/internal/config"
+)
+
+// LockFile is the name of the file 'distro pull' writes next to the assets of
+// an architecture of a distro, recording what it resolved.
+const LockFile = "distro.lock"
+
+// Lock records the assets pulled for an architecture of a distro.
+type Lock struct {
+	KernelVersion string `json:"kernel_version"`
+	// Kernel and Initrd are the file names of the kernel and initrd, in the
+	// directory of the assets.
+	Kernel   string    `json:"kernel"`
+	Initrd   string    `json:"initrd"`
+	Qcow2URL string    `json:"qcow2_url,omitempty"`
+	PulledAt time.Time `json:"pulled_at"`
+	// Retained are the file names of the kernels and initrds of the previous
+	// pulls, kept for the VMs that still boot them.
+	Retained []string `json:"retained,omitempty"`
+}
+
+// ReadLock reads the lock file of the assets in distroPath. The error
+// satisfies os.IsNotExist if the assets were never pulled, or pulled before
+// lock files.
+func ReadLock(distroPath string) (*Lock, error) {
+	data, err := os.ReadFile(filepath.Join(distroPath, LockFile))
+	if err != nil {
+		return nil, err
+	}
+	var lock Lock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", LockFile, err)
+	}
+	return &lock, nil
+}
+
+// WriteLock writes the lock file of the assets in distroPath.
+func WriteLock(distroPath string, lock *Lock) error {
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(distroPath, LockFile+".tmp")
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", LockFile, err)
+	}
+	return os.Rename(tmp, filepath.Join(distroPath, LockFile))
+}
+
+// PruneKernels removes the kernels and initrds retained in distroPath from
+// previous pulls that no VM boots anymore, inUse being the file names of the
+// kernels and initrds of the VMs created from the assets.
+func PruneKernels(distroPath string, inUse map[string]bool) error {
+	lock, err := ReadLock(distroPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var retained []string
+	for _, name := range lock.Retained {
+		if inUse[name] {
+			retained = append(retained, name)
+			continue
+		}
+		if err := os.Remove(filepath.Join(distroPath, filepath.Base(name))); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+	}
+	if len(retained) == len(lock.Retained) {
+		return nil
+	}
+	lock.Retained = retained
+	return WriteLock(distroPath, lock)
+}
+
+// Assets returns the file names of the kernel and initrd pulled in
+// distroPath, from its lock file or, for the assets pulled before lock files,
+// from the kernel_path and initrd_path of distros.yaml.
+var Assets = func(distroPath string, distroInfo *config.ArchInfo) (string, string, error) {
+	lock, err := ReadLock(distroPath)
+	switch {
+	case err == nil:
+		return lock.Kernel, lock.Initrd, nil
+	case !os.IsNotExist(err):
+		return "", "", err
+	case distroInfo.KernelPath != "" && distroInfo.InitrdPath != "":
+		return filepath.Base(distroInfo.KernelPath), filepath.Base(distroInfo.InitrdPath), nil
+	}
+	return "", "", fmt.Errorf("no kernel pulled in %s", distroPath)
+}
@@ -0,0 +1,100 @@
+package distro
+
+import (
+	"os"
+	"path/filepath"
+	"pvmlab/internal/config"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	distroPath := t.TempDir()
+	if _, err := ReadLock(distroPath); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error without lock file, got %v", err)
+	}
+
+	lock := &Lock{
+		KernelVersion: "6.8.0-87-generic",
+		Kernel:        "vmlinuz-6.8.0-87-generic",
+		Initrd:        "initrd.img-6.8.0-87-generic",
+		Qcow2URL:      "https://example.com/image.img",
+		PulledAt:      time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		Retained:      []string{"vmlinuz-6.8.0-86-generic", "initrd.img-6.8.0-86-generic"},
+	}
+	if err := WriteLock(distroPath, lock); err != nil {
+		t.Fatalf("WriteLock() failed: %v", err)
+	}
+	got, err := ReadLock(distroPath)
+	if err != nil {
+		t.Fatalf("ReadLock() failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, lock) {
+		t.Errorf("expected %+v, got %+v", lock, got)
+	}
+
+	if err := os.WriteFile(filepath.Join(distroPath, LockFile), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadLock(distroPath); err == nil || os.IsNotExist(err) {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+}
+
+func TestPruneKernels(t *testing.T) {
+	if err := PruneKernels(t.TempDir(), nil); err != nil {
+		t.Errorf("expected no error without lock file, got %v", err)
+	}
+
+	distroPath := t.TempDir()
+	names := []string{
+		"vmlinuz-6.8.0-90-generic", "initrd.img-6.8.0-90-generic",
+		"vmlinuz-6.8.0-87-generic", "initrd.img-6.8.0-87-generic",
+		"vmlinuz-6.8.0-86-generic", "initrd.img-6.8.0-86-generic",
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(distroPath, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := WriteLock(distroPath, &Lock{Kernel: names[0], Initrd: names[1], Retained: names[2:]}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the retained kernels no VM boots are removed, never the locked one.
+	if err := PruneKernels(distroPath, map[string]bool{names[2]: true, names[3]: true}); err != nil {
+		t.Fatalf("PruneKernels() failed: %v", err)
+	}
+	for i, name := range names {
+		if _, err := os.Stat(filepath.Join(distroPath, name)); (err == nil) != (i < 4) {
+			t.Errorf("expected %s to exist: %v", name, i < 4)
+		}
+	}
+	lock, err := ReadLock(distroPath)
+	if err != nil || !reflect.DeepEqual(lock.Retained, names[2:4]) {
+		t.Errorf("expected %v to be retained, got %+v, %v", names[2:4], lock, err)
+	}
+}
+
+func TestAssets(t *testing.T) {
+	pinned := &config.ArchInfo{KernelPath: "./boot/vmlinuz-6.8.0-87-generic", InitrdPath: "./boot/initrd.img-6.8.0-87-generic"}
+
+	// Assets pulled before lock files.
+	kernel, initrd, err := Assets(t.TempDir(), pinned)
+	if err != nil || kernel != "vmlinuz-6.8.0-87-generic" || initrd != "initrd.img-6.8.0-87-generic" {
+		t.Errorf("expected the names of distros.yaml, got %q, %q, %v", kernel, initrd, err)
+	}
+	if _, _, err := Assets(t.TempDir(), &config.ArchInfo{}); err == nil {
+		t.Error("expected an error without lock file nor pinned kernel")
+	}
+
+	distroPath := t.TempDir()
+	if err := WriteLock(distroPath, &Lock{Kernel: "vmlinuz-6.8.0-90-generic", Initrd: "initrd.img-6.8.0-90-generic"}); err != nil {
+		t.Fatal(err)
+	}
+	kernel, initrd, err = Assets(distroPath, pinned)
+	if err != nil || kernel != "vmlinuz-6.8.0-90-generic" || initrd != "initrd.img-6.8.0-90-generic" {
+		t.Errorf("expected the names of the lock file, got %q, %q, %v", kernel, initrd, err)
+	}
+}
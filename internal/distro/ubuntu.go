@@ -9,7 +9,6 @@ import (
 	"path/filepath"
 
 	"pvmlab/internal/config"
-	"pvmlab/internal/downloader"
 
 	"github.com/fatih/color"
 )
@@ -27,49 +26,19 @@ func fileExists(path string) bool {
 }
 
 func (e *UbuntuExtractor) ExtractKernelAndInitrd(ctx context.Context, cfg *config.Config, distroInfo *config.ArchInfo, distroPath string) error {
-	color.Cyan("i Extracting PXE boot assets from rootfs...")
-
-	rootfsPath := filepath.Join(distroPath, "rootfs.tar.gz")
-	if _, err := os.Stat(rootfsPath); os.IsNotExist(err) {
-		return fmt.Errorf("rootfs.tar.gz not found at %s", rootfsPath)
-	}
-
-	// --- Extract Kernel and Initrd ---
-	extractDir, err := os.MkdirTemp(distroPath, "extract-")
-	if err != nil {
-		return fmt.Errorf("failed to create temporary extraction directory: %w", err)
-	}
-	defer os.RemoveAll(extractDir)
-
-	cmd := exec.CommandContext(ctx, "tar", "-xzf", rootfsPath, "-C", extractDir, distroInfo.KernelPath, distroInfo.InitrdPath)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		if ctx.Err() == context.Canceled {
-			color.Yellow("\nOperation cancelled by user.")
-			return nil
-		}
-		color.Red("! Failed to extract from rootfs.tar.gz. Output:\n%s", string(output))
-		return fmt.Errorf("failed to extract kernel and initrd from rootfs: %w", err)
-	}
-
-	// Move kernel
-	finalVmlinuz := filepath.Join(distroPath, filepath.Base(distroInfo.KernelPath))
-	if err := os.Rename(filepath.Join(extractDir, distroInfo.KernelPath), finalVmlinuz); err != nil {
-		return fmt.Errorf("failed to move vmlinuz: %w", err)
-	}
-	if err := os.Chmod(finalVmlinuz, 0644); err != nil {
-		return fmt.Errorf("failed to set permissions on vmlinuz: %w", err)
+	if err := extractKernelAndInitrd(ctx, distroInfo, distroPath); err != nil {
+		return err
 	}
+	return e.CreateModules(ctx, distroPath)
+}
 
-	// Move initrd
-	finalInitrd := filepath.Join(distroPath, filepath.Base(distroInfo.InitrdPath))
-	if err := os.Rename(filepath.Join(extractDir, distroInfo.InitrdPath), finalInitrd); err != nil {
-		return fmt.Errorf("failed to move initrd.img: %w", err)
-	}
-	if err := os.Chmod(finalInitrd, 0644); err != nil {
-		return fmt.Errorf("failed to set permissions on initrd.img: %w", err)
-	}
+func (e *UbuntuExtractor) CreateModules(ctx context.Context, distroPath string) error {
+	return createModulesCpio(ctx, filepath.Join(distroPath, "rootfs.tar.gz"), distroPath)
+}
 
-	// --- Create modules.cpio.gz ---
+// createModulesCpio creates modules.cpio.gz in distroPath from the kernel
+// modules of a rootfs with a merged /usr, for the installer's initrd.
+func createModulesCpio(ctx context.Context, rootfsPath, distroPath string) error {
 	color.Cyan("i Creating modules.cpio.gz from rootfs...")
 	modulesDir, err := os.MkdirTemp(distroPath, "modules-")
 	if err != nil {
@@ -125,14 +94,10 @@ func (e *UbuntuExtractor) ExtractKernelAndInitrd(ctx context.Context, cfg *confi
 }
 
 func (e *UbuntuExtractor) CreateRootfs(ctx context.Context, distroInfo *config.ArchInfo, distroName, distroPath string) error {
-	// Step 1: Download the qcow2 image
 	qcow2Name := filepath.Base(distroInfo.Qcow2URL)
 	qcow2Path := filepath.Join(distroPath, qcow2Name)
-	if err := downloader.DownloadImageIfNotExists(ctx, qcow2Path, distroInfo.Qcow2URL); err != nil {
-		return err
-	}
 
-	// Step 2: Create a temporary script file from the embedded script in distroPath
+	// Step 1: Create a temporary script file from the embedded script in distroPath
 	tmpfile, err := os.CreateTemp(distroPath, "create-rootfs-*.sh")
 	if err != nil {
 		return fmt.Errorf("failed to create temporary script file in %s: %w", distroPath, err)
@@ -149,7 +114,7 @@ func (e *UbuntuExtractor) CreateRootfs(ctx context.Context, distroInfo *config.A
 		return fmt.Errorf("failed to make temporary script executable: %w", err)
 	}
 
-	// Step 3: Run the script to create the rootfs tarball
+	// Step 2: Run the script to create the rootfs tarball
 	// On Linux, run natively. On other platforms (macOS), use Docker.
 	var cmd *exec.Cmd
 
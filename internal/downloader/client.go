@@ -0,0 +1,223 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"pvmlab/internal/config"
+
+	"github.com/cheggaaa/pb/v3"
+	"github.com/fatih/color"
+)
+
+// Download tuning, variables so that tests can shorten them.
+var (
+	// attempts is the number of times each URL is tried.
+	attempts = 5
+	// retryDelay is the delay before the first retry, doubled after each
+	// failed attempt up to maxRetryDelay.
+	retryDelay    = time.Second
+	maxRetryDelay = 30 * time.Second
+	// stallTimeout aborts, and retries, a download that receives no data for
+	// that long.
+	stallTimeout = time.Minute
+)
+
+// client is the HTTP client of the downloads. It uses the proxy set by the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables, and times out
+// connections that don't respond; the body of a response is covered by
+// stallTimeout instead, as images take long to download.
+var client = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConnsPerHost:   8,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   30 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+	},
+}
+
+// permanentError is an error that retrying won't fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func isPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
+
+// statusError returns the error of an unexpected HTTP response. Client
+// errors, such as 404 Not Found, are permanent, except for timeouts and rate
+// limiting.
+func statusError(url string, resp *http.Response) error {
+	err := fmt.Errorf("failed to download file from %s: %s", url, resp.Status)
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err}
+	}
+	return err
+}
+
+// withRetries calls try with url and then with its mirrors, as listed in
+// distros.yaml, until one succeeds. The URLs are retried with an exponential
+// backoff, except those that failed with a permanent error.
+func withRetries(ctx context.Context, url string, try func(url string) error) error {
+	urls := append([]string{url}, config.MirrorURLs(url)...)
+	failed := map[string]bool{}
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		var lastErr error
+		for _, u := range urls {
+			if failed[u] {
+				continue
+			}
+			err := try(u)
+			if err == nil {
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if isPermanent(err) {
+				failed[u] = true
+			}
+			if lastErr != nil {
+				color.Yellow("! %v", lastErr)
+			}
+			lastErr = err
+		}
+		if len(failed) == len(urls) || attempt == attempts {
+			return lastErr
+		}
+		color.Yellow("! %v", lastErr)
+		color.Yellow("! Retrying in %s (attempt %d/%d)...", delay, attempt+1, attempts)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// span is a byte range of a download, from its current position to end
+// (inclusive), or to the end of the file if end is negative. pos advances as
+// the bytes are written so that a failed download resumes where it stopped.
+type span struct {
+	pos atomic.Int64
+	end int64
+}
+
+// getSpan downloads the bytes of s from url and writes them to w at their
+// offset. If the server ignores the range of a span to the end of the file,
+// the whole file is downloaded again from the start.
+func getSpan(ctx context.Context, url string, w io.WriterAt, s *span, bar *pb.ProgressBar) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return &permanentError{err}
+	}
+	pos := s.pos.Load()
+	if pos > 0 || s.end >= 0 {
+		rangeHeader := fmt.Sprintf("bytes=%d-", pos)
+		if s.end >= 0 {
+			rangeHeader += strconv.FormatInt(s.end, 10)
+		}
+		req.Header.Set("Range", rangeHeader)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+	case resp.StatusCode == http.StatusOK && s.end < 0:
+		bar.Add64(-pos)
+		pos = 0
+		s.pos.Store(0)
+	case resp.StatusCode == http.StatusOK:
+		return &permanentError{fmt.Errorf("%s doesn't support range requests", url)}
+	default:
+		return statusError(url, resp)
+	}
+
+	var stalled atomic.Bool
+	timer := time.AfterFunc(stallTimeout, func() {
+		stalled.Store(true)
+		cancel()
+	})
+	defer timer.Stop()
+
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			timer.Reset(stallTimeout)
+			if _, err := w.WriteAt(buf[:n], pos); err != nil {
+				return &permanentError{err}
+			}
+			pos += int64(n)
+			s.pos.Store(pos)
+			bar.Add(n)
+		}
+		switch {
+		case errors.Is(err, io.EOF):
+			if s.end >= 0 && pos <= s.end {
+				return fmt.Errorf("failed to download file from %s: %w", url, io.ErrUnexpectedEOF)
+			}
+			return nil
+		case stalled.Load():
+			return fmt.Errorf("download from %s stalled: no data received for %s", url, stallTimeout)
+		case err != nil:
+			return fmt.Errorf("failed to download file from %s: %w", url, err)
+		}
+	}
+}
+
+// remoteInfo is what a HEAD request tells about a remote file.
+type remoteInfo struct {
+	// size is the size of the file, or -1 if unknown.
+	size int64
+	// ranges tells whether the server supports range requests.
+	ranges bool
+}
+
+func head(ctx context.Context, url string) (remoteInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+	if err != nil {
+		return remoteInfo{}, &permanentError{fmt.Errorf("failed to create HEAD request: %w", err)}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return remoteInfo{}, fmt.Errorf("failed to get remote file headers: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return remoteInfo{}, statusError(url, resp)
+	}
+	return remoteInfo{
+		size:   resp.ContentLength,
+		ranges: resp.Header.Get("Accept-Ranges") == "bytes",
+	}, nil
+}
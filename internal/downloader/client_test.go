@@ -0,0 +1,139 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pvmlab/internal/config"
+)
+
+// fastRetries shortens the retry delays for the duration of a test.
+func fastRetries(t *testing.T) {
+	t.Helper()
+	originalDelay, originalStall := retryDelay, stallTimeout
+	retryDelay, stallTimeout = time.Millisecond, 200*time.Millisecond
+	t.Cleanup(func() { retryDelay, stallTimeout = originalDelay, originalStall })
+}
+
+func TestDownloadFile_Resume(t *testing.T) {
+	fastRetries(t)
+	content := strings.Repeat("0123456789", 1000)
+	var requests atomic.Int32
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if requests.Add(1) == 1 {
+			// Fail in the middle of the body.
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write([]byte(content[:4000]))
+			return
+		}
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "file")
+	if err := DownloadFile(context.Background(), path, server.URL, "", int64(len(content)), 0); err != nil {
+		t.Fatalf("DownloadFile() returned an error: %v", err)
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != content {
+		t.Errorf("unexpected content of %d bytes, %v", len(got), err)
+	}
+	if len(ranges) != 2 || ranges[1] != "bytes=4000-" {
+		t.Errorf("expected the download to resume from byte 4000, got ranges %q", ranges)
+	}
+}
+
+func TestDownloadFile_Stall(t *testing.T) {
+	fastRetries(t)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Content-Length", "12")
+			w.Write([]byte("test"))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader("test content"))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "file")
+	if err := DownloadFile(context.Background(), path, server.URL, "", 12, 0); err != nil {
+		t.Fatalf("DownloadFile() returned an error: %v", err)
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != "test content" {
+		t.Errorf("unexpected content %q, %v", got, err)
+	}
+}
+
+func TestDownloadFile_Mirrors(t *testing.T) {
+	fastRetries(t)
+	var primaryRequests atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryRequests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/pub/linux/image.qcow2" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("test content"))
+	}))
+	defer mirror.Close()
+
+	originalDistros := config.Distros
+	defer func() { config.Distros = originalDistros }()
+	config.Distros = map[string]config.Distro{
+		"test": {Mirrors: []string{primary.URL + "/linux/", mirror.URL + "/pub/linux/"}},
+	}
+
+	path := filepath.Join(t.TempDir(), "image.qcow2")
+	if err := DownloadFile(context.Background(), path, primary.URL+"/linux/image.qcow2", "", 0, 0); err != nil {
+		t.Fatalf("DownloadFile() returned an error: %v", err)
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != "test content" {
+		t.Errorf("unexpected content %q, %v", got, err)
+	}
+	if primaryRequests.Load() != 1 {
+		t.Errorf("expected the primary to be tried once, got %d requests", primaryRequests.Load())
+	}
+
+	// Without mirrors, the failing server is retried.
+	config.Distros = nil
+	if err := DownloadFile(context.Background(), path, primary.URL+"/linux/image.qcow2", "", 0, 0); err == nil {
+		t.Error("expected an error")
+	}
+	if got := primaryRequests.Load(); got != 1+int32(attempts) {
+		t.Errorf("expected %d attempts, got %d", attempts, got-1)
+	}
+}
+
+func TestDownloadFile_ServerErrorNotRetried(t *testing.T) {
+	fastRetries(t)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "file")
+	if err := DownloadFile(context.Background(), path, server.URL, "", 0, 0); err == nil {
+		t.Fatal("expected an error")
+	}
+	if requests.Load() != 1 {
+		t.Errorf("expected a single request, got %d", requests.Load())
+	}
+}
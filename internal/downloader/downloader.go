@@ -3,8 +3,6 @@ package downloader
 import (
 	"context"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"path/filepath"
 
@@ -13,23 +11,16 @@ import (
 )
 
 // DownloadFile downloads a file from a URL to a local path, with support for Range headers and a progress bar.
+// Failed downloads are retried with an exponential backoff, resuming from the
+// last byte received, and fall back to the mirrors of the URL.
 func DownloadFile(ctx context.Context, path string, url string, rangeHeader string, totalSize int64, initialSize int64) error {
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return err
-	}
+	s := &span{end: -1}
 	if rangeHeader != "" {
-		req.Header.Add("Range", rangeHeader)
-	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
-		return fmt.Errorf("failed to download file from %s: %s", url, resp.Status)
+		var start int64
+		if _, err := fmt.Sscanf(rangeHeader, "bytes=%d-", &start); err != nil {
+			return fmt.Errorf("unsupported range %q: %w", rangeHeader, err)
+		}
+		s.pos.Store(start)
 	}
 
 	// Ensure the destination directory exists.
@@ -39,9 +30,7 @@ func DownloadFile(ctx context.Context, path string, url string, rangeHeader stri
 	}
 
 	openFlags := os.O_CREATE | os.O_WRONLY
-	if rangeHeader != "" {
-		openFlags |= os.O_APPEND
-	} else {
+	if rangeHeader == "" {
 		openFlags |= os.O_TRUNC
 	}
 
@@ -51,23 +40,37 @@ func DownloadFile(ctx context.Context, path string, url string, rangeHeader stri
 	}
 	defer out.Close()
 
-	bar := pb.New64(totalSize)
-	bar.SetCurrent(initialSize)
+	bar := newBar(totalSize, initialSize)
+	bar.Start()
+	err = withRetries(ctx, url, func(url string) error {
+		return getSpan(ctx, url, out, s, bar)
+	})
+	bar.Finish()
+	if err != nil {
+		return err
+	}
+
+	// The server may have sent the whole file instead of the requested range.
+	return out.Truncate(s.pos.Load())
+}
+
+func newBar(total, current int64) *pb.ProgressBar {
+	bar := pb.New64(total)
+	bar.SetCurrent(current)
 	bar.Set(pb.Bytes, true)
 	bar.SetTemplateString(`{{counters . }} {{bar . }} {{percent . }} {{rtime . }} {{speed . }}`)
 	bar.SetWidth(80)
-	bar.Start()
-
-	barReader := bar.NewProxyReader(resp.Body)
-	defer barReader.Close()
+	return bar
+}
 
-	if _, err = io.Copy(out, barReader); err != nil {
-		bar.Finish()
-		return err
+// RemoteSize returns the size of a remote file, or -1 if the server doesn't
+// tell it.
+func RemoteSize(ctx context.Context, url string) (int64, error) {
+	remote, err := head(ctx, url)
+	if err != nil {
+		return 0, err
 	}
-
-	bar.Finish()
-	return nil
+	return remote.size, nil
 }
 
 // DownloadImageIfNotExists checks if an image exists and downloads it if it doesn't,
@@ -75,17 +78,21 @@ func DownloadFile(ctx context.Context, path string, url string, rangeHeader stri
 var DownloadImageIfNotExists = func(ctx context.Context, imagePath, imageUrl string) error {
 	color.Cyan("i Checking for distro image at %s...", imageUrl)
 
-	// Get remote file size
-	req, err := http.NewRequestWithContext(ctx, "HEAD", imageUrl, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create HEAD request: %w", err)
-	}
-	resp, err := http.DefaultClient.Do(req)
+	var remote remoteInfo
+	err := withRetries(ctx, imageUrl, func(url string) error {
+		var err error
+		remote, err = head(ctx, url)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to get remote file headers: %w", err)
+		if !isPermanent(err) {
+			return err
+		}
+		// Some servers don't implement HEAD: let the download fail if the
+		// image doesn't exist.
+		remote = remoteInfo{size: -1}
 	}
-	remoteSize := resp.ContentLength
-	resp.Body.Close()
+	remoteSize := remote.size
 
 	localFileInfo, err := os.Stat(imagePath)
 	if err == nil {
@@ -108,6 +115,15 @@ var DownloadImageIfNotExists = func(ctx context.Context, imagePath, imageUrl str
 		// Local file is larger or remote size is unknown, re-download
 	}
 
+	if remote.ranges && remoteSize >= parallelThreshold {
+		color.Cyan("i Downloading distro image from %s with %d connections...", imageUrl, connections)
+		if err := downloadParallel(ctx, imagePath, imageUrl, remoteSize); err != nil {
+			return err
+		}
+		color.Green("✔ Download complete.")
+		return nil
+	}
+
 	// File does not exist or needs re-downloading
 	color.Cyan("i Downloading distro image from %s...", imageUrl)
 	if err := DownloadFile(ctx, imagePath, imageUrl, "", remoteSize, 0); err != nil {
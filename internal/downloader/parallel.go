@@ -0,0 +1,190 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fatih/color"
+)
+
+var (
+	// parallelThreshold is the size from which the images of servers that
+	// support range requests are downloaded in parallel.
+	parallelThreshold int64 = 64 << 20
+	// connections is the number of parts downloaded at once.
+	connections = 4
+)
+
+// part is a part of a parallel download.
+type part struct {
+	start int64
+	span
+}
+
+// partState is saved next to a parallel download in progress so that it
+// resumes where it stopped.
+type partState struct {
+	URL   string      `json:"url"`
+	Size  int64       `json:"size"`
+	Parts []partRange `json:"parts"`
+}
+
+type partRange struct {
+	Start int64 `json:"start"`
+	Pos   int64 `json:"pos"`
+	End   int64 `json:"end"`
+}
+
+// downloadParallel downloads url, of the given size, to path in parts, each
+// with its own ranged requests. The download is written to path.part and
+// renamed to path once complete.
+func downloadParallel(ctx context.Context, path, url string, size int64) error {
+	partPath, statePath := path+".part", path+".part.json"
+	parts := resumeParts(partPath, statePath, url, size)
+	if parts == nil {
+		parts = splitParts(size, connections)
+		if err := os.Remove(partPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		color.Cyan("i Resuming the download of %s...", filepath.Base(path))
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	f, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var mu sync.Mutex
+	save := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return saveParts(statePath, url, size, parts)
+	}
+	if err := save(); err != nil {
+		return fmt.Errorf("failed to save the download state: %w", err)
+	}
+
+	var done int64
+	for _, p := range parts {
+		done += p.pos.Load() - p.start
+	}
+	bar := newBar(size, done)
+	bar.Start()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make([]error, len(parts))
+	for i, p := range parts {
+		if p.pos.Load() > p.end {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = withRetries(ctx, url, func(url string) error {
+				err := getSpan(ctx, url, f, &p.span, bar)
+				// The progress is saved after each attempt: a failure to save
+				// it only prevents resuming.
+				_ = save()
+				return err
+			})
+			if errs[i] != nil {
+				// The download is failing: stop the other parts.
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	bar.Finish()
+	if err := firstError(errs); err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(partPath, path); err != nil {
+		return err
+	}
+	return os.Remove(statePath)
+}
+
+// splitParts splits a download of size bytes into n parts.
+func splitParts(size int64, n int) []*part {
+	chunk := (size + int64(n) - 1) / int64(n)
+	var parts []*part
+	for start := int64(0); start < size; start += chunk {
+		p := &part{start: start}
+		p.pos.Store(start)
+		p.end = min(start+chunk, size) - 1
+		parts = append(parts, p)
+	}
+	return parts
+}
+
+// resumeParts returns the parts of the download in progress of url, or nil if
+// there is none.
+func resumeParts(partPath, statePath, url string, size int64) []*part {
+	if _, err := os.Stat(partPath); err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return nil
+	}
+	var state partState
+	if err := json.Unmarshal(data, &state); err != nil || state.URL != url || state.Size != size {
+		return nil
+	}
+	var parts []*part
+	for _, r := range state.Parts {
+		if r.Start < 0 || r.Pos < r.Start || r.Pos > r.End+1 || r.End >= size {
+			return nil
+		}
+		p := &part{start: r.Start}
+		p.pos.Store(r.Pos)
+		p.end = r.End
+		parts = append(parts, p)
+	}
+	return parts
+}
+
+func saveParts(statePath, url string, size int64, parts []*part) error {
+	state := partState{URL: url, Size: size}
+	for _, p := range parts {
+		state.Parts = append(state.Parts, partRange{Start: p.start, Pos: p.pos.Load(), End: p.end})
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(statePath, data, 0644)
+}
+
+// firstError returns the error that failed a parallel download, rather than
+// the cancellation of the other parts it caused.
+func firstError(errs []error) error {
+	var canceled error
+	for _, err := range errs {
+		switch {
+		case err == nil:
+		case errors.Is(err, context.Canceled):
+			canceled = err
+		default:
+			return err
+		}
+	}
+	return canceled
+}
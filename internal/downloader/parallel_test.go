@@ -0,0 +1,109 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloadImageIfNotExists_Parallel(t *testing.T) {
+	fastRetries(t)
+	originalThreshold, originalConnections := parallelThreshold, connections
+	parallelThreshold, connections = 1, 3
+	defer func() { parallelThreshold, connections = originalThreshold, originalConnections }()
+
+	content := strings.Repeat("0123456789", 1000)
+	var mu sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			mu.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			mu.Unlock()
+		}
+		http.ServeContent(w, r, "image.qcow2", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	imagePath := filepath.Join(t.TempDir(), "image.qcow2")
+	if err := DownloadImageIfNotExists(context.Background(), imagePath, server.URL); err != nil {
+		t.Fatalf("DownloadImageIfNotExists() returned an error: %v", err)
+	}
+	if got, err := os.ReadFile(imagePath); err != nil || string(got) != content {
+		t.Errorf("unexpected content of %d bytes, %v", len(got), err)
+	}
+	if len(ranges) != 3 {
+		t.Errorf("expected 3 ranged requests, got %q", ranges)
+	}
+	for _, leftover := range []string{imagePath + ".part", imagePath + ".part.json"} {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %v", leftover, err)
+		}
+	}
+}
+
+func TestDownloadParallel_Resume(t *testing.T) {
+	fastRetries(t)
+	content := strings.Repeat("0123456789", 1000)
+	var mu sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+		http.ServeContent(w, r, "image.qcow2", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	// A previous download stopped with the first part complete and 1000
+	// bytes of the second.
+	imagePath := filepath.Join(t.TempDir(), "image.qcow2")
+	parts := splitParts(int64(len(content)), 2)
+	parts[0].pos.Store(parts[0].end + 1)
+	parts[1].pos.Store(parts[1].start + 1000)
+	if err := os.WriteFile(imagePath+".part", []byte(content[:parts[1].start+1000]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveParts(imagePath+".part.json", server.URL, int64(len(content)), parts); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := downloadParallel(context.Background(), imagePath, server.URL, int64(len(content))); err != nil {
+		t.Fatalf("downloadParallel() returned an error: %v", err)
+	}
+	if got, err := os.ReadFile(imagePath); err != nil || string(got) != content {
+		t.Errorf("unexpected content of %d bytes, %v", len(got), err)
+	}
+	if len(ranges) != 1 || ranges[0] != "bytes=6000-9999" {
+		t.Errorf("expected only the rest of the second part to be requested, got %q", ranges)
+	}
+}
+
+func TestDownloadParallel_Failure(t *testing.T) {
+	fastRetries(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Range"), "bytes=0-") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, "image.qcow2", time.Time{}, strings.NewReader("0123456789"))
+	}))
+	defer server.Close()
+
+	imagePath := filepath.Join(t.TempDir(), "image.qcow2")
+	if err := downloadParallel(context.Background(), imagePath, server.URL, 10); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected the error of the failed part, got %v", err)
+	}
+	if _, err := os.Stat(imagePath); !os.IsNotExist(err) {
+		t.Errorf("expected no image, got %v", err)
+	}
+	if parts := resumeParts(imagePath+".part", imagePath+".part.json", server.URL, 10); len(parts) != connections {
+		t.Errorf("expected the download to be resumable, got %d parts", len(parts))
+	}
+}
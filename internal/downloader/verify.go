@@ -0,0 +1,274 @@
+package downloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// maxChecksumsSize caps the size of the checksum, signature and key files.
+const maxChecksumsSize = 16 << 20
+
+// Verification describes how to verify a downloaded image. The zero value
+// verifies nothing.
+type Verification struct {
+	// SHA256 is the expected SHA-256 digest of the image. It takes precedence
+	// over SHA256URL.
+	SHA256 string
+	// SHA256URL is the URL of a checksum file listing the image, such as
+	// Ubuntu's SHA256SUMS or Fedora's CHECKSUM.
+	SHA256URL string
+	// KeyURL is the URL of the armored GPG public key that signed the
+	// checksum file. If set, the checksum file is verified with gpg.
+	KeyURL string
+	// SignatureURL is the URL of the detached signature of the checksum
+	// file. If empty, the checksum file is expected to be clearsigned.
+	SignatureURL string
+}
+
+// DownloadVerifiedImage downloads an image like DownloadImageIfNotExists and
+// verifies it. An image that doesn't match its checksum, e.g. truncated or
+// replaced upstream since it was downloaded, is downloaded again from
+// scratch, and removed if it still doesn't match.
+var DownloadVerifiedImage = func(ctx context.Context, imagePath, imageUrl string, v Verification) error {
+	expected, err := v.ExpectedSHA256(ctx, path.Base(imageUrl))
+	if err != nil {
+		return err
+	}
+
+	if err := DownloadImageIfNotExists(ctx, imagePath, imageUrl); err != nil {
+		return err
+	}
+	if expected == "" {
+		return nil
+	}
+
+	color.Cyan("i Verifying the SHA-256 checksum of %s...", filepath.Base(imagePath))
+	if err := verifySHA256(imagePath, expected); err != nil {
+		color.Yellow("! %v, downloading it again.", err)
+		if err := os.Remove(imagePath); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", imagePath, err)
+		}
+		if err := DownloadImageIfNotExists(ctx, imagePath, imageUrl); err != nil {
+			return err
+		}
+		if err := verifySHA256(imagePath, expected); err != nil {
+			os.Remove(imagePath)
+			return fmt.Errorf("%w, refusing to use it", err)
+		}
+	}
+	color.Green("✔ Checksum verified.")
+	return nil
+}
+
+// ExpectedSHA256 returns the expected SHA-256 digest of the image named name,
+// or an empty string if v doesn't set any.
+func (v Verification) ExpectedSHA256(ctx context.Context, name string) (string, error) {
+	if v.SHA256 != "" {
+		return normalizeSHA256(v.SHA256)
+	}
+	if v.SHA256URL == "" {
+		return "", nil
+	}
+
+	sums, err := fetch(ctx, v.SHA256URL)
+	if err != nil {
+		return "", err
+	}
+	if v.KeyURL != "" {
+		if sums, err = v.verifySignature(ctx, sums); err != nil {
+			return "", err
+		}
+	}
+
+	digest, err := parseSHA256Sums(sums, name)
+	if err != nil {
+		return "", fmt.Errorf("%w in %s", err, v.SHA256URL)
+	}
+	return digest, nil
+}
+
+// verifySignature verifies the signature of the checksum file sums with gpg,
+// in a keyring of its own, and returns the signed content. The signature is
+// skipped with a warning if gpg is not installed.
+func (v Verification) verifySignature(ctx context.Context, sums []byte) ([]byte, error) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		color.Yellow("! gpg is not installed, skipping the signature verification of %s.", v.SHA256URL)
+		return sums, nil
+	}
+
+	homeDir, err := os.MkdirTemp("", "pvmlab-gpg-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary gpg home: %w", err)
+	}
+	defer os.RemoveAll(homeDir)
+
+	gpg := func(args ...string) error {
+		cmd := exec.CommandContext(ctx, "gpg", append([]string{"--homedir", homeDir, "--batch", "--quiet"}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+
+	files := map[string]string{v.KeyURL: "key.asc", v.SHA256URL: "sums"}
+	if v.SignatureURL != "" {
+		files[v.SignatureURL] = "sums.sig"
+	}
+	for url, name := range files {
+		data := sums
+		if url != v.SHA256URL {
+			if data, err = fetch(ctx, url); err != nil {
+				return nil, err
+			}
+		}
+		if err := os.WriteFile(filepath.Join(homeDir, name), data, 0600); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := gpg("--import", filepath.Join(homeDir, "key.asc")); err != nil {
+		return nil, fmt.Errorf("failed to import the GPG key %s: %w", v.KeyURL, err)
+	}
+	if v.SignatureURL != "" {
+		if err := gpg("--verify", filepath.Join(homeDir, "sums.sig"), filepath.Join(homeDir, "sums")); err != nil {
+			return nil, fmt.Errorf("bad signature of %s: %w", v.SHA256URL, err)
+		}
+		color.Green("✔ Signature of %s verified.", path.Base(v.SHA256URL))
+		return sums, nil
+	}
+
+	// Only keep the signed content of a clearsigned file.
+	signed := filepath.Join(homeDir, "sums.signed")
+	if err := gpg("--output", signed, "--verify", filepath.Join(homeDir, "sums")); err != nil {
+		return nil, fmt.Errorf("bad signature of %s: %w", v.SHA256URL, err)
+	}
+	color.Green("✔ Signature of %s verified.", path.Base(v.SHA256URL))
+	return os.ReadFile(signed)
+}
+
+// parseSHA256Sums returns the SHA-256 digest of name in a checksum file, in
+// the GNU format of Ubuntu's SHA256SUMS ("<digest> *<name>") or the BSD format
+// of Fedora's CHECKSUM ("SHA256 (<name>) = <digest>").
+func parseSHA256Sums(data []byte, name string) (string, error) {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if rest, ok := strings.CutPrefix(line, "SHA256 ("); ok {
+			if file, digest, ok := strings.Cut(rest, ") = "); ok && file == name {
+				return normalizeSHA256(digest)
+			}
+			continue
+		}
+		if fields := strings.Fields(line); len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return normalizeSHA256(fields[0])
+		}
+	}
+	return "", fmt.Errorf("no SHA-256 checksum for %s", name)
+}
+
+func normalizeSHA256(digest string) (string, error) {
+	digest = strings.ToLower(strings.TrimSpace(digest))
+	if b, err := hex.DecodeString(digest); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid SHA-256 checksum %q", digest)
+	}
+	return digest, nil
+}
+
+// FileSHA256 returns the hex-encoded SHA-256 digest of a file.
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func verifySHA256(path, expected string) error {
+	digest, err := FileSHA256(path)
+	if err != nil {
+		return err
+	}
+	if digest != expected {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", filepath.Base(path), expected, digest)
+	}
+	return nil
+}
+
+// fetch returns the content of a small file, such as a checksum file. It is
+// retried, and fetched from the mirrors of its URL, like the images.
+func fetch(ctx context.Context, url string) ([]byte, error) {
+	var data []byte
+	err := withRetries(ctx, url, func(url string) error {
+		var err error
+		data, err = fetchOnce(ctx, url)
+		return err
+	})
+	return data, err
+}
+
+// fetchOnce gets the content of a small file from url, aborting if no data is
+// received for stallTimeout.
+func fetchOnce(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, &permanentError{err}
+	}
+	var stalled atomic.Bool
+	timer := time.AfterFunc(stallTimeout, func() {
+		stalled.Store(true)
+		cancel()
+	})
+	defer timer.Stop()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if stalled.Load() {
+			return nil, fmt.Errorf("download from %s stalled: no data received for %s", url, stallTimeout)
+		}
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(url, resp)
+	}
+
+	var data []byte
+	body := io.LimitReader(resp.Body, maxChecksumsSize)
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			timer.Reset(stallTimeout)
+			data = append(data, buf[:n]...)
+		}
+		switch {
+		case errors.Is(err, io.EOF):
+			return data, nil
+		case stalled.Load():
+			return nil, fmt.Errorf("download from %s stalled: no data received for %s", url, stallTimeout)
+		case err != nil:
+			return nil, fmt.Errorf("failed to download %s: %w", url, err)
+		}
+	}
+}
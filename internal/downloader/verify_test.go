@@ -0,0 +1,229 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pvmlab/internal/config"
+)
+
+func TestParseSHA256Sums(t *testing.T) {
+	digest := strings.Repeat("ab", 32)
+	tests := []struct {
+		name     string
+		sums     string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "gnu binary",
+			sums:     strings.Repeat("cd", 32) + " *noble-server-cloudimg-arm64.img\n" + digest + " *noble-server-cloudimg-amd64.img\n",
+			expected: digest,
+		},
+		{
+			name:     "gnu text",
+			sums:     digest + "  noble-server-cloudimg-amd64.img\n",
+			expected: digest,
+		},
+		{
+			name:     "bsd",
+			sums:     "# noble-server-cloudimg-amd64.img: 1234 bytes\nSHA256 (noble-server-cloudimg-amd64.img) = " + strings.ToUpper(digest) + "\n",
+			expected: digest,
+		},
+		{
+			name:    "missing",
+			sums:    digest + " *noble-server-cloudimg-arm64.img\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid digest",
+			sums:    "abc *noble-server-cloudimg-amd64.img\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSHA256Sums([]byte(tt.sums), "noble-server-cloudimg-amd64.img")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSHA256Sums() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// imageServer serves image.qcow2 with the content of *image, and SHA256SUMS
+// with the checksum of *listed.
+func imageServer(t *testing.T, image, listed *string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image.qcow2":
+			http.ServeContent(w, r, "image.qcow2", time.Time{}, strings.NewReader(*image))
+		case "/SHA256SUMS":
+			sum := sha256.Sum256([]byte(*listed))
+			fmt.Fprintf(w, "%s *image.qcow2\n", hex.EncodeToString(sum[:]))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetch(t *testing.T) {
+	fastRetries(t)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/stalled/SHA256SUMS":
+			if requests.Load() == 1 {
+				w.Write([]byte("partial"))
+				w.(http.Flusher).Flush()
+				<-r.Context().Done()
+				return
+			}
+			w.Write([]byte("sums"))
+		case "/unavailable/SHA256SUMS":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/mirror/SHA256SUMS":
+			w.Write([]byte("mirrored sums"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	// A stalled download is retried.
+	if data, err := fetch(context.Background(), server.URL+"/stalled/SHA256SUMS"); err != nil || string(data) != "sums" {
+		t.Errorf("expected the retried content, got %q, %v", data, err)
+	}
+
+	// A file missing upstream is not retried.
+	requests.Store(0)
+	if _, err := fetch(context.Background(), server.URL+"/missing/SHA256SUMS"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+	if requests.Load() != 1 {
+		t.Errorf("expected a single request for a missing file, got %d", requests.Load())
+	}
+
+	// An unavailable server falls back to its mirrors.
+	originalDistros := config.Distros
+	defer func() { config.Distros = originalDistros }()
+	config.Distros = map[string]config.Distro{
+		"test": {Mirrors: []string{server.URL + "/unavailable/", server.URL + "/mirror/"}},
+	}
+	if data, err := fetch(context.Background(), server.URL+"/unavailable/SHA256SUMS"); err != nil || string(data) != "mirrored sums" {
+		t.Errorf("expected the content of the mirror, got %q, %v", data, err)
+	}
+}
+
+func TestDownloadVerifiedImage(t *testing.T) {
+	image, listed := "current image", "current image"
+	server := imageServer(t, &image, &listed)
+	imagePath := filepath.Join(t.TempDir(), "image.qcow2")
+	v := Verification{SHA256URL: server.URL + "/SHA256SUMS"}
+
+	if err := DownloadVerifiedImage(context.Background(), imagePath, server.URL+"/image.qcow2", v); err != nil {
+		t.Fatalf("DownloadVerifiedImage() failed: %v", err)
+	}
+
+	// The image was updated upstream with the same size.
+	image, listed = "updated image", "updated image"
+	if err := DownloadVerifiedImage(context.Background(), imagePath, server.URL+"/image.qcow2", v); err != nil {
+		t.Fatalf("DownloadVerifiedImage() failed: %v", err)
+	}
+	if content, err := os.ReadFile(imagePath); err != nil || string(content) != image {
+		t.Errorf("expected the updated image, got %q, %v", content, err)
+	}
+
+	// The server sends a corrupted image.
+	if err := os.Remove(imagePath); err != nil {
+		t.Fatal(err)
+	}
+	image = "corrupt image"
+	if err := DownloadVerifiedImage(context.Background(), imagePath, server.URL+"/image.qcow2", v); err == nil {
+		t.Fatal("expected an error for a corrupted image")
+	}
+	if _, err := os.Stat(imagePath); !os.IsNotExist(err) {
+		t.Errorf("expected the corrupted image to be removed, got %v", err)
+	}
+
+	// A pinned checksum takes precedence.
+	image = "updated image"
+	v.SHA256 = strings.Repeat("00", 32)
+	if err := DownloadVerifiedImage(context.Background(), imagePath, server.URL+"/image.qcow2", v); err == nil {
+		t.Error("expected an error for a mismatching pinned checksum")
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not installed")
+	}
+	signerHome, err := os.MkdirTemp("", "pvmlab-gpg-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(signerHome)
+	gpg := func(stdin []byte, args ...string) []byte {
+		t.Helper()
+		cmd := exec.Command("gpg", append([]string{"--homedir", signerHome, "--batch", "--quiet", "--passphrase", "", "--pinentry-mode", "loopback"}, args...)...)
+		cmd.Stdin = bytes.NewReader(stdin)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("gpg %v failed: %v", args, err)
+		}
+		return out
+	}
+	gpg(nil, "--quick-gen-key", "pvmlab test <test@example.com>", "ed25519", "sign", "never")
+
+	sums := []byte(strings.Repeat("ab", 32) + " *image.qcow2\n")
+	files := map[string][]byte{
+		"/key.asc":         gpg(nil, "--armor", "--export"),
+		"/SHA256SUMS":      sums,
+		"/SHA256SUMS.gpg":  gpg(sums, "--detach-sign"),
+		"/CHECKSUM":        append([]byte("injected unsigned line\n"), gpg(sums, "--clearsign")...),
+		"/SHA256SUMS.evil": append(sums, "extra line\n"...),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if data, ok := files[r.URL.Path]; ok {
+			w.Write(data)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	detached := Verification{SHA256URL: server.URL + "/SHA256SUMS", KeyURL: server.URL + "/key.asc", SignatureURL: server.URL + "/SHA256SUMS.gpg"}
+	if got, err := detached.verifySignature(context.Background(), sums); err != nil || !bytes.Equal(got, sums) {
+		t.Errorf("expected a good detached signature, got %q, %v", got, err)
+	}
+	if _, err := detached.verifySignature(context.Background(), files["/SHA256SUMS.evil"]); err == nil {
+		t.Error("expected a bad detached signature")
+	}
+
+	clearsigned := Verification{SHA256URL: server.URL + "/CHECKSUM", KeyURL: server.URL + "/key.asc"}
+	if got, err := clearsigned.verifySignature(context.Background(), files["/CHECKSUM"]); err != nil || !bytes.Equal(got, sums) {
+		t.Errorf("expected the signed content of a clearsigned file, got %q, %v", got, err)
+	}
+	if _, err := clearsigned.verifySignature(context.Background(), sums); err == nil {
+		t.Error("expected an error for a file that isn't clearsigned")
+	}
+}
@@ -0,0 +1,77 @@
+// Package installstatus reads the progress of the PXE installer of target
+// VMs. The installer reports each phase to the boot handler running on the
+// provisioner, which persists it in the shared vms directory as
+// install-status/<mac>.json.
+package installstatus
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Installation states.
+const (
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+)
+
+// Status is the last phase reported by the installer of a VM.
+type Status struct {
+	VM          string    `json:"vm"`
+	MAC         string    `json:"mac"`
+	Phase       int       `json:"phase"`
+	TotalPhases int       `json:"total_phases,omitempty"`
+	PhaseName   string    `json:"phase_name"`
+	State       string    `json:"state"`
+	Error       string    `json:"error,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Path returns the path of the status file of the VM with the given MAC
+// address in vmsDir.
+func Path(vmsDir, mac string) string {
+	return filepath.Join(vmsDir, "install-status", strings.ReplaceAll(strings.ToLower(mac), ":", "-")+".json")
+}
+
+// Read returns the installation status of the VM with the given MAC address,
+// or nil if the installer has not reported anything yet.
+var Read = func(vmsDir, mac string) (*Status, error) {
+	data, err := os.ReadFile(Path(vmsDir, mac))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var status Status
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("failed to parse install status: %w", err)
+	}
+	return &status, nil
+}
+
+// Clear removes the installation status of the VM with the given MAC
+// address, so that a new installation is not mistaken for a previous one.
+var Clear = func(vmsDir, mac string) error {
+	if err := os.Remove(Path(vmsDir, mac)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// String describes the status for humans, e.g. "phase 4/7 (Disk Preparation)".
+func (s *Status) String() string {
+	phase := fmt.Sprintf("phase %d", s.Phase)
+	if s.TotalPhases > 0 {
+		phase = fmt.Sprintf("phase %d/%d", s.Phase, s.TotalPhases)
+	}
+	if s.PhaseName != "" {
+		phase += " (" + s.PhaseName + ")"
+	}
+	return phase
+}
@@ -0,0 +1,61 @@
+package installstatus
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadClear(t *testing.T) {
+	vmsDir := t.TempDir()
+	mac := "52:54:00:AB:CD:EF"
+
+	status, err := Read(vmsDir, mac)
+	if err != nil || status != nil {
+		t.Fatalf("expected no status before the installer reports, got %v, %v", status, err)
+	}
+
+	path := Path(vmsDir, mac)
+	if filepath.Base(path) != "52-54-00-ab-cd-ef.json" {
+		t.Errorf("unexpected status file name: %s", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := `{"vm": "target1", "mac": "52:54:00:ab:cd:ef", "phase": 4, "total_phases": 7, "phase_name": "Disk Preparation", "state": "failed", "error": "no disk found"}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err = Read(vmsDir, mac)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status.VM != "target1" || status.State != StateFailed || status.Error != "no disk found" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	if got := status.String(); got != "phase 4/7 (Disk Preparation)" {
+		t.Errorf("unexpected description: %s", got)
+	}
+
+	if err := Clear(vmsDir, mac); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status, _ := Read(vmsDir, mac); status != nil {
+		t.Errorf("expected status to be cleared, got %+v", status)
+	}
+	if err := Clear(vmsDir, mac); err != nil {
+		t.Errorf("expected clearing a missing status to succeed, got %v", err)
+	}
+}
+
+func TestRead_Invalid(t *testing.T) {
+	vmsDir := t.TempDir()
+	path := Path(vmsDir, "52:54:00:00:00:01")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	os.WriteFile(path, []byte("{"), 0644)
+
+	if _, err := Read(vmsDir, "52:54:00:00:00:01"); err == nil {
+		t.Error("expected a parse error")
+	}
+}
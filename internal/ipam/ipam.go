@@ -0,0 +1,339 @@
+package ipam
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"pvmlab/internal/cloudinit"
+	"pvmlab/internal/config"
+	"pvmlab/internal/metadata"
+	"sort"
+)
+
+const (
+	// Auto is the value of the --ip and --ipv6 flags asking for the address
+	// of a VM to be allocated.
+	Auto = "auto"
+
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+
+	// maxScan bounds the number of addresses looked at when allocating from
+	// large subnets, e.g. IPv6 /64s.
+	maxScan = 1 << 16
+)
+
+// Pool is a subnet of the provisioner that the addresses of the target VMs
+// are allocated from.
+type Pool struct {
+	Family string `json:"family"`
+	Subnet string `json:"subnet"`
+	// Gateway is the address of the provisioner in the subnet.
+	Gateway string `json:"gateway"`
+	// DHCPStart and DHCPEnd delimit the dynamic range of the provisioner's
+	// DHCP server, which is never allocated.
+	DHCPStart string `json:"dhcp_start,omitempty"`
+	DHCPEnd   string `json:"dhcp_end,omitempty"`
+
+	network            *net.IPNet
+	gateway            net.IP
+	dhcpStart, dhcpEnd net.IP
+}
+
+// Allocation is an address assigned to a VM.
+type Allocation struct {
+	Address string `json:"address"`
+	Family  string `json:"family"`
+	VM      string `json:"vm"`
+	Role    string `json:"role"`
+	// Conflicts describes why the address should not be used, e.g. because
+	// another VM has it too.
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+// Pools returns the IPv4 and IPv6 pools of the provisioner of the lab. The
+// IPv6 pool is nil if the provisioner has no IPv6 address. The DHCP ranges
+// are read from the provisioner's cloud-init meta-data, or default to the
+// ones cloud-init would be given for its subnets.
+var Pools = func(cfg *config.Config) (*Pool, *Pool, error) {
+	provisioner, err := metadata.GetProvisioner(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get provisioner metadata: %w", err)
+	}
+	return provisionerPools(cfg, provisioner)
+}
+
+// provisionerPools returns the pools of the given provisioner, like Pools.
+// It doesn't read the metadata store, so it can be called under its lock.
+func provisionerPools(cfg *config.Config, provisioner *metadata.Metadata) (*Pool, *Pool, error) {
+	if provisioner == nil || provisioner.IP == "" {
+		return nil, nil, fmt.Errorf("provisioner VM not found. Please create a provisioner first")
+	}
+
+	metaData, err := cloudinit.LoadMetaData(cfg.GetAppDir(), provisioner.Name)
+	if err != nil {
+		metaData = &cloudinit.MetaData{}
+	}
+
+	// Records of provisioners created before the subnet was saved assume
+	// the /24 of the provisioner.
+	subnet := provisioner.Subnet
+	if subnet == "" {
+		subnet = provisioner.IP + "/24"
+	}
+	v4, err := newPool(FamilyIPv4, subnet, provisioner.IP, metaData.DhcpRangeStart, metaData.DhcpRangeEnd)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var v6 *Pool
+	if provisioner.IPv6 != "" && provisioner.SubnetV6 != "" {
+		v6, err = newPool(FamilyIPv6, provisioner.SubnetV6, provisioner.IPv6, metaData.DhcpRangeV6Start, metaData.DhcpRangeV6End)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return v4, v6, nil
+}
+
+func newPool(family, subnet, gateway, dhcpStart, dhcpEnd string) (*Pool, error) {
+	_, network, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid provisioner subnet '%s': %w", subnet, err)
+	}
+	p := &Pool{
+		Family:  family,
+		Subnet:  network.String(),
+		Gateway: gateway,
+		network: network,
+		gateway: net.ParseIP(gateway),
+	}
+
+	if dhcpStart == "" || dhcpEnd == "" {
+		if family == FamilyIPv4 {
+			dhcpStart, dhcpEnd = cloudinit.DHCPRange(network)
+		} else {
+			dhcpStart, dhcpEnd = cloudinit.DHCPRangeV6()
+		}
+	}
+	p.dhcpStart = inSubnet(network, net.ParseIP(dhcpStart))
+	p.dhcpEnd = inSubnet(network, net.ParseIP(dhcpEnd))
+	if p.dhcpStart != nil && p.dhcpEnd != nil {
+		p.DHCPStart, p.DHCPEnd = p.dhcpStart.String(), p.dhcpEnd.String()
+	}
+	return p, nil
+}
+
+// inSubnet returns the address of the subnet that ip designates. Addresses
+// outside of the subnet, such as the ::64 of the IPv6 DHCP ranges, are
+// interface identifiers combined with the prefix of the subnet.
+func inSubnet(network *net.IPNet, ip net.IP) net.IP {
+	if ip == nil {
+		return nil
+	}
+	if network.Contains(ip) {
+		return normalize(ip)
+	}
+	base := normalize(network.IP)
+	ip = normalize(ip)
+	if len(ip) != len(base) {
+		return nil
+	}
+	addr := make(net.IP, len(base))
+	for i := range base {
+		addr[i] = base[i] | (ip[i] &^ network.Mask[i])
+	}
+	return addr
+}
+
+// normalize returns IPv4 addresses in their 4-byte form, so that they can be
+// compared to subnet masks.
+func normalize(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip.To16()
+}
+
+// Reserved returns why an address of the pool can't be given to a target VM,
+// or an empty string if it can.
+func (p *Pool) Reserved(ip net.IP) string {
+	ip = normalize(ip)
+	switch {
+	case !p.network.Contains(ip):
+		return fmt.Sprintf("outside of the provisioner subnet %s", p.Subnet)
+	case ip.Equal(p.network.IP):
+		return "network address"
+	case p.Family == FamilyIPv4 && ip.Equal(broadcast(p.network)):
+		return "broadcast address"
+	case ip.Equal(p.gateway):
+		return "provisioner address"
+	case p.dhcpStart != nil && p.dhcpEnd != nil &&
+		bytes.Compare(ip, p.dhcpStart) >= 0 && bytes.Compare(ip, p.dhcpEnd) <= 0:
+		return fmt.Sprintf("inside the DHCP range %s-%s", p.DHCPStart, p.DHCPEnd)
+	}
+	return ""
+}
+
+// Next returns the first address of the pool that is neither reserved nor
+// used, in CIDR notation with the prefix length of the pool. accept, if not
+// nil, can reject more addresses.
+func (p *Pool) Next(used map[string]bool, accept func(net.IP) bool) (string, error) {
+	ip := nextIP(normalize(p.network.IP))
+	for i := 0; i < maxScan && p.network.Contains(ip); i++ {
+		if p.Reserved(ip) == "" && !used[ip.String()] && (accept == nil || accept(ip)) {
+			ones, _ := p.network.Mask.Size()
+			return fmt.Sprintf("%s/%d", ip, ones), nil
+		}
+		ip = nextIP(ip)
+	}
+	return "", fmt.Errorf("no available %s address in the provisioner subnet %s", p.Family, p.Subnet)
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+func broadcast(network *net.IPNet) net.IP {
+	base := normalize(network.IP)
+	addr := make(net.IP, len(base))
+	for i := range base {
+		addr[i] = base[i] | ^network.Mask[i]
+	}
+	return addr
+}
+
+// Allocate returns the first address of the given family that none of the
+// VMs of allMeta use, for a new target VM of the lab, in CIDR notation. The
+// address belongs to the provisioner's subnet and to the lab's, and is outside
+// of the DHCP range.
+//
+// The address is only taken once the VM's metadata is written: allocate it
+// from the callback of metadata.Create, which runs under the store lock, so
+// that VMs created concurrently get different addresses. The provisioner is
+// looked up in allMeta, as the store can't be read again under its lock.
+var Allocate = func(cfg *config.Config, family string, allMeta map[string]*metadata.Metadata) (string, error) {
+	var provisioner *metadata.Metadata
+	for _, meta := range allMeta {
+		if meta.Role == "provisioner" {
+			provisioner = meta
+			break
+		}
+	}
+	v4, v6, err := provisionerPools(cfg, provisioner)
+	if err != nil {
+		return "", err
+	}
+	pool := v4
+	if family == FamilyIPv6 {
+		if v6 == nil {
+			return "", fmt.Errorf("the provisioner has no IPv6 subnet to allocate from")
+		}
+		pool = v6
+	}
+
+	lab, err := cfg.Lab()
+	if err != nil {
+		return "", err
+	}
+	_, labSubnet, _ := net.ParseCIDR(lab.Subnet)
+	if family == FamilyIPv6 {
+		_, labSubnet, _ = net.ParseCIDR(lab.SubnetV6)
+	}
+
+	used := map[string]bool{}
+	for _, meta := range allMeta {
+		for _, addr := range []string{meta.IP, meta.IPv6} {
+			if ip := net.ParseIP(addr); ip != nil {
+				used[ip.String()] = true
+			}
+		}
+	}
+
+	return pool.Next(used, func(ip net.IP) bool {
+		return labSubnet == nil || labSubnet.Contains(ip)
+	})
+}
+
+// List returns the pools of the lab and the addresses of its VMs, sorted by
+// family and address, with the conflicts found: addresses used by several
+// VMs, outside of the provisioner's subnets or inside a DHCP range. The
+// pools are empty if the lab has no provisioner.
+var List = func(cfg *config.Config) ([]*Pool, []Allocation, error) {
+	allMeta, err := metadata.GetAll(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get all VM metadata: %w", err)
+	}
+
+	var pools []*Pool
+	var v4, v6 *Pool
+	for _, meta := range allMeta {
+		if meta.Role != "provisioner" {
+			continue
+		}
+		if v4, v6, err = Pools(cfg); err != nil {
+			return nil, nil, err
+		}
+		pools = append(pools, v4)
+		if v6 != nil {
+			pools = append(pools, v6)
+		}
+		break
+	}
+
+	names := make([]string, 0, len(allMeta))
+	for name := range allMeta {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var allocations []Allocation
+	owners := map[string][]string{}
+	for _, name := range names {
+		meta := allMeta[name]
+		for _, addr := range []struct{ family, ip string }{{FamilyIPv4, meta.IP}, {FamilyIPv6, meta.IPv6}} {
+			ip := net.ParseIP(addr.ip)
+			if ip == nil {
+				continue
+			}
+			a := Allocation{Address: ip.String(), Family: addr.family, VM: name, Role: meta.Role}
+			pool := v4
+			if addr.family == FamilyIPv6 {
+				pool = v6
+			}
+			if pool != nil && meta.Role != "provisioner" {
+				if reason := pool.Reserved(ip); reason != "" {
+					a.Conflicts = append(a.Conflicts, reason)
+				}
+			}
+			owners[a.Address] = append(owners[a.Address], name)
+			allocations = append(allocations, a)
+		}
+	}
+
+	for i := range allocations {
+		a := &allocations[i]
+		for _, owner := range owners[a.Address] {
+			if owner != a.VM {
+				a.Conflicts = append(a.Conflicts, fmt.Sprintf("also used by VM '%s'", owner))
+			}
+		}
+	}
+
+	sort.SliceStable(allocations, func(i, j int) bool {
+		a, b := allocations[i], allocations[j]
+		if a.Family != b.Family {
+			return a.Family < b.Family
+		}
+		return bytes.Compare(normalize(net.ParseIP(a.Address)), normalize(net.ParseIP(b.Address))) < 0
+	})
+	return pools, allocations, nil
+}
@@ -0,0 +1,249 @@
+package ipam
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"pvmlab/internal/config"
+	"pvmlab/internal/metadata"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func setup(t *testing.T, vms ...*metadata.Metadata) *config.Config {
+	t.Setenv("PVMLAB_LAB", "")
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatalf("Failed to create config: %v", err)
+	}
+	cfg.SetHomeDir(t.TempDir())
+	for _, meta := range vms {
+		if err := metadata.Write(cfg, meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cfg
+}
+
+func provisioner() *metadata.Metadata {
+	return &metadata.Metadata{
+		Name: "provisioner", Role: "provisioner",
+		IP: "192.168.100.1", Subnet: "192.168.100.0/24",
+		IPv6: "fd00:cafe:babe::1", SubnetV6: "fd00:cafe:babe::/64",
+	}
+}
+
+func TestPools(t *testing.T) {
+	cfg := setup(t, provisioner())
+
+	v4, v6, err := Pools(cfg)
+	if err != nil {
+		t.Fatalf("Pools() failed: %v", err)
+	}
+	if v4.Subnet != "192.168.100.0/24" || v4.DHCPStart != "192.168.100.100" || v4.DHCPEnd != "192.168.100.200" {
+		t.Errorf("unexpected IPv4 pool %+v", v4)
+	}
+	if v6 == nil || v6.DHCPStart != "fd00:cafe:babe::64" || v6.DHCPEnd != "fd00:cafe:babe::c8" {
+		t.Fatalf("unexpected IPv6 pool %+v", v6)
+	}
+
+	// The DHCP ranges of the provisioner's cloud-init meta-data win.
+	configDir := filepath.Join(cfg.GetAppDir(), "configs", "cloud-init", "provisioner")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	metaData := "dhcp_range_start: 192.168.100.10\ndhcp_range_end: 192.168.100.19\n"
+	if err := os.WriteFile(filepath.Join(configDir, "meta-data"), []byte(metaData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	v4, _, err = Pools(cfg)
+	if err != nil {
+		t.Fatalf("Pools() failed: %v", err)
+	}
+	if v4.DHCPStart != "192.168.100.10" || v4.DHCPEnd != "192.168.100.19" {
+		t.Errorf("expected the DHCP range of the meta-data, got %+v", v4)
+	}
+
+	if _, _, err := Pools(setup(t)); err == nil {
+		t.Error("expected an error without a provisioner")
+	}
+}
+
+func TestReserved(t *testing.T) {
+	pool, err := newPool(FamilyIPv4, "10.0.0.0/24", "10.0.0.1", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"10.0.0.0":   "network address",
+		"10.0.0.1":   "provisioner address",
+		"10.0.0.2":   "",
+		"10.0.0.99":  "",
+		"10.0.0.100": "inside the DHCP range 10.0.0.100-10.0.0.200",
+		"10.0.0.200": "inside the DHCP range 10.0.0.100-10.0.0.200",
+		"10.0.0.201": "",
+		"10.0.0.255": "broadcast address",
+		"10.0.1.2":   "outside of the provisioner subnet 10.0.0.0/24",
+	}
+	for addr, expected := range tests {
+		if got := pool.Reserved(net.ParseIP(addr)); got != expected {
+			t.Errorf("Reserved(%s) = %q, expected %q", addr, got, expected)
+		}
+	}
+}
+
+// allocate allocates an address among the VMs of the store.
+func allocate(t *testing.T, cfg *config.Config, family string) (string, error) {
+	t.Helper()
+	allMeta, err := metadata.GetAll(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Allocate(cfg, family, allMeta)
+}
+
+func TestAllocate(t *testing.T) {
+	cfg := setup(t, provisioner(),
+		&metadata.Metadata{Name: "vm1", Role: "target", IP: "192.168.100.2", IPv6: "fd00:cafe:babe::2"},
+		&metadata.Metadata{Name: "vm2", Role: "target", IP: "192.168.100.4"},
+	)
+
+	tests := []struct {
+		family   string
+		expected string
+	}{
+		{FamilyIPv4, "192.168.100.3/24"},
+		{FamilyIPv6, "fd00:cafe:babe::3/64"},
+	}
+	for _, tt := range tests {
+		got, err := allocate(t, cfg, tt.family)
+		if err != nil {
+			t.Fatalf("Allocate(%s) failed: %v", tt.family, err)
+		}
+		if got != tt.expected {
+			t.Errorf("Allocate(%s) = %s, expected %s", tt.family, got, tt.expected)
+		}
+	}
+
+	// Fill the addresses below the DHCP range, the next one is after it.
+	for i := 3; i < 100; i++ {
+		meta := &metadata.Metadata{Name: "fill" + strconv.Itoa(i), Role: "target", IP: "192.168.100." + strconv.Itoa(i)}
+		if err := metadata.Write(cfg, meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := allocate(t, cfg, FamilyIPv4); err != nil || got != "192.168.100.201/24" {
+		t.Errorf("expected the first address after the DHCP range, got %s, %v", got, err)
+	}
+
+	noV6 := setup(t, &metadata.Metadata{Name: "provisioner", Role: "provisioner", IP: "192.168.100.1", Subnet: "192.168.100.0/24"})
+	if _, err := allocate(t, noV6, FamilyIPv6); err == nil {
+		t.Error("expected an error without an IPv6 subnet")
+	}
+
+	// The provisioner is looked up in the VMs given, not in the store.
+	if _, err := Allocate(cfg, FamilyIPv4, map[string]*metadata.Metadata{}); err == nil {
+		t.Error("expected an error without a provisioner among the VMs")
+	}
+}
+
+func TestAllocate_Concurrent(t *testing.T) {
+	cfg := setup(t, provisioner())
+
+	// VMs created concurrently get different addresses.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			meta := &metadata.Metadata{Name: "vm" + strconv.Itoa(i), Role: "target"}
+			if err := metadata.Create(cfg, meta, func(allMeta map[string]*metadata.Metadata) error {
+				ip, err := Allocate(cfg, FamilyIPv4, allMeta)
+				meta.IP = strings.TrimSuffix(ip, "/24")
+				return err
+			}); err != nil {
+				t.Errorf("Create() failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	allMeta, err := metadata.GetAll(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := map[string]string{}
+	for name, meta := range allMeta {
+		if other, ok := used[meta.IP]; ok {
+			t.Errorf("VMs '%s' and '%s' got the same address %s", name, other, meta.IP)
+		}
+		used[meta.IP] = name
+	}
+	if len(used) != 11 {
+		t.Errorf("expected 11 addresses, got %v", used)
+	}
+}
+
+func TestAllocate_Lab(t *testing.T) {
+	cfg := setup(t)
+	if _, err := cfg.CreateLab("lab1", "10.1.0.0/25", ""); err != nil {
+		t.Fatal(err)
+	}
+	cfg.SetLabName("lab1")
+	if err := metadata.Write(cfg, &metadata.Metadata{Name: "provisioner", Role: "provisioner", IP: "10.1.0.1", Subnet: "10.1.0.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 2; i < 100; i++ {
+		meta := &metadata.Metadata{Name: "vm" + strconv.Itoa(i), Role: "target", IP: "10.1.0." + strconv.Itoa(i)}
+		if err := metadata.Write(cfg, meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The rest of the lab's subnet is in the DHCP range.
+	if got, err := allocate(t, cfg, FamilyIPv4); err == nil {
+		t.Errorf("expected no address left in the lab's subnet, got %s", got)
+	}
+}
+
+func TestList(t *testing.T) {
+	cfg := setup(t, provisioner(),
+		&metadata.Metadata{Name: "vm1", Role: "target", IP: "192.168.100.2", IPv6: "fd00:cafe:babe::2"},
+		&metadata.Metadata{Name: "vm2", Role: "target", IP: "192.168.100.2"},
+		&metadata.Metadata{Name: "vm3", Role: "target", IP: "192.168.100.150"},
+		&metadata.Metadata{Name: "vm4", Role: "target", IP: "192.168.100.10"},
+	)
+
+	pools, allocations, err := List(cfg)
+	if err != nil {
+		t.Fatalf("List() failed: %v", err)
+	}
+	if len(pools) != 2 {
+		t.Errorf("expected 2 pools, got %d", len(pools))
+	}
+
+	var got []string
+	for _, a := range allocations {
+		got = append(got, a.Address+" "+a.VM+" ["+strings.Join(a.Conflicts, "; ")+"]")
+	}
+	expected := []string{
+		"192.168.100.1 provisioner []",
+		"192.168.100.2 vm1 [also used by VM 'vm2']",
+		"192.168.100.2 vm2 [also used by VM 'vm1']",
+		"192.168.100.10 vm4 []",
+		"192.168.100.150 vm3 [inside the DHCP range 192.168.100.100-192.168.100.200]",
+		"fd00:cafe:babe::1 provisioner []",
+		"fd00:cafe:babe::2 vm1 []",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected allocations\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	// Without a provisioner, there are no pools and no conflicts but the
+	// duplicates.
+	pools, allocations, err = List(setup(t, &metadata.Metadata{Name: "vm1", Role: "target", IP: "10.0.0.1"}))
+	if err != nil || len(pools) != 0 || len(allocations) != 1 {
+		t.Errorf("expected only one allocation without a provisioner, got %v, %v, %v", pools, allocations, err)
+	}
+}
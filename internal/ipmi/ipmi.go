@@ -0,0 +1,740 @@
+// Package ipmi implements the subset of IPMI 2.0 over LAN (RMCP+) used by
+// provisioning tools to control servers out of band: chassis power control
+// and status, and boot device selection.
+//
+// A BMC manages a single system, so the system controlled by a session is
+// selected by its user name: every system of the backend is a user, and all
+// users share the same password. Only RMCP+ sessions with the cipher suites
+// 3 and 17 are supported, IPMI 1.5 sessions are not.
+package ipmi
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"pvmlab/internal/redfish"
+)
+
+// Backend controls the systems exposed by the server. It is the part of a
+// redfish.Backend used by IPMI, so that both protocols can control the same
+// systems.
+type Backend interface {
+	System(id string) (*redfish.System, error)
+	Reset(id, resetType string) error
+	SetBoot(id string, boot redfish.Boot) error
+}
+
+// Network functions.
+const (
+	netFnChassis = 0x00
+	netFnApp     = 0x06
+)
+
+// Commands.
+const (
+	cmdGetChassisStatus         = 0x01
+	cmdChassisControl           = 0x02
+	cmdSetSystemBootOptions     = 0x08
+	cmdGetSystemBootOptions     = 0x09
+	cmdGetDeviceID              = 0x01
+	cmdGetChannelAuthCaps       = 0x38
+	cmdSetSessionPrivilegeLevel = 0x3b
+	cmdCloseSession             = 0x3c
+	cmdGetChannelCipherSuites   = 0x54
+)
+
+// Completion codes.
+const (
+	ccOK                   = 0x00
+	ccParamNotSupported    = 0x80
+	ccPrivilegeUnavailable = 0x81
+	ccInvalidCommand       = 0xc1
+	ccInvalidData          = 0xcc
+	ccInsufficientPriv     = 0xd4
+	ccNotInPresentState    = 0xd5
+	ccUnspecified          = 0xff
+)
+
+// RMCP+ status codes of the session setup messages.
+const (
+	statusOK                   = 0x00
+	statusInsufficientResource = 0x01
+	statusInvalidSessionID     = 0x02
+	statusInvalidRole          = 0x09
+	statusUnauthorizedName     = 0x0d
+	statusInvalidICV           = 0x0f
+	statusNoCipherSuiteMatch   = 0x11
+)
+
+// Privilege levels.
+const (
+	privilegeUser     = 0x02
+	privilegeOperator = 0x03
+	privilegeAdmin    = 0x04
+)
+
+const (
+	// maxSessions is the number of sessions, pending or active, at any
+	// time.
+	maxSessions = 64
+	// sessionTimeout is how long an idle session is kept.
+	sessionTimeout = time.Minute
+	// maxRequests is the number of messages handled at once.
+	maxRequests = 16
+	// seqWindowAhead and seqWindowBehind bound the sliding window of the
+	// inbound session sequence numbers accepted, around the highest one
+	// received (IPMI 2.0, 13.28.x).
+	seqWindowAhead  = 15
+	seqWindowBehind = 16
+)
+
+// session is an RMCP+ session, opened by an Open Session Request and
+// activated by the RAKP exchange.
+type session struct {
+	id, consoleID uint32
+	suite         *cipherSuite
+	active        bool
+	// user is the system controlled by the session.
+	user string
+	// role is the RAKP1 role byte, privilege the current privilege level.
+	role, privilege byte
+	consoleRandom   []byte
+	bmcRandom       []byte
+	sik, k1, k2     []byte
+	seq             uint32
+	// inSeq is the highest inbound sequence number received, inSeen the
+	// numbers received below it: bit n is set for inSeq-n.
+	inSeq    uint32
+	inSeen   uint32
+	lastUsed time.Time
+}
+
+// acceptSeq records the sequence number of an inbound message, and reports
+// whether it is new and within the sliding window, so that replayed
+// messages are ignored.
+func (sess *session) acceptSeq(seq uint32) bool {
+	if seq == 0 {
+		return false
+	}
+	if sess.inSeen == 0 {
+		sess.inSeq, sess.inSeen = seq, 1
+		return true
+	}
+	// The difference is signed, for the numbers to wrap around.
+	d := int32(seq - sess.inSeq)
+	switch {
+	case d > seqWindowAhead || d < -seqWindowBehind:
+		return false
+	case d > 0:
+		sess.inSeq, sess.inSeen = seq, sess.inSeen<<d|1
+		return true
+	case sess.inSeen&(1<<-d) != 0:
+		return false
+	}
+	sess.inSeen |= 1 << -d
+	return true
+}
+
+// Server serves IPMI over LAN for the systems of a backend.
+type Server struct {
+	backend  Backend
+	password []byte
+	guid     []byte
+	// Logf, if set, logs the commands and the errors of the backend.
+	Logf func(format string, args ...any)
+
+	mu       sync.Mutex
+	sessions map[uint32]*session
+}
+
+// NewServer returns a server for the systems of backend, authenticating
+// sessions with the given password.
+func NewServer(backend Backend, password string) (*Server, error) {
+	if len(password) > maxPasswordLength {
+		return nil, fmt.Errorf("IPMI passwords are limited to %d characters", maxPasswordLength)
+	}
+	guid := make([]byte, 16)
+	if _, err := rand.Read(guid); err != nil {
+		return nil, err
+	}
+	return &Server{
+		backend:  backend,
+		password: []byte(password),
+		guid:     guid,
+		sessions: map[uint32]*session{},
+	}, nil
+}
+
+// Serve handles the messages received on conn until it is closed.
+func (s *Server) Serve(conn net.PacketConn) error {
+	buf := make([]byte, 1500)
+	sem := make(chan struct{}, maxRequests)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		msg := append([]byte{}, buf[:n]...)
+		// Power actions can take a while, so they must not hold up the
+		// other sessions, but only a few messages are handled at once.
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem }()
+			if resp := s.handle(msg); resp != nil {
+				conn.WriteTo(resp, addr)
+			}
+		}()
+	}
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+// handle returns the response to an RMCP message, or nil if it is ignored.
+func (s *Server) handle(msg []byte) []byte {
+	if len(msg) < rmcpHeaderLength+1 || msg[0] != 0x06 {
+		return nil
+	}
+	body := msg[rmcpHeaderLength:]
+	switch msg[3] {
+	case classASF:
+		return handlePing(body)
+	case classIPMI:
+		if body[0] == authTypeRMCPPlus {
+			return s.handleRMCPPlus(body)
+		}
+		return s.handleIPMI15(body)
+	}
+	return nil
+}
+
+// handlePing answers ASF presence pings, which clients use to discover
+// BMCs.
+func handlePing(body []byte) []byte {
+	const asfIANA = 0x000011be
+	if len(body) < 8 || binary.BigEndian.Uint32(body) != asfIANA || body[4] != 0x80 {
+		return nil
+	}
+	resp := rmcpHeader(classASF)
+	resp = binary.BigEndian.AppendUint32(resp, asfIANA)
+	resp = append(resp, 0x40, body[5], 0x00, 0x10)
+	resp = binary.BigEndian.AppendUint32(resp, asfIANA)
+	resp = binary.BigEndian.AppendUint32(resp, 0)
+	// IPMI is supported, with ASF 1.0 and no other interactions.
+	resp = append(resp, 0x81, 0x00)
+	return append(resp, make([]byte, 6)...)
+}
+
+// handleIPMI15 answers the IPMI 1.5 messages sent outside of a session,
+// which RMCP+ clients use to discover the capabilities of the BMC.
+func (s *Server) handleIPMI15(body []byte) []byte {
+	// Authentication type, sequence number, session ID and length.
+	if len(body) < 10 || body[0] != authTypeNone || binary.LittleEndian.Uint32(body[5:9]) != 0 {
+		return nil
+	}
+	length := int(body[9])
+	if len(body) < 10+length {
+		return nil
+	}
+	req, err := parseIPMIRequest(body[10 : 10+length])
+	if err != nil {
+		return nil
+	}
+	respMsg := s.handleSessionless(req)
+	resp := append(rmcpHeader(classIPMI), authTypeNone)
+	resp = append(resp, make([]byte, 8)...)
+	resp = append(resp, byte(len(respMsg)))
+	return append(resp, respMsg...)
+}
+
+// handleSessionless answers the requests allowed outside of a session.
+func (s *Server) handleSessionless(req *ipmiRequest) []byte {
+	if req.netFn != netFnApp {
+		return req.response(ccInsufficientPriv, nil)
+	}
+	switch req.cmd {
+	case cmdGetChannelAuthCaps:
+		return getChannelAuthCaps(req)
+	case cmdGetChannelCipherSuites:
+		return getChannelCipherSuites(req)
+	}
+	return req.response(ccInsufficientPriv, nil)
+}
+
+func getChannelAuthCaps(req *ipmiRequest) []byte {
+	if len(req.data) < 2 {
+		return req.response(ccInvalidData, nil)
+	}
+	// No IPMI 1.5 authentication type is supported; the extended
+	// capabilities, reported to RMCP+ clients, tell that users need a
+	// name and that IPMI 2.0 sessions are supported.
+	var authTypes byte
+	if req.data[0]&0x80 != 0 {
+		authTypes = 0x80
+	}
+	return req.response(ccOK, []byte{0x01, authTypes, 0x04, 0x02, 0x00, 0x00, 0x00, 0x00})
+}
+
+func getChannelCipherSuites(req *ipmiRequest) []byte {
+	if len(req.data) < 3 {
+		return req.response(ccInvalidData, nil)
+	}
+	var records []byte
+	for _, c := range cipherSuites {
+		records = append(records, 0xc0, c.id, c.authentication, 0x40|c.integrity, 0x80|c.confidentiality)
+	}
+	// The records are returned 16 bytes at a time.
+	start := int(req.data[2]&0x3f) * 16
+	start = min(start, len(records))
+	end := min(start+16, len(records))
+	return req.response(ccOK, append([]byte{0x01}, records[start:end]...))
+}
+
+func (s *Server) handleRMCPPlus(body []byte) []byte {
+	m, err := parseRMCPPlus(body)
+	if err != nil {
+		return nil
+	}
+	payloadType := m.payloadType & payloadTypeMask
+	if m.sessionID == 0 {
+		if m.payloadType&(payloadEncrypted|payloadAuthenticated) != 0 {
+			return nil
+		}
+		switch payloadType {
+		case payloadIPMI:
+			req, err := parseIPMIRequest(m.payload)
+			if err != nil {
+				return nil
+			}
+			resp, _ := encodeRMCPPlus(payloadIPMI, 0, 0, s.handleSessionless(req), nil, nil, nil)
+			return resp
+		case payloadOpenSessionReq:
+			return s.openSession(m.payload)
+		case payloadRAKP1:
+			return s.rakp1(m.payload)
+		case payloadRAKP3:
+			return s.rakp3(m.payload)
+		}
+		return nil
+	}
+	if payloadType != payloadIPMI {
+		return nil
+	}
+
+	s.mu.Lock()
+	sess, ok := s.sessions[m.sessionID]
+	if ok && sess.active {
+		sess.lastUsed = time.Now()
+	}
+	s.mu.Unlock()
+	if !ok || !sess.active {
+		return nil
+	}
+	// Every supported cipher suite authenticates and encrypts messages.
+	if m.payloadType&payloadAuthenticated == 0 || m.payloadType&payloadEncrypted == 0 ||
+		!hmac.Equal(m.authCode, sess.suite.mac(sess.k1, m.signed)[:sess.suite.icvLength]) {
+		return nil
+	}
+	s.mu.Lock()
+	fresh := sess.acceptSeq(m.seq)
+	s.mu.Unlock()
+	if !fresh {
+		return nil
+	}
+	payload, err := decrypt(sess.k2, m.payload)
+	if err != nil {
+		return nil
+	}
+	req, err := parseIPMIRequest(payload)
+	if err != nil {
+		return nil
+	}
+	respMsg := s.handleRequest(sess, req)
+
+	s.mu.Lock()
+	sess.seq++
+	seq := sess.seq
+	s.mu.Unlock()
+	resp, err := encodeRMCPPlus(payloadIPMI, sess.consoleID, seq, respMsg, sess.suite, sess.k1, sess.k2)
+	if err != nil {
+		return nil
+	}
+	return resp
+}
+
+// openSession answers an RMCP+ Open Session Request, which selects the
+// cipher suite of a new session.
+func (s *Server) openSession(p []byte) []byte {
+	if len(p) < 32 {
+		return nil
+	}
+	tag, consoleID := p[0], binary.LittleEndian.Uint32(p[4:8])
+	fail := func(status byte) []byte {
+		resp := []byte{tag, status, 0x00, 0x00}
+		resp = binary.LittleEndian.AppendUint32(resp, consoleID)
+		msg, _ := encodeRMCPPlus(payloadOpenSessionResp, 0, 0, resp, nil, nil, nil)
+		return msg
+	}
+	if consoleID == 0 {
+		return fail(statusInvalidSessionID)
+	}
+	suite := findCipherSuite(p[12]&0x3f, p[20]&0x3f, p[28]&0x3f)
+	if suite == nil {
+		return fail(statusNoCipherSuiteMatch)
+	}
+	privilege := p[1] & 0x0f
+	if privilege == 0 || privilege > privilegeAdmin {
+		privilege = privilegeAdmin
+	}
+
+	s.mu.Lock()
+	s.expireSessions()
+	if len(s.sessions) >= maxSessions {
+		s.mu.Unlock()
+		return fail(statusInsufficientResource)
+	}
+	var id uint32
+	for id == 0 || s.sessions[id] != nil {
+		var b [4]byte
+		rand.Read(b[:])
+		id = binary.LittleEndian.Uint32(b[:])
+	}
+	s.sessions[id] = &session{id: id, consoleID: consoleID, suite: suite, lastUsed: time.Now()}
+	s.mu.Unlock()
+
+	resp := []byte{tag, statusOK, privilege, 0x00}
+	resp = binary.LittleEndian.AppendUint32(resp, consoleID)
+	resp = binary.LittleEndian.AppendUint32(resp, id)
+	for i, alg := range []byte{suite.authentication, suite.integrity, suite.confidentiality} {
+		resp = append(resp, byte(i), 0x00, 0x00, 0x08, alg, 0x00, 0x00, 0x00)
+	}
+	msg, _ := encodeRMCPPlus(payloadOpenSessionResp, 0, 0, resp, nil, nil, nil)
+	return msg
+}
+
+// expireSessions removes the idle sessions. The caller must hold s.mu.
+func (s *Server) expireSessions() {
+	for id, sess := range s.sessions {
+		if time.Since(sess.lastUsed) > sessionTimeout {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// rakp1 answers RAKP Message 1, which names the user of a session, with RAKP
+// Message 2, which proves that the BMC knows the user's password.
+func (s *Server) rakp1(p []byte) []byte {
+	if len(p) < 28 || len(p) < 28+int(p[27]) {
+		return nil
+	}
+	tag, id := p[0], binary.LittleEndian.Uint32(p[4:8])
+	role, user := p[24], p[28:28+int(p[27])]
+
+	s.mu.Lock()
+	sess, ok := s.sessions[id]
+	pending := ok && !sess.active
+	s.mu.Unlock()
+	fail := func(status byte, consoleID uint32) []byte {
+		resp := []byte{tag, status, 0x00, 0x00}
+		resp = binary.LittleEndian.AppendUint32(resp, consoleID)
+		msg, _ := encodeRMCPPlus(payloadRAKP2, 0, 0, resp, nil, nil, nil)
+		return msg
+	}
+	if !pending {
+		return fail(statusInvalidSessionID, 0)
+	}
+	if privilege := role & 0x0f; privilege == 0 || privilege > privilegeAdmin {
+		s.closeSession(id)
+		return fail(statusInvalidRole, sess.consoleID)
+	}
+	if len(user) == 0 || len(user) > maxUserNameLength {
+		s.closeSession(id)
+		return fail(statusUnauthorizedName, sess.consoleID)
+	}
+	if _, err := s.backend.System(string(user)); err != nil {
+		s.closeSession(id)
+		return fail(statusUnauthorizedName, sess.consoleID)
+	}
+
+	bmcRandom := make([]byte, 16)
+	if _, err := rand.Read(bmcRandom); err != nil {
+		return fail(statusInsufficientResource, sess.consoleID)
+	}
+	consoleRandom := append([]byte{}, p[8:24]...)
+	userInfo := append([]byte{role, byte(len(user))}, user...)
+	suite := sess.suite
+
+	var ids []byte
+	ids = binary.LittleEndian.AppendUint32(ids, sess.consoleID)
+	ids = binary.LittleEndian.AppendUint32(ids, id)
+	authCode := suite.mac(s.password, ids, consoleRandom, bmcRandom, s.guid, userInfo)
+	sik := suite.mac(s.password, consoleRandom, bmcRandom, userInfo)
+	k1, k2 := suite.deriveKeys(sik)
+
+	s.mu.Lock()
+	sess.user, sess.role = string(user), role
+	sess.consoleRandom, sess.bmcRandom = consoleRandom, bmcRandom
+	sess.sik, sess.k1, sess.k2 = sik, k1, k2
+	sess.lastUsed = time.Now()
+	s.mu.Unlock()
+
+	resp := []byte{tag, statusOK, 0x00, 0x00}
+	resp = binary.LittleEndian.AppendUint32(resp, sess.consoleID)
+	resp = append(resp, bmcRandom...)
+	resp = append(resp, s.guid...)
+	resp = append(resp, authCode...)
+	msg, _ := encodeRMCPPlus(payloadRAKP2, 0, 0, resp, nil, nil, nil)
+	return msg
+}
+
+// rakp3 checks RAKP Message 3, which proves that the client knows the
+// password, and activates the session with RAKP Message 4.
+func (s *Server) rakp3(p []byte) []byte {
+	if len(p) < 8 {
+		return nil
+	}
+	tag, status, id := p[0], p[1], binary.LittleEndian.Uint32(p[4:8])
+
+	s.mu.Lock()
+	sess, ok := s.sessions[id]
+	pending := ok && !sess.active && sess.sik != nil
+	s.mu.Unlock()
+	if !pending {
+		resp := []byte{tag, statusInvalidSessionID, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+		msg, _ := encodeRMCPPlus(payloadRAKP4, 0, 0, resp, nil, nil, nil)
+		return msg
+	}
+	if status != statusOK {
+		// The client gave up on the session.
+		s.closeSession(id)
+		return nil
+	}
+
+	suite := sess.suite
+	resp := []byte{tag, statusOK, 0x00, 0x00}
+	resp = binary.LittleEndian.AppendUint32(resp, sess.consoleID)
+	var consoleID []byte
+	consoleID = binary.LittleEndian.AppendUint32(consoleID, sess.consoleID)
+	expected := suite.mac(s.password, sess.bmcRandom, consoleID, []byte{sess.role, byte(len(sess.user))}, []byte(sess.user))
+	if !hmac.Equal(p[8:], expected) {
+		s.closeSession(id)
+		s.logf("IPMI authentication failed for '%s'", sess.user)
+		resp[1] = statusInvalidICV
+		msg, _ := encodeRMCPPlus(payloadRAKP4, 0, 0, resp, nil, nil, nil)
+		return msg
+	}
+
+	var bmcID []byte
+	bmcID = binary.LittleEndian.AppendUint32(bmcID, id)
+	resp = append(resp, suite.mac(sess.sik, sess.consoleRandom, bmcID, s.guid)[:suite.icvLength]...)
+
+	s.mu.Lock()
+	sess.active = true
+	sess.privilege = min(sess.role&0x0f, privilegeUser)
+	sess.lastUsed = time.Now()
+	s.mu.Unlock()
+	msg, _ := encodeRMCPPlus(payloadRAKP4, 0, 0, resp, nil, nil, nil)
+	return msg
+}
+
+func (s *Server) closeSession(id uint32) {
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+}
+
+// handleRequest answers a request received in an active session.
+func (s *Server) handleRequest(sess *session, req *ipmiRequest) []byte {
+	switch req.netFn {
+	case netFnApp:
+		switch req.cmd {
+		case cmdGetDeviceID:
+			// A chassis device supporting IPMI 2.0.
+			return req.response(ccOK, []byte{0x20, 0x01, 0x01, 0x00, 0x02, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00})
+		case cmdGetChannelAuthCaps, cmdGetChannelCipherSuites:
+			return s.handleSessionless(req)
+		case cmdSetSessionPrivilegeLevel:
+			return s.setSessionPrivilege(sess, req)
+		case cmdCloseSession:
+			if len(req.data) < 4 {
+				return req.response(ccInvalidData, nil)
+			}
+			if binary.LittleEndian.Uint32(req.data) != sess.id {
+				return req.response(ccInsufficientPriv, nil)
+			}
+			s.closeSession(sess.id)
+			return req.response(ccOK, nil)
+		}
+	case netFnChassis:
+		if req.cmd != cmdGetChassisStatus && req.cmd != cmdGetSystemBootOptions {
+			s.mu.Lock()
+			privilege := sess.privilege
+			s.mu.Unlock()
+			if privilege < privilegeOperator {
+				return req.response(ccInsufficientPriv, nil)
+			}
+		}
+		switch req.cmd {
+		case cmdGetChassisStatus:
+			return s.getChassisStatus(sess, req)
+		case cmdChassisControl:
+			return s.chassisControl(sess, req)
+		case cmdSetSystemBootOptions:
+			return s.setBootOptions(sess, req)
+		case cmdGetSystemBootOptions:
+			return s.getBootOptions(sess, req)
+		}
+	}
+	return req.response(ccInvalidCommand, nil)
+}
+
+func (s *Server) setSessionPrivilege(sess *session, req *ipmiRequest) []byte {
+	if len(req.data) < 1 {
+		return req.response(ccInvalidData, nil)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	requested := req.data[0] & 0x0f
+	if requested == 0 {
+		return req.response(ccOK, []byte{sess.privilege})
+	}
+	if requested > sess.role&0x0f {
+		return req.response(ccPrivilegeUnavailable, nil)
+	}
+	sess.privilege = requested
+	return req.response(ccOK, []byte{requested})
+}
+
+func (s *Server) getChassisStatus(sess *session, req *ipmiRequest) []byte {
+	sys, err := s.backend.System(sess.user)
+	if err != nil {
+		s.logf("IPMI: failed to get the status of '%s': %v", sess.user, err)
+		return req.response(ccUnspecified, nil)
+	}
+	var power byte
+	if sys.PowerState != redfish.PowerOff {
+		power = 0x01
+	}
+	return req.response(ccOK, []byte{power, 0x00, 0x00})
+}
+
+// resetTypes maps the chassis control commands to Redfish reset types.
+var resetTypes = map[byte]string{
+	0x00: "ForceOff",
+	0x01: "On",
+	0x02: "ForceRestart", // Power cycle.
+	0x03: "ForceRestart", // Hard reset.
+	0x04: "Nmi",          // Pulse diagnostic interrupt.
+	0x05: "GracefulShutdown",
+}
+
+func (s *Server) chassisControl(sess *session, req *ipmiRequest) []byte {
+	if len(req.data) < 1 {
+		return req.response(ccInvalidData, nil)
+	}
+	resetType, ok := resetTypes[req.data[0]&0x0f]
+	if !ok {
+		return req.response(ccInvalidData, nil)
+	}
+	s.logf("IPMI chassis control %s of '%s'", resetType, sess.user)
+	if err := s.backend.Reset(sess.user, resetType); err != nil {
+		s.logf("IPMI: %s of '%s' failed: %v", resetType, sess.user, err)
+		return req.response(ccNotInPresentState, nil)
+	}
+	return req.response(ccOK, nil)
+}
+
+// Boot option parameters.
+const (
+	bootParamSetInProgress = 0x00
+	bootParamValidBitClear = 0x03
+	bootParamInfoAck       = 0x04
+	bootParamFlags         = 0x05
+)
+
+// bootDevices maps the boot device selectors of the boot flags to Redfish
+// boot targets.
+var bootDevices = map[byte]string{
+	0x00: "None",
+	0x01: "Pxe",
+	0x02: "Hdd",
+	0x03: "Hdd", // Safe mode.
+	0x05: "Cd",
+}
+
+func (s *Server) setBootOptions(sess *session, req *ipmiRequest) []byte {
+	if len(req.data) < 1 {
+		return req.response(ccInvalidData, nil)
+	}
+	switch req.data[0] & 0x7f {
+	case bootParamSetInProgress, bootParamValidBitClear, bootParamInfoAck:
+		// The override is only kept by the BMC, so there is nothing to
+		// lock or acknowledge.
+		return req.response(ccOK, nil)
+	case bootParamFlags:
+	default:
+		return req.response(ccParamNotSupported, nil)
+	}
+	flags := req.data[1:]
+	if len(flags) < 2 {
+		return req.response(ccInvalidData, nil)
+	}
+	target, ok := bootDevices[flags[1]>>2&0x0f]
+	if !ok {
+		return req.response(ccInvalidData, nil)
+	}
+	boot := redfish.Boot{Target: target, Enabled: "Once"}
+	if flags[0]&0x40 != 0 {
+		boot.Enabled = "Continuous"
+	}
+	if flags[0]&0x80 == 0 || target == "None" {
+		boot = redfish.Boot{Target: "None", Enabled: "Disabled"}
+	}
+	s.logf("IPMI boot device %s (%s) of '%s'", boot.Target, boot.Enabled, sess.user)
+	if err := s.backend.SetBoot(sess.user, boot); err != nil {
+		s.logf("IPMI: failed to set the boot device of '%s': %v", sess.user, err)
+		return req.response(ccNotInPresentState, nil)
+	}
+	return req.response(ccOK, nil)
+}
+
+func (s *Server) getBootOptions(sess *session, req *ipmiRequest) []byte {
+	if len(req.data) < 1 {
+		return req.response(ccInvalidData, nil)
+	}
+	if req.data[0]&0x7f != bootParamFlags {
+		return req.response(ccParamNotSupported, nil)
+	}
+	sys, err := s.backend.System(sess.user)
+	if err != nil {
+		s.logf("IPMI: failed to get the boot device of '%s': %v", sess.user, err)
+		return req.response(ccUnspecified, nil)
+	}
+	flags := make([]byte, 5)
+	if sys.Boot.Enabled != "Disabled" {
+		for selector, target := range bootDevices {
+			if target == sys.Boot.Target && selector != 0x03 {
+				flags[1] = selector << 2
+			}
+		}
+		if flags[1] != 0 {
+			flags[0] = 0x80
+			if sys.Boot.Enabled == "Continuous" {
+				flags[0] |= 0x40
+			}
+		}
+	}
+	return req.response(ccOK, append([]byte{0x01, bootParamFlags}, flags...))
+}
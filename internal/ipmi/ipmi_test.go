@@ -0,0 +1,411 @@
+package ipmi
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"pvmlab/internal/redfish"
+)
+
+type fakeBackend struct {
+	mu     sync.Mutex
+	system redfish.System
+	calls  []string
+}
+
+func (b *fakeBackend) System(id string) (*redfish.System, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if id != b.system.ID {
+		return nil, fmt.Errorf("%w: %s", redfish.ErrNotFound, id)
+	}
+	sys := b.system
+	return &sys, nil
+}
+
+func (b *fakeBackend) Reset(id, resetType string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, "reset "+id+" "+resetType)
+	if resetType == "On" {
+		b.system.PowerState = redfish.PowerOn
+	}
+	return nil
+}
+
+func (b *fakeBackend) SetBoot(id string, boot redfish.Boot) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, fmt.Sprintf("boot %s %s %s", id, boot.Target, boot.Enabled))
+	b.system.Boot = boot
+	return nil
+}
+
+// startServer serves IPMI for a powered off target1 VM and returns a
+// connection to the server.
+func startServer(t *testing.T, password string) (*fakeBackend, net.Conn) {
+	t.Helper()
+	backend := &fakeBackend{system: redfish.System{
+		ID:         "target1",
+		PowerState: redfish.PowerOff,
+		Boot:       redfish.Boot{Target: "None", Enabled: "Disabled"},
+	}}
+	srv, err := NewServer(backend, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(pc)
+	t.Cleanup(func() { pc.Close() })
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return backend, conn
+}
+
+func exchange(t *testing.T, conn net.Conn, msg []byte) []byte {
+	t.Helper()
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("no response: %v", err)
+	}
+	return buf[:n]
+}
+
+// request encodes an IPMI request from the remote console.
+func request(netFn, cmd, seq byte, data ...byte) []byte {
+	msg := []byte{bmcSlaveAddress, netFn << 2}
+	msg = append(msg, checksum(msg))
+	msg = append(msg, 0x81, seq<<2, cmd)
+	msg = append(msg, data...)
+	return append(msg, checksum(msg[3:]))
+}
+
+// completion returns the completion code and data of an IPMI response.
+func completion(t *testing.T, msg []byte) (byte, []byte) {
+	t.Helper()
+	if len(msg) < 8 || checksum(msg[:3]) != 0 || checksum(msg[3:]) != 0 {
+		t.Fatalf("malformed response % x", msg)
+	}
+	return msg[6], msg[7 : len(msg)-1]
+}
+
+func sessionless(t *testing.T, conn net.Conn, payloadType byte, payload []byte) []byte {
+	t.Helper()
+	msg, _ := encodeRMCPPlus(payloadType, 0, 0, payload, nil, nil, nil)
+	m, err := parseRMCPPlus(exchange(t, conn, msg)[rmcpHeaderLength:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m.payload
+}
+
+type clientSession struct {
+	conn   net.Conn
+	suite  *cipherSuite
+	bmcID  uint32
+	k1, k2 []byte
+	seq    uint32
+}
+
+// openSession runs the RMCP+ session setup as a remote console would. It
+// returns the status of the first setup message that failed, if any.
+func openSession(t *testing.T, conn net.Conn, suiteID byte, user, password string) (*clientSession, byte) {
+	t.Helper()
+	var suite *cipherSuite
+	for i := range cipherSuites {
+		if cipherSuites[i].id == suiteID {
+			suite = &cipherSuites[i]
+		}
+	}
+	const consoleID = 0xa0a1a2a3
+
+	open := []byte{0x01, 0x00, 0x00, 0x00, 0xa3, 0xa2, 0xa1, 0xa0}
+	for i, alg := range []byte{suite.authentication, suite.integrity, suite.confidentiality} {
+		open = append(open, byte(i), 0x00, 0x00, 0x08, alg, 0x00, 0x00, 0x00)
+	}
+	resp := sessionless(t, conn, payloadOpenSessionReq, open)
+	if resp[1] != statusOK {
+		return nil, resp[1]
+	}
+	bmcID := binary.LittleEndian.Uint32(resp[8:12])
+
+	consoleRandom := bytes.Repeat([]byte{0x42}, 16)
+	rakp1 := []byte{0x02, 0x00, 0x00, 0x00}
+	rakp1 = binary.LittleEndian.AppendUint32(rakp1, bmcID)
+	rakp1 = append(rakp1, consoleRandom...)
+	rakp1 = append(rakp1, privilegeAdmin, 0x00, 0x00, byte(len(user)))
+	rakp1 = append(rakp1, user...)
+	resp = sessionless(t, conn, payloadRAKP1, rakp1)
+	if resp[1] != statusOK {
+		return nil, resp[1]
+	}
+	bmcRandom, guid, authCode := resp[8:24], resp[24:40], resp[40:]
+
+	// A console aborts the setup when the BMC doesn't know its password,
+	// the check is deferred to let the BMC reject the password in RAKP4.
+	// HMAC(SIDm, SIDc, Rm, Rc, GUIDc, ROLEm, ULENGTHm, UNAMEm)
+	h := hmac.New(suite.hash, []byte(password))
+	binary.Write(h, binary.LittleEndian, uint32(consoleID))
+	binary.Write(h, binary.LittleEndian, bmcID)
+	h.Write(consoleRandom)
+	h.Write(bmcRandom)
+	h.Write(guid)
+	h.Write([]byte{privilegeAdmin, byte(len(user))})
+	h.Write([]byte(user))
+	rakp2Valid := hmac.Equal(authCode, h.Sum(nil))
+
+	// HMAC(Rc, SIDm, ROLEm, ULENGTHm, UNAMEm)
+	h = hmac.New(suite.hash, []byte(password))
+	h.Write(bmcRandom)
+	binary.Write(h, binary.LittleEndian, uint32(consoleID))
+	h.Write([]byte{privilegeAdmin, byte(len(user))})
+	h.Write([]byte(user))
+	rakp3 := []byte{0x03, 0x00, 0x00, 0x00}
+	rakp3 = binary.LittleEndian.AppendUint32(rakp3, bmcID)
+	rakp3 = append(rakp3, h.Sum(nil)...)
+	resp = sessionless(t, conn, payloadRAKP3, rakp3)
+	if resp[1] != statusOK {
+		return nil, resp[1]
+	}
+	if !rakp2Valid {
+		t.Fatalf("RAKP2 key exchange authentication code mismatch")
+	}
+
+	// SIK = HMAC(Rm, Rc, ROLEm, ULENGTHm, UNAMEm)
+	h = hmac.New(suite.hash, []byte(password))
+	h.Write(consoleRandom)
+	h.Write(bmcRandom)
+	h.Write([]byte{privilegeAdmin, byte(len(user))})
+	h.Write([]byte(user))
+	sik := h.Sum(nil)
+	// ICV = HMAC(Rm, SIDc, GUIDc)
+	h = hmac.New(suite.hash, sik)
+	h.Write(consoleRandom)
+	binary.Write(h, binary.LittleEndian, bmcID)
+	h.Write(guid)
+	if !hmac.Equal(resp[8:], h.Sum(nil)[:suite.icvLength]) {
+		t.Fatalf("RAKP4 integrity check value mismatch")
+	}
+
+	k1, k2 := suite.deriveKeys(sik)
+	return &clientSession{conn: conn, suite: suite, bmcID: bmcID, k1: k1, k2: k2}, statusOK
+}
+
+// run sends a request in the session and returns the completion code and
+// data of the response.
+func (c *clientSession) run(t *testing.T, netFn, cmd byte, data ...byte) (byte, []byte) {
+	t.Helper()
+	c.seq++
+	return c.response(t, exchange(t, c.conn, c.message(t, c.seq, netFn, cmd, data...)))
+}
+
+// message encodes a request of the session with the given sequence number.
+func (c *clientSession) message(t *testing.T, seq uint32, netFn, cmd byte, data ...byte) []byte {
+	t.Helper()
+	msg, err := encodeRMCPPlus(payloadIPMI, c.bmcID, seq, request(netFn, cmd, byte(seq), data...), c.suite, c.k1, c.k2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// response returns the completion code and data of a response of the
+// session.
+func (c *clientSession) response(t *testing.T, resp []byte) (byte, []byte) {
+	t.Helper()
+	m, err := parseRMCPPlus(resp[rmcpHeaderLength:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.sessionID != 0xa0a1a2a3 || !hmac.Equal(m.authCode, c.suite.mac(c.k1, m.signed)[:c.suite.icvLength]) {
+		t.Fatalf("unexpected session ID or integrity check value")
+	}
+	payload, err := decrypt(c.k2, m.payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return completion(t, payload)
+}
+
+func TestPing(t *testing.T) {
+	_, conn := startServer(t, "")
+	ping := append(rmcpHeader(classASF), 0x00, 0x00, 0x11, 0xbe, 0x80, 0x07, 0x00, 0x00)
+	pong := exchange(t, conn, ping)
+	if len(pong) != 28 || pong[8] != 0x40 || pong[9] != 0x07 || pong[20] != 0x81 {
+		t.Errorf("unexpected pong % x", pong)
+	}
+}
+
+func TestSessionlessDiscovery(t *testing.T) {
+	_, conn := startServer(t, "")
+
+	// Get Channel Authentication Capabilities is sent in IPMI 1.5 format.
+	req := request(netFnApp, cmdGetChannelAuthCaps, 1, 0x8e, privilegeAdmin)
+	msg := append(rmcpHeader(classIPMI), make([]byte, 9)...)
+	msg = append(msg, byte(len(req)))
+	msg = append(msg, req...)
+	resp := exchange(t, conn, msg)
+	code, data := completion(t, resp[rmcpHeaderLength+10:])
+	if code != ccOK || data[1] != 0x80 || data[3]&0x02 == 0 {
+		t.Errorf("expected IPMI 2.0 support, got %x % x", code, data)
+	}
+
+	code, data = completion(t, sessionless(t, conn, payloadIPMI, request(netFnApp, cmdGetChannelCipherSuites, 2, 0x0e, 0x00, 0x80)))
+	expected := []byte{0x01, 0xc0, 17, 0x03, 0x44, 0x81, 0xc0, 3, 0x01, 0x41, 0x81}
+	if code != ccOK || !bytes.Equal(data, expected) {
+		t.Errorf("expected cipher suites % x, got %x % x", expected, code, data)
+	}
+
+	// Other commands need a session.
+	code, _ = completion(t, sessionless(t, conn, payloadIPMI, request(netFnChassis, cmdChassisControl, 3, 0x01)))
+	if code != ccInsufficientPriv {
+		t.Errorf("expected insufficient privilege, got %x", code)
+	}
+}
+
+func TestSession(t *testing.T) {
+	for _, suiteID := range []byte{3, 17} {
+		t.Run(fmt.Sprintf("cipher suite %d", suiteID), func(t *testing.T) {
+			backend, conn := startServer(t, "secret")
+			sess, status := openSession(t, conn, suiteID, "target1", "secret")
+			if status != statusOK {
+				t.Fatalf("session setup failed with status %x", status)
+			}
+
+			// Sessions start at the user privilege level.
+			if code, _ := sess.run(t, netFnChassis, cmdChassisControl, 0x01); code != ccInsufficientPriv {
+				t.Errorf("expected insufficient privilege, got %x", code)
+			}
+			if code, data := sess.run(t, netFnApp, cmdSetSessionPrivilegeLevel, privilegeAdmin); code != ccOK || data[0] != privilegeAdmin {
+				t.Fatalf("failed to raise the privilege level: %x % x", code, data)
+			}
+
+			if code, data := sess.run(t, netFnChassis, cmdGetChassisStatus); code != ccOK || data[0]&0x01 != 0 {
+				t.Errorf("expected power off, got %x % x", code, data)
+			}
+			if code, _ := sess.run(t, netFnChassis, cmdChassisControl, 0x01); code != ccOK {
+				t.Errorf("power on failed: %x", code)
+			}
+			if code, data := sess.run(t, netFnChassis, cmdGetChassisStatus); code != ccOK || data[0]&0x01 != 1 {
+				t.Errorf("expected power on, got %x % x", code, data)
+			}
+			if code, _ := sess.run(t, netFnChassis, cmdChassisControl, 0x05); code != ccOK {
+				t.Errorf("soft off failed: %x", code)
+			}
+
+			// Boot from PXE persistently, as 'ipmitool chassis bootdev pxe
+			// options=persistent' does.
+			if code, _ := sess.run(t, netFnChassis, cmdSetSystemBootOptions, bootParamValidBitClear, 0x08); code != ccOK {
+				t.Errorf("setting the valid bit clearing failed: %x", code)
+			}
+			if code, _ := sess.run(t, netFnChassis, cmdSetSystemBootOptions, bootParamFlags, 0xc0, 0x04, 0x00, 0x00, 0x00); code != ccOK {
+				t.Errorf("setting the boot device failed: %x", code)
+			}
+			code, data := sess.run(t, netFnChassis, cmdGetSystemBootOptions, bootParamFlags, 0x00, 0x00)
+			if expected := []byte{0x01, bootParamFlags, 0xc0, 0x04, 0x00, 0x00, 0x00}; code != ccOK || !bytes.Equal(data, expected) {
+				t.Errorf("expected boot flags % x, got %x % x", expected, code, data)
+			}
+
+			var id [4]byte
+			binary.LittleEndian.PutUint32(id[:], sess.bmcID)
+			if code, _ := sess.run(t, netFnApp, cmdCloseSession, id[:]...); code != ccOK {
+				t.Errorf("closing the session failed: %x", code)
+			}
+
+			expectedCalls := []string{"reset target1 On", "reset target1 GracefulShutdown", "boot target1 Pxe Continuous"}
+			backend.mu.Lock()
+			defer backend.mu.Unlock()
+			if !reflect.DeepEqual(backend.calls, expectedCalls) {
+				t.Errorf("expected calls %v, got %v", expectedCalls, backend.calls)
+			}
+		})
+	}
+}
+
+func TestSessionReplay(t *testing.T) {
+	_, conn := startServer(t, "secret")
+	sess, status := openSession(t, conn, 17, "target1", "secret")
+	if status != statusOK {
+		t.Fatalf("session setup failed with status %x", status)
+	}
+
+	first := sess.message(t, 1, netFnChassis, cmdGetChassisStatus)
+	if code, _ := sess.response(t, exchange(t, conn, first)); code != ccOK {
+		t.Fatalf("expected the chassis status, got %x", code)
+	}
+
+	tests := []struct {
+		name     string
+		seq      uint32
+		accepted bool
+	}{
+		{"replayed", 1, false},
+		{"ahead of the window", 1 + seqWindowAhead + 1, false},
+		{"ahead", 1 + seqWindowAhead, true},
+		{"out of order", 3, true},
+		{"replayed out of order", 3, false},
+		{"ahead again", 1 + 2*seqWindowAhead, true},
+		{"behind the window", 1 + 2*seqWindowAhead - seqWindowBehind - 1, false},
+	}
+	for _, tt := range tests {
+		msg := sess.message(t, tt.seq, netFnChassis, cmdGetChassisStatus)
+		if tt.accepted {
+			if code, _ := sess.response(t, exchange(t, conn, msg)); code != ccOK {
+				t.Errorf("%s: expected the chassis status, got %x", tt.name, code)
+			}
+			continue
+		}
+		if _, err := conn.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		if n, err := conn.Read(make([]byte, 1500)); err == nil {
+			t.Errorf("%s: expected sequence number %d to be ignored, got a %d bytes response", tt.name, tt.seq, n)
+		}
+	}
+}
+
+func TestSessionSetupFailures(t *testing.T) {
+	_, conn := startServer(t, "secret")
+
+	if _, status := openSession(t, conn, 3, "target1", "wrong"); status != statusInvalidICV {
+		t.Errorf("expected a wrong password to be rejected, got status %x", status)
+	}
+	if _, status := openSession(t, conn, 3, "missing", "secret"); status != statusUnauthorizedName {
+		t.Errorf("expected an unknown VM to be rejected, got status %x", status)
+	}
+
+	// Cipher suite 0 has no authentication.
+	open := []byte{0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00}
+	for i := range 3 {
+		open = append(open, byte(i), 0x00, 0x00, 0x08, 0x00, 0x00, 0x00, 0x00)
+	}
+	if resp := sessionless(t, conn, payloadOpenSessionReq, open); resp[1] != statusNoCipherSuiteMatch {
+		t.Errorf("expected no cipher suite match, got status %x", resp[1])
+	}
+}
+
+func TestNewServerPasswordLength(t *testing.T) {
+	if _, err := NewServer(&fakeBackend{}, "a-password-longer-than-20"); err == nil {
+		t.Error("expected an error for a password longer than 20 characters")
+	}
+}
@@ -0,0 +1,262 @@
+package ipmi
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+)
+
+// RMCP message classes.
+const (
+	classASF  = 0x06
+	classIPMI = 0x07
+)
+
+// Session authentication types of the session header. RMCP+ messages use
+// authTypeRMCPPlus, IPMI 1.5 messages are only accepted outside of a session.
+const (
+	authTypeNone     = 0x00
+	authTypeRMCPPlus = 0x06
+)
+
+// RMCP+ payload types, and the flags of the payload type byte.
+const (
+	payloadIPMI            = 0x00
+	payloadOpenSessionReq  = 0x10
+	payloadOpenSessionResp = 0x11
+	payloadRAKP1           = 0x12
+	payloadRAKP2           = 0x13
+	payloadRAKP3           = 0x14
+	payloadRAKP4           = 0x15
+
+	payloadEncrypted     = 0x80
+	payloadAuthenticated = 0x40
+	payloadTypeMask      = 0x3f
+)
+
+const (
+	rmcpHeaderLength        = 4
+	rmcpPlusHeaderLength    = 12
+	ipmiMessageHeaderLength = 6
+	// integrityNextHeader follows the integrity pad of authenticated
+	// messages.
+	integrityNextHeader   = 0x07
+	confidentialityAESCBC = 0x01
+	aesBlockSize          = aes.BlockSize
+	maxUserNameLength     = 16
+	maxPasswordLength     = 20
+	bmcSlaveAddress       = 0x20
+)
+
+// rmcpHeader is the header of RMCP messages that don't expect an ACK.
+func rmcpHeader(class byte) []byte {
+	return []byte{0x06, 0x00, 0xff, class}
+}
+
+// cipherSuite is a combination of RMCP+ authentication, integrity and
+// confidentiality algorithms.
+type cipherSuite struct {
+	id              byte
+	authentication  byte
+	integrity       byte
+	confidentiality byte
+	hash            func() hash.Hash
+	// icvLength is the length of the integrity check values of RAKP4 and
+	// of the session messages.
+	icvLength int
+}
+
+// cipherSuites are the supported cipher suites, most secure first.
+var cipherSuites = []cipherSuite{
+	// RAKP-HMAC-SHA256, HMAC-SHA256-128, AES-CBC-128.
+	{id: 17, authentication: 0x03, integrity: 0x04, confidentiality: confidentialityAESCBC, hash: sha256.New, icvLength: 16},
+	// RAKP-HMAC-SHA1, HMAC-SHA1-96, AES-CBC-128.
+	{id: 3, authentication: 0x01, integrity: 0x01, confidentiality: confidentialityAESCBC, hash: sha1.New, icvLength: 12},
+}
+
+func findCipherSuite(authentication, integrity, confidentiality byte) *cipherSuite {
+	for i := range cipherSuites {
+		c := &cipherSuites[i]
+		if c.authentication == authentication && c.integrity == integrity && c.confidentiality == confidentiality {
+			return c
+		}
+	}
+	return nil
+}
+
+func (c *cipherSuite) mac(key []byte, data ...[]byte) []byte {
+	h := hmac.New(c.hash, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// deriveKeys returns the integrity key K1 and the confidentiality key K2 of
+// a session from its session integrity key.
+func (c *cipherSuite) deriveKeys(sik []byte) (k1, k2 []byte) {
+	size := c.hash().Size()
+	return c.mac(sik, bytes.Repeat([]byte{0x01}, size)), c.mac(sik, bytes.Repeat([]byte{0x02}, size))
+}
+
+// ipmiRequest is an IPMI request message as sent over LAN.
+type ipmiRequest struct {
+	netFn, cmd byte
+	// rqAddr, rqSeq and rsLUN are copied from the request to address the
+	// response; rqSeq holds the requester's sequence number and LUN.
+	rqAddr, rqSeq, rsLUN byte
+	data                 []byte
+}
+
+func checksum(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return -sum
+}
+
+var errMalformed = errors.New("malformed message")
+
+func parseIPMIRequest(msg []byte) (*ipmiRequest, error) {
+	if len(msg) < ipmiMessageHeaderLength+1 || checksum(msg[:3]) != 0 || checksum(msg[3:]) != 0 {
+		return nil, errMalformed
+	}
+	return &ipmiRequest{
+		netFn:  msg[1] >> 2,
+		rsLUN:  msg[1] & 0x03,
+		rqAddr: msg[3],
+		rqSeq:  msg[4],
+		cmd:    msg[5],
+		data:   msg[6 : len(msg)-1],
+	}, nil
+}
+
+// response encodes the response to the request.
+func (r *ipmiRequest) response(code byte, data []byte) []byte {
+	msg := []byte{r.rqAddr, (r.netFn|1)<<2 | r.rqSeq&0x03}
+	msg = append(msg, checksum(msg))
+	msg = append(msg, bmcSlaveAddress, r.rqSeq&^0x03|r.rsLUN, r.cmd, code)
+	msg = append(msg, data...)
+	return append(msg, checksum(msg[3:]))
+}
+
+// rmcpPlusMessage is a decoded RMCP+ session message.
+type rmcpPlusMessage struct {
+	payloadType byte
+	sessionID   uint32
+	seq         uint32
+	payload     []byte
+	// signed is the part of the message covered by the integrity check
+	// value, authCode the integrity check value itself; both are nil for
+	// unauthenticated messages.
+	signed, authCode []byte
+}
+
+// parseRMCPPlus decodes an RMCP+ message, starting at its authentication
+// type.
+func parseRMCPPlus(body []byte) (*rmcpPlusMessage, error) {
+	if len(body) < rmcpPlusHeaderLength {
+		return nil, errMalformed
+	}
+	m := &rmcpPlusMessage{
+		payloadType: body[1],
+		sessionID:   binary.LittleEndian.Uint32(body[2:6]),
+		seq:         binary.LittleEndian.Uint32(body[6:10]),
+	}
+	length := int(binary.LittleEndian.Uint16(body[10:12]))
+	end := rmcpPlusHeaderLength + length
+	if len(body) < end {
+		return nil, errMalformed
+	}
+	m.payload = body[rmcpPlusHeaderLength:end]
+	if m.payloadType&payloadAuthenticated == 0 {
+		return m, nil
+	}
+	// The integrity pad is followed by its length, the next header and
+	// the authentication code, which takes the rest of the message.
+	padEnd := end
+	for padEnd < len(body) && body[padEnd] == 0xff {
+		padEnd++
+	}
+	if len(body) < padEnd+2 || int(body[padEnd]) != padEnd-end || body[padEnd+1] != integrityNextHeader {
+		return nil, errMalformed
+	}
+	m.signed = body[:padEnd+2]
+	m.authCode = body[padEnd+2:]
+	return m, nil
+}
+
+// encodeRMCPPlus encodes an RMCP+ message. If suite is not nil, the payload
+// is encrypted with k2 and the message authenticated with k1.
+func encodeRMCPPlus(payloadType byte, sessionID, seq uint32, payload []byte, suite *cipherSuite, k1, k2 []byte) ([]byte, error) {
+	if suite != nil {
+		encrypted, err := encrypt(k2, payload)
+		if err != nil {
+			return nil, err
+		}
+		payload = encrypted
+		payloadType |= payloadEncrypted | payloadAuthenticated
+	}
+	msg := []byte{authTypeRMCPPlus, payloadType}
+	msg = binary.LittleEndian.AppendUint32(msg, sessionID)
+	msg = binary.LittleEndian.AppendUint32(msg, seq)
+	msg = binary.LittleEndian.AppendUint16(msg, uint16(len(payload)))
+	msg = append(msg, payload...)
+	if suite != nil {
+		// The pad aligns the data covered by the authentication code,
+		// including the pad length and next header, to 4 bytes.
+		pad := (4 - (len(msg)+2)%4) % 4
+		msg = append(msg, bytes.Repeat([]byte{0xff}, pad)...)
+		msg = append(msg, byte(pad), integrityNextHeader)
+		msg = append(msg, suite.mac(k1, msg)[:suite.icvLength]...)
+	}
+	return append(rmcpHeader(classIPMI), msg...), nil
+}
+
+// encrypt encrypts a payload with AES-CBC-128, prefixing it with its IV. The
+// pad bytes are numbered from 1 and followed by the pad length.
+func encrypt(k2, payload []byte) ([]byte, error) {
+	block, err := aes.NewCipher(k2[:16])
+	if err != nil {
+		return nil, err
+	}
+	pad := (aesBlockSize - (len(payload)+1)%aesBlockSize) % aesBlockSize
+	plain := append([]byte{}, payload...)
+	for i := 1; i <= pad; i++ {
+		plain = append(plain, byte(i))
+	}
+	plain = append(plain, byte(pad))
+
+	out := make([]byte, aesBlockSize+len(plain))
+	if _, err := rand.Read(out[:aesBlockSize]); err != nil {
+		return nil, err
+	}
+	cipher.NewCBCEncrypter(block, out[:aesBlockSize]).CryptBlocks(out[aesBlockSize:], plain)
+	return out, nil
+}
+
+// decrypt reverses encrypt.
+func decrypt(k2, payload []byte) ([]byte, error) {
+	if len(payload) < 2*aesBlockSize || len(payload)%aesBlockSize != 0 {
+		return nil, errMalformed
+	}
+	block, err := aes.NewCipher(k2[:16])
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(payload)-aesBlockSize)
+	cipher.NewCBCDecrypter(block, payload[:aesBlockSize]).CryptBlocks(plain, payload[aesBlockSize:])
+	pad := int(plain[len(plain)-1])
+	if pad >= aesBlockSize {
+		return nil, errMalformed
+	}
+	return plain[:len(plain)-1-pad], nil
+}
@@ -0,0 +1,366 @@
+// Package iso9660 writes ISO 9660 images with Joliet extensions, such as the
+// NoCloud seed images of cloud-init, without depending on mkisofs.
+//
+// Only flat images are supported: all the files are at the root of the image,
+// which is all cloud-init needs.
+package iso9660
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	sectorSize = 2048
+
+	// The first 16 sectors of an image are its system area, which is unused.
+	pvdSector        = 16
+	svdSector        = 17
+	terminatorSector = 18
+	pathTablesSector = 19
+	rootSector       = 23
+
+	// maxJolietName is the maximum length of the Joliet names, in UCS-2
+	// characters.
+	maxJolietName = 64
+	// maxISOName is the maximum length of the ISO 9660 names of level 2, with
+	// the separator.
+	maxISOName = 31
+
+	flagDirectory = 0x02
+)
+
+// jolietEscape is the escape sequence of the supplementary volume descriptor
+// of Joliet UCS-2 level 3.
+var jolietEscape = []byte("%/E")
+
+// File is a file at the root of an image.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// entry is a file laid out in the image.
+type entry struct {
+	File
+	isoName    []byte
+	jolietName []byte
+	extent     uint32
+}
+
+// WriteDir writes to path an image labelled volumeID of the regular files of
+// dir, like 'mkisofs -o path -V volumeID -J dir' does for flat directories.
+func WriteDir(path, volumeID, dir string) error {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var files []File
+	for _, de := range dirEntries {
+		if !de.Type().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, de.Name()))
+		if err != nil {
+			return err
+		}
+		files = append(files, File{Name: de.Name(), Data: data})
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := Write(w, volumeID, files, time.Now()); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write writes to w an image labelled volumeID with files at its root, dated
+// modTime.
+func Write(w io.Writer, volumeID string, files []File, modTime time.Time) error {
+	entries, err := layout(files)
+	if err != nil {
+		return err
+	}
+	modTime = modTime.UTC()
+
+	// The primary and the Joliet directories, then the files.
+	isoSectors := dirSectors(entries, func(e *entry) []byte { return e.isoName })
+	jolietSectors := dirSectors(entries, func(e *entry) []byte { return e.jolietName })
+	isoRoot := uint32(rootSector)
+	jolietRoot := isoRoot + isoSectors
+	next := jolietRoot + jolietSectors
+	for _, e := range entries {
+		if len(e.Data) == 0 {
+			continue
+		}
+		e.extent = next
+		next += sectors(len(e.Data))
+	}
+	volumeSectors := next
+
+	image := make([]byte, int(jolietRoot+jolietSectors)*sectorSize)
+	sector := func(n uint32) []byte {
+		return image[n*sectorSize : (n+1)*sectorSize]
+	}
+
+	isoRootRecord := dirRecord([]byte{0}, isoRoot, isoSectors*sectorSize, flagDirectory, modTime)
+	jolietRootRecord := dirRecord([]byte{0}, jolietRoot, jolietSectors*sectorSize, flagDirectory, modTime)
+
+	volumeDescriptor(sector(pvdSector), 1, volumeID, volumeSectors, isoRootRecord, pathTablesSector, modTime, false)
+	volumeDescriptor(sector(svdSector), 2, volumeID, volumeSectors, jolietRootRecord, pathTablesSector+2, modTime, true)
+	terminator := sector(terminatorSector)
+	terminator[0] = 255
+	copy(terminator[1:], "CD001")
+	terminator[6] = 1
+
+	pathTables(sector(pathTablesSector), sector(pathTablesSector+1), isoRoot)
+	pathTables(sector(pathTablesSector+2), sector(pathTablesSector+3), jolietRoot)
+
+	sortByName(entries, func(e *entry) []byte { return e.isoName })
+	writeDir(image[isoRoot*sectorSize:jolietRoot*sectorSize], isoRootRecord, entries, func(e *entry) []byte { return e.isoName }, modTime)
+	sortByName(entries, func(e *entry) []byte { return e.jolietName })
+	writeDir(image[jolietRoot*sectorSize:], jolietRootRecord, entries, func(e *entry) []byte { return e.jolietName }, modTime)
+
+	if _, err := w.Write(image); err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].extent < entries[j].extent })
+	for _, e := range entries {
+		if len(e.Data) == 0 {
+			continue
+		}
+		if _, err := w.Write(e.Data); err != nil {
+			return err
+		}
+		if _, err := w.Write(make([]byte, int(sectors(len(e.Data)))*sectorSize-len(e.Data))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// layout checks the files and computes their names in the image.
+func layout(files []File) ([]*entry, error) {
+	entries := make([]*entry, 0, len(files))
+	isoNames := map[string]bool{}
+	jolietNames := map[string]bool{}
+	for _, f := range files {
+		if f.Name == "" || strings.ContainsAny(f.Name, "/\\") {
+			return nil, fmt.Errorf("invalid file name '%s'", f.Name)
+		}
+		if uint64(len(f.Data)) > 0xffffffff {
+			return nil, fmt.Errorf("file '%s' is too large", f.Name)
+		}
+		joliet := utf16.Encode([]rune(f.Name))
+		if len(joliet) > maxJolietName {
+			return nil, fmt.Errorf("file name '%s' is longer than %d characters", f.Name, maxJolietName)
+		}
+		if jolietNames[f.Name] {
+			return nil, fmt.Errorf("duplicate file name '%s'", f.Name)
+		}
+		jolietNames[f.Name] = true
+
+		e := &entry{File: f, jolietName: make([]byte, 2*len(joliet))}
+		for i, c := range joliet {
+			binary.BigEndian.PutUint16(e.jolietName[2*i:], c)
+		}
+		e.isoName = []byte(isoName(f.Name, isoNames))
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// isoName returns the ISO 9660 name of a file: upper case d-characters, with
+// the name and extension separator and the version. Names mapping to the same
+// ISO 9660 name are numbered, the Joliet names keep the original ones.
+func isoName(name string, taken map[string]bool) string {
+	base, ext := name, ""
+	if i := strings.LastIndex(name, "."); i > 0 {
+		base, ext = name[:i], name[i+1:]
+	}
+	base, ext = dChars(base), dChars(ext)
+	if len(ext) > 3 && len(base)+1+len(ext) > maxISOName {
+		ext = ext[:3]
+	}
+	if len(base)+1+len(ext) > maxISOName {
+		base = base[:maxISOName-1-len(ext)]
+	}
+	candidate := base + "." + ext
+	for i := 1; taken[candidate]; i++ {
+		suffix := fmt.Sprintf("_%d", i)
+		b := base
+		if len(b)+len(suffix)+1+len(ext) > maxISOName {
+			b = b[:maxISOName-len(suffix)-1-len(ext)]
+		}
+		candidate = b + suffix + "." + ext
+	}
+	taken[candidate] = true
+	return candidate + ";1"
+}
+
+func dChars(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return '_'
+	}, s)
+}
+
+func sortByName(entries []*entry, name func(*entry) []byte) {
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(name(entries[i]), name(entries[j])) < 0 })
+}
+
+func sectors(size int) uint32 {
+	return uint32((size + sectorSize - 1) / sectorSize)
+}
+
+// dirSectors returns the number of sectors of the root directory. Directory
+// records can't span two sectors.
+func dirSectors(entries []*entry, name func(*entry) []byte) uint32 {
+	n, used := uint32(1), 2*recordLen(1)
+	for _, e := range entries {
+		l := recordLen(len(name(e)))
+		if used+l > sectorSize {
+			n++
+			used = 0
+		}
+		used += l
+	}
+	return n
+}
+
+func recordLen(nameLen int) int {
+	return 33 + nameLen + (nameLen+1)%2
+}
+
+// writeDir writes the root directory, whose own record is self, to dir.
+func writeDir(dir, self []byte, entries []*entry, name func(*entry) []byte, modTime time.Time) {
+	// The root directory is its own parent.
+	off := copy(dir, self)
+	parent := append([]byte(nil), self...)
+	parent[32+1] = 1
+	off += copy(dir[off:], parent)
+	for _, e := range entries {
+		record := dirRecord(name(e), e.extent, uint32(len(e.Data)), 0, modTime)
+		if off%sectorSize+len(record) > sectorSize {
+			off += sectorSize - off%sectorSize
+		}
+		off += copy(dir[off:], record)
+	}
+}
+
+// dirRecord returns a directory record, see ECMA-119 9.1.
+func dirRecord(id []byte, extent, size uint32, flags byte, modTime time.Time) []byte {
+	r := make([]byte, recordLen(len(id)))
+	r[0] = byte(len(r))
+	bothEndian32(r[2:], extent)
+	bothEndian32(r[10:], size)
+	r[18] = byte(modTime.Year() - 1900)
+	r[19] = byte(modTime.Month())
+	r[20] = byte(modTime.Day())
+	r[21] = byte(modTime.Hour())
+	r[22] = byte(modTime.Minute())
+	r[23] = byte(modTime.Second())
+	r[25] = flags
+	bothEndian16(r[28:], 1)
+	r[32] = byte(len(id))
+	copy(r[33:], id)
+	return r
+}
+
+// volumeDescriptor writes a primary (type 1) or Joliet supplementary (type 2)
+// volume descriptor, see ECMA-119 8.4 and 8.5.
+func volumeDescriptor(d []byte, kind byte, volumeID string, volumeSectors uint32, rootRecord []byte, pathTable uint32, modTime time.Time, joliet bool) {
+	d[0] = kind
+	copy(d[1:], "CD001")
+	d[6] = 1
+	text(d[8:40], "", joliet)
+	text(d[40:72], volumeID, joliet)
+	bothEndian32(d[80:], volumeSectors)
+	if joliet {
+		copy(d[88:], jolietEscape)
+	}
+	bothEndian16(d[120:], 1)
+	bothEndian16(d[124:], 1)
+	bothEndian16(d[128:], sectorSize)
+	bothEndian32(d[132:], pathTableSize)
+	binary.LittleEndian.PutUint32(d[140:], pathTable)
+	binary.BigEndian.PutUint32(d[148:], pathTable+1)
+	copy(d[156:190], rootRecord)
+	text(d[190:318], "", joliet)
+	text(d[318:446], "", joliet)
+	text(d[446:574], "", joliet)
+	text(d[574:702], "PVMLAB", joliet)
+	text(d[702:739], "", joliet)
+	text(d[739:776], "", joliet)
+	text(d[776:813], "", joliet)
+	date := fmt.Sprintf("%04d%02d%02d%02d%02d%02d00",
+		modTime.Year(), modTime.Month(), modTime.Day(), modTime.Hour(), modTime.Minute(), modTime.Second())
+	copy(d[813:], date)
+	copy(d[830:], date)
+	copy(d[847:], "0000000000000000")
+	copy(d[864:], date)
+	d[881] = 1
+}
+
+// text writes s padded with spaces to field, in UCS-2 for Joliet.
+func text(field []byte, s string, joliet bool) {
+	if !joliet {
+		copy(field, s+strings.Repeat(" ", len(field)))
+		return
+	}
+	chars := utf16.Encode([]rune(s))
+	for i := 0; i+1 < len(field); i += 2 {
+		c := uint16(' ')
+		if i/2 < len(chars) {
+			c = chars[i/2]
+		}
+		binary.BigEndian.PutUint16(field[i:], c)
+	}
+}
+
+// pathTableSize is the size of the path tables, which only have the root.
+const pathTableSize = 10
+
+// pathTables writes the little and big endian path tables, see ECMA-119 9.4.
+func pathTables(l, m []byte, root uint32) {
+	for _, t := range [][]byte{l, m} {
+		t[0] = 1
+	}
+	binary.LittleEndian.PutUint32(l[2:], root)
+	binary.LittleEndian.PutUint16(l[6:], 1)
+	binary.BigEndian.PutUint32(m[2:], root)
+	binary.BigEndian.PutUint16(m[6:], 1)
+}
+
+func bothEndian32(b []byte, v uint32) {
+	binary.LittleEndian.PutUint32(b, v)
+	binary.BigEndian.PutUint32(b[4:], v)
+}
+
+func bothEndian16(b []byte, v uint16) {
+	binary.LittleEndian.PutUint16(b, v)
+	binary.BigEndian.PutUint16(b[2:], v)
+}
@@ -0,0 +1,156 @@
+package iso9660
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readRoot returns the files of the root directory of the volume described
+// at sector, by name.
+func readRoot(t *testing.T, image []byte, sector int, joliet bool) map[string]string {
+	t.Helper()
+	d := image[sector*sectorSize:]
+	root := d[156:190]
+	extent := binary.LittleEndian.Uint32(root[2:])
+	size := binary.LittleEndian.Uint32(root[10:])
+	assert.Equal(t, extent, binary.BigEndian.Uint32(root[6:]), "both-endian extent")
+
+	files := map[string]string{}
+	dir := image[extent*sectorSize : extent*sectorSize+size]
+	for off := 0; off < len(dir); {
+		l := int(dir[off])
+		if l == 0 {
+			// The rest of the sector is padding.
+			off += sectorSize - off%sectorSize
+			continue
+		}
+		r := dir[off : off+l]
+		off += l
+		id := r[33 : 33+int(r[32])]
+		if len(id) == 1 && id[0] <= 1 {
+			continue
+		}
+		name := string(id)
+		if joliet {
+			chars := make([]uint16, len(id)/2)
+			for i := range chars {
+				chars[i] = binary.BigEndian.Uint16(id[2*i:])
+			}
+			name = string(utf16.Decode(chars))
+		}
+		fileExtent := binary.LittleEndian.Uint32(r[2:])
+		fileSize := binary.LittleEndian.Uint32(r[10:])
+		files[name] = string(image[fileExtent*sectorSize : fileExtent*sectorSize+fileSize])
+	}
+	return files
+}
+
+func TestWrite(t *testing.T) {
+	files := []File{
+		{Name: "user-data", Data: []byte("#cloud-config\n")},
+		{Name: "meta-data", Data: []byte("instance-id: vm1\n")},
+		{Name: "network-config", Data: bytes.Repeat([]byte("x"), 3*sectorSize+1)},
+		{Name: "vendor-data"},
+		{Name: "vendor_data"},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, "cidata", files, time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	image := buf.Bytes()
+	if len(image)%sectorSize != 0 {
+		t.Fatalf("the image size %d is not a multiple of the sector size", len(image))
+	}
+
+	pvd := image[pvdSector*sectorSize:]
+	assert.Equal(t, []byte{1, 'C', 'D', '0', '0', '1', 1}, pvd[:7])
+	assert.Equal(t, "cidata", strings.TrimSpace(string(pvd[40:72])))
+	assert.Equal(t, uint32(len(image)/sectorSize), binary.LittleEndian.Uint32(pvd[80:]))
+	assert.Equal(t, "20250102030405", string(pvd[813:827]))
+
+	svd := image[svdSector*sectorSize:]
+	assert.Equal(t, byte(2), svd[0])
+	assert.Equal(t, jolietEscape, svd[88:91])
+	assert.Equal(t, byte(255), image[terminatorSector*sectorSize])
+
+	expected := map[string]string{}
+	for _, f := range files {
+		expected[f.Name] = string(f.Data)
+	}
+	assert.Equal(t, expected, readRoot(t, image, svdSector, true))
+
+	isoNames := map[string]string{
+		"META_DATA.;1":      "instance-id: vm1\n",
+		"NETWORK_CONFIG.;1": expected["network-config"],
+		"USER_DATA.;1":      "#cloud-config\n",
+		"VENDOR_DATA.;1":    "",
+		"VENDOR_DATA_1.;1":  "",
+	}
+	assert.Equal(t, isoNames, readRoot(t, image, pvdSector, false))
+}
+
+func TestWrite_ManyFiles(t *testing.T) {
+	// The root directory spans several sectors.
+	var files []File
+	for i := 0; i < 100; i++ {
+		files = append(files, File{Name: strings.Repeat("f", 40) + string(rune('a'+i%26)) + strings.Repeat("g", i/26), Data: []byte{byte(i)}})
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, "cidata", files, time.Now()); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	got := readRoot(t, buf.Bytes(), svdSector, true)
+	if len(got) != len(files) {
+		t.Fatalf("expected %d files, got %d", len(files), len(got))
+	}
+	for _, f := range files {
+		assert.Equal(t, string(f.Data), got[f.Name])
+	}
+}
+
+func TestWrite_InvalidNames(t *testing.T) {
+	for _, files := range [][]File{
+		{{Name: ""}},
+		{{Name: "dir/file"}},
+		{{Name: strings.Repeat("a", maxJolietName+1)}},
+		{{Name: "user-data"}, {Name: "user-data"}},
+	} {
+		if err := Write(&bytes.Buffer{}, "cidata", files, time.Now()); err == nil {
+			t.Errorf("expected an error for %v", files)
+		}
+	}
+}
+
+func TestWriteDir(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{"meta-data": "instance-id: vm1\n", "user-data": "#cloud-config\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "subdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	isoPath := filepath.Join(t.TempDir(), "seed.iso")
+	if err := WriteDir(isoPath, "cidata", dir); err != nil {
+		t.Fatalf("WriteDir() failed: %v", err)
+	}
+	image, err := os.ReadFile(isoPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]string{"meta-data": "instance-id: vm1\n", "user-data": "#cloud-config\n"}, readRoot(t, image, svdSector, true))
+
+	if err := WriteDir(isoPath, "cidata", filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
@@ -1,15 +1,21 @@
 package metadata
 
 import (
-	"encoding/json"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
 	"pvmlab/internal/config"
+	"sort"
 )
 
+// Metadata is the record of a VM, stored in the vms directory as <name>.json.
+// The files are also read by the boot handler of the provisioner, see
+// Migrations before renaming or removing fields.
 type Metadata struct {
+	// SchemaVersion is the version of the record format, see
+	// CurrentSchemaVersion.
+	SchemaVersion    int    `json:"schema_version"`
 	Name             string `json:"name"`
 	Role             string `json:"role"`
 	Arch             string `json:"arch"`
@@ -24,66 +30,102 @@ type Metadata struct {
 	SSHPort          int    `json:"ssh_port,omitempty"`
 	PxeBoot          bool   `json:"pxeboot,omitempty"`
 	Distro           string `json:"distro,omitempty"`
+	DistroFamily     string `json:"distro_family,omitempty"`
 	SSHKey           string `json:"ssh_key,omitempty"`
 	Kernel           string `json:"kernel,omitempty"`
 	Initrd           string `json:"initrd,omitempty"`
+	// CPUs, MemoryMB, CPUModel and Machine override the QEMU defaults when set.
+	CPUs     int    `json:"cpus,omitempty"`
+	MemoryMB int    `json:"memory_mb,omitempty"`
+	CPUModel string `json:"cpu_model,omitempty"`
+	Machine  string `json:"machine,omitempty"`
+	// BaseImage is the SHA-256 digest of the cached image the root disk of
+	// the VM is backed on, which the cache keeps while the VM exists.
+	BaseImage string `json:"base_image,omitempty"`
+	// Disks are the data disks attached to the VM in addition to its root disk.
+	Disks []Disk `json:"disks,omitempty"`
+	// CloneOf is the name of the VM whose disk backs this VM's disk, if the
+	// VM was created with `pvmlab vm clone`.
+	CloneOf string `json:"clone_of,omitempty"`
+	// VirtualMedia is the URL of the ISO image inserted in the VM's virtual
+	// CD drive by the BMC, if any. The image is stored in the vms directory
+	// as <vm>-media.iso.
+	VirtualMedia string `json:"virtual_media,omitempty"`
+}
+
+// Disk describes a data disk of a VM. Its image is stored in the vms
+// directory as <vm>-<name>.qcow2.
+type Disk struct {
+	Name   string `json:"name"`
+	Size   string `json:"size"`
+	Bus    string `json:"bus"`
+	Serial string `json:"serial,omitempty"`
 }
 
 func getVMsDir(cfg *config.Config) string {
 	return filepath.Join(cfg.GetAppDir(), "vms")
 }
 
-// Save saves the VM's metadata to a file.
-var Save = func(cfg *config.Config, vmName, role, arch, ip, subnet, ipv6, subnetv6, mac, pxeBootStackTar, dockerImagesPath, vmsPath, sshKey, kernel, initrd string, sshPort int, pxeBoot bool, distro string) error {
-	meta := Metadata{
-		Name:             vmName,
-		Role:             role,
-		Arch:             arch,
-		IP:               ip,
-		Subnet:           subnet,
-		IPv6:             ipv6,
-		SubnetV6:         subnetv6,
-		MAC:              mac,
-		PxeBootStackTar:  pxeBootStackTar,
-		DockerImagesPath: dockerImagesPath,
-		VMsPath:          vmsPath,
-		SSHPort:          sshPort,
-		PxeBoot:          pxeBoot,
-		Distro:           distro,
-		SSHKey:           sshKey,
-		Kernel:           kernel,
-		Initrd:           initrd,
-	}
-
-	data, err := json.MarshalIndent(meta, "", "  ")
+// Write saves the given metadata to the VM's metadata file. The file is
+// replaced atomically while holding the store lock.
+var Write = func(cfg *config.Config, meta *Metadata) error {
+	unlock, err := lockStore(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to marshal metadata: %w", err)
+		return err
 	}
+	defer unlock()
+	return write(cfg, meta)
+}
 
-	vmsDir := getVMsDir(cfg)
-
-	if err := os.MkdirAll(vmsDir, 0755); err != nil {
-		return fmt.Errorf("failed to create vms directory: %w", err)
+// Load returns the metadata of a VM. Records written with an older schema
+// version are upgraded and saved while holding the store lock, so that the
+// boot handler of the provisioner, which reads the files directly, sees the
+// migrated fields.
+var Load = func(cfg *config.Config, vmName string) (*Metadata, error) {
+	meta, upgraded, err := readRecord(cfg, vmName)
+	// Records that loadLocked wouldn't save don't need the lock, which the
+	// callback of Create already holds.
+	if err != nil || !upgraded || meta.Name != vmName {
+		return meta, err
 	}
 
-	metaPath := filepath.Join(vmsDir, vmName+".json")
-	return os.WriteFile(metaPath, data, 0644)
+	unlock, err := lockStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return loadLocked(cfg, vmName)
 }
 
-var Load = func(cfg *config.Config, vmName string) (*Metadata, error) {
-	vmsDir := getVMsDir(cfg)
+// readRecord reads and decodes the metadata of a VM without saving it, and
+// reports whether the record was upgraded from an older schema version.
+func readRecord(cfg *config.Config, vmName string) (*Metadata, bool, error) {
+	data, err := os.ReadFile(filepath.Join(getVMsDir(cfg), vmName+".json"))
+	if err != nil {
+		return nil, false, err
+	}
 
-	metaPath := filepath.Join(vmsDir, vmName+".json")
-	data, err := os.ReadFile(metaPath)
+	meta, upgraded, err := decode(data)
 	if err != nil {
-		return nil, err
+		return nil, false, fmt.Errorf("failed to unmarshal metadata for %s: %w", vmName, err)
 	}
+	return meta, upgraded, nil
+}
 
-	var meta Metadata
-	if err := json.Unmarshal(data, &meta); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal metadata for %s: %w", vmName, err)
+// loadLocked returns the metadata of a VM like Load, for callers that already
+// hold the store lock. Records whose name doesn't match their file are not
+// saved, since that would write another file; Check repairs them.
+func loadLocked(cfg *config.Config, vmName string) (*Metadata, error) {
+	meta, upgraded, err := readRecord(cfg, vmName)
+	if err != nil {
+		return nil, err
 	}
-	return &meta, nil
+	if upgraded && meta.Name == vmName {
+		if err := write(cfg, meta); err != nil {
+			return nil, fmt.Errorf("failed to save the upgraded metadata of %s: %w", vmName, err)
+		}
+	}
+	return meta, nil
 }
 
 var FindProvisioner = func(cfg *config.Config) (string, error) {
@@ -139,16 +181,44 @@ var FindVM = func(cfg *config.Config, vmName string) (string, error) {
 	return "", nil
 }
 
+// FindClones returns the names of the VMs whose disks are backed by the disk
+// of the given VM, sorted by name.
+var FindClones = func(cfg *config.Config, vmName string) ([]string, error) {
+	allMeta, err := GetAll(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var clones []string
+	for name, meta := range allMeta {
+		if meta.CloneOf == vmName {
+			clones = append(clones, name)
+		}
+	}
+	sort.Strings(clones)
+	return clones, nil
+}
+
 var Delete = func(cfg *config.Config, vmName string) error {
-	vmsDir := getVMsDir(cfg)
-	metaPath := filepath.Join(vmsDir, vmName+".json")
-	if _, err := os.Stat(metaPath); err == nil {
-		return os.Remove(metaPath)
+	unlock, err := lockStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	metaPath := filepath.Join(getVMsDir(cfg), vmName+".json")
+	if err := os.Remove(metaPath); err != nil && !os.IsNotExist(err) {
+		return err
 	}
 	return nil
 }
 
 var GetAll = func(cfg *config.Config) (map[string]*Metadata, error) {
+	return getAll(cfg, Load)
+}
+
+// getAll loads the metadata of every VM with the given function, skipping
+// malformed records.
+func getAll(cfg *config.Config, load func(*config.Config, string) (*Metadata, error)) (map[string]*Metadata, error) {
 	vmsDir := getVMsDir(cfg)
 
 	allMeta := make(map[string]*Metadata)
@@ -164,9 +234,9 @@ var GetAll = func(cfg *config.Config) (map[string]*Metadata, error) {
 	for _, file := range files {
 		if filepath.Ext(file.Name()) == ".json" {
 			vmName := file.Name()[:len(file.Name())-len(".json")]
-			meta, err := Load(cfg, vmName)
+			meta, err := load(cfg, vmName)
 			if err != nil {
-				// Log or ignore malformed metadata files
+				// Malformed metadata files are reported by Check.
 				continue
 			}
 			allMeta[vmName] = meta
@@ -181,7 +251,13 @@ var CheckForDuplicateIPs = func(cfg *config.Config, ip, ipv6 string) error {
 	if err != nil {
 		return fmt.Errorf("failed to get all VMs: %w", err)
 	}
+	return CheckForDuplicateIPsIn(allVMs, ip, ipv6)
+}
 
+// CheckForDuplicateIPsIn is CheckForDuplicateIPs for the VMs of allVMs. It
+// doesn't read the store, so the callback of Create can call it with the VMs
+// it is given.
+var CheckForDuplicateIPsIn = func(allVMs map[string]*Metadata, ip, ipv6 string) error {
 	var newIP net.IP
 	if ip != "" {
 		var err error
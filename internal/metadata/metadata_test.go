@@ -28,7 +28,7 @@ func setup(t *testing.T) (*config.Config, func()) {
 	return cfg, cleanup
 }
 
-func TestSaveLoad(t *testing.T) {
+func TestWriteLoad(t *testing.T) {
 	cfg, cleanup := setup(t)
 	defer cleanup()
 
@@ -41,9 +41,9 @@ func TestSaveLoad(t *testing.T) {
 	dockerImagesPath := "/path/to/docker/images"
 	vmsPath := "/path/to/vms"
 
-	err := Save(cfg, vmName, role, "aarch64", ip, subnet, "", "", mac, pxeBootStackTar, dockerImagesPath, vmsPath, "", "", "", 0, false, "")
+	err := Write(cfg, &Metadata{Name: vmName, Role: role, Arch: "aarch64", IP: ip, Subnet: subnet, MAC: mac, PxeBootStackTar: pxeBootStackTar, DockerImagesPath: dockerImagesPath, VMsPath: vmsPath})
 	if err != nil {
-		t.Fatalf("Save() failed: %v", err)
+		t.Fatalf("Write() failed: %v", err)
 	}
 
 	meta, err := Load(cfg, vmName)
@@ -52,6 +52,7 @@ func TestSaveLoad(t *testing.T) {
 	}
 
 	want := &Metadata{
+		SchemaVersion:    CurrentSchemaVersion,
 		Name:             vmName,
 		Role:             "provisioner",
 		Arch:             "aarch64",
@@ -72,14 +73,14 @@ func TestSaveLoad(t *testing.T) {
 func TestFindProvisioner(t *testing.T) {
 	cfg, cleanup := setup(t)
 	defer cleanup()
-	if err := Save(cfg, "vm1", "target", "aarch64", "", "", "", "", "mac1", "", "", "", "", "", "", 0, false, ""); err != nil {
-		t.Fatalf("Save() failed for vm1: %v", err)
+	if err := Write(cfg, &Metadata{Name: "vm1", Role: "target", Arch: "aarch64", MAC: "mac1"}); err != nil {
+		t.Fatalf("Write() failed for vm1: %v", err)
 	}
-	if err := Save(cfg, "vm2", "provisioner", "aarch64", "ip2", "subnet2", "", "", "mac2", "pxe2", "docker2", "", "", "", "", 45678, false, ""); err != nil {
-		t.Fatalf("Save() failed for vm2: %v", err)
+	if err := Write(cfg, &Metadata{Name: "vm2", Role: "provisioner", Arch: "aarch64", IP: "ip2", Subnet: "subnet2", MAC: "mac2", PxeBootStackTar: "pxe2", DockerImagesPath: "docker2", SSHPort: 45678}); err != nil {
+		t.Fatalf("Write() failed for vm2: %v", err)
 	}
-	if err := Save(cfg, "vm3", "target", "aarch64", "", "", "", "", "mac3", "", "", "", "", "", "", 0, false, ""); err != nil {
-		t.Fatalf("Save() failed for vm3: %v", err)
+	if err := Write(cfg, &Metadata{Name: "vm3", Role: "target", Arch: "aarch64", MAC: "mac3"}); err != nil {
+		t.Fatalf("Write() failed for vm3: %v", err)
 	}
 
 	provisionerName, err := FindProvisioner(cfg)
@@ -97,8 +98,8 @@ func TestDelete(t *testing.T) {
 	defer cleanup()
 
 	vmName := "vm-to-delete"
-	if err := Save(cfg, vmName, "target", "aarch64", "", "", "", "", "mac", "", "", "", "", "", "", 0, false, ""); err != nil {
-		t.Fatalf("Save() failed: %v", err)
+	if err := Write(cfg, &Metadata{Name: vmName, Role: "target", Arch: "aarch64", MAC: "mac"}); err != nil {
+		t.Fatalf("Write() failed: %v", err)
 	}
 
 	err := Delete(cfg, vmName)
@@ -117,11 +118,11 @@ func TestGetAll(t *testing.T) {
 	cfg, cleanup := setup(t)
 	defer cleanup()
 
-	if err := Save(cfg, "vm1", "target", "aarch64", "", "", "", "", "mac1", "", "", "", "", "", "", 0, false, ""); err != nil {
-		t.Fatalf("Save() failed for vm1: %v", err)
+	if err := Write(cfg, &Metadata{Name: "vm1", Role: "target", Arch: "aarch64", MAC: "mac1"}); err != nil {
+		t.Fatalf("Write() failed for vm1: %v", err)
 	}
-	if err := Save(cfg, "vm2", "provisioner", "aarch64", "ip2", "subnet2", "", "", "mac2", "pxe2", "docker2", "", "", "", "", 45678, false, ""); err != nil {
-		t.Fatalf("Save() failed for vm2: %v", err)
+	if err := Write(cfg, &Metadata{Name: "vm2", Role: "provisioner", Arch: "aarch64", IP: "ip2", Subnet: "subnet2", MAC: "mac2", PxeBootStackTar: "pxe2", DockerImagesPath: "docker2", SSHPort: 45678}); err != nil {
+		t.Fatalf("Write() failed for vm2: %v", err)
 	}
 
 	allMeta, err := GetAll(cfg)
@@ -146,11 +147,11 @@ func TestGetProvisioner(t *testing.T) {
 	defer cleanup()
 
 	// Scenario 1: Provisioner exists
-	if err := Save(cfg, "vm1", "target", "aarch64", "", "", "", "", "mac1", "", "", "", "", "", "", 0, false, ""); err != nil {
-		t.Fatalf("Save() failed for vm1: %v", err)
+	if err := Write(cfg, &Metadata{Name: "vm1", Role: "target", Arch: "aarch64", MAC: "mac1"}); err != nil {
+		t.Fatalf("Write() failed for vm1: %v", err)
 	}
-	if err := Save(cfg, "vm2", "provisioner", "aarch64", "ip2", "subnet2", "", "", "mac2", "pxe2", "docker2", "", "", "", "", 45678, false, ""); err != nil {
-		t.Fatalf("Save() failed for vm2: %v", err)
+	if err := Write(cfg, &Metadata{Name: "vm2", Role: "provisioner", Arch: "aarch64", IP: "ip2", Subnet: "subnet2", MAC: "mac2", PxeBootStackTar: "pxe2", DockerImagesPath: "docker2", SSHPort: 45678}); err != nil {
+		t.Fatalf("Write() failed for vm2: %v", err)
 	}
 
 	provisioner, err := GetProvisioner(cfg)
@@ -165,8 +166,8 @@ func TestGetProvisioner(t *testing.T) {
 	cleanup()
 	cfg, cleanup = setup(t)
 	defer cleanup()
-	if err := Save(cfg, "vm1", "target", "aarch64", "", "", "", "", "mac1", "", "", "", "", "", "", 0, false, ""); err != nil {
-		t.Fatalf("Save() failed for vm1: %v", err)
+	if err := Write(cfg, &Metadata{Name: "vm1", Role: "target", Arch: "aarch64", MAC: "mac1"}); err != nil {
+		t.Fatalf("Write() failed for vm1: %v", err)
 	}
 
 	_, err = GetProvisioner(cfg)
@@ -180,8 +181,8 @@ func TestFindVM(t *testing.T) {
 	defer cleanup()
 
 	// Scenario 1: VM exists
-	if err := Save(cfg, "vm1", "target", "aarch64", "", "", "", "", "mac1", "", "", "", "", "", "", 0, false, ""); err != nil {
-		t.Fatalf("Save() failed for vm1: %v", err)
+	if err := Write(cfg, &Metadata{Name: "vm1", Role: "target", Arch: "aarch64", MAC: "mac1"}); err != nil {
+		t.Fatalf("Write() failed for vm1: %v", err)
 	}
 
 	vmName, err := FindVM(cfg, "vm1")
@@ -200,4 +201,43 @@ func TestFindVM(t *testing.T) {
 	if vmName != "" {
 		t.Errorf("FindVM() for non-existent vm got = %s, want empty string", vmName)
 	}
-}
\ No newline at end of file
+}
+func TestWriteFindClones(t *testing.T) {
+	cfg, cleanup := setup(t)
+	defer cleanup()
+
+	for _, meta := range []*Metadata{
+		{Name: "golden", Role: "target", Arch: "aarch64"},
+		{Name: "clone2", Role: "target", Arch: "aarch64", CloneOf: "golden"},
+		{Name: "clone1", Role: "target", Arch: "aarch64", CloneOf: "golden"},
+		{Name: "other", Role: "target", Arch: "aarch64"},
+	} {
+		if err := Write(cfg, meta); err != nil {
+			t.Fatalf("Write() failed for %s: %v", meta.Name, err)
+		}
+	}
+
+	meta, err := Load(cfg, "clone1")
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if meta.CloneOf != "golden" {
+		t.Errorf("expected clone1 to be a clone of golden, got %q", meta.CloneOf)
+	}
+
+	clones, err := FindClones(cfg, "golden")
+	if err != nil {
+		t.Fatalf("FindClones() failed: %v", err)
+	}
+	if want := []string{"clone1", "clone2"}; !reflect.DeepEqual(clones, want) {
+		t.Errorf("FindClones() got %v, want %v", clones, want)
+	}
+
+	clones, err = FindClones(cfg, "other")
+	if err != nil {
+		t.Fatalf("FindClones() failed: %v", err)
+	}
+	if len(clones) != 0 {
+		t.Errorf("FindClones() got %v, want none", clones)
+	}
+}
@@ -0,0 +1,95 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// CurrentSchemaVersion is the version of the records written by this version
+// of pvmlab. Records without a version predate versioning and are version 1.
+const CurrentSchemaVersion = 2
+
+// ErrNewerSchema is returned when loading a record written by a newer version
+// of pvmlab, which must not be modified to avoid losing its new fields.
+var ErrNewerSchema = errors.New("metadata was written by a newer version of pvmlab")
+
+// Migration upgrades a record from the version it is registered under to the
+// next one. It works on the raw JSON fields, so that fields can be renamed or
+// restructured before the record is decoded.
+type Migration func(fields map[string]json.RawMessage) error
+
+// Migrations holds the migration from each schema version to the next, e.g.
+// Migrations[1] upgrades version 1 records to version 2. Adding a field with
+// a usable zero value doesn't need a migration, changing the meaning or the
+// format of existing fields does: bump CurrentSchemaVersion and register the
+// migration here.
+//
+// The boot handler of the provisioner reads the name, arch, distro, mac,
+// ssh_key, kernel, initrd and pxeboot fields of the same files, so they must
+// keep their names and formats. It doesn't migrate records itself, which is
+// why Load saves the records it upgrades.
+var Migrations = map[int]Migration{
+	1: migrateDefaultArch,
+}
+
+// migrateDefaultArch sets the architecture of records written before x86_64
+// VMs were supported, which were all aarch64.
+func migrateDefaultArch(fields map[string]json.RawMessage) error {
+	var arch string
+	if raw, ok := fields["arch"]; ok {
+		if err := json.Unmarshal(raw, &arch); err != nil {
+			return fmt.Errorf("invalid arch: %w", err)
+		}
+	}
+	if arch == "" {
+		fields["arch"] = json.RawMessage(`"aarch64"`)
+	}
+	return nil
+}
+
+// decode parses a record, upgrading it to CurrentSchemaVersion. It reports
+// whether the record was upgraded, in which case its file should be written
+// again.
+func decode(data []byte) (*Metadata, bool, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, false, err
+	}
+
+	version := 1
+	if raw, ok := fields["schema_version"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return nil, false, fmt.Errorf("invalid schema version: %w", err)
+		}
+	}
+	if version > CurrentSchemaVersion {
+		return nil, false, fmt.Errorf("%w: schema version %d, supported up to %d", ErrNewerSchema, version, CurrentSchemaVersion)
+	}
+
+	upgraded := version < CurrentSchemaVersion
+	if upgraded {
+		for ; version < CurrentSchemaVersion; version++ {
+			migrate, ok := Migrations[version]
+			if !ok {
+				return nil, false, fmt.Errorf("no migration from schema version %d", version)
+			}
+			if err := migrate(fields); err != nil {
+				return nil, false, fmt.Errorf("failed to migrate from schema version %d: %w", version, err)
+			}
+		}
+		// schema_version is left as is, so that the record tells which
+		// version its file has until it is written again.
+		migrated, err := json.Marshal(fields)
+		if err != nil {
+			return nil, false, err
+		}
+		data = migrated
+	}
+
+	var meta Metadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, false, err
+	}
+	return &meta, upgraded, nil
+}
@@ -0,0 +1,164 @@
+package metadata
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadMigratesLegacyRecords(t *testing.T) {
+	cfg, cleanup := setup(t)
+	defer cleanup()
+
+	vmsDir := getVMsDir(cfg)
+	if err := os.MkdirAll(vmsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A record written before schema versions and x86_64 support.
+	legacy := `{"name": "old", "role": "target", "mac": "52:54:00:00:00:01", "pxeboot": true}`
+	if err := os.WriteFile(filepath.Join(vmsDir, "old.json"), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// fsck reports the outdated record without upgrading it.
+	problems, err := Check(cfg, false)
+	if err != nil {
+		t.Fatalf("Check() failed: %v", err)
+	}
+	if len(problems) != 1 || problems[0].Description != "outdated schema version 1" || problems[0].Repaired {
+		t.Fatalf("expected the outdated record to be reported, got %+v", problems)
+	}
+
+	meta, err := Load(cfg, "old")
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if meta.Arch != "aarch64" || meta.MAC != "52:54:00:00:00:01" || !meta.PxeBoot {
+		t.Errorf("unexpected migrated record: %+v", meta)
+	}
+	if meta.SchemaVersion != CurrentSchemaVersion {
+		t.Errorf("expected schema version %d, got %d", CurrentSchemaVersion, meta.SchemaVersion)
+	}
+
+	// The boot handler reads the file, so Load saves the upgraded record.
+	data, err := os.ReadFile(filepath.Join(vmsDir, "old.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"schema_version": 2`) || !strings.Contains(string(data), `"arch": "aarch64"`) {
+		t.Errorf("expected the upgraded record to be saved, got %s", data)
+	}
+
+	problems, err = Check(cfg, false)
+	if err != nil {
+		t.Fatalf("Check() failed: %v", err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("expected no problems after the upgrade, got %+v", problems)
+	}
+}
+
+func TestGetAllUpgradesRecordsUnderLock(t *testing.T) {
+	cfg, cleanup := setup(t)
+	defer cleanup()
+
+	vmsDir := getVMsDir(cfg)
+	if err := os.MkdirAll(vmsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	legacy := `{"name": "old", "role": "target", "ip": "192.168.254.10"}`
+	if err := os.WriteFile(filepath.Join(vmsDir, "old.json"), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Create reads the other records while holding the lock, which must not
+	// deadlock when they are upgraded.
+	err := Create(cfg, &Metadata{Name: "new", Role: "target"}, func(allMeta map[string]*Metadata) error {
+		if allMeta["old"] == nil || allMeta["old"].Arch != "aarch64" {
+			t.Errorf("expected the migrated record, got %+v", allMeta["old"])
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(vmsDir, "old.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"schema_version": 2`) {
+		t.Errorf("expected the upgraded record to be saved, got %s", data)
+	}
+}
+
+func TestLoadUnderLockMismatchedName(t *testing.T) {
+	cfg, cleanup := setup(t)
+	defer cleanup()
+
+	vmsDir := getVMsDir(cfg)
+	if err := os.MkdirAll(vmsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A copied record, which loadLocked leaves for Check to repair.
+	legacy := `{"name": "old", "role": "target"}`
+	if err := os.WriteFile(filepath.Join(vmsDir, "copy.json"), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Create(cfg, &Metadata{Name: "new", Role: "target"}, func(map[string]*Metadata) error {
+			_, err := Load(cfg, "copy")
+			return err
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Create() failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Load() of a record with a mismatched name deadlocked under the store lock")
+	}
+}
+
+func TestLoadNewerSchema(t *testing.T) {
+	cfg, cleanup := setup(t)
+	defer cleanup()
+
+	vmsDir := getVMsDir(cfg)
+	if err := os.MkdirAll(vmsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(vmsDir, "new.json")
+	if err := os.WriteFile(path, []byte(`{"schema_version": 99, "name": "new", "role": "target"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(cfg, "new"); !errors.Is(err, ErrNewerSchema) {
+		t.Errorf("expected ErrNewerSchema, got %v", err)
+	}
+
+	// Records of newer versions are reported, but never moved aside.
+	problems, err := Check(cfg, true)
+	if err != nil {
+		t.Fatalf("Check() failed: %v", err)
+	}
+	if len(problems) != 1 || problems[0].Repaired || !strings.Contains(problems[0].Description, "schema version 99") {
+		t.Errorf("expected an unrepairable problem, got %+v", problems)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected the record to be left in place: %v", err)
+	}
+}
+
+func TestMigrationsAreComplete(t *testing.T) {
+	for version := 1; version < CurrentSchemaVersion; version++ {
+		if Migrations[version] == nil {
+			t.Errorf("missing migration from schema version %d", version)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"pvmlab/internal/config"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+const (
+	// lockFileName is the file in the vms directory that is locked while the
+	// store is modified, so that concurrent pvmlab processes don't interleave
+	// their changes. Readers don't need the lock since records are replaced
+	// atomically.
+	lockFileName = ".lock"
+	// tempSuffix ends the name of the temporary files records are written to
+	// before being renamed into place.
+	tempSuffix = ".tmp"
+	// corruptSuffix is appended to the name of the records moved aside by
+	// Check, so that they are no longer read.
+	corruptSuffix = ".corrupt"
+)
+
+// lockStore takes an exclusive lock on the metadata store, creating the vms
+// directory if needed. The returned function releases the lock.
+func lockStore(cfg *config.Config) (func(), error) {
+	vmsDir := getVMsDir(cfg)
+	if err := os.MkdirAll(vmsDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create vms directory: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(vmsDir, lockFileName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the metadata store lock: %w", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock the metadata store: %w", err)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// write saves the metadata of a VM with the current schema version. The
+// caller must hold the store lock.
+func write(cfg *config.Config, meta *Metadata) error {
+	meta.SchemaVersion = CurrentSchemaVersion
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(getVMsDir(cfg), meta.Name+".json"), data)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// over path, so that readers see either the old or the new content, never a
+// partial write.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*"+tempSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed.
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Update loads the metadata of a VM, applies fn to it and saves the result
+// while holding the store lock, so that concurrent updates are not lost. It
+// returns the updated metadata.
+var Update = func(cfg *config.Config, vmName string, fn func(*Metadata) error) (*Metadata, error) {
+	unlock, err := lockStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	meta, err := loadLocked(cfg, vmName)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(meta); err != nil {
+		return nil, err
+	}
+	if err := write(cfg, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// Create saves the metadata of a new VM while holding the store lock, and
+// fails if a VM with the same name exists, so that VMs created concurrently
+// can't get the same name. If allocate is not nil, it is called under the
+// lock with the metadata of the existing VMs before meta is saved, so that
+// the addresses it picks for meta are not given to concurrent VMs.
+var Create = func(cfg *config.Config, meta *Metadata, allocate func(allMeta map[string]*Metadata) error) error {
+	unlock, err := lockStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := os.Stat(filepath.Join(getVMsDir(cfg), meta.Name+".json")); err == nil {
+		return fmt.Errorf("a VM named '%s' already exists", meta.Name)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if allocate != nil {
+		allMeta, err := getAll(cfg, loadLocked)
+		if err != nil {
+			return fmt.Errorf("failed to get all VM metadata: %w", err)
+		}
+		if err := allocate(allMeta); err != nil {
+			return err
+		}
+	}
+	return write(cfg, meta)
+}
+
+// Kinds of problems found by Check.
+const (
+	ProblemUnreadable = "unreadable"
+	ProblemOutdated   = "outdated"
+	ProblemName       = "name"
+	ProblemRole       = "role"
+	ProblemLeftover   = "leftover"
+	ProblemDuplicate  = "duplicate"
+)
+
+// Problem is an inconsistency found in the metadata store by Check.
+type Problem struct {
+	Kind string `json:"kind"`
+	// Path is the file the problem was found in.
+	Path        string `json:"path"`
+	Description string `json:"description"`
+	// Repair describes how the problem is repaired, it is empty if the
+	// problem must be fixed by hand.
+	Repair   string `json:"repair,omitempty"`
+	Repaired bool   `json:"repaired"`
+
+	fix func() error
+}
+
+// Check looks for corrupted records in the metadata store: files that can't
+// be parsed, records with an outdated schema version or whose name doesn't
+// match their file, leftovers of interrupted writes and IP or MAC addresses
+// used by several VMs. If repair is true, the problems that can be repaired
+// are: corrupted records are moved aside, records are upgraded, names are
+// fixed and leftovers removed.
+var Check = func(cfg *config.Config, repair bool) ([]Problem, error) {
+	vmsDir := getVMsDir(cfg)
+	if _, err := os.Stat(vmsDir); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	// Take the lock so that the temporary files of writes in progress are
+	// not mistaken for leftovers.
+	unlock, err := lockStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	files, err := os.ReadDir(vmsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []Problem
+	valid := map[string]*Metadata{}
+	for _, file := range files {
+		name := file.Name()
+		path := filepath.Join(vmsDir, name)
+		switch {
+		case file.IsDir():
+			continue
+		case strings.HasPrefix(name, ".") && strings.HasSuffix(name, tempSuffix):
+			problems = append(problems, Problem{
+				Kind:        ProblemLeftover,
+				Path:        path,
+				Description: "leftover of an interrupted write",
+				Repair:      "remove the file",
+				fix:         func() error { return os.Remove(path) },
+			})
+		case filepath.Ext(name) == ".json":
+			vmName := strings.TrimSuffix(name, ".json")
+			// The records are not upgraded unless repairing.
+			meta, _, err := readRecord(cfg, vmName)
+			if errors.Is(err, ErrNewerSchema) {
+				problems = append(problems, Problem{
+					Kind:        ProblemUnreadable,
+					Path:        path,
+					Description: err.Error(),
+				})
+				continue
+			}
+			if err != nil {
+				problems = append(problems, Problem{
+					Kind:        ProblemUnreadable,
+					Path:        path,
+					Description: fmt.Sprintf("unreadable record: %v", err),
+					Repair:      fmt.Sprintf("move it aside to %s", name+corruptSuffix),
+					fix:         func() error { return os.Rename(path, path+corruptSuffix) },
+				})
+				continue
+			}
+			if meta.Name != vmName {
+				problems = append(problems, Problem{
+					Kind:        ProblemName,
+					Path:        path,
+					Description: fmt.Sprintf("record is named '%s' instead of '%s'", meta.Name, vmName),
+					Repair:      fmt.Sprintf("rename the record to '%s'", vmName),
+					fix: func() error {
+						meta.Name = vmName
+						return write(cfg, meta)
+					},
+				})
+			} else if meta.SchemaVersion < CurrentSchemaVersion {
+				// Renaming the record also upgrades it.
+				problems = append(problems, Problem{
+					Kind:        ProblemOutdated,
+					Path:        path,
+					Description: fmt.Sprintf("outdated schema version %d", max(meta.SchemaVersion, 1)),
+					Repair:      fmt.Sprintf("upgrade the record to schema version %d", CurrentSchemaVersion),
+					fix:         func() error { return write(cfg, meta) },
+				})
+			}
+			if meta.Role != "provisioner" && meta.Role != "target" {
+				problems = append(problems, Problem{
+					Kind:        ProblemRole,
+					Path:        path,
+					Description: fmt.Sprintf("unknown role '%s'", meta.Role),
+				})
+			}
+			valid[vmName] = meta
+		}
+	}
+	problems = append(problems, duplicateAddresses(vmsDir, valid)...)
+
+	if repair {
+		for i := range problems {
+			p := &problems[i]
+			if p.fix == nil {
+				continue
+			}
+			if err := p.fix(); err != nil {
+				return problems, fmt.Errorf("failed to repair %s: %w", p.Path, err)
+			}
+			p.Repaired = true
+		}
+	}
+	return problems, nil
+}
+
+// duplicateAddresses reports the IP and MAC addresses used by several VMs,
+// e.g. because they were created concurrently.
+func duplicateAddresses(vmsDir string, allMeta map[string]*Metadata) []Problem {
+	names := make([]string, 0, len(allMeta))
+	for name := range allMeta {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []Problem
+	owners := map[string]string{}
+	for _, name := range names {
+		meta := allMeta[name]
+		// The addresses are checked in a fixed order, so that the problems
+		// are reported in the same order on every run.
+		for _, a := range []struct{ kind, addr string }{
+			{"IP", meta.IP},
+			{"IPv6", meta.IPv6},
+			{"MAC", strings.ToLower(meta.MAC)},
+		} {
+			kind, addr := a.kind, a.addr
+			if addr == "" {
+				continue
+			}
+			key := kind + " " + addr
+			if owner, ok := owners[key]; ok {
+				problems = append(problems, Problem{
+					Kind:        ProblemDuplicate,
+					Path:        filepath.Join(vmsDir, name+".json"),
+					Description: fmt.Sprintf("%s address %s is also used by VM '%s'", kind, addr, owner),
+				})
+				continue
+			}
+			owners[key] = name
+		}
+	}
+	return problems
+}
@@ -0,0 +1,214 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWriteIsAtomic(t *testing.T) {
+	cfg, cleanup := setup(t)
+	defer cleanup()
+
+	if err := Write(cfg, &Metadata{Name: "vm1", Role: "target"}); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+
+	files, err := os.ReadDir(getVMsDir(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	if strings.Join(names, ",") != lockFileName+",vm1.json" {
+		t.Errorf("expected only the lock and the record, got %v", names)
+	}
+	info, err := os.Stat(filepath.Join(getVMsDir(cfg), "vm1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("expected mode 0644, got %v", info.Mode().Perm())
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	cfg, cleanup := setup(t)
+	defer cleanup()
+
+	if err := Write(cfg, &Metadata{Name: "vm1", Role: "target"}); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+
+	// Concurrent updates must not be lost.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := Update(cfg, "vm1", func(meta *Metadata) error {
+				meta.CPUs++
+				return nil
+			}); err != nil {
+				t.Errorf("Update() failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	meta, err := Load(cfg, "vm1")
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if meta.CPUs != 20 {
+		t.Errorf("expected 20 updates, got %d", meta.CPUs)
+	}
+
+	if _, err := Update(cfg, "missing", func(*Metadata) error { return nil }); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error for a missing VM, got %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	cfg, cleanup := setup(t)
+	defer cleanup()
+
+	if problems, err := Check(cfg, false); err != nil || len(problems) != 0 {
+		t.Fatalf("expected no problems without a store, got %v, %v", problems, err)
+	}
+
+	vmsDir := getVMsDir(cfg)
+	for _, meta := range []*Metadata{
+		{Name: "good", Role: "target", IP: "192.168.100.2", MAC: "52:54:00:00:00:01"},
+		{Name: "dup", Role: "target", IP: "192.168.100.2", MAC: "52:54:00:00:00:02"},
+		{Name: "other", Role: "target", MAC: "52:54:00:00:00:03"},
+		{Name: "norole", MAC: "52:54:00:00:00:04"},
+	} {
+		if err := Write(cfg, meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Rename a record, so that its name no longer matches its file.
+	if err := os.Rename(filepath.Join(vmsDir, "other.json"), filepath.Join(vmsDir, "renamed.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(vmsDir, "broken.json"), []byte(`{"name": "bro`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(vmsDir, ".good.json.123"+tempSuffix), []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := Check(cfg, false)
+	if err != nil {
+		t.Fatalf("Check() failed: %v", err)
+	}
+	var got []string
+	for _, p := range problems {
+		got = append(got, filepath.Base(p.Path)+": "+p.Description)
+		if p.Repaired {
+			t.Errorf("expected nothing to be repaired without repair, got %+v", p)
+		}
+	}
+	sort.Strings(got)
+	expected := []string{
+		".good.json.123.tmp: leftover of an interrupted write",
+		"broken.json: unreadable record",
+		"good.json: IP address 192.168.100.2 is also used by VM 'dup'",
+		"norole.json: unknown role ''",
+		"renamed.json: record is named 'other' instead of 'renamed'",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("expected problems %v, got %v", expected, got)
+	}
+	for i := range expected {
+		// The parse error of unreadable records is not checked.
+		if !strings.HasPrefix(got[i], expected[i]) {
+			t.Errorf("expected problem '%s', got '%s'", expected[i], got[i])
+		}
+	}
+
+	problems, err = Check(cfg, true)
+	if err != nil {
+		t.Fatalf("Check() with repair failed: %v", err)
+	}
+	for _, p := range problems {
+		if p.Repaired != (p.Repair != "") {
+			t.Errorf("expected repairable problems to be repaired, got %+v", p)
+		}
+	}
+
+	problems, err = Check(cfg, false)
+	if err != nil {
+		t.Fatalf("Check() failed: %v", err)
+	}
+	// Only the problems that must be fixed by hand are left.
+	if len(problems) != 2 {
+		t.Errorf("expected 2 problems after repair, got %+v", problems)
+	}
+	if _, err := os.Stat(filepath.Join(vmsDir, "broken.json"+corruptSuffix)); err != nil {
+		t.Errorf("expected the unreadable record to be moved aside: %v", err)
+	}
+	if meta, err := Load(cfg, "renamed"); err != nil || meta.Name != "renamed" {
+		t.Errorf("expected the record to be renamed, got %+v, %v", meta, err)
+	}
+}
+
+func TestDuplicateAddresses_Order(t *testing.T) {
+	allMeta := map[string]*Metadata{
+		"vm1": {Name: "vm1", IP: "192.168.100.2", IPv6: "fd00::2", MAC: "52:54:00:00:00:01"},
+		"vm2": {Name: "vm2", IP: "192.168.100.2", IPv6: "fd00::2", MAC: "52:54:00:00:00:01"},
+	}
+	expected := []string{
+		"IP address 192.168.100.2 is also used by VM 'vm1'",
+		"IPv6 address fd00::2 is also used by VM 'vm1'",
+		"MAC address 52:54:00:00:00:01 is also used by VM 'vm1'",
+	}
+	// Map iteration order is random, so check several runs.
+	for i := 0; i < 20; i++ {
+		var got []string
+		for _, p := range duplicateAddresses("vms", allMeta) {
+			got = append(got, p.Description)
+		}
+		if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+			t.Fatalf("expected problems %v, got %v", expected, got)
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	cfg, cleanup := setup(t)
+	defer cleanup()
+
+	// Only one of the VMs created concurrently with the same name is
+	// created.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := Create(cfg, &Metadata{Name: "vm1", Role: "target", CPUs: i}, nil)
+			if err == nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			} else if !strings.Contains(err.Error(), "a VM named 'vm1' already exists") {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if created != 1 {
+		t.Errorf("expected the VM to be created once, got %d", created)
+	}
+	if _, err := Load(cfg, "vm1"); err != nil {
+		t.Errorf("expected the VM to be saved: %v", err)
+	}
+}
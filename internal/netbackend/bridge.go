@@ -0,0 +1,191 @@
+package netbackend
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"pvmlab/internal/config"
+	"strconv"
+	"strings"
+)
+
+// DefaultBridge is the name of the host bridge used when PVMLAB_BRIDGE is not set.
+const DefaultBridge = "pvmlab0"
+
+var execCommand = exec.Command
+
+var (
+	// sysClassNet is the sysfs directory describing the host's network interfaces.
+	sysClassNet = "/sys/class/net"
+	// bridgeNfCallIptables is set to 1 when bridged traffic goes through iptables.
+	bridgeNfCallIptables = "/proc/sys/net/bridge/bridge-nf-call-iptables"
+)
+
+// Bridge attaches VMs to a private Linux bridge, with one TAP device per VM.
+// The bridge carries no host address: like socket_vmnet in host mode, it only
+// connects the VMs to each other. The provisioner reaches the outside world
+// through its QEMU user-mode (NAT) uplink and routes for the targets.
+type Bridge struct {
+	bridge string
+	// lab is the lab the VMs belong to, empty for the default lab.
+	lab string
+}
+
+// NewBridge returns a bridge/TAP backend of the default lab using the given
+// bridge device.
+func NewBridge(bridge string) *Bridge {
+	return &Bridge{bridge: bridge}
+}
+
+func (b *Bridge) Name() string {
+	return BridgeName
+}
+
+func (b *Bridge) Dependencies() []string {
+	return []string{"ip", "sudo", "iptables"}
+}
+
+// Setup creates the bridge and brings it up. If bridged traffic is passed
+// through iptables (br_netfilter, typically loaded by Docker, which also sets
+// the FORWARD policy to DROP), a rule is added to let traffic between VMs on
+// the bridge through.
+func (b *Bridge) Setup() error {
+	if !linkExists(b.bridge) {
+		if err := runSudo("ip", "link", "add", "name", b.bridge, "type", "bridge"); err != nil {
+			return fmt.Errorf("failed to create bridge %s: %w", b.bridge, err)
+		}
+	}
+	if err := runSudo("ip", "link", "set", b.bridge, "up"); err != nil {
+		return fmt.Errorf("failed to bring up bridge %s: %w", b.bridge, err)
+	}
+	if bridgeNetfilterEnabled() {
+		if err := runSudo("iptables", b.forwardRule("-C")...); err != nil {
+			if err := runSudo("iptables", b.forwardRule("-I")...); err != nil {
+				return fmt.Errorf("failed to allow forwarding on bridge %s: %w", b.bridge, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Teardown removes the bridge and the forwarding rule added by Setup.
+// TAP devices still attached to the bridge are detached by the kernel.
+func (b *Bridge) Teardown() error {
+	if runSudo("iptables", b.forwardRule("-C")...) == nil {
+		if err := runSudo("iptables", b.forwardRule("-D")...); err != nil {
+			return fmt.Errorf("failed to remove forwarding rule for bridge %s: %w", b.bridge, err)
+		}
+	}
+	if !linkExists(b.bridge) {
+		return nil
+	}
+	if err := runSudo("ip", "link", "del", b.bridge); err != nil {
+		return fmt.Errorf("failed to delete bridge %s: %w", b.bridge, err)
+	}
+	return nil
+}
+
+func (b *Bridge) IsRunning() (bool, error) {
+	data, err := os.ReadFile(filepath.Join(sysClassNet, b.bridge, "flags"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error reading state of bridge %s: %w", b.bridge, err)
+	}
+	flags, err := strconv.ParseUint(strings.TrimSpace(string(data)), 0, 32)
+	if err != nil {
+		return false, fmt.Errorf("error parsing flags of bridge %s: %w", b.bridge, err)
+	}
+	const iffUp = 0x1
+	return flags&iffUp != 0, nil
+}
+
+// PrepareVM creates the VM's TAP device, owned by the current user so that
+// QEMU does not need to run as root, and attaches it to the bridge. The TAP
+// device is persistent and reused across restarts of the VM.
+func (b *Bridge) PrepareVM(vmName string) error {
+	if !linkExists(b.bridge) {
+		return fmt.Errorf("bridge %s does not exist. Run 'pvmlab network setup' first", b.bridge)
+	}
+	tap := b.tapName(vmName)
+	if !linkExists(tap) {
+		u, err := user.Current()
+		if err != nil {
+			return fmt.Errorf("failed to determine current user: %w", err)
+		}
+		if err := runSudo("ip", "tuntap", "add", "dev", tap, "mode", "tap", "user", u.Username); err != nil {
+			return fmt.Errorf("failed to create TAP device %s: %w", tap, err)
+		}
+	}
+	if err := runSudo("ip", "link", "set", tap, "master", b.bridge); err != nil {
+		return fmt.Errorf("failed to attach TAP device %s to bridge %s: %w", tap, b.bridge, err)
+	}
+	if err := runSudo("ip", "link", "set", tap, "up"); err != nil {
+		return fmt.Errorf("failed to bring up TAP device %s: %w", tap, err)
+	}
+	return nil
+}
+
+// ReleaseVM deletes the VM's TAP device.
+func (b *Bridge) ReleaseVM(vmName string) error {
+	tap := b.tapName(vmName)
+	if !linkExists(tap) {
+		return nil
+	}
+	if err := runSudo("ip", "link", "del", tap); err != nil {
+		return fmt.Errorf("failed to delete TAP device %s: %w", tap, err)
+	}
+	return nil
+}
+
+func (b *Bridge) Netdev(id, vmName string) string {
+	return fmt.Sprintf("tap,id=%s,ifname=%s,script=no,downscript=no", id, b.tapName(vmName))
+}
+
+func (b *Bridge) WrapCommand(qemuArgs []string) ([]string, error) {
+	return qemuArgs, nil
+}
+
+func (b *Bridge) forwardRule(op string) []string {
+	return []string{op, "FORWARD", "-i", b.bridge, "-o", b.bridge, "-j", "ACCEPT"}
+}
+
+// TapName returns the TAP device name of a VM. Interface names are limited
+// to 15 characters, so the name is derived from a hash of the VM name.
+func TapName(vmName string) string {
+	h := fnv.New32a()
+	h.Write([]byte(vmName))
+	return fmt.Sprintf("pvm%08x", h.Sum32())
+}
+
+// tapName returns the TAP device name of a VM of the backend's lab. VMs of
+// other labs may have the same name, so the lab is part of the hashed name,
+// except for the default lab whose devices keep their original names.
+func (b *Bridge) tapName(vmName string) string {
+	if b.lab == "" || b.lab == config.DefaultLab {
+		return TapName(vmName)
+	}
+	return TapName(b.lab + "/" + vmName)
+}
+
+func linkExists(name string) bool {
+	_, err := os.Stat(filepath.Join(sysClassNet, name))
+	return err == nil
+}
+
+func bridgeNetfilterEnabled() bool {
+	data, err := os.ReadFile(bridgeNfCallIptables)
+	return err == nil && strings.TrimSpace(string(data)) == "1"
+}
+
+func runSudo(name string, args ...string) error {
+	cmd := execCommand("sudo", append([]string{name}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package netbackend
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeHost points the backend at a fake sysfs and records the commands run.
+type fakeHost struct {
+	sysfs    string
+	commands []string
+	// failing lists command prefixes that exit with an error.
+	failing []string
+}
+
+func newFakeHost(t *testing.T, links ...string) *fakeHost {
+	t.Helper()
+	h := &fakeHost{sysfs: t.TempDir()}
+	for _, link := range links {
+		h.addLink(t, link, "0x1003")
+	}
+
+	origSys, origNf, origExec := sysClassNet, bridgeNfCallIptables, execCommand
+	t.Cleanup(func() {
+		sysClassNet, bridgeNfCallIptables, execCommand = origSys, origNf, origExec
+	})
+	sysClassNet = h.sysfs
+	bridgeNfCallIptables = filepath.Join(h.sysfs, "bridge-nf-call-iptables")
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		cmdLine := strings.Join(append([]string{name}, args...), " ")
+		h.commands = append(h.commands, cmdLine)
+		for _, prefix := range h.failing {
+			if strings.HasPrefix(cmdLine, prefix) {
+				return exec.Command("false")
+			}
+		}
+		return exec.Command("true")
+	}
+	return h
+}
+
+func (h *fakeHost) addLink(t *testing.T, name, flags string) {
+	t.Helper()
+	dir := filepath.Join(h.sysfs, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "flags"), []byte(flags+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTapName(t *testing.T) {
+	name := TapName("a-very-long-vm-name-that-exceeds-the-limit")
+	if len(name) > 15 {
+		t.Errorf("TAP name '%s' exceeds 15 characters", name)
+	}
+	if name != TapName("a-very-long-vm-name-that-exceeds-the-limit") {
+		t.Error("TAP name is not deterministic")
+	}
+	if TapName("vm1") == TapName("vm2") {
+		t.Error("expected different TAP names for different VMs")
+	}
+}
+
+func TestBridge_Setup(t *testing.T) {
+	t.Run("creates missing bridge", func(t *testing.T) {
+		h := newFakeHost(t)
+		if err := NewBridge("br0").Setup(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []string{
+			"sudo ip link add name br0 type bridge",
+			"sudo ip link set br0 up",
+		}
+		if !reflect.DeepEqual(h.commands, want) {
+			t.Errorf("expected commands %v, got %v", want, h.commands)
+		}
+	})
+
+	t.Run("adds forward rule with br_netfilter", func(t *testing.T) {
+		h := newFakeHost(t, "br0")
+		h.failing = []string{"sudo iptables -C"}
+		if err := os.WriteFile(bridgeNfCallIptables, []byte("1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := NewBridge("br0").Setup(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []string{
+			"sudo ip link set br0 up",
+			"sudo iptables -C FORWARD -i br0 -o br0 -j ACCEPT",
+			"sudo iptables -I FORWARD -i br0 -o br0 -j ACCEPT",
+		}
+		if !reflect.DeepEqual(h.commands, want) {
+			t.Errorf("expected commands %v, got %v", want, h.commands)
+		}
+	})
+
+	t.Run("reports failures", func(t *testing.T) {
+		h := newFakeHost(t)
+		h.failing = []string{"sudo ip link add"}
+		err := NewBridge("br0").Setup()
+		if err == nil || !strings.Contains(err.Error(), "failed to create bridge br0") {
+			t.Errorf("expected bridge creation error, got '%v'", err)
+		}
+	})
+}
+
+func TestBridge_Teardown(t *testing.T) {
+	h := newFakeHost(t, "br0")
+	if err := NewBridge("br0").Teardown(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"sudo iptables -C FORWARD -i br0 -o br0 -j ACCEPT",
+		"sudo iptables -D FORWARD -i br0 -o br0 -j ACCEPT",
+		"sudo ip link del br0",
+	}
+	if !reflect.DeepEqual(h.commands, want) {
+		t.Errorf("expected commands %v, got %v", want, h.commands)
+	}
+}
+
+func TestBridge_IsRunning(t *testing.T) {
+	h := newFakeHost(t)
+	b := NewBridge("br0")
+
+	if running, err := b.IsRunning(); err != nil || running {
+		t.Errorf("expected missing bridge to be stopped, got running=%v err=%v", running, err)
+	}
+	h.addLink(t, "br0", "0x1002")
+	if running, err := b.IsRunning(); err != nil || running {
+		t.Errorf("expected down bridge to be stopped, got running=%v err=%v", running, err)
+	}
+	h.addLink(t, "br0", "0x1003")
+	if running, err := b.IsRunning(); err != nil || !running {
+		t.Errorf("expected up bridge to be running, got running=%v err=%v", running, err)
+	}
+}
+
+func TestBridge_PrepareVM(t *testing.T) {
+	t.Run("requires bridge", func(t *testing.T) {
+		newFakeHost(t)
+		err := NewBridge("br0").PrepareVM("vm1")
+		if err == nil || !strings.Contains(err.Error(), "pvmlab network setup") {
+			t.Errorf("expected missing bridge error, got '%v'", err)
+		}
+	})
+
+	t.Run("creates and attaches tap", func(t *testing.T) {
+		h := newFakeHost(t, "br0")
+		if err := NewBridge("br0").PrepareVM("vm1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		tap := TapName("vm1")
+		if len(h.commands) != 3 || !strings.HasPrefix(h.commands[0], "sudo ip tuntap add dev "+tap+" mode tap user ") {
+			t.Fatalf("unexpected commands: %v", h.commands)
+		}
+		want := []string{
+			"sudo ip link set " + tap + " master br0",
+			"sudo ip link set " + tap + " up",
+		}
+		if !reflect.DeepEqual(h.commands[1:], want) {
+			t.Errorf("expected commands %v, got %v", want, h.commands[1:])
+		}
+	})
+
+	t.Run("reuses existing tap", func(t *testing.T) {
+		h := newFakeHost(t, "br0", TapName("vm1"))
+		if err := NewBridge("br0").PrepareVM("vm1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(h.commands) != 2 {
+			t.Errorf("expected the TAP device to be reused, got %v", h.commands)
+		}
+	})
+}
+
+func TestBridge_ReleaseVM(t *testing.T) {
+	h := newFakeHost(t, TapName("vm1"))
+	b := NewBridge("br0")
+	if err := b.ReleaseVM("vm1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := b.ReleaseVM("vm2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"sudo ip link del " + TapName("vm1")}
+	if !reflect.DeepEqual(h.commands, want) {
+		t.Errorf("expected commands %v, got %v", want, h.commands)
+	}
+}
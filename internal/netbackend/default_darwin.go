@@ -0,0 +1,5 @@
+//go:build darwin
+
+package netbackend
+
+const defaultBackend = SocketVmnetName
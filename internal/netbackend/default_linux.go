@@ -0,0 +1,5 @@
+//go:build linux
+
+package netbackend
+
+const defaultBackend = BridgeName
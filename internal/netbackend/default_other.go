@@ -0,0 +1,5 @@
+//go:build !darwin && !linux
+
+package netbackend
+
+const defaultBackend = ""
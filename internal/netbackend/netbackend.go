@@ -0,0 +1,75 @@
+// Package netbackend abstracts how VMs are attached to the private lab
+// network. On macOS the network is provided by socket_vmnet, on Linux by a
+// host bridge with one TAP device per VM.
+package netbackend
+
+import (
+	"fmt"
+	"os"
+	"pvmlab/internal/config"
+)
+
+const (
+	// SocketVmnetName is the name of the socket_vmnet backend.
+	SocketVmnetName = "socket_vmnet"
+	// BridgeName is the name of the Linux bridge/TAP backend.
+	BridgeName = "bridge"
+)
+
+// Backend manages the host side of the private lab network.
+type Backend interface {
+	// Name returns the name of the backend.
+	Name() string
+	// Dependencies returns the executables the backend needs on the PATH.
+	Dependencies() []string
+	// Setup brings the private network up on the host.
+	Setup() error
+	// Teardown removes the private network from the host.
+	Teardown() error
+	// IsRunning reports whether the private network is up.
+	IsRunning() (bool, error)
+	// PrepareVM creates the per-VM host resources, if any, before QEMU starts.
+	PrepareVM(vmName string) error
+	// ReleaseVM removes the per-VM host resources created by PrepareVM.
+	ReleaseVM(vmName string) error
+	// Netdev returns the value of the QEMU -netdev option attaching a NIC
+	// with the given id to the private network.
+	Netdev(id, vmName string) string
+	// WrapCommand returns the full command line used to launch QEMU.
+	WrapCommand(qemuArgs []string) ([]string, error)
+}
+
+// Default returns the backend of a lab selected by the PVMLAB_NETWORK_BACKEND
+// environment variable, or the platform default when it is not set.
+func Default(lab *config.Lab) (Backend, error) {
+	name := os.Getenv("PVMLAB_NETWORK_BACKEND")
+	if name == "" {
+		name = defaultBackend
+	}
+	return Get(name, lab)
+}
+
+// Get returns the backend with the given name attaching VMs to the private
+// network of a lab. Each lab has its own network: its own socket_vmnet
+// service or its own bridge, named after the lab's index.
+func Get(name string, lab *config.Lab) (Backend, error) {
+	switch name {
+	case SocketVmnetName:
+		return &SocketVmnet{lab: lab.Name}, nil
+	case BridgeName:
+		if lab.Name != config.DefaultLab {
+			b := NewBridge(fmt.Sprintf("pvmlab%d", lab.Index))
+			b.lab = lab.Name
+			return b, nil
+		}
+		bridge := os.Getenv("PVMLAB_BRIDGE")
+		if bridge == "" {
+			bridge = DefaultBridge
+		}
+		return NewBridge(bridge), nil
+	case "":
+		return nil, fmt.Errorf("no network backend is available on this platform")
+	default:
+		return nil, fmt.Errorf("unknown network backend '%s'. Must be '%s' or '%s'", name, SocketVmnetName, BridgeName)
+	}
+}
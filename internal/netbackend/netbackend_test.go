@@ -0,0 +1,105 @@
+package netbackend
+
+import (
+	"pvmlab/internal/config"
+	"strings"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name        string
+		backend     string
+		bridgeEnv   string
+		wantName    string
+		wantNetdev  string
+		expectedErr string
+	}{
+		{
+			name:       "socket_vmnet",
+			backend:    SocketVmnetName,
+			wantName:   SocketVmnetName,
+			wantNetdev: "socket,id=net0,fd=3",
+		},
+		{
+			name:       "bridge",
+			backend:    BridgeName,
+			wantName:   BridgeName,
+			wantNetdev: "tap,id=net0,ifname=" + TapName("vm1") + ",script=no,downscript=no",
+		},
+		{
+			name:        "unknown",
+			backend:     "slirp",
+			expectedErr: "unknown network backend 'slirp'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := Get(tt.backend, &config.Lab{Name: config.DefaultLab})
+			if tt.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+					t.Fatalf("expected error containing '%s', got '%v'", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if b.Name() != tt.wantName {
+				t.Errorf("expected backend '%s', got '%s'", tt.wantName, b.Name())
+			}
+			if got := b.Netdev("net0", "vm1"); got != tt.wantNetdev {
+				t.Errorf("expected netdev '%s', got '%s'", tt.wantNetdev, got)
+			}
+		})
+	}
+}
+
+func TestDefault_EnvOverride(t *testing.T) {
+	t.Setenv("PVMLAB_NETWORK_BACKEND", BridgeName)
+	t.Setenv("PVMLAB_BRIDGE", "br-test")
+
+	b, err := Default(&config.Lab{Name: config.DefaultLab})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bridge, ok := b.(*Bridge)
+	if !ok {
+		t.Fatalf("expected a *Bridge, got %T", b)
+	}
+	if bridge.bridge != "br-test" {
+		t.Errorf("expected bridge 'br-test', got '%s'", bridge.bridge)
+	}
+}
+
+func TestGet_Lab(t *testing.T) {
+	t.Setenv("PVMLAB_BRIDGE", "br-test")
+	lab := &config.Lab{Name: "fedora", Index: 2}
+
+	b, err := Get(BridgeName, lab)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bridge := b.(*Bridge)
+	// PVMLAB_BRIDGE only applies to the default lab.
+	if bridge.bridge != "pvmlab2" {
+		t.Errorf("expected bridge 'pvmlab2', got '%s'", bridge.bridge)
+	}
+	if bridge.tapName("vm1") == TapName("vm1") {
+		t.Error("expected the TAP devices of a lab to differ from the default lab's")
+	}
+
+	t.Setenv("PVMLAB_SOCKET_VMNET_CLIENT", "/usr/bin/socket_vmnet_client")
+	b, err = Get(SocketVmnetName, lab)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := b.WrapCommand([]string{"qemu-system-aarch64"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got[1] != "/var/run/vmlab.socket_vmnet.fedora" {
+		t.Errorf("expected the socket of the lab's service, got '%s'", got[1])
+	}
+}
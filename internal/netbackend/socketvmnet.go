@@ -0,0 +1,63 @@
+package netbackend
+
+import (
+	"fmt"
+	"pvmlab/internal/socketvmnet"
+)
+
+// SocketVmnet attaches VMs to the socket_vmnet daemon managed by launchd.
+// QEMU is launched through socket_vmnet_client, which passes the connected
+// socket to QEMU as file descriptor 3.
+type SocketVmnet struct {
+	// lab is the name of the lab whose socket_vmnet service is used.
+	lab string
+}
+
+// NewSocketVmnet returns the socket_vmnet backend of the default lab.
+func NewSocketVmnet() *SocketVmnet {
+	return &SocketVmnet{}
+}
+
+func (s *SocketVmnet) Name() string {
+	return SocketVmnetName
+}
+
+func (s *SocketVmnet) Dependencies() []string {
+	return []string{"brew"}
+}
+
+func (s *SocketVmnet) Setup() error {
+	return socketvmnet.StartSocketVmnet(s.lab)
+}
+
+func (s *SocketVmnet) Teardown() error {
+	return socketvmnet.StopSocketVmnet(s.lab)
+}
+
+func (s *SocketVmnet) IsRunning() (bool, error) {
+	return socketvmnet.IsSocketVmnetRunning(s.lab)
+}
+
+func (s *SocketVmnet) PrepareVM(vmName string) error {
+	return nil
+}
+
+func (s *SocketVmnet) ReleaseVM(vmName string) error {
+	return nil
+}
+
+func (s *SocketVmnet) Netdev(id, vmName string) string {
+	return fmt.Sprintf("socket,id=%s,fd=3", id)
+}
+
+func (s *SocketVmnet) WrapCommand(qemuArgs []string) ([]string, error) {
+	socketPath, err := socketvmnet.GetSocketPath(s.lab)
+	if err != nil {
+		return nil, fmt.Errorf("error getting socket_vmnet path: %w", err)
+	}
+	clientPath, err := socketvmnet.GetClientPath()
+	if err != nil {
+		return nil, fmt.Errorf("error getting socket_vmnet_client path: %w", err)
+	}
+	return append([]string{clientPath, socketPath}, qemuArgs...), nil
+}
@@ -0,0 +1,20 @@
+package netbackend
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSocketVmnet_WrapCommand(t *testing.T) {
+	t.Setenv("PVMLAB_SOCKET_VMNET_CLIENT", "/usr/bin/socket_vmnet_client")
+	t.Setenv("PVMLAB_SOCKET_VMNET_PATH", "/tmp/socket_vmnet")
+
+	got, err := NewSocketVmnet().WrapCommand([]string{"qemu-system-aarch64", "-m", "2048"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"/usr/bin/socket_vmnet_client", "/tmp/socket_vmnet", "qemu-system-aarch64", "-m", "2048"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 )
 
 func getPIDFilePath(cfg *config.Config, vmName string) string {
@@ -47,4 +48,13 @@ var Read = func(cfg *config.Config, vmName string) (int, error) {
 	}
 
 	return pid, nil
-}
\ No newline at end of file
+}
+
+// StartTime returns when the VM was started, i.e. when QEMU wrote its pidfile.
+var StartTime = func(cfg *config.Config, vmName string) (time.Time, error) {
+	info, err := os.Stat(getPIDFilePath(cfg, vmName))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
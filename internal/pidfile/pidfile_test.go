@@ -7,6 +7,7 @@ import (
 	"pvmlab/internal/config"
 	"strconv"
 	"testing"
+	"time"
 )
 
 // setup creates a temporary directory for pids and returns a config object.
@@ -127,3 +128,29 @@ func TestIsRunning(t *testing.T) {
 		}
 	})
 }
+
+func TestStartTime(t *testing.T) {
+	cfg, cleanup := setup(t)
+	defer cleanup()
+
+	if _, err := StartTime(cfg, "test-vm"); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+
+	pidPath := filepath.Join(cfg.GetAppDir(), "pids", "test-vm.pid")
+	if err := os.WriteFile(pidPath, []byte("12345"), 0644); err != nil {
+		t.Fatalf("Failed to write pid file: %v", err)
+	}
+	started := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(pidPath, started, started); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := StartTime(cfg, "test-vm")
+	if err != nil {
+		t.Fatalf("StartTime() returned an error: %v", err)
+	}
+	if !got.Equal(started) {
+		t.Errorf("StartTime() got = %v, want %v", got, started)
+	}
+}
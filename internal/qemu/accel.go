@@ -0,0 +1,78 @@
+package qemu
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+var (
+	hostOS    = runtime.GOOS
+	hostArch  = HostArch()
+	kvmDevice = "/dev/kvm"
+)
+
+// Accelerator describes the QEMU accelerator selected for a guest.
+type Accelerator struct {
+	// Name is the value passed to QEMU's -accel option: kvm, hvf or tcg.
+	Name string
+	// Reason explains why the accelerator was selected.
+	Reason string
+}
+
+// CPU returns the CPU model to use with the accelerator. Hardware
+// accelerators pass the host CPU through, TCG emulates the most capable CPU.
+func (a Accelerator) CPU() string {
+	if a.Name == "tcg" {
+		return "max"
+	}
+	return "host"
+}
+
+// HostArch returns the host architecture using the names pvmlab uses for
+// guests ('aarch64' or 'x86_64').
+func HostArch() string {
+	switch runtime.GOARCH {
+	case "arm64":
+		return "aarch64"
+	case "amd64":
+		return "x86_64"
+	default:
+		return runtime.GOARCH
+	}
+}
+
+// SelectAccelerator picks the accelerator for a guest of the given
+// architecture. PVMLAB_QEMU_ACCEL always wins. Otherwise hardware
+// acceleration is used when the guest matches the host architecture: hvf on
+// macOS, kvm on Linux when /dev/kvm is usable. Everything else falls back to
+// TCG emulation.
+var SelectAccelerator = func(guestArch string) Accelerator {
+	if accel := os.Getenv("PVMLAB_QEMU_ACCEL"); accel != "" {
+		return Accelerator{Name: accel, Reason: "set by PVMLAB_QEMU_ACCEL"}
+	}
+	if guestArch != hostArch {
+		return Accelerator{Name: "tcg", Reason: fmt.Sprintf("%s guest on %s host requires emulation", guestArch, hostArch)}
+	}
+	switch hostOS {
+	case "darwin":
+		return Accelerator{Name: "hvf", Reason: "Hypervisor.framework is available on macOS"}
+	case "linux":
+		if err := checkKVM(); err != nil {
+			return Accelerator{Name: "tcg", Reason: fmt.Sprintf("KVM is not usable: %v", err)}
+		}
+		return Accelerator{Name: "kvm", Reason: fmt.Sprintf("%s is usable", kvmDevice)}
+	default:
+		return Accelerator{Name: "tcg", Reason: fmt.Sprintf("no hardware accelerator is supported on %s", hostOS)}
+	}
+}
+
+// checkKVM verifies that the KVM device exists and can be opened for
+// reading and writing, which typically requires membership of the kvm group.
+func checkKVM() error {
+	f, err := os.OpenFile(kvmDevice, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
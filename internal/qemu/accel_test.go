@@ -0,0 +1,103 @@
+package qemu
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSelectAccelerator(t *testing.T) {
+	usableKVM := filepath.Join(t.TempDir(), "kvm")
+	if err := os.WriteFile(usableKVM, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		env        string
+		os         string
+		arch       string
+		kvm        string
+		guestArch  string
+		wantAccel  string
+		wantCPU    string
+		wantReason string
+	}{
+		{
+			name:       "env override",
+			env:        "tcg",
+			os:         "darwin",
+			arch:       "aarch64",
+			guestArch:  "aarch64",
+			wantAccel:  "tcg",
+			wantCPU:    "max",
+			wantReason: "PVMLAB_QEMU_ACCEL",
+		},
+		{
+			name:      "hvf on macOS",
+			os:        "darwin",
+			arch:      "aarch64",
+			guestArch: "aarch64",
+			wantAccel: "hvf",
+			wantCPU:   "host",
+		},
+		{
+			name:      "kvm on Linux",
+			os:        "linux",
+			arch:      "x86_64",
+			kvm:       usableKVM,
+			guestArch: "x86_64",
+			wantAccel: "kvm",
+			wantCPU:   "host",
+		},
+		{
+			name:       "kvm device missing",
+			os:         "linux",
+			arch:       "x86_64",
+			kvm:        filepath.Join(t.TempDir(), "missing"),
+			guestArch:  "x86_64",
+			wantAccel:  "tcg",
+			wantCPU:    "max",
+			wantReason: "KVM is not usable",
+		},
+		{
+			name:       "foreign architecture",
+			os:         "linux",
+			arch:       "x86_64",
+			kvm:        usableKVM,
+			guestArch:  "aarch64",
+			wantAccel:  "tcg",
+			wantCPU:    "max",
+			wantReason: "requires emulation",
+		},
+		{
+			name:      "unsupported host OS",
+			os:        "freebsd",
+			arch:      "x86_64",
+			guestArch: "x86_64",
+			wantAccel: "tcg",
+			wantCPU:   "max",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origOS, origArch, origKVM := hostOS, hostArch, kvmDevice
+			defer func() { hostOS, hostArch, kvmDevice = origOS, origArch, origKVM }()
+			hostOS, hostArch, kvmDevice = tt.os, tt.arch, tt.kvm
+			t.Setenv("PVMLAB_QEMU_ACCEL", tt.env)
+
+			got := SelectAccelerator(tt.guestArch)
+			if got.Name != tt.wantAccel {
+				t.Errorf("expected accelerator %s, got %s (%s)", tt.wantAccel, got.Name, got.Reason)
+			}
+			if got.CPU() != tt.wantCPU {
+				t.Errorf("expected CPU %s, got %s", tt.wantCPU, got.CPU())
+			}
+			if !strings.Contains(got.Reason, tt.wantReason) {
+				t.Errorf("expected reason to contain '%s', got '%s'", tt.wantReason, got.Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package qemu
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Firmware is a UEFI firmware image for a guest architecture.
+type Firmware struct {
+	// Code is the read-only firmware code.
+	Code string
+	// Vars is the template copied to create each VM's variable store. It is
+	// empty for unified images, which hold code and variables in one file.
+	Vars string
+}
+
+// FirmwarePaths maps each guest architecture to the locations searched for
+// its firmware, in order of preference. Code and vars templates must come
+// from the same build, so they are listed in pairs.
+var FirmwarePaths = map[string][]Firmware{
+	"aarch64": {
+		// Debian, Ubuntu (qemu-efi-aarch64)
+		{Code: "/usr/share/AAVMF/AAVMF_CODE.fd", Vars: "/usr/share/AAVMF/AAVMF_VARS.fd"},
+		{Code: "/usr/share/qemu-efi-aarch64/QEMU_EFI.fd", Vars: "/usr/share/qemu-efi-aarch64/QEMU_VARS.fd"},
+		// Fedora, RHEL and derivatives (edk2-aarch64)
+		{Code: "/usr/share/edk2/aarch64/QEMU_EFI-pflash.raw", Vars: "/usr/share/edk2/aarch64/vars-template-pflash.raw"},
+		// Arch Linux (edk2-aarch64)
+		{Code: "/usr/share/edk2/aarch64/QEMU_CODE.fd", Vars: "/usr/share/edk2/aarch64/QEMU_VARS.fd"},
+		// Homebrew on Apple silicon and Intel, QEMU installed from source
+		{Code: "/opt/homebrew/share/qemu/edk2-aarch64-code.fd", Vars: "/opt/homebrew/share/qemu/edk2-arm-vars.fd"},
+		{Code: "/usr/local/share/qemu/edk2-aarch64-code.fd", Vars: "/usr/local/share/qemu/edk2-arm-vars.fd"},
+		{Code: "/usr/share/qemu/edk2-aarch64-code.fd", Vars: "/usr/share/qemu/edk2-arm-vars.fd"},
+	},
+	"x86_64": {
+		// Debian, Ubuntu (ovmf)
+		{Code: "/usr/share/OVMF/OVMF_CODE_4M.fd", Vars: "/usr/share/OVMF/OVMF_VARS_4M.fd"},
+		{Code: "/usr/share/OVMF/OVMF_CODE.fd", Vars: "/usr/share/OVMF/OVMF_VARS.fd"},
+		// Fedora, RHEL and derivatives (edk2-ovmf)
+		{Code: "/usr/share/edk2/ovmf/OVMF_CODE.fd", Vars: "/usr/share/edk2/ovmf/OVMF_VARS.fd"},
+		// Arch Linux (edk2-ovmf)
+		{Code: "/usr/share/edk2/x64/OVMF_CODE.4m.fd", Vars: "/usr/share/edk2/x64/OVMF_VARS.4m.fd"},
+		{Code: "/usr/share/edk2-ovmf/x64/OVMF_CODE.fd", Vars: "/usr/share/edk2-ovmf/x64/OVMF_VARS.fd"},
+		// Homebrew on Apple silicon and Intel, QEMU installed from source
+		{Code: "/opt/homebrew/share/qemu/edk2-x86_64-code.fd", Vars: "/opt/homebrew/share/qemu/edk2-i386-vars.fd"},
+		{Code: "/usr/local/share/qemu/edk2-x86_64-code.fd", Vars: "/usr/local/share/qemu/edk2-i386-vars.fd"},
+		{Code: "/usr/share/qemu/edk2-x86_64-code.fd", Vars: "/usr/share/qemu/edk2-i386-vars.fd"},
+		// Unified images
+		{Code: "/usr/share/qemu/OVMF.fd"},
+		{Code: "/usr/share/ovmf/OVMF.fd"},
+	},
+}
+
+// FindFirmware returns the UEFI firmware for the given guest architecture.
+// PVMLAB_FIRMWARE_CODE and PVMLAB_FIRMWARE_VARS override the search; when
+// only the code is set it is treated as a unified image.
+var FindFirmware = func(arch string) (*Firmware, error) {
+	if code := os.Getenv("PVMLAB_FIRMWARE_CODE"); code != "" {
+		fw := &Firmware{Code: code, Vars: os.Getenv("PVMLAB_FIRMWARE_VARS")}
+		for _, path := range []string{fw.Code, fw.Vars} {
+			if path == "" {
+				continue
+			}
+			if _, err := os.Stat(path); err != nil {
+				return nil, fmt.Errorf("firmware set by PVMLAB_FIRMWARE_CODE/PVMLAB_FIRMWARE_VARS not found: %w", err)
+			}
+		}
+		return fw, nil
+	}
+
+	candidates, ok := FirmwarePaths[arch]
+	if !ok {
+		return nil, fmt.Errorf("unsupported architecture: %s", arch)
+	}
+	var searched []string
+	for _, fw := range candidates {
+		searched = append(searched, fw.Code)
+		if !fileExists(fw.Code) || (fw.Vars != "" && !fileExists(fw.Vars)) {
+			continue
+		}
+		found := fw
+		return &found, nil
+	}
+	return nil, fmt.Errorf("could not find UEFI firmware for %s in any of the following locations: %s. Install your distribution's OVMF/AAVMF (edk2) package or set PVMLAB_FIRMWARE_CODE", arch, strings.Join(searched, ", "))
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
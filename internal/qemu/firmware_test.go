@@ -0,0 +1,83 @@
+package qemu
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func touch(t *testing.T, path string) string {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFindFirmware(t *testing.T) {
+	dir := t.TempDir()
+	origPaths := FirmwarePaths
+	defer func() { FirmwarePaths = origPaths }()
+
+	FirmwarePaths = map[string][]Firmware{
+		"aarch64": {
+			// Code present but vars missing: the pair is skipped.
+			{Code: touch(t, filepath.Join(dir, "a/code.fd")), Vars: filepath.Join(dir, "a/vars.fd")},
+			{Code: touch(t, filepath.Join(dir, "b/code.fd")), Vars: touch(t, filepath.Join(dir, "b/vars.fd"))},
+		},
+		"x86_64": {
+			{Code: filepath.Join(dir, "missing/code.fd"), Vars: filepath.Join(dir, "missing/vars.fd")},
+			{Code: touch(t, filepath.Join(dir, "OVMF.fd"))},
+		},
+	}
+
+	fw, err := FindFirmware("aarch64")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fw.Code != filepath.Join(dir, "b/code.fd") || fw.Vars != filepath.Join(dir, "b/vars.fd") {
+		t.Errorf("unexpected aarch64 firmware: %+v", fw)
+	}
+
+	fw, err = FindFirmware("x86_64")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fw.Code != filepath.Join(dir, "OVMF.fd") || fw.Vars != "" {
+		t.Errorf("expected unified x86_64 firmware, got %+v", fw)
+	}
+
+	if _, err := FindFirmware("riscv64"); err == nil || !strings.Contains(err.Error(), "unsupported architecture") {
+		t.Errorf("expected unsupported architecture error, got %v", err)
+	}
+
+	FirmwarePaths = map[string][]Firmware{"aarch64": {{Code: filepath.Join(dir, "nope.fd")}}}
+	if _, err := FindFirmware("aarch64"); err == nil || !strings.Contains(err.Error(), "PVMLAB_FIRMWARE_CODE") {
+		t.Errorf("expected not found error with a hint, got %v", err)
+	}
+}
+
+func TestFindFirmware_EnvOverride(t *testing.T) {
+	dir := t.TempDir()
+	code := touch(t, filepath.Join(dir, "code.fd"))
+	vars := touch(t, filepath.Join(dir, "vars.fd"))
+
+	t.Setenv("PVMLAB_FIRMWARE_CODE", code)
+	t.Setenv("PVMLAB_FIRMWARE_VARS", vars)
+	fw, err := FindFirmware("aarch64")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fw.Code != code || fw.Vars != vars {
+		t.Errorf("unexpected firmware: %+v", fw)
+	}
+
+	t.Setenv("PVMLAB_FIRMWARE_VARS", filepath.Join(dir, "missing.fd"))
+	if _, err := FindFirmware("aarch64"); err == nil {
+		t.Error("expected an error for a missing vars override")
+	}
+}
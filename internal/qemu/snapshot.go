@@ -0,0 +1,90 @@
+package qemu
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var snapshotDate = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// SnapshotInfo describes an internal snapshot of a qcow2 image.
+type SnapshotInfo struct {
+	ID      string
+	Name    string
+	VMSize  string
+	Date    string
+	VMClock string
+}
+
+// IsQcow2 reports whether the file at path is a qcow2 image.
+func IsQcow2(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		return false, err
+	}
+	return bytes.Equal(magic, []byte{'Q', 'F', 'I', 0xfb}), nil
+}
+
+// ConvertToQcow2 creates a qcow2 copy of a raw image. UEFI variable stores
+// are kept in qcow2 so that QEMU can include them in VM snapshots.
+var ConvertToQcow2 = func(src, dst string) error {
+	cmd := execCommand("qemu-img", "convert", "-f", "raw", "-O", "qcow2", src, dst)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to convert %s to qcow2: %w: %s", src, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Snapshot runs `qemu-img snapshot` on an image that is not in use. op is
+// one of "-c" (create), "-a" (apply) or "-d" (delete).
+var Snapshot = func(op, name, imagePath string) error {
+	cmd := execCommand("qemu-img", "snapshot", op, name, imagePath)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("qemu-img snapshot %s %s failed on %s: %w: %s", op, name, imagePath, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// ListSnapshots returns the internal snapshots of an image that is not in use.
+var ListSnapshots = func(imagePath string) ([]SnapshotInfo, error) {
+	cmd := execCommand("qemu-img", "snapshot", "-l", imagePath)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to list snapshots of %s: %w", imagePath, err)
+	}
+	return ParseSnapshotList(out.String()), nil
+}
+
+// ParseSnapshotList parses the snapshot table printed by both
+// `qemu-img snapshot -l` and the monitor's `info snapshots` command.
+func ParseSnapshotList(output string) []SnapshotInfo {
+	var snapshots []SnapshotInfo
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		// ID TAG SIZE UNIT DATE TIME CLOCK [ICOUNT]
+		if len(fields) < 7 || !snapshotDate.MatchString(fields[4]) {
+			continue
+		}
+		snapshots = append(snapshots, SnapshotInfo{
+			ID:      fields[0],
+			Name:    fields[1],
+			VMSize:  fields[2] + " " + fields[3],
+			Date:    fields[4] + " " + fields[5],
+			VMClock: fields[6],
+		})
+	}
+	return snapshots
+}
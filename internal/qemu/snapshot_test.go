@@ -0,0 +1,79 @@
+package qemu
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIsQcow2(t *testing.T) {
+	dir := t.TempDir()
+	qcow2 := filepath.Join(dir, "disk.qcow2")
+	raw := filepath.Join(dir, "vars.fd")
+	empty := filepath.Join(dir, "empty.fd")
+	os.WriteFile(qcow2, []byte{'Q', 'F', 'I', 0xfb, 0, 0, 0, 3}, 0644)
+	os.WriteFile(raw, make([]byte, 64), 0644)
+	os.WriteFile(empty, nil, 0644)
+
+	for path, want := range map[string]bool{qcow2: true, raw: false, empty: false} {
+		got, err := IsQcow2(path)
+		if err != nil {
+			t.Fatalf("IsQcow2(%s) failed: %v", path, err)
+		}
+		if got != want {
+			t.Errorf("IsQcow2(%s) = %v, want %v", path, got, want)
+		}
+	}
+
+	if _, err := IsQcow2(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestParseSnapshotList(t *testing.T) {
+	qemuImgOutput := `Snapshot list:
+ID        TAG               VM SIZE                DATE     VM CLOCK     ICOUNT
+1         blank                 0 B 2025-01-02 10:00:00 00:00:00.000          0
+2         installed         1.2 GiB 2025-01-02 11:30:00 00:12:34.567
+`
+	monitorOutput := `List of snapshots present on all disks:
+ID        TAG               VM SIZE                DATE     VM CLOCK     ICOUNT
+--        installed         1.2 GiB 2025-01-02 11:30:00 00:12:34.567
+`
+
+	want := []SnapshotInfo{
+		{ID: "1", Name: "blank", VMSize: "0 B", Date: "2025-01-02 10:00:00", VMClock: "00:00:00.000"},
+		{ID: "2", Name: "installed", VMSize: "1.2 GiB", Date: "2025-01-02 11:30:00", VMClock: "00:12:34.567"},
+	}
+	if got := ParseSnapshotList(qemuImgOutput); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected qemu-img snapshots:\n got %+v\nwant %+v", got, want)
+	}
+
+	want = []SnapshotInfo{
+		{ID: "--", Name: "installed", VMSize: "1.2 GiB", Date: "2025-01-02 11:30:00", VMClock: "00:12:34.567"},
+	}
+	if got := ParseSnapshotList(monitorOutput); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected monitor snapshots:\n got %+v\nwant %+v", got, want)
+	}
+
+	if got := ParseSnapshotList("There is no snapshot available.\n"); got != nil {
+		t.Errorf("expected no snapshots, got %+v", got)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() { execCommand = originalExecCommand }()
+
+	execCommand = mockExecCommand("", "", nil)
+
+	if err := Snapshot("-c", "blank", "/tmp/disk.qcow2"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	execCommand = mockExecCommand("", "Could not create snapshot", os.ErrInvalid)
+	if err := Snapshot("-c", "blank", "/tmp/disk.qcow2"); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,283 @@
+// Package qmp is a client for the QEMU Machine Protocol (QMP) exposed by every
+// VM on a unix socket.
+package qmp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Error is an error returned by QEMU in response to a command.
+type Error struct {
+	Class string `json:"class"`
+	Desc  string `json:"desc"`
+}
+
+func (e *Error) Error() string {
+	return e.Desc
+}
+
+// Event is an asynchronous event emitted by QEMU, e.g. SHUTDOWN or STOP.
+type Event struct {
+	Event     string          `json:"event"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Timestamp struct {
+		Seconds      int64 `json:"seconds"`
+		Microseconds int64 `json:"microseconds"`
+	} `json:"timestamp"`
+}
+
+// Status is the run state of a VM as returned by query-status.
+type Status struct {
+	Status  string `json:"status"`
+	Running bool   `json:"running"`
+}
+
+// message is any message sent by QEMU: a greeting, a command response or an
+// event.
+type message struct {
+	QMP    json.RawMessage `json:"QMP,omitempty"`
+	Return json.RawMessage `json:"return,omitempty"`
+	Error  *Error          `json:"error,omitempty"`
+	Event  string          `json:"event,omitempty"`
+}
+
+// Client is a QMP connection. It is not safe for concurrent use.
+type Client struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+	// events holds the events received while waiting for command responses.
+	events []Event
+}
+
+// Dial connects to the QMP socket at socketPath and negotiates capabilities.
+// timeout bounds every operation on the connection.
+func Dial(socketPath string, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout("unix", socketPath, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to QMP socket: %w", err)
+	}
+	c := &Client{conn: conn, reader: bufio.NewReader(conn), timeout: timeout}
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	greeting, _, err := c.read()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read QMP greeting: %w", err)
+	}
+	if greeting.QMP == nil {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected QMP greeting")
+	}
+	if _, err := c.Execute("qmp_capabilities", nil); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to negotiate QMP capabilities: %w", err)
+	}
+	return c, nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Execute runs a command and returns its result. args is marshalled to the
+// command's arguments and may be nil. Events received before the response
+// are kept for WaitEvent.
+func (c *Client) Execute(command string, args any) (json.RawMessage, error) {
+	return c.ExecuteTimeout(command, args, c.timeout)
+}
+
+// ExecuteTimeout is like Execute with a specific timeout, for commands that
+// take longer than usual such as saving the VM state.
+func (c *Client) ExecuteTimeout(command string, args any, timeout time.Duration) (json.RawMessage, error) {
+	req := struct {
+		Execute   string `json:"execute"`
+		Arguments any    `json:"arguments,omitempty"`
+	}{command, args}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := c.conn.Write(append(data, '\n')); err != nil {
+		return nil, fmt.Errorf("failed to send QMP command '%s': %w", command, err)
+	}
+	for {
+		msg, event, err := c.read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read QMP response to '%s': %w", command, err)
+		}
+		switch {
+		case event != nil:
+			c.events = append(c.events, *event)
+		case msg.Error != nil:
+			return nil, msg.Error
+		case msg.Return != nil:
+			return msg.Return, nil
+		}
+	}
+}
+
+// WaitEvent waits up to timeout for one of the named events and returns it.
+func (c *Client) WaitEvent(timeout time.Duration, names ...string) (*Event, error) {
+	matches := func(e Event) bool {
+		for _, name := range names {
+			if e.Event == name {
+				return true
+			}
+		}
+		return false
+	}
+	for i, e := range c.events {
+		if matches(e) {
+			c.events = c.events[i+1:]
+			return &e, nil
+		}
+	}
+	c.events = nil
+
+	if err := c.conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	for {
+		_, event, err := c.read()
+		if err != nil {
+			return nil, fmt.Errorf("failed waiting for %s: %w", strings.Join(names, " or "), err)
+		}
+		if event != nil && matches(*event) {
+			return event, nil
+		}
+	}
+}
+
+// QueryStatus returns the run state of the VM.
+func (c *Client) QueryStatus() (*Status, error) {
+	ret, err := c.Execute("query-status", nil)
+	if err != nil {
+		return nil, err
+	}
+	var status Status
+	if err := json.Unmarshal(ret, &status); err != nil {
+		return nil, fmt.Errorf("failed to parse query-status response: %w", err)
+	}
+	return &status, nil
+}
+
+// HumanMonitorCommand runs a human monitor (HMP) command, for features that
+// have no QMP equivalent in all supported QEMU versions, and returns its
+// output. Output starting with "Error:" is returned as an error.
+func (c *Client) HumanMonitorCommand(cmdline string, timeout time.Duration) (string, error) {
+	ret, err := c.ExecuteTimeout("human-monitor-command", map[string]string{"command-line": cmdline}, timeout)
+	if err != nil {
+		return "", err
+	}
+	var out string
+	if err := json.Unmarshal(ret, &out); err != nil {
+		return "", fmt.Errorf("failed to parse human-monitor-command response: %w", err)
+	}
+	out = strings.TrimRight(strings.ReplaceAll(out, "\r", ""), "\n")
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "Error:") {
+			return "", fmt.Errorf("%s", strings.TrimSpace(strings.TrimPrefix(line, "Error:")))
+		}
+	}
+	return out, nil
+}
+
+// read reads the next message. If it is an event, the event is returned too.
+func (c *Client) read() (*message, *Event, error) {
+	line, err := c.reader.ReadBytes('\n')
+	if err != nil {
+		return nil, nil, err
+	}
+	var msg message
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return nil, nil, fmt.Errorf("invalid QMP message: %w", err)
+	}
+	if msg.Event != "" {
+		var event Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, nil, fmt.Errorf("invalid QMP event: %w", err)
+		}
+		return &msg, &event, nil
+	}
+	return &msg, nil, nil
+}
+
+// Run connects to the QMP socket, runs a single command and disconnects.
+var Run = func(socketPath, command string, args any, timeout time.Duration) (json.RawMessage, error) {
+	c, err := Dial(socketPath, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	return c.Execute(command, args)
+}
+
+// RunHMP connects to the QMP socket, runs a single human monitor command and
+// disconnects.
+var RunHMP = func(socketPath, cmdline string, timeout time.Duration) (string, error) {
+	c, err := Dial(socketPath, timeout)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+	return c.HumanMonitorCommand(cmdline, timeout)
+}
+
+// QueryStatus connects to the QMP socket and returns the run state of the VM.
+var QueryStatus = func(socketPath string, timeout time.Duration) (*Status, error) {
+	c, err := Dial(socketPath, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	return c.QueryStatus()
+}
+
+// requestPowerdown asks the guest to power off and waits for QEMU to report
+// the ACPI power button press with the POWERDOWN event.
+func (c *Client) requestPowerdown(timeout time.Duration) error {
+	if _, err := c.Execute("system_powerdown", nil); err != nil {
+		return err
+	}
+	_, err := c.WaitEvent(timeout, "POWERDOWN")
+	return err
+}
+
+// RequestPowerdown connects to the QMP socket and asks the guest to power off,
+// without waiting for the shutdown.
+var RequestPowerdown = func(socketPath string, timeout time.Duration) error {
+	c, err := Dial(socketPath, timeout)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.requestPowerdown(timeout)
+}
+
+// Powerdown connects to the QMP socket, asks the guest to power off and waits
+// up to timeout for QEMU to report the shutdown.
+var Powerdown = func(socketPath string, timeout time.Duration) error {
+	c, err := Dial(socketPath, timeout)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := c.requestPowerdown(timeout); err != nil {
+		return err
+	}
+	_, err = c.WaitEvent(timeout, "SHUTDOWN")
+	return err
+}
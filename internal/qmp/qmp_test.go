@@ -0,0 +1,226 @@
+package qmp
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeQMP serves a minimal QMP session on a unix socket. handle is called
+// for every command after capabilities negotiation and returns the lines to
+// send back, e.g. events followed by the response.
+func fakeQMP(t *testing.T, handle func(command string, args map[string]any) []string) (string, chan string) {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "qmp.sock")
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	received := make(chan string, 10)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte(`{"QMP": {"version": {"qemu": {"micro": 0, "minor": 0, "major": 9}}, "capabilities": []}}` + "\r\n"))
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			var req struct {
+				Execute   string         `json:"execute"`
+				Arguments map[string]any `json:"arguments"`
+			}
+			if err := json.Unmarshal(line, &req); err != nil {
+				return
+			}
+			if req.Execute == "qmp_capabilities" {
+				conn.Write([]byte(`{"return": {}}` + "\r\n"))
+				continue
+			}
+			received <- req.Execute
+			for _, out := range handle(req.Execute, req.Arguments) {
+				conn.Write([]byte(out + "\r\n"))
+			}
+		}
+	}()
+	return socketPath, received
+}
+
+func TestRun(t *testing.T) {
+	socketPath, received := fakeQMP(t, func(command string, args map[string]any) []string {
+		return []string{`{"return": {}}`}
+	})
+
+	if _, err := Run(socketPath, "system_reset", nil, 5*time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := <-received; got != "system_reset" {
+		t.Errorf("expected command 'system_reset', got '%s'", got)
+	}
+}
+
+func TestRun_Error(t *testing.T) {
+	socketPath, _ := fakeQMP(t, func(command string, args map[string]any) []string {
+		return []string{`{"error": {"class": "CommandNotFound", "desc": "The command foo has not been found"}}`}
+	})
+
+	_, err := Run(socketPath, "foo", nil, 5*time.Second)
+	qmpErr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected *Error, got '%v'", err)
+	}
+	if qmpErr.Class != "CommandNotFound" || qmpErr.Desc != "The command foo has not been found" {
+		t.Errorf("unexpected error: %+v", qmpErr)
+	}
+}
+
+func TestRun_NoSocket(t *testing.T) {
+	_, err := Run(filepath.Join(t.TempDir(), "missing.sock"), "query-status", nil, time.Second)
+	if err == nil || !strings.Contains(err.Error(), "failed to connect to QMP socket") {
+		t.Errorf("expected connection error, got '%v'", err)
+	}
+}
+
+func TestRunHMP(t *testing.T) {
+	var gotCmdline any
+	socketPath, _ := fakeQMP(t, func(command string, args map[string]any) []string {
+		gotCmdline = args["command-line"]
+		return []string{`{"return": "List of snapshots present on all disks:\r\nID  TAG\r\n--  blank\r\n"}`}
+	})
+
+	out, err := RunHMP(socketPath, "info snapshots", 5*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotCmdline != "info snapshots" {
+		t.Errorf("expected command line 'info snapshots', got '%v'", gotCmdline)
+	}
+	want := "List of snapshots present on all disks:\nID  TAG\n--  blank"
+	if out != want {
+		t.Errorf("expected output %q, got %q", want, out)
+	}
+}
+
+func TestRunHMP_Error(t *testing.T) {
+	socketPath, _ := fakeQMP(t, func(command string, args map[string]any) []string {
+		return []string{`{"return": "Error: Device 'pflash1' is writable but does not support snapshots\r\n"}`}
+	})
+
+	_, err := RunHMP(socketPath, "savevm snap", 5*time.Second)
+	if err == nil || err.Error() != "Device 'pflash1' is writable but does not support snapshots" {
+		t.Errorf("expected monitor error, got '%v'", err)
+	}
+}
+
+func TestQueryStatus(t *testing.T) {
+	socketPath, _ := fakeQMP(t, func(command string, args map[string]any) []string {
+		return []string{`{"return": {"status": "paused", "singlestep": false, "running": false}}`}
+	})
+
+	status, err := QueryStatus(socketPath, 5*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status.Status != "paused" || status.Running {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
+
+func TestWaitEvent(t *testing.T) {
+	socketPath, _ := fakeQMP(t, func(command string, args map[string]any) []string {
+		// QEMU may emit events before the command's response.
+		return []string{
+			`{"event": "POWERDOWN", "timestamp": {"seconds": 1, "microseconds": 0}}`,
+			`{"return": {}}`,
+			`{"event": "SHUTDOWN", "data": {"guest": true, "reason": "guest-shutdown"}, "timestamp": {"seconds": 2, "microseconds": 0}}`,
+		}
+	})
+
+	c, err := Dial(socketPath, 5*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Execute("system_powerdown", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	event, err := c.WaitEvent(5*time.Second, "POWERDOWN")
+	if err != nil || event.Event != "POWERDOWN" {
+		t.Fatalf("expected buffered POWERDOWN event, got %v, %v", event, err)
+	}
+	event, err = c.WaitEvent(5*time.Second, "SHUTDOWN")
+	if err != nil || event.Event != "SHUTDOWN" {
+		t.Fatalf("expected SHUTDOWN event, got %v, %v", event, err)
+	}
+	if event.Timestamp.Seconds != 2 || !strings.Contains(string(event.Data), "guest-shutdown") {
+		t.Errorf("unexpected event: %+v", event)
+	}
+}
+
+func TestWaitEvent_Timeout(t *testing.T) {
+	socketPath, _ := fakeQMP(t, func(command string, args map[string]any) []string {
+		return []string{`{"return": {}}`}
+	})
+
+	c, err := Dial(socketPath, 5*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.WaitEvent(100*time.Millisecond, "SHUTDOWN"); err == nil {
+		t.Error("expected timeout error")
+	}
+}
+
+func TestPowerdown(t *testing.T) {
+	socketPath, received := fakeQMP(t, func(command string, args map[string]any) []string {
+		return []string{
+			`{"return": {}}`,
+			`{"event": "POWERDOWN", "timestamp": {"seconds": 1, "microseconds": 0}}`,
+			`{"event": "SHUTDOWN", "data": {"guest": true, "reason": "guest-shutdown"}, "timestamp": {"seconds": 2, "microseconds": 0}}`,
+		}
+	})
+
+	if err := Powerdown(socketPath, 5*time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := <-received; got != "system_powerdown" {
+		t.Errorf("expected command 'system_powerdown', got '%s'", got)
+	}
+}
+
+func TestRequestPowerdown(t *testing.T) {
+	socketPath, received := fakeQMP(t, func(command string, args map[string]any) []string {
+		return []string{
+			`{"return": {}}`,
+			`{"event": "POWERDOWN", "timestamp": {"seconds": 1, "microseconds": 0}}`,
+		}
+	})
+
+	if err := RequestPowerdown(socketPath, 5*time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := <-received; got != "system_powerdown" {
+		t.Errorf("expected command 'system_powerdown', got '%s'", got)
+	}
+
+	// QEMU confirms the request with the POWERDOWN event.
+	socketPath, _ = fakeQMP(t, func(command string, args map[string]any) []string {
+		return []string{`{"return": {}}`}
+	})
+	if err := RequestPowerdown(socketPath, 100*time.Millisecond); err == nil {
+		t.Error("expected an error without the POWERDOWN event")
+	}
+}
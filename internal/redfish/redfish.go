@@ -0,0 +1,473 @@
+// Package redfish implements the subset of the DMTF Redfish API used by
+// provisioning tools to control servers out of band: power actions, boot
+// source override and virtual media.
+//
+// Every system has a manager (its BMC) with the same ID, which holds a single
+// virtual CD drive.
+package redfish
+
+import (
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// ErrNotFound is returned by a Backend for systems that don't exist.
+var ErrNotFound = errors.New("system not found")
+
+// ErrInvalidImage is returned by a Backend for virtual media images it
+// refuses to insert.
+var ErrInvalidImage = errors.New("invalid image")
+
+// Power states reported for systems.
+const (
+	PowerOn          = "On"
+	PowerOff         = "Off"
+	PowerPaused      = "Paused"
+	PowerPoweringOff = "PoweringOff"
+)
+
+// Reset types accepted by the ComputerSystem.Reset action.
+var ResetTypes = []string{"On", "ForceOff", "GracefulShutdown", "ForceRestart", "PushPowerButton", "Nmi"}
+
+// Boot source override targets and modes.
+var (
+	BootTargets = []string{"None", "Pxe", "Hdd", "Cd"}
+	BootEnabled = []string{"Disabled", "Once", "Continuous"}
+)
+
+// Boot is the boot source override of a system.
+type Boot struct {
+	Target  string
+	Enabled string
+}
+
+// Media is the state of a system's virtual CD drive.
+type Media struct {
+	Image    string
+	Inserted bool
+}
+
+// System is a computer system controlled by the service.
+type System struct {
+	ID         string
+	PowerState string
+	MAC        string
+	CPUs       int
+	MemoryMB   int
+	Boot       Boot
+	Media      Media
+}
+
+// Backend controls the systems exposed by the service. Methods taking an ID
+// return an error wrapping ErrNotFound for unknown systems.
+type Backend interface {
+	Systems() ([]string, error)
+	System(id string) (*System, error)
+	Reset(id, resetType string) error
+	SetBoot(id string, boot Boot) error
+	InsertMedia(id, image string) error
+	EjectMedia(id string) error
+}
+
+type server struct {
+	backend            Backend
+	username, password string
+}
+
+// NewHandler returns an http.Handler serving the Redfish API for the systems
+// of backend. If username is not empty, requests must use HTTP basic
+// authentication with these credentials.
+func NewHandler(backend Backend, username, password string) http.Handler {
+	s := &server{backend: backend, username: username, password: password}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /redfish", s.versions)
+	mux.HandleFunc("GET /redfish/v1", s.serviceRoot)
+	mux.HandleFunc("GET /redfish/v1/{$}", s.serviceRoot)
+	mux.HandleFunc("GET /redfish/v1/Systems", s.systems)
+	mux.HandleFunc("GET /redfish/v1/Systems/{id}", s.system)
+	mux.HandleFunc("PATCH /redfish/v1/Systems/{id}", s.patchSystem)
+	mux.HandleFunc("POST /redfish/v1/Systems/{id}/Actions/ComputerSystem.Reset", s.reset)
+	mux.HandleFunc("GET /redfish/v1/Systems/{id}/EthernetInterfaces", s.ethernetInterfaces)
+	mux.HandleFunc("GET /redfish/v1/Systems/{id}/EthernetInterfaces/{nic}", s.ethernetInterface)
+	mux.HandleFunc("GET /redfish/v1/Managers", s.managers)
+	mux.HandleFunc("GET /redfish/v1/Managers/{id}", s.manager)
+	mux.HandleFunc("GET /redfish/v1/Managers/{id}/VirtualMedia", s.virtualMediaCollection)
+	mux.HandleFunc("GET /redfish/v1/Managers/{id}/VirtualMedia/Cd", s.virtualMedia)
+	mux.HandleFunc("POST /redfish/v1/Managers/{id}/VirtualMedia/Cd/Actions/VirtualMedia.InsertMedia", s.insertMedia)
+	mux.HandleFunc("POST /redfish/v1/Managers/{id}/VirtualMedia/Cd/Actions/VirtualMedia.EjectMedia", s.ejectMedia)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "Base.1.0.ResourceMissingAtURI", fmt.Sprintf("The resource at %s was not found", r.URL.Path))
+	})
+	return s.authenticate(mux)
+}
+
+func (s *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The version and service root documents are always readable so
+		// clients can discover the service.
+		public := r.URL.Path == "/redfish" || r.URL.Path == "/redfish/v1" || r.URL.Path == "/redfish/v1/"
+		if s.username != "" && !public {
+			user, pass, ok := r.BasicAuth()
+			if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(s.username)) != 1 ||
+				subtle.ConstantTimeCompare([]byte(pass), []byte(s.password)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="pvmlab"`)
+				writeError(w, http.StatusUnauthorized, "Base.1.0.InsufficientPrivilege", "Authentication required")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *server) versions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{"v1": "/redfish/v1/"})
+}
+
+func (s *server) serviceRoot(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]any{
+		"@odata.type":    "#ServiceRoot.v1_5_0.ServiceRoot",
+		"@odata.id":      "/redfish/v1/",
+		"Id":             "RootService",
+		"Name":           "pvmlab Redfish Service",
+		"RedfishVersion": "1.6.0",
+		"UUID":           uuid("pvmlab"),
+		"Systems":        odataID("/redfish/v1/Systems"),
+		"Managers":       odataID("/redfish/v1/Managers"),
+	})
+}
+
+func (s *server) systems(w http.ResponseWriter, r *http.Request) {
+	ids, err := s.backend.Systems()
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	writeCollection(w, "#ComputerSystemCollection.ComputerSystemCollection", "/redfish/v1/Systems", "Computer System Collection", ids)
+}
+
+func (s *server) system(w http.ResponseWriter, r *http.Request) {
+	sys, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	base := "/redfish/v1/Systems/" + sys.ID
+	writeJSON(w, map[string]any{
+		"@odata.type": "#ComputerSystem.v1_10_0.ComputerSystem",
+		"@odata.id":   base,
+		"Id":          sys.ID,
+		"Name":        sys.ID,
+		"UUID":        uuid(sys.ID),
+		"SystemType":  "Virtual",
+		"PowerState":  sys.PowerState,
+		"Status":      map[string]string{"State": "Enabled", "Health": "OK"},
+		"Boot": map[string]any{
+			"BootSourceOverrideTarget":                          sys.Boot.Target,
+			"BootSourceOverrideTarget@Redfish.AllowableValues":  BootTargets,
+			"BootSourceOverrideEnabled":                         sys.Boot.Enabled,
+			"BootSourceOverrideEnabled@Redfish.AllowableValues": BootEnabled,
+			"BootSourceOverrideMode":                            "UEFI",
+		},
+		"ProcessorSummary":   map[string]int{"Count": sys.CPUs},
+		"MemorySummary":      map[string]float64{"TotalSystemMemoryGiB": float64(sys.MemoryMB) / 1024},
+		"EthernetInterfaces": odataID(base + "/EthernetInterfaces"),
+		"Links": map[string]any{
+			"ManagedBy": []any{odataID("/redfish/v1/Managers/" + sys.ID)},
+		},
+		"Actions": map[string]any{
+			"#ComputerSystem.Reset": map[string]any{
+				"target":                            base + "/Actions/ComputerSystem.Reset",
+				"ResetType@Redfish.AllowableValues": ResetTypes,
+			},
+		},
+	})
+}
+
+func (s *server) patchSystem(w http.ResponseWriter, r *http.Request) {
+	sys, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Boot *struct {
+			BootSourceOverrideTarget  string
+			BootSourceOverrideEnabled string
+			BootSourceOverrideMode    string
+		}
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.Boot == nil {
+		writeError(w, http.StatusBadRequest, "Base.1.0.PropertyNotWritable", "Only the Boot property can be modified")
+		return
+	}
+
+	boot := sys.Boot
+	if req.Boot.BootSourceOverrideTarget != "" {
+		boot.Target = req.Boot.BootSourceOverrideTarget
+		// Setting a target without a mode means "next boot only".
+		if req.Boot.BootSourceOverrideEnabled == "" && boot.Enabled == "Disabled" {
+			boot.Enabled = "Once"
+		}
+	}
+	if req.Boot.BootSourceOverrideEnabled != "" {
+		boot.Enabled = req.Boot.BootSourceOverrideEnabled
+	}
+	if !slices.Contains(BootTargets, boot.Target) {
+		writeError(w, http.StatusBadRequest, "Base.1.0.PropertyValueNotInList", fmt.Sprintf("Unsupported BootSourceOverrideTarget '%s'", boot.Target))
+		return
+	}
+	if !slices.Contains(BootEnabled, boot.Enabled) {
+		writeError(w, http.StatusBadRequest, "Base.1.0.PropertyValueNotInList", fmt.Sprintf("Unsupported BootSourceOverrideEnabled '%s'", boot.Enabled))
+		return
+	}
+	if mode := req.Boot.BootSourceOverrideMode; mode != "" && mode != "UEFI" {
+		writeError(w, http.StatusBadRequest, "Base.1.0.PropertyValueNotInList", fmt.Sprintf("Unsupported BootSourceOverrideMode '%s', systems only boot in UEFI mode", mode))
+		return
+	}
+	if err := s.backend.SetBoot(sys.ID, boot); err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) reset(w http.ResponseWriter, r *http.Request) {
+	sys, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		ResetType string
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.ResetType == "" {
+		req.ResetType = "On"
+	}
+	if !slices.Contains(ResetTypes, req.ResetType) {
+		writeError(w, http.StatusBadRequest, "Base.1.0.ActionParameterNotSupported", fmt.Sprintf("Unsupported ResetType '%s'", req.ResetType))
+		return
+	}
+	if err := s.backend.Reset(sys.ID, req.ResetType); err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) ethernetInterfaces(w http.ResponseWriter, r *http.Request) {
+	sys, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	var ids []string
+	if sys.MAC != "" {
+		ids = append(ids, "nic0")
+	}
+	writeCollection(w, "#EthernetInterfaceCollection.EthernetInterfaceCollection", "/redfish/v1/Systems/"+sys.ID+"/EthernetInterfaces", "Ethernet Interface Collection", ids)
+}
+
+func (s *server) ethernetInterface(w http.ResponseWriter, r *http.Request) {
+	sys, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	if r.PathValue("nic") != "nic0" || sys.MAC == "" {
+		writeError(w, http.StatusNotFound, "Base.1.0.ResourceMissingAtURI", fmt.Sprintf("The resource at %s was not found", r.URL.Path))
+		return
+	}
+	writeJSON(w, map[string]any{
+		"@odata.type": "#EthernetInterface.v1_4_0.EthernetInterface",
+		"@odata.id":   r.URL.Path,
+		"Id":          "nic0",
+		"Name":        "Private network interface",
+		"MACAddress":  sys.MAC,
+		"Status":      map[string]string{"State": "Enabled", "Health": "OK"},
+	})
+}
+
+func (s *server) managers(w http.ResponseWriter, r *http.Request) {
+	ids, err := s.backend.Systems()
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	writeCollection(w, "#ManagerCollection.ManagerCollection", "/redfish/v1/Managers", "Manager Collection", ids)
+}
+
+func (s *server) manager(w http.ResponseWriter, r *http.Request) {
+	sys, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	base := "/redfish/v1/Managers/" + sys.ID
+	writeJSON(w, map[string]any{
+		"@odata.type":  "#Manager.v1_5_0.Manager",
+		"@odata.id":    base,
+		"Id":           sys.ID,
+		"Name":         "BMC of " + sys.ID,
+		"ManagerType":  "BMC",
+		"Status":       map[string]string{"State": "Enabled", "Health": "OK"},
+		"VirtualMedia": odataID(base + "/VirtualMedia"),
+		"Links": map[string]any{
+			"ManagerForServers": []any{odataID("/redfish/v1/Systems/" + sys.ID)},
+		},
+	})
+}
+
+func (s *server) virtualMediaCollection(w http.ResponseWriter, r *http.Request) {
+	sys, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	writeCollection(w, "#VirtualMediaCollection.VirtualMediaCollection", "/redfish/v1/Managers/"+sys.ID+"/VirtualMedia", "Virtual Media Collection", []string{"Cd"})
+}
+
+func (s *server) virtualMedia(w http.ResponseWriter, r *http.Request) {
+	sys, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	base := "/redfish/v1/Managers/" + sys.ID + "/VirtualMedia/Cd"
+	connectedVia := "NotConnected"
+	if sys.Media.Inserted {
+		connectedVia = "URI"
+	}
+	writeJSON(w, map[string]any{
+		"@odata.type":    "#VirtualMedia.v1_3_0.VirtualMedia",
+		"@odata.id":      base,
+		"Id":             "Cd",
+		"Name":           "Virtual CD",
+		"MediaTypes":     []string{"CD", "DVD"},
+		"Image":          sys.Media.Image,
+		"Inserted":       sys.Media.Inserted,
+		"WriteProtected": true,
+		"ConnectedVia":   connectedVia,
+		"Actions": map[string]any{
+			"#VirtualMedia.InsertMedia": map[string]string{"target": base + "/Actions/VirtualMedia.InsertMedia"},
+			"#VirtualMedia.EjectMedia":  map[string]string{"target": base + "/Actions/VirtualMedia.EjectMedia"},
+		},
+	})
+}
+
+func (s *server) insertMedia(w http.ResponseWriter, r *http.Request) {
+	sys, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Image string
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.Image == "" {
+		writeError(w, http.StatusBadRequest, "Base.1.0.ActionParameterMissing", "The Image parameter is required")
+		return
+	}
+	if err := s.backend.InsertMedia(sys.ID, req.Image); err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) ejectMedia(w http.ResponseWriter, r *http.Request) {
+	sys, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	if err := s.backend.EjectMedia(sys.ID); err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lookup returns the system named by the request's id path value, writing an
+// error response if it can't be loaded.
+func (s *server) lookup(w http.ResponseWriter, r *http.Request) (*System, bool) {
+	sys, err := s.backend.System(r.PathValue("id"))
+	if err != nil {
+		writeBackendError(w, err)
+		return nil, false
+	}
+	return sys, true
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	// Some clients send actions without a body.
+	if r.ContentLength == 0 {
+		return true
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "Base.1.0.MalformedJSON", fmt.Sprintf("Invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("OData-Version", "4.0")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeCollection(w http.ResponseWriter, odataType, path, name string, ids []string) {
+	members := make([]any, 0, len(ids))
+	for _, id := range ids {
+		members = append(members, odataID(path+"/"+id))
+	}
+	writeJSON(w, map[string]any{
+		"@odata.type":         odataType,
+		"@odata.id":           path,
+		"Name":                name,
+		"Members@odata.count": len(members),
+		"Members":             members,
+	})
+}
+
+func writeBackendError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, http.StatusNotFound, "Base.1.0.ResourceMissingAtURI", err.Error())
+		return
+	}
+	if errors.Is(err, ErrInvalidImage) {
+		writeError(w, http.StatusBadRequest, "Base.1.0.ActionParameterValueFormatError", err.Error())
+		return
+	}
+	writeError(w, http.StatusInternalServerError, "Base.1.0.GeneralError", err.Error())
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{
+			"code":    code,
+			"message": message,
+			"@Message.ExtendedInfo": []any{
+				map[string]string{"MessageId": code, "Message": message},
+			},
+		},
+	})
+}
+
+func odataID(path string) map[string]string {
+	return map[string]string{"@odata.id": path}
+}
+
+// uuid derives a stable, RFC 4122 formatted UUID from a name.
+func uuid(name string) string {
+	sum := sha1.Sum([]byte(name))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
@@ -0,0 +1,286 @@
+package redfish
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fakeBackend struct {
+	systems map[string]*System
+	calls   []string
+	err     error
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{systems: map[string]*System{
+		"target1": {
+			ID:         "target1",
+			PowerState: PowerOff,
+			MAC:        "52:54:00:12:34:56",
+			CPUs:       2,
+			MemoryMB:   2048,
+			Boot:       Boot{Target: "None", Enabled: "Disabled"},
+		},
+	}}
+}
+
+func (b *fakeBackend) Systems() ([]string, error) {
+	return []string{"target1"}, nil
+}
+
+func (b *fakeBackend) System(id string) (*System, error) {
+	sys, ok := b.systems[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return sys, nil
+}
+
+func (b *fakeBackend) Reset(id, resetType string) error {
+	b.calls = append(b.calls, "reset "+id+" "+resetType)
+	return b.err
+}
+
+func (b *fakeBackend) SetBoot(id string, boot Boot) error {
+	b.calls = append(b.calls, fmt.Sprintf("boot %s %s %s", id, boot.Target, boot.Enabled))
+	return b.err
+}
+
+func (b *fakeBackend) InsertMedia(id, image string) error {
+	b.calls = append(b.calls, "insert "+id+" "+image)
+	return b.err
+}
+
+func (b *fakeBackend) EjectMedia(id string) error {
+	b.calls = append(b.calls, "eject "+id)
+	return b.err
+}
+
+func do(t *testing.T, h http.Handler, method, path, body string) (*http.Response, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body == "" {
+		req.ContentLength = 0
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	resp := rec.Result()
+	data, _ := io.ReadAll(resp.Body)
+	var doc map[string]any
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("invalid JSON response %q: %v", data, err)
+		}
+	}
+	return resp, doc
+}
+
+func TestGetResources(t *testing.T) {
+	h := NewHandler(newFakeBackend(), "", "")
+
+	_, root := do(t, h, "GET", "/redfish/v1/", "")
+	if root["Systems"].(map[string]any)["@odata.id"] != "/redfish/v1/Systems" {
+		t.Errorf("unexpected service root: %v", root)
+	}
+
+	_, systems := do(t, h, "GET", "/redfish/v1/Systems", "")
+	members := systems["Members"].([]any)
+	if len(members) != 1 || members[0].(map[string]any)["@odata.id"] != "/redfish/v1/Systems/target1" {
+		t.Errorf("unexpected systems collection: %v", systems)
+	}
+
+	_, sys := do(t, h, "GET", "/redfish/v1/Systems/target1", "")
+	if sys["PowerState"] != "Off" || sys["Id"] != "target1" {
+		t.Errorf("unexpected system: %v", sys)
+	}
+	if target := sys["Boot"].(map[string]any)["BootSourceOverrideTarget"]; target != "None" {
+		t.Errorf("expected boot target None, got %v", target)
+	}
+
+	_, nic := do(t, h, "GET", "/redfish/v1/Systems/target1/EthernetInterfaces/nic0", "")
+	if nic["MACAddress"] != "52:54:00:12:34:56" {
+		t.Errorf("unexpected ethernet interface: %v", nic)
+	}
+
+	_, media := do(t, h, "GET", "/redfish/v1/Managers/target1/VirtualMedia/Cd", "")
+	if media["Inserted"] != false || media["ConnectedVia"] != "NotConnected" {
+		t.Errorf("unexpected virtual media: %v", media)
+	}
+
+	resp, errDoc := do(t, h, "GET", "/redfish/v1/Systems/missing", "")
+	if resp.StatusCode != http.StatusNotFound || errDoc["error"] == nil {
+		t.Errorf("expected 404 with an error document, got %d: %v", resp.StatusCode, errDoc)
+	}
+}
+
+func TestActions(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		backendErr     error
+		expectedStatus int
+		expectedCalls  []string
+	}{
+		{
+			name:           "power on",
+			method:         "POST",
+			path:           "/redfish/v1/Systems/target1/Actions/ComputerSystem.Reset",
+			body:           `{"ResetType": "On"}`,
+			expectedStatus: http.StatusNoContent,
+			expectedCalls:  []string{"reset target1 On"},
+		},
+		{
+			name:           "unsupported reset type",
+			method:         "POST",
+			path:           "/redfish/v1/Systems/target1/Actions/ComputerSystem.Reset",
+			body:           `{"ResetType": "Suspend"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "backend error",
+			method:         "POST",
+			path:           "/redfish/v1/Systems/target1/Actions/ComputerSystem.Reset",
+			body:           `{"ResetType": "ForceOff"}`,
+			backendErr:     fmt.Errorf("qemu exploded"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"reset target1 ForceOff"},
+		},
+		{
+			name:           "boot override defaults to once",
+			method:         "PATCH",
+			path:           "/redfish/v1/Systems/target1",
+			body:           `{"Boot": {"BootSourceOverrideTarget": "Pxe"}}`,
+			expectedStatus: http.StatusNoContent,
+			expectedCalls:  []string{"boot target1 Pxe Once"},
+		},
+		{
+			name:           "continuous boot override",
+			method:         "PATCH",
+			path:           "/redfish/v1/Systems/target1",
+			body:           `{"Boot": {"BootSourceOverrideTarget": "Cd", "BootSourceOverrideEnabled": "Continuous"}}`,
+			expectedStatus: http.StatusNoContent,
+			expectedCalls:  []string{"boot target1 Cd Continuous"},
+		},
+		{
+			name:           "unsupported boot target",
+			method:         "PATCH",
+			path:           "/redfish/v1/Systems/target1",
+			body:           `{"Boot": {"BootSourceOverrideTarget": "Floppy"}}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "legacy boot mode",
+			method:         "PATCH",
+			path:           "/redfish/v1/Systems/target1",
+			body:           `{"Boot": {"BootSourceOverrideTarget": "Pxe", "BootSourceOverrideMode": "Legacy"}}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "insert media",
+			method:         "POST",
+			path:           "/redfish/v1/Managers/target1/VirtualMedia/Cd/Actions/VirtualMedia.InsertMedia",
+			body:           `{"Image": "http://example.com/boot.iso", "Inserted": true}`,
+			expectedStatus: http.StatusNoContent,
+			expectedCalls:  []string{"insert target1 http://example.com/boot.iso"},
+		},
+		{
+			name:           "insert invalid media",
+			method:         "POST",
+			path:           "/redfish/v1/Managers/target1/VirtualMedia/Cd/Actions/VirtualMedia.InsertMedia",
+			body:           `{"Image": "file:///etc/passwd"}`,
+			backendErr:     fmt.Errorf("%w 'file:///etc/passwd'", ErrInvalidImage),
+			expectedStatus: http.StatusBadRequest,
+			expectedCalls:  []string{"insert target1 file:///etc/passwd"},
+		},
+		{
+			name:           "insert media without image",
+			method:         "POST",
+			path:           "/redfish/v1/Managers/target1/VirtualMedia/Cd/Actions/VirtualMedia.InsertMedia",
+			body:           `{}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "eject media without body",
+			method:         "POST",
+			path:           "/redfish/v1/Managers/target1/VirtualMedia/Cd/Actions/VirtualMedia.EjectMedia",
+			expectedStatus: http.StatusNoContent,
+			expectedCalls:  []string{"eject target1"},
+		},
+		{
+			name:           "unknown system",
+			method:         "POST",
+			path:           "/redfish/v1/Systems/missing/Actions/ComputerSystem.Reset",
+			body:           `{"ResetType": "On"}`,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "malformed body",
+			method:         "POST",
+			path:           "/redfish/v1/Systems/target1/Actions/ComputerSystem.Reset",
+			body:           `{`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newFakeBackend()
+			backend.err = tt.backendErr
+			resp, _ := do(t, NewHandler(backend, "", ""), tt.method, tt.path, tt.body)
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if !reflect.DeepEqual(backend.calls, tt.expectedCalls) {
+				t.Errorf("expected calls %v, got %v", tt.expectedCalls, backend.calls)
+			}
+		})
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	h := NewHandler(newFakeBackend(), "admin", "secret")
+
+	// The service root is readable without credentials.
+	if resp, _ := do(t, h, "GET", "/redfish/v1/", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected service root to be public, got %d", resp.StatusCode)
+	}
+
+	resp, _ := do(t, h, "GET", "/redfish/v1/Systems", "")
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Errorf("expected 401 with a challenge, got %d", resp.StatusCode)
+	}
+
+	for _, creds := range []struct {
+		user, pass string
+		status     int
+	}{
+		{"admin", "wrong", http.StatusUnauthorized},
+		{"admin", "secret", http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", "/redfish/v1/Systems", nil)
+		req.SetBasicAuth(creds.user, creds.pass)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != creds.status {
+			t.Errorf("credentials %s:%s: expected status %d, got %d", creds.user, creds.pass, creds.status, rec.Code)
+		}
+	}
+}
+
+func TestUUID(t *testing.T) {
+	u := uuid("target1")
+	if u != uuid("target1") || u == uuid("target2") {
+		t.Error("expected a stable UUID per name")
+	}
+	if len(u) != 36 || u[14] != '5' {
+		t.Errorf("expected a version 5 UUID, got %s", u)
+	}
+}
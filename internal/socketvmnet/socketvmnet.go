@@ -9,25 +9,76 @@ import (
 )
 
 const (
-	// ServiceName is the name of the socket_vmnet service.
+	// ServiceName is the name of the socket_vmnet service of the default lab.
 	ServiceName = "io.github.pallotron.pvmlab.socket_vmnet"
+	// defaultLab is the name of the lab using the unsuffixed service, socket
+	// and log directory, as they were named before labs existed.
+	defaultLab = "default"
 )
 
-// GetSocketPath returns the path to the socket_vmnet socket.
-func GetSocketPath() (string, error) {
+// labSuffix returns the suffix of the service, socket and log directory names
+// of a lab. Each lab runs its own socket_vmnet service, so that labs don't
+// share a network.
+func labSuffix(lab string) string {
+	if lab == "" || lab == defaultLab {
+		return ""
+	}
+	return "." + lab
+}
+
+// GetServiceName returns the name of the socket_vmnet service of a lab.
+func GetServiceName(lab string) string {
+	return ServiceName + labSuffix(lab)
+}
+
+// GetPlistPath returns the path to the launchd plist of a lab's service.
+func GetPlistPath(lab string) string {
+	return fmt.Sprintf("/Library/LaunchDaemons/%s.plist", GetServiceName(lab))
+}
+
+// GetLogDir returns the directory the socket_vmnet service of a lab logs to.
+func GetLogDir(lab string) string {
+	return "/var/log/vmlab.socket_vmnet" + labSuffix(lab)
+}
+
+// GetSocketPath returns the path to the socket_vmnet socket of a lab.
+func GetSocketPath(lab string) (string, error) {
 	// Check for an override via environment variable, useful for testing.
 	if socketPath := os.Getenv("PVMLAB_SOCKET_VMNET_PATH"); socketPath != "" {
 		return socketPath, nil
 	}
 
-	return "/var/run/vmlab.socket_vmnet", nil
+	return "/var/run/vmlab.socket_vmnet" + labSuffix(lab), nil
 }
 
 var execCommand = exec.Command
 
-// IsSocketVmnetRunning checks if the socket_vmnet service is running.
-var IsSocketVmnetRunning = func() (bool, error) {
-	cmd := execCommand("sudo", "launchctl", "list", ServiceName)
+// GetClientPath returns the path to the socket_vmnet_client binary.
+func GetClientPath() (string, error) {
+	// if PVMLAB_SOCKET_VMNET_CLIENT is set use that client
+	if path := os.Getenv("PVMLAB_SOCKET_VMNET_CLIENT"); path != "" {
+		return path, nil
+	}
+
+	paths := []string{
+		"/opt/homebrew/opt/socket_vmnet/bin/socket_vmnet_client",
+	}
+	for _, p := range paths {
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	cmd := exec.Command("which", "socket_vmnet_client")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("socket_vmnet_client not found in standard paths or via 'which'. Please install it")
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// IsSocketVmnetRunning checks if the socket_vmnet service of a lab is running.
+var IsSocketVmnetRunning = func(lab string) (bool, error) {
+	cmd := execCommand("sudo", "launchctl", "list", GetServiceName(lab))
 	var out bytes.Buffer
 	cmd.Stdout = &out
 	err := cmd.Run()
@@ -37,16 +88,16 @@ var IsSocketVmnetRunning = func() (bool, error) {
 		if _, ok := err.(*exec.ExitError); ok {
 			return false, nil
 		}
-		return false, fmt.Errorf("error checking %s service status: %w", ServiceName, err)
+		return false, fmt.Errorf("error checking %s service status: %w", GetServiceName(lab), err)
 	}
 
 	// If the service is running, the output will contain a PID.
 	return strings.Contains(out.String(), "PID"), nil
 }
 
-var StartSocketVmnet = func() error {
+var StartSocketVmnet = func(lab string) error {
 	// Ensure the log directory and files exist.
-	if err := execCommand("sudo", "mkdir", "-p", "/var/log/vmlab.socket_vmnet").Run(); err != nil {
+	if err := execCommand("sudo", "mkdir", "-p", GetLogDir(lab)).Run(); err != nil {
 		return fmt.Errorf("failed to create log directory: %w", err)
 	}
 	// Ensure the state directory exists.
@@ -54,25 +105,23 @@ var StartSocketVmnet = func() error {
 		return fmt.Errorf("failed to create state directory: %w", err)
 	}
 
-	plistPath := fmt.Sprintf("/Library/LaunchDaemons/%s.plist", ServiceName)
-	cmd := execCommand("sudo", "launchctl", "load", "-w", plistPath)
+	cmd := execCommand("sudo", "launchctl", "load", "-w", GetPlistPath(lab))
 	return cmd.Run()
 }
 
-var StopSocketVmnet = func() error {
-	plistPath := fmt.Sprintf("/Library/LaunchDaemons/%s.plist", ServiceName)
-	cmd := execCommand("sudo", "launchctl", "unload", "-w", plistPath)
+var StopSocketVmnet = func(lab string) error {
+	cmd := execCommand("sudo", "launchctl", "unload", "-w", GetPlistPath(lab))
 	return cmd.Run()
 }
 
-// CheckSocketVmnet checks if the socket_vmnet service is running and warns the user if it is not.
-func CheckSocketVmnet() error {
-	running, err := IsSocketVmnetRunning()
+// CheckSocketVmnet checks if the socket_vmnet service of a lab is running and warns the user if it is not.
+func CheckSocketVmnet(lab string) error {
+	running, err := IsSocketVmnetRunning(lab)
 	if err != nil {
 		return err
 	}
 	if !running {
-		return fmt.Errorf("%s service is not running", ServiceName)
+		return fmt.Errorf("%s service is not running", GetServiceName(lab))
 	}
 	return nil
 }
@@ -84,7 +84,7 @@ func TestIsSocketVmnetRunning(t *testing.T) {
 		os.Setenv("LAUNCHCTL_LIST_OUTPUT", `{"PID": 123}`)
 		defer os.Unsetenv("LAUNCHCTL_LIST_OUTPUT")
 
-		running, err := IsSocketVmnetRunning()
+		running, err := IsSocketVmnetRunning("default")
 		if err != nil {
 			t.Fatalf("IsSocketVmnetRunning() returned an error: %v", err)
 		}
@@ -97,7 +97,7 @@ func TestIsSocketVmnetRunning(t *testing.T) {
 		os.Setenv("LAUNCHCTL_LIST_OUTPUT", "")
 		defer os.Unsetenv("LAUNCHCTL_LIST_OUTPUT")
 
-		running, err := IsSocketVmnetRunning()
+		running, err := IsSocketVmnetRunning("default")
 		if err != nil {
 			t.Fatalf("IsSocketVmnetRunning() returned an error: %v", err)
 		}
@@ -116,7 +116,7 @@ func TestStartSocketVmnet(t *testing.T) {
 
 	t.Run("start succeeds", func(t *testing.T) {
 		os.Unsetenv("LAUNCHCTL_LOAD_FAIL")
-		err := StartSocketVmnet()
+		err := StartSocketVmnet("default")
 		if err != nil {
 			t.Fatalf("StartSocketVmnet() returned an error: %v", err)
 		}
@@ -125,7 +125,7 @@ func TestStartSocketVmnet(t *testing.T) {
 	t.Run("start fails", func(t *testing.T) {
 		os.Setenv("LAUNCHCTL_LOAD_FAIL", "1")
 		defer os.Unsetenv("LAUNCHCTL_LOAD_FAIL")
-		err := StartSocketVmnet()
+		err := StartSocketVmnet("default")
 		if err == nil {
 			t.Fatal("StartSocketVmnet() did not return an error")
 		}
@@ -141,7 +141,7 @@ func TestStopSocketVmnet(t *testing.T) {
 
 	t.Run("stop succeeds", func(t *testing.T) {
 		os.Unsetenv("LAUNCHCTL_UNLOAD_FAIL")
-		err := StopSocketVmnet()
+		err := StopSocketVmnet("default")
 		if err != nil {
 			t.Fatalf("StopSocketVmnet() returned an error: %v", err)
 		}
@@ -150,9 +150,84 @@ func TestStopSocketVmnet(t *testing.T) {
 	t.Run("stop fails", func(t *testing.T) {
 		os.Setenv("LAUNCHCTL_UNLOAD_FAIL", "1")
 		defer os.Unsetenv("LAUNCHCTL_UNLOAD_FAIL")
-		err := StopSocketVmnet()
+		err := StopSocketVmnet("default")
 		if err == nil {
 			t.Fatal("StopSocketVmnet() did not return an error")
 		}
 	})
-}
\ No newline at end of file
+}
+
+func TestGetClientPath(t *testing.T) {
+	// Save original env var
+	originalEnv := os.Getenv("PVMLAB_SOCKET_VMNET_CLIENT")
+	defer func() {
+		if originalEnv != "" {
+			os.Setenv("PVMLAB_SOCKET_VMNET_CLIENT", originalEnv)
+		} else {
+			os.Unsetenv("PVMLAB_SOCKET_VMNET_CLIENT")
+		}
+	}()
+
+	tests := []struct {
+		name    string
+		envVar  string
+		wantErr bool
+	}{
+		{
+			name:    "env var set",
+			envVar:  "/custom/path/socket_vmnet_client",
+			wantErr: false,
+		},
+		{
+			name:    "env var not set - will search paths",
+			envVar:  "",
+			wantErr: false, // May succeed or fail depending on system
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.envVar != "" {
+				os.Setenv("PVMLAB_SOCKET_VMNET_CLIENT", tt.envVar)
+			} else {
+				os.Unsetenv("PVMLAB_SOCKET_VMNET_CLIENT")
+			}
+
+			result, err := GetClientPath()
+
+			if tt.envVar != "" {
+				// When env var is set, it should always succeed and return that path
+				if err != nil {
+					t.Errorf("GetClientPath() unexpected error when env var set: %v", err)
+				}
+				if result != tt.envVar {
+					t.Errorf("GetClientPath() = %q, want %q", result, tt.envVar)
+				}
+			} else {
+				// When env var is not set, it searches system paths
+				// We don't enforce success/failure as it depends on the system
+				t.Logf("GetClientPath() result: %q, err: %v", result, err)
+			}
+		})
+	}
+}
+
+func TestLabNames(t *testing.T) {
+	t.Setenv("PVMLAB_SOCKET_VMNET_PATH", "")
+
+	for lab, want := range map[string]string{
+		"default": "/var/run/vmlab.socket_vmnet",
+		"fedora":  "/var/run/vmlab.socket_vmnet.fedora",
+	} {
+		socketPath, err := GetSocketPath(lab)
+		if err != nil || socketPath != want {
+			t.Errorf("GetSocketPath(%s) = %s, %v, want %s", lab, socketPath, err, want)
+		}
+	}
+	if got := GetServiceName("default"); got != ServiceName {
+		t.Errorf("GetServiceName(default) = %s, want %s", got, ServiceName)
+	}
+	if got := GetPlistPath("fedora"); got != "/Library/LaunchDaemons/"+ServiceName+".fedora.plist" {
+		t.Errorf("unexpected plist path: %s", got)
+	}
+}
@@ -0,0 +1,135 @@
+package topology
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Provisioner describes the provisioner VM of a lab.
+type Provisioner struct {
+	Name                  string `yaml:"name"`
+	Arch                  string `yaml:"arch,omitempty"`
+	IP                    string `yaml:"ip"`
+	IPv6                  string `yaml:"ipv6,omitempty"`
+	MAC                   string `yaml:"mac,omitempty"`
+	DiskSize              string `yaml:"disk_size,omitempty"`
+	DockerPxebootStackTar string `yaml:"docker_pxeboot_stack_tar,omitempty"`
+	DockerImagesPath      string `yaml:"docker_images_path,omitempty"`
+	VMsPath               string `yaml:"vms_path,omitempty"`
+}
+
+// Target describes a target VM of a lab.
+type Target struct {
+	Name     string `yaml:"name"`
+	Arch     string `yaml:"arch,omitempty"`
+	Distro   string `yaml:"distro,omitempty"`
+	IP       string `yaml:"ip"`
+	IPv6     string `yaml:"ipv6,omitempty"`
+	MAC      string `yaml:"mac,omitempty"`
+	DiskSize string `yaml:"disk_size,omitempty"`
+	PxeBoot  bool   `yaml:"pxeboot,omitempty"`
+}
+
+// Topology is the declarative description of a lab: one provisioner plus
+// any number of target VMs.
+type Topology struct {
+	Provisioner Provisioner `yaml:"provisioner"`
+	Targets     []Target    `yaml:"targets"`
+}
+
+var (
+	vmNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	macRegex    = regexp.MustCompile(`^([0-9A-Fa-f]{2}[:-]){5}([0-9A-Fa-f]{2})$`)
+)
+
+// Load reads and validates a topology file.
+func Load(path string) (*Topology, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read topology file: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse decodes and validates a topology from its YAML representation.
+func Parse(data []byte) (*Topology, error) {
+	var t Topology
+	if err := yaml.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse topology: %w", err)
+	}
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Validate checks that the topology is self-consistent: names are present
+// and unique, addresses are valid CIDRs and are not assigned twice.
+func (t *Topology) Validate() error {
+	p := t.Provisioner
+	if p.Name == "" {
+		return fmt.Errorf("provisioner: name is required")
+	}
+	if p.IP == "" {
+		return fmt.Errorf("provisioner '%s': ip is required", p.Name)
+	}
+
+	names := map[string]bool{}
+	ips := map[string]string{}
+
+	// Targets can leave the allocation of their addresses to
+	// 'pvmlab vm create' with "auto".
+	check := func(name, arch, ip, ipv6, mac string, allowAuto bool) error {
+		if !vmNameRegex.MatchString(name) {
+			return fmt.Errorf("invalid VM name '%s'", name)
+		}
+		if names[name] {
+			return fmt.Errorf("duplicate VM name '%s'", name)
+		}
+		names[name] = true
+
+		if arch != "" && arch != "aarch64" && arch != "x86_64" {
+			return fmt.Errorf("VM '%s': arch must be either 'aarch64' or 'x86_64'", name)
+		}
+		if mac != "" && !macRegex.MatchString(mac) {
+			return fmt.Errorf("VM '%s': invalid MAC address '%s'", name, mac)
+		}
+		for _, addr := range []string{ip, ipv6} {
+			if addr == "" || (allowAuto && addr == "auto") {
+				continue
+			}
+			parsed, _, err := net.ParseCIDR(addr)
+			if err != nil {
+				return fmt.Errorf("VM '%s': invalid address '%s', expected CIDR notation", name, addr)
+			}
+			if other, ok := ips[parsed.String()]; ok {
+				return fmt.Errorf("VM '%s': address %s is already assigned to '%s'", name, parsed, other)
+			}
+			ips[parsed.String()] = name
+		}
+		return nil
+	}
+
+	if err := check(p.Name, p.Arch, p.IP, p.IPv6, p.MAC, false); err != nil {
+		return err
+	}
+	for _, target := range t.Targets {
+		if target.Name == "" {
+			return fmt.Errorf("target: name is required")
+		}
+		if target.IP == "" {
+			return fmt.Errorf("target '%s': ip is required", target.Name)
+		}
+		if target.PxeBoot && target.Distro == "" {
+			return fmt.Errorf("target '%s': distro is required for pxeboot targets", target.Name)
+		}
+		if err := check(target.Name, target.Arch, target.IP, target.IPv6, target.MAC, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package topology
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const validTopology = `
+provisioner:
+  name: provisioner
+  ip: 192.168.100.1/24
+  ipv6: fd00:cafe:babe::1/64
+targets:
+  - name: client1
+    distro: ubuntu-24.04
+    ip: 192.168.100.2/24
+    ipv6: auto
+  - name: client2
+    arch: x86_64
+    distro: ubuntu-24.04
+    ip: 192.168.100.3/24
+    mac: 52:54:00:12:34:56
+    disk_size: 20G
+    pxeboot: true
+`
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lab.yaml")
+	if err := os.WriteFile(path, []byte(validTopology), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	topo, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if topo.Provisioner.Name != "provisioner" {
+		t.Errorf("expected provisioner name 'provisioner', got '%s'", topo.Provisioner.Name)
+	}
+	if len(topo.Targets) != 2 {
+		t.Fatalf("expected 2 targets, got %d", len(topo.Targets))
+	}
+	want := Target{
+		Name:     "client2",
+		Arch:     "x86_64",
+		Distro:   "ubuntu-24.04",
+		IP:       "192.168.100.3/24",
+		MAC:      "52:54:00:12:34:56",
+		DiskSize: "20G",
+		PxeBoot:  true,
+	}
+	if topo.Targets[1] != want {
+		t.Errorf("unexpected target: got %+v, want %+v", topo.Targets[1], want)
+	}
+}
+
+func TestLoad_MissingFile(t *testing.T) {
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name        string
+		yaml        string
+		expectedErr string
+	}{
+		{
+			name:        "malformed yaml",
+			yaml:        "provisioner: [",
+			expectedErr: "failed to parse topology",
+		},
+		{
+			name:        "missing provisioner",
+			yaml:        "targets: []",
+			expectedErr: "provisioner: name is required",
+		},
+		{
+			name:        "provisioner without ip",
+			yaml:        "provisioner: {name: prov}",
+			expectedErr: "ip is required",
+		},
+		{
+			name: "duplicate names",
+			yaml: `
+provisioner: {name: prov, ip: 192.168.100.1/24}
+targets:
+  - {name: prov, ip: 192.168.100.2/24}`,
+			expectedErr: "duplicate VM name 'prov'",
+		},
+		{
+			name: "duplicate ip",
+			yaml: `
+provisioner: {name: prov, ip: 192.168.100.1/24}
+targets:
+  - {name: vm1, ip: 192.168.100.1/24}`,
+			expectedErr: "already assigned to 'prov'",
+		},
+		{
+			name: "invalid cidr",
+			yaml: `
+provisioner: {name: prov, ip: 192.168.100.1/24}
+targets:
+  - {name: vm1, ip: 192.168.100.2}`,
+			expectedErr: "expected CIDR notation",
+		},
+		{
+			name:        "provisioner with an allocated ip",
+			yaml:        "provisioner: {name: prov, ip: auto}",
+			expectedErr: "expected CIDR notation",
+		},
+		{
+			name: "invalid arch",
+			yaml: `
+provisioner: {name: prov, ip: 192.168.100.1/24, arch: riscv64}`,
+			expectedErr: "arch must be either",
+		},
+		{
+			name: "invalid mac",
+			yaml: `
+provisioner: {name: prov, ip: 192.168.100.1/24}
+targets:
+  - {name: vm1, ip: 192.168.100.2/24, mac: nope}`,
+			expectedErr: "invalid MAC address",
+		},
+		{
+			name: "pxeboot without distro",
+			yaml: `
+provisioner: {name: prov, ip: 192.168.100.1/24}
+targets:
+  - {name: vm1, ip: 192.168.100.2/24, pxeboot: true}`,
+			expectedErr: "distro is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml))
+			if err == nil {
+				t.Fatalf("expected error containing '%s', got nil", tt.expectedErr)
+			}
+			if !strings.Contains(err.Error(), tt.expectedErr) {
+				t.Errorf("expected error containing '%s', got '%v'", tt.expectedErr, err)
+			}
+		})
+	}
+}
@@ -43,6 +43,21 @@ var ParseSize = func(sizeStr string) (int64, error) {
 	return value, nil
 }
 
+// FormatSize formats a size in bytes like "1.5G", "512M" or "100B", with
+// the units of ParseSize.
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	value, units := float64(size)/unit, "KMGT"
+	for len(units) > 1 && value >= unit {
+		value /= unit
+		units = units[1:]
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", value), ".0") + units[:1]
+}
+
 // FileExists checks if a file exists and is not a directory.
 func FileExists(path string) bool {
 	info, err := os.Stat(path)
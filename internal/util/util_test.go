@@ -57,6 +57,26 @@ func TestParseSize(t *testing.T) {
 	}
 }
 
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		input    int64
+		expected string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1024, "1K"},
+		{1536, "1.5K"},
+		{512 * 1024 * 1024, "512M"},
+		{3 * 1024 * 1024 * 1024 / 2, "1.5G"},
+		{2048 * 1024 * 1024 * 1024 * 1024, "2048T"},
+	}
+	for _, tt := range tests {
+		if got := FormatSize(tt.input); got != tt.expected {
+			t.Errorf("FormatSize(%d) = %q; want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
 func TestFileExists(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "util-test")
 	if err != nil {
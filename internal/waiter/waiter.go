@@ -5,6 +5,7 @@ import (
 	"io"
 	"net"
 	"os/exec"
+	"pvmlab/internal/installstatus"
 	"strings"
 	"time"
 
@@ -16,6 +17,8 @@ import (
 var (
 	// execCommand is a variable to allow mocking of exec.Command in tests
 	execCommand = exec.Command
+	// installPollInterval is how often ForInstall checks the install status.
+	installPollInterval = 2 * time.Second
 )
 
 // ForPort polls a TCP port until it becomes available or a timeout is reached.
@@ -154,3 +157,47 @@ func ForCloudInitTarget(provisionerPort int, targetIP, sshKeyPath string, timeou
 
 	return pollCloudInit(s, sshArgs, timeout, timeoutMsg)
 }
+
+// ForInstall polls the status reported by the PXE installer of the VM with the
+// given MAC address until the installation succeeds, fails or times out.
+func ForInstall(vmsDir, mac string, timeout time.Duration) error {
+	s := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
+	s.Suffix = " Waiting for the installer to start..."
+	s.Start()
+	defer s.Stop()
+
+	var last *installstatus.Status
+	timeoutChan := time.After(timeout)
+	for {
+		select {
+		case <-timeoutChan:
+			if last == nil {
+				s.FinalMSG = color.RedString("✖ Timed out waiting for the installer to start.\n")
+				return fmt.Errorf("timed out waiting for the installer to start")
+			}
+			s.FinalMSG = color.RedString("✖ Timed out during installation %s.\n", last)
+			return fmt.Errorf("timed out waiting for the installation to complete, last reported %s", last)
+		default:
+			status, err := installstatus.Read(vmsDir, mac)
+			if err != nil {
+				// The boot handler may be writing the file, retry.
+				time.Sleep(installPollInterval)
+				continue
+			}
+			if status != nil {
+				last = status
+				switch status.State {
+				case installstatus.StateSucceeded:
+					s.FinalMSG = color.GreenString("✔ Installation completed successfully.\n")
+					return nil
+				case installstatus.StateFailed:
+					s.FinalMSG = color.RedString("✖ Installation failed in %s.\n", status)
+					return fmt.Errorf("installation failed in %s: %s", status, status.Error)
+				default:
+					s.Suffix = fmt.Sprintf(" Installing: %s...", status)
+				}
+			}
+			time.Sleep(installPollInterval)
+		}
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"pvmlab/internal/installstatus"
 	"strings"
 	"testing"
 	"time"
@@ -145,3 +147,76 @@ func TestForCloudInitTarget(t *testing.T) {
 		t.Errorf("ForCloudInitTarget() returned an error: %v", err)
 	}
 }
+
+func TestForInstall(t *testing.T) {
+	originalInterval := installPollInterval
+	installPollInterval = 10 * time.Millisecond
+	defer func() { installPollInterval = originalInterval }()
+
+	mac := "52:54:00:12:34:56"
+	writeStatus := func(t *testing.T, vmsDir, data string) {
+		t.Helper()
+		path := installstatus.Path(vmsDir, mac)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		statuses      []string
+		expectedError string
+	}{
+		{
+			name: "success",
+			statuses: []string{
+				`{"phase": 4, "total_phases": 7, "phase_name": "Disk Preparation", "state": "running"}`,
+				`{"phase": 7, "total_phases": 7, "phase_name": "Finalization", "state": "succeeded"}`,
+			},
+		},
+		{
+			name: "failure",
+			statuses: []string{
+				`{"phase": 5, "total_phases": 7, "phase_name": "OS Installation", "state": "failed", "error": "tar failed"}`,
+			},
+			expectedError: "installation failed in phase 5/7 (OS Installation): tar failed",
+		},
+		{
+			name: "timeout during installation",
+			statuses: []string{
+				`{"phase": 3, "total_phases": 7, "phase_name": "Fetch Cloud-Init Configuration", "state": "running"}`,
+			},
+			expectedError: "last reported phase 3/7 (Fetch Cloud-Init Configuration)",
+		},
+		{
+			name:          "installer never starts",
+			expectedError: "timed out waiting for the installer to start",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vmsDir := t.TempDir()
+			go func() {
+				for _, status := range tt.statuses {
+					writeStatus(t, vmsDir, status)
+					time.Sleep(50 * time.Millisecond)
+				}
+			}()
+
+			err := ForInstall(vmsDir, mac, 300*time.Millisecond)
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("expected error containing '%s', got '%v'", tt.expectedError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,411 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"pvmlab/internal/config"
+	"pvmlab/internal/downloader"
+	"pvmlab/internal/metadata"
+	"pvmlab/internal/pidfile"
+	"pvmlab/internal/qmp"
+	"pvmlab/internal/redfish"
+	"pvmlab/internal/util"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// bmcCmd represents the bmc command
+var bmcCmd = &cobra.Command{
+	Use:   "bmc",
+	Short: "Virtual BMC for the target VMs",
+	Long: `Out-of-band management of the target VMs, so that provisioning tools that
+talk Redfish or IPMI to real hardware can drive the lab unchanged.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// bmcBackend implements the Redfish and IPMI systems on top of the target VMs.
+type bmcBackend struct {
+	cfg *config.Config
+	// mu serializes operations, since power actions start and stop
+	// processes and update metadata.
+	mu sync.Mutex
+	// boot holds the boot source override of each VM. Overrides only live
+	// as long as the BMC, like on hardware without persistent settings.
+	boot map[string]redfish.Boot
+	// mediaDir is the directory of the local images that can be inserted
+	// as virtual media, if any. Images are otherwise only downloaded from
+	// http(s) URLs, so that API clients can't read other files of the user.
+	mediaDir string
+}
+
+func newBMCBackend(cfg *config.Config, mediaDir string) *bmcBackend {
+	return &bmcBackend{cfg: cfg, boot: map[string]redfish.Boot{}, mediaDir: mediaDir}
+}
+
+func (b *bmcBackend) Systems() ([]string, error) {
+	allMeta, err := metadata.GetAll(b.cfg)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for name, meta := range allMeta {
+		if meta.Role != provisionerRole {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// bmcSystemIDRegex matches the names of VMs. The ids of the systems come
+// from API clients and are used in paths, e.g. "../x" decoded from
+// "..%2Fx" in a Redfish URL.
+var bmcSystemIDRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// checkID returns redfish.ErrNotFound unless id is the name of a target VM.
+func (b *bmcBackend) checkID(id string) error {
+	if !bmcSystemIDRegex.MatchString(id) {
+		return fmt.Errorf("%w: %s", redfish.ErrNotFound, id)
+	}
+	systems, err := b.Systems()
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(systems, id) {
+		return fmt.Errorf("%w: %s", redfish.ErrNotFound, id)
+	}
+	return nil
+}
+
+// load returns the metadata of a target VM.
+func (b *bmcBackend) load(id string) (*metadata.Metadata, error) {
+	if err := b.checkID(id); err != nil {
+		return nil, err
+	}
+	meta, err := metadata.Load(b.cfg, id)
+	if os.IsNotExist(err) || (err == nil && meta.Role == provisionerRole) {
+		return nil, fmt.Errorf("%w: %s", redfish.ErrNotFound, id)
+	}
+	return meta, err
+}
+
+// update applies fn to the metadata of a target VM under the store lock, so
+// that the changes made by the BMC and by concurrent pvmlab commands are not
+// lost.
+func (b *bmcBackend) update(id string, fn func(*metadata.Metadata) error) error {
+	if err := b.checkID(id); err != nil {
+		return err
+	}
+	_, err := metadata.Update(b.cfg, id, fn)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", redfish.ErrNotFound, id)
+	}
+	return err
+}
+
+func (b *bmcBackend) System(id string) (*redfish.System, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	meta, err := b.load(id)
+	if err != nil {
+		return nil, err
+	}
+	running, err := pidfile.IsRunning(b.cfg, id)
+	if err != nil {
+		return nil, err
+	}
+	powerState := redfish.PowerOff
+	if running {
+		switch runStatus(b.cfg.GetAppDir(), id) {
+		case "paused":
+			powerState = redfish.PowerPaused
+		case "shutdown-pending":
+			powerState = redfish.PowerPoweringOff
+		default:
+			powerState = redfish.PowerOn
+		}
+	}
+	cpus, memoryMB := meta.CPUs, meta.MemoryMB
+	if cpus == 0 {
+		cpus = defaultCPUs
+	}
+	if memoryMB == 0 {
+		memoryMB = defaultTargetMemoryMB
+	}
+	return &redfish.System{
+		ID:         id,
+		PowerState: powerState,
+		MAC:        meta.MAC,
+		CPUs:       cpus,
+		MemoryMB:   memoryMB,
+		Boot:       b.bootOverride(id),
+		Media:      redfish.Media{Image: meta.VirtualMedia, Inserted: meta.VirtualMedia != ""},
+	}, nil
+}
+
+func (b *bmcBackend) bootOverride(id string) redfish.Boot {
+	if boot, ok := b.boot[id]; ok {
+		return boot
+	}
+	return redfish.Boot{Target: "None", Enabled: "Disabled"}
+}
+
+func (b *bmcBackend) SetBoot(id string, boot redfish.Boot) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	meta, err := b.load(id)
+	if err != nil {
+		return err
+	}
+	if boot.Target == "Cd" && meta.VirtualMedia == "" {
+		return fmt.Errorf("cannot boot VM '%s' from CD: no virtual media is inserted", id)
+	}
+	b.boot[id] = boot
+	return nil
+}
+
+func (b *bmcBackend) Reset(id, resetType string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := b.load(id); err != nil {
+		return err
+	}
+	running, err := pidfile.IsRunning(b.cfg, id)
+	if err != nil {
+		return err
+	}
+	socketPath := qmpSocketPath(b.cfg.GetAppDir(), id)
+
+	switch resetType {
+	case "On":
+		if running {
+			return nil
+		}
+		return b.powerOn(id)
+	case "ForceOff":
+		if !running {
+			return nil
+		}
+		return b.forceOff(id)
+	case "GracefulShutdown":
+		if !running {
+			return nil
+		}
+		return b.powerdown(id)
+	case "ForceRestart":
+		// Restart the QEMU process rather than resetting the machine, so
+		// that boot override and virtual media changes take effect.
+		if running {
+			if err := b.forceOff(id); err != nil {
+				return err
+			}
+		}
+		return b.powerOn(id)
+	case "PushPowerButton":
+		if running {
+			return b.powerdown(id)
+		}
+		return b.powerOn(id)
+	case "Nmi":
+		if !running {
+			return fmt.Errorf("VM '%s' is powered off", id)
+		}
+		_, err := qmp.Run(socketPath, "inject-nmi", nil, qmpTimeout)
+		return err
+	default:
+		return fmt.Errorf("unsupported reset type '%s'", resetType)
+	}
+}
+
+// powerOn starts the VM, applying its boot source override.
+func (b *bmcBackend) powerOn(id string) error {
+	boot := b.bootOverride(id)
+	var device string
+	if boot.Enabled != "Disabled" {
+		switch boot.Target {
+		case "Pxe":
+			device = "pxe"
+		case "Hdd":
+			device = "disk"
+		case "Cd":
+			device = "cdrom"
+		}
+	}
+	if err := startVMProcess(id, device); err != nil {
+		return err
+	}
+	if boot.Enabled == "Once" {
+		delete(b.boot, id)
+	}
+	return nil
+}
+
+// powerdown asks the guest of the VM to power off, and records the request
+// once QEMU has delivered it.
+func (b *bmcBackend) powerdown(id string) error {
+	appDir := b.cfg.GetAppDir()
+	if err := qmp.RequestPowerdown(qmpSocketPath(appDir, id), qmpTimeout); err != nil {
+		return fmt.Errorf("failed to shut down VM '%s': %w", id, err)
+	}
+	markPowerdown(appDir, id)
+	return nil
+}
+
+// forceOff stops the VM's QEMU process without shutting down the guest.
+func (b *bmcBackend) forceOff(id string) error {
+	if _, err := qmp.Run(qmpSocketPath(b.cfg.GetAppDir(), id), "quit", nil, qmpTimeout); err != nil {
+		return fmt.Errorf("failed to power off VM '%s': %w", id, err)
+	}
+	for i := 0; i < 50; i++ {
+		running, err := pidfile.IsRunning(b.cfg, id)
+		if err != nil {
+			return err
+		}
+		if !running {
+			cleanupFiles(id, b.cfg.GetAppDir())
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("timed out waiting for VM '%s' to power off", id)
+}
+
+func (b *bmcBackend) InsertMedia(id, image string) error {
+	if _, err := b.load(id); err != nil {
+		return err
+	}
+	src, err := b.mediaSource(image)
+	if err != nil {
+		return err
+	}
+
+	// The image is fetched without holding the lock, so that a large
+	// download doesn't block the other requests, e.g. power state polls,
+	// and to a temporary file, since a running VM has the current image
+	// open as its CD.
+	dst := virtualMediaPath(b.cfg.GetAppDir(), id)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*.part")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name()) // No-op once renamed.
+	if err := fetchVirtualMedia(context.Background(), src, tmp.Name()); err != nil {
+		return fmt.Errorf("failed to fetch virtual media: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// Renaming the image into place leaves the previous one to the VM until
+	// it is restarted, like media changed under a running machine.
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return err
+	}
+	return b.update(id, func(meta *metadata.Metadata) error {
+		meta.VirtualMedia = image
+		return nil
+	})
+}
+
+func (b *bmcBackend) EjectMedia(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := b.load(id); err != nil {
+		return err
+	}
+	if err := os.Remove(virtualMediaPath(b.cfg.GetAppDir(), id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if boot := b.bootOverride(id); boot.Target == "Cd" {
+		delete(b.boot, id)
+	}
+	return b.update(id, func(meta *metadata.Metadata) error {
+		meta.VirtualMedia = ""
+		return nil
+	})
+}
+
+// mediaSource returns the http(s) URL of an image to insert as virtual media,
+// or the path of a local image, given by a file:// URL or an absolute path,
+// once its symlinks are resolved. Local images must be in the media
+// directory.
+func (b *bmcBackend) mediaSource(image string) (string, error) {
+	if strings.HasPrefix(image, "http://") || strings.HasPrefix(image, "https://") {
+		return image, nil
+	}
+	src := strings.TrimPrefix(image, "file://")
+	if !filepath.IsAbs(src) {
+		return "", fmt.Errorf("%w '%s': expected an http(s) or file URL", redfish.ErrInvalidImage, image)
+	}
+	if b.mediaDir == "" {
+		return "", fmt.Errorf("%w '%s': local images are only allowed with 'pvmlab bmc serve --media-dir'", redfish.ErrInvalidImage, image)
+	}
+	mediaDir, err := filepath.EvalSymlinks(b.mediaDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the media directory: %w", err)
+	}
+	src, err = filepath.EvalSymlinks(src)
+	if err != nil {
+		return "", fmt.Errorf("%w '%s': %v", redfish.ErrInvalidImage, image, err)
+	}
+	if rel, err := filepath.Rel(mediaDir, src); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w '%s': not in the media directory %s", redfish.ErrInvalidImage, image, b.mediaDir)
+	}
+	return src, nil
+}
+
+// virtualMediaPath returns the path of the ISO image inserted in a VM's
+// virtual CD drive.
+func virtualMediaPath(appDir, vmName string) string {
+	return filepath.Join(appDir, "vms", vmName+"-media.iso")
+}
+
+// startVMProcess starts a VM by running 'pvmlab vm start' in a new process,
+// so the BMC is not affected by the command's global flags. It is a variable
+// to allow mocking in tests.
+var startVMProcess = func(vmName, boot string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	args := []string{"vm", "start", vmName}
+	if boot != "" {
+		args = append(args, "--boot", boot)
+	}
+	if out, err := exec.Command(exe, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to start VM '%s': %w: %s", vmName, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// fetchVirtualMedia downloads an ISO image from an http(s) URL, or copies it
+// from a local path checked by mediaSource. It is a variable to allow mocking
+// in tests.
+var fetchVirtualMedia = func(ctx context.Context, image, dst string) error {
+	if strings.HasPrefix(image, "http://") || strings.HasPrefix(image, "https://") {
+		return downloader.DownloadFile(ctx, dst, image, "", 0, 0)
+	}
+	return util.CopyFile(image, dst, 0644)
+}
+
+func init() {
+	rootCmd.AddCommand(bmcCmd)
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os/signal"
+	"pvmlab/internal/config"
+	"pvmlab/internal/ipmi"
+	"pvmlab/internal/redfish"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var bmcListen, bmcUsername, bmcPassword, bmcTLSCert, bmcTLSKey, bmcMediaDir, bmcIPMIListen string
+
+// bmcServeCmd represents the bmc serve command
+var bmcServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serves a Redfish API, and optionally IPMI, for the target VMs",
+	Long: `Serves a Redfish API exposing every target VM as a system under
+/redfish/v1/Systems/<vm-name>, with:
+
+- power actions (On, ForceOff, GracefulShutdown, ForceRestart, PushPowerButton, Nmi)
+- a boot source override (Pxe, Hdd or Cd, once or continuous)
+- a virtual CD drive under /redfish/v1/Managers/<vm-name>/VirtualMedia/Cd
+
+Boot overrides and virtual media apply the next time the VM is powered on or
+restarted. Virtual media images are downloaded from http(s) URLs; local images
+can only be inserted from the directory given by --media-dir.
+
+With --ipmi-listen, the VMs are also served over IPMI 2.0 (RMCP+, e.g.
+'ipmitool -I lanplus') for chassis power control and boot device selection.
+The IPMI user name selects the VM, and every VM shares the --password.
+
+The server runs in the foreground until interrupted.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if (bmcUsername == "") != (bmcPassword == "") {
+			return fmt.Errorf("the --username and --password flags must be set together")
+		}
+		if (bmcTLSCert == "") != (bmcTLSKey == "") {
+			return fmt.Errorf("the --tls-cert and --tls-key flags must be set together")
+		}
+
+		cfg, err := config.New()
+		if err != nil {
+			return err
+		}
+
+		backend := newBMCBackend(cfg, bmcMediaDir)
+		handler := redfish.NewHandler(backend, bmcUsername, bmcPassword)
+		srv := &http.Server{Addr: bmcListen, Handler: logRequests(handler)}
+
+		var ipmiConn net.PacketConn
+		if bmcIPMIListen != "" {
+			ipmiSrv, err := ipmi.NewServer(backend, bmcPassword)
+			if err != nil {
+				return err
+			}
+			ipmiSrv.Logf = func(format string, args ...any) {
+				color.Cyan("i "+format, args...)
+			}
+			ipmiConn, err = net.ListenPacket("udp", bmcIPMIListen)
+			if err != nil {
+				return fmt.Errorf("failed to listen for IPMI: %w", err)
+			}
+			defer ipmiConn.Close()
+			go func() {
+				if err := ipmiSrv.Serve(ipmiConn); err != nil {
+					color.Red("! IPMI server failed: %v", err)
+				}
+			}()
+			color.Cyan("i Serving IPMI on %s, the user names are the names of the VMs", bmcIPMIListen)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			srv.Shutdown(shutdownCtx)
+			if ipmiConn != nil {
+				ipmiConn.Close()
+			}
+		}()
+
+		scheme := "http"
+		if bmcTLSCert != "" {
+			scheme = "https"
+		}
+		color.Cyan("i Serving Redfish API on %s://%s/redfish/v1", scheme, bmcListen)
+		if bmcUsername == "" {
+			color.Yellow("! No credentials set, the API is not authenticated.")
+		}
+		if bmcIPMIListen != "" && bmcPassword == "" {
+			color.Yellow("! No password set, IPMI sessions only need the name of a VM.")
+		}
+
+		if bmcTLSCert != "" {
+			err = srv.ListenAndServeTLS(bmcTLSCert, bmcTLSKey)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("BMC server failed: %w", err)
+		}
+		color.Green("✔ BMC server stopped.")
+		return nil
+	},
+}
+
+// logRequests logs every request handled by the BMC.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		color.Cyan("i %s %s", r.Method, r.URL.Path)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func init() {
+	bmcCmd.AddCommand(bmcServeCmd)
+	bmcServeCmd.Flags().StringVar(&bmcListen, "listen", "127.0.0.1:8000", "The address to listen on")
+	bmcServeCmd.Flags().StringVar(&bmcUsername, "username", "", "The username required by the API (default: no authentication)")
+	bmcServeCmd.Flags().StringVar(&bmcPassword, "password", "", "The password required by the API")
+	bmcServeCmd.Flags().StringVar(&bmcTLSCert, "tls-cert", "", "The TLS certificate file to serve HTTPS")
+	bmcServeCmd.Flags().StringVar(&bmcTLSKey, "tls-key", "", "The TLS key file to serve HTTPS")
+	bmcServeCmd.Flags().StringVar(&bmcIPMIListen, "ipmi-listen", "", "The UDP address to also serve IPMI on, e.g. 127.0.0.1:6230 (default: IPMI disabled)")
+	bmcServeCmd.Flags().StringVar(&bmcMediaDir, "media-dir", "", "The directory of the local ISO images that can be inserted as virtual media (default: only http(s) URLs)")
+}
@@ -0,0 +1,399 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"pvmlab/internal/config"
+	"pvmlab/internal/metadata"
+	"pvmlab/internal/pidfile"
+	"pvmlab/internal/qmp"
+	"pvmlab/internal/redfish"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockBMCVMs sets up a provisioner and a target VM and records the QMP
+// commands and VM starts made by the BMC.
+func mockBMCVMs(t *testing.T, running *bool) (*bmcBackend, *[]string, map[string]*metadata.Metadata) {
+	t.Helper()
+	setupMocks(t)
+	vms := map[string]*metadata.Metadata{
+		"prov":    {Name: "prov", Role: "provisioner"},
+		"target1": {Name: "target1", Role: "target", MAC: "52:54:00:00:00:01", CPUs: 4},
+	}
+	metadata.GetAll = func(*config.Config) (map[string]*metadata.Metadata, error) {
+		return vms, nil
+	}
+	metadata.Load = func(c *config.Config, name string) (*metadata.Metadata, error) {
+		meta, ok := vms[name]
+		if !ok {
+			return nil, &os.PathError{Op: "open", Path: name + ".json", Err: os.ErrNotExist}
+		}
+		copied := *meta
+		return &copied, nil
+	}
+	metadata.Write = func(c *config.Config, meta *metadata.Metadata) error {
+		vms[meta.Name] = meta
+		return nil
+	}
+	pidfile.IsRunning = func(c *config.Config, name string) (bool, error) {
+		return *running, nil
+	}
+
+	var calls []string
+	qmp.Run = func(socketPath, command string, args any, timeout time.Duration) (json.RawMessage, error) {
+		calls = append(calls, "qmp "+command)
+		if command == "quit" {
+			*running = false
+		}
+		return json.RawMessage("{}"), nil
+	}
+	qmp.RequestPowerdown = func(socketPath string, timeout time.Duration) error {
+		calls = append(calls, "qmp system_powerdown")
+		return nil
+	}
+	startVMProcess = func(vmName, boot string) error {
+		calls = append(calls, strings.TrimSpace("start "+vmName+" "+boot))
+		*running = true
+		return nil
+	}
+
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newBMCBackend(cfg, ""), &calls, vms
+}
+
+func TestBMCBackendSystems(t *testing.T) {
+	running := false
+	b, _, _ := mockBMCVMs(t, &running)
+
+	ids, err := b.Systems()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []string{"target1"}) {
+		t.Errorf("expected only the target VM, got %v", ids)
+	}
+
+	sys, err := b.System("target1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sys.PowerState != redfish.PowerOff || sys.CPUs != 4 || sys.MemoryMB != defaultTargetMemoryMB || sys.MAC != "52:54:00:00:00:01" {
+		t.Errorf("unexpected system: %+v", sys)
+	}
+
+	running = true
+	qmp.QueryStatus = func(socketPath string, timeout time.Duration) (*qmp.Status, error) {
+		return &qmp.Status{Status: "paused"}, nil
+	}
+	if sys, _ := b.System("target1"); sys.PowerState != redfish.PowerPaused {
+		t.Errorf("expected Paused, got %s", sys.PowerState)
+	}
+
+	// The system is powering off from a graceful shutdown until QEMU exits.
+	qmp.QueryStatus = func(socketPath string, timeout time.Duration) (*qmp.Status, error) {
+		return &qmp.Status{Status: "running", Running: true}, nil
+	}
+	pidPath := filepath.Join(b.cfg.GetAppDir(), "pids", "target1.pid")
+	if err := os.MkdirAll(filepath.Dir(pidPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pidPath, []byte("123"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Reset("target1", "GracefulShutdown"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sys, _ := b.System("target1"); sys.PowerState != redfish.PowerPoweringOff {
+		t.Errorf("expected PoweringOff, got %s", sys.PowerState)
+	}
+
+	for _, id := range []string{"prov", "missing"} {
+		if _, err := b.System(id); !errors.Is(err, redfish.ErrNotFound) {
+			t.Errorf("expected ErrNotFound for %s, got %v", id, err)
+		}
+	}
+}
+
+func TestBMCBackend_InvalidID(t *testing.T) {
+	running := false
+	b, calls, vms := mockBMCVMs(t, &running)
+	// A record outside of the vms directory, reachable through ".." in the
+	// id if it wasn't checked.
+	vms["../../x"] = &metadata.Metadata{Name: "../../x", Role: "target"}
+	var loaded []string
+	load := metadata.Load
+	metadata.Load = func(c *config.Config, name string) (*metadata.Metadata, error) {
+		loaded = append(loaded, name)
+		return load(c, name)
+	}
+
+	srv := httptest.NewServer(redfish.NewHandler(b, "", ""))
+	defer srv.Close()
+	requests := []struct{ method, path, body string }{
+		{"GET", "/redfish/v1/Systems/..%2F..%2Fx", ""},
+		{"POST", "/redfish/v1/Systems/..%2F..%2Fx/Actions/ComputerSystem.Reset", `{"ResetType": "On"}`},
+		{"POST", "/redfish/v1/Managers/..%2F..%2Fx/VirtualMedia/Cd/Actions/VirtualMedia.InsertMedia", `{"Image": "http://example.com/x.iso"}`},
+		{"POST", "/redfish/v1/Managers/..%2F..%2Fx/VirtualMedia/Cd/Actions/VirtualMedia.EjectMedia", ""},
+	}
+	for _, r := range requests {
+		req, err := http.NewRequest(r.method, srv.URL+r.path, strings.NewReader(r.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s %s: expected 404, got %d", r.method, r.path, resp.StatusCode)
+		}
+	}
+	if len(loaded) != 0 || len(*calls) != 0 {
+		t.Errorf("expected the id to be rejected before use, got loads %v and calls %v", loaded, *calls)
+	}
+	if err := b.update("../../x", func(*metadata.Metadata) error { return nil }); !errors.Is(err, redfish.ErrNotFound) {
+		t.Errorf("expected ErrNotFound from update, got %v", err)
+	}
+}
+
+func TestBMCBackendReset(t *testing.T) {
+	tests := []struct {
+		name          string
+		running       bool
+		boot          *redfish.Boot
+		resetTypes    []string
+		expectedCalls []string
+		expectedError string
+	}{
+		{
+			name:          "power on",
+			resetTypes:    []string{"On", "On"},
+			expectedCalls: []string{"start target1"},
+		},
+		{
+			name:          "force off",
+			running:       true,
+			resetTypes:    []string{"ForceOff", "ForceOff"},
+			expectedCalls: []string{"qmp quit"},
+		},
+		{
+			name:          "graceful shutdown",
+			running:       true,
+			resetTypes:    []string{"GracefulShutdown"},
+			expectedCalls: []string{"qmp system_powerdown"},
+		},
+		{
+			name:          "force restart applies the boot override once",
+			running:       true,
+			boot:          &redfish.Boot{Target: "Pxe", Enabled: "Once"},
+			resetTypes:    []string{"ForceRestart", "ForceRestart"},
+			expectedCalls: []string{"qmp quit", "start target1 pxe", "qmp quit", "start target1"},
+		},
+		{
+			name:          "continuous boot override",
+			boot:          &redfish.Boot{Target: "Hdd", Enabled: "Continuous"},
+			resetTypes:    []string{"On", "ForceOff", "On"},
+			expectedCalls: []string{"start target1 disk", "qmp quit", "start target1 disk"},
+		},
+		{
+			name:          "push power button",
+			resetTypes:    []string{"PushPowerButton", "PushPowerButton"},
+			expectedCalls: []string{"start target1", "qmp system_powerdown"},
+		},
+		{
+			name:          "nmi",
+			running:       true,
+			resetTypes:    []string{"Nmi"},
+			expectedCalls: []string{"qmp inject-nmi"},
+		},
+		{
+			name:          "nmi while off",
+			resetTypes:    []string{"Nmi"},
+			expectedError: "is powered off",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			running := tt.running
+			b, calls, _ := mockBMCVMs(t, &running)
+			if tt.boot != nil {
+				if err := b.SetBoot("target1", *tt.boot); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			var err error
+			for _, resetType := range tt.resetTypes {
+				if err = b.Reset("target1", resetType); err != nil {
+					break
+				}
+			}
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("expected error to contain '%s', but got '%v'", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(*calls, tt.expectedCalls) {
+				t.Errorf("expected calls %v, got %v", tt.expectedCalls, *calls)
+			}
+		})
+	}
+}
+
+func TestBMCBackendVirtualMedia(t *testing.T) {
+	running := false
+	b, calls, vms := mockBMCVMs(t, &running)
+	mediaPath := virtualMediaPath(b.cfg.GetAppDir(), "target1")
+	if err := os.MkdirAll(filepath.Dir(mediaPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(mediaPath, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The running VM keeps the image it has open.
+	inUse, err := os.Open(mediaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inUse.Close()
+
+	var fetched []string
+	fetchVirtualMedia = func(ctx context.Context, image, dst string) error {
+		fetched = append(fetched, image+" "+dst)
+		// Other requests are served while the image is fetched.
+		done := make(chan error, 1)
+		go func() {
+			_, err := b.System("target1")
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("requests are blocked while the image is fetched")
+		}
+		return os.WriteFile(dst, []byte("new"), 0644)
+	}
+
+	if err := b.SetBoot("target1", redfish.Boot{Target: "Cd", Enabled: "Once"}); err == nil || !strings.Contains(err.Error(), "no virtual media") {
+		t.Errorf("expected CD boot to require media, got %v", err)
+	}
+
+	if err := b.InsertMedia("target1", "http://example.com/boot.iso"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fetched) != 1 || !strings.HasSuffix(fetched[0], ".part") {
+		t.Errorf("expected the image to be fetched to a temporary file, got %v", fetched)
+	}
+	if data, err := os.ReadFile(mediaPath); err != nil || string(data) != "new" {
+		t.Errorf("expected the new image in place, got %q, %v", data, err)
+	}
+	if data, err := io.ReadAll(inUse); err != nil || string(data) != "old" {
+		t.Errorf("expected the image in use to be left unchanged, got %q, %v", data, err)
+	}
+	if vms["target1"].VirtualMedia != "http://example.com/boot.iso" {
+		t.Errorf("expected the image to be saved in the metadata, got '%s'", vms["target1"].VirtualMedia)
+	}
+	sys, _ := b.System("target1")
+	if !sys.Media.Inserted || sys.Media.Image != "http://example.com/boot.iso" {
+		t.Errorf("unexpected media state: %+v", sys.Media)
+	}
+
+	if err := b.SetBoot("target1", redfish.Boot{Target: "Cd", Enabled: "Once"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := b.Reset("target1", "On"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(*calls, []string{"start target1 cdrom"}) {
+		t.Errorf("expected a CD boot, got %v", *calls)
+	}
+
+	if err := b.EjectMedia("target1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if vms["target1"].VirtualMedia != "" {
+		t.Errorf("expected the media to be ejected")
+	}
+}
+
+func TestBMCBackendMediaSource(t *testing.T) {
+	mediaDir := t.TempDir()
+	outside := t.TempDir()
+	for _, path := range []string{filepath.Join(mediaDir, "boot.iso"), filepath.Join(outside, "vm_rsa")} {
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(outside, "vm_rsa"), filepath.Join(mediaDir, "link.iso")); err != nil {
+		t.Fatal(err)
+	}
+	resolvedMediaDir, _ := filepath.EvalSymlinks(mediaDir)
+
+	tests := []struct {
+		name          string
+		mediaDir      string
+		image         string
+		expected      string
+		expectedError string
+	}{
+		{"http url", "", "http://example.com/boot.iso", "http://example.com/boot.iso", ""},
+		{"local image without media dir", "", filepath.Join(mediaDir, "boot.iso"), "", "--media-dir"},
+		{"file url in media dir", mediaDir, "file://" + filepath.Join(mediaDir, "boot.iso"), filepath.Join(resolvedMediaDir, "boot.iso"), ""},
+		{"path outside media dir", mediaDir, filepath.Join(outside, "vm_rsa"), "", "not in the media directory"},
+		{"parent reference", mediaDir, filepath.Join(mediaDir, "..", filepath.Base(outside), "vm_rsa"), "", "not in the media directory"},
+		{"symlink outside media dir", mediaDir, filepath.Join(mediaDir, "link.iso"), "", "not in the media directory"},
+		{"relative path", mediaDir, "boot.iso", "", "expected an http(s) or file URL"},
+		{"ftp url", mediaDir, "ftp://example.com/boot.iso", "", "expected an http(s) or file URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBMCBackend(nil, tt.mediaDir)
+			src, err := b.mediaSource(tt.image)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) || !errors.Is(err, redfish.ErrInvalidImage) {
+					t.Fatalf("expected an invalid image error containing '%s', got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil || src != tt.expected {
+				t.Errorf("expected %s, got %s, %v", tt.expected, src, err)
+			}
+		})
+	}
+}
+
+func TestBMCServeFlags(t *testing.T) {
+	setupMocks(t)
+	defer func() { bmcUsername, bmcPassword, bmcIPMIListen = "", "", "" }()
+
+	_, _, err := executeCommand(rootCmd, "bmc", "serve", "--username", "admin")
+	if err == nil || !strings.Contains(err.Error(), "must be set together") {
+		t.Errorf("expected credentials error, got %v", err)
+	}
+
+	_, _, err = executeCommand(rootCmd, "bmc", "serve", "--username", "admin", "--password", "a-password-longer-than-20", "--ipmi-listen", "127.0.0.1:0")
+	if err == nil || !strings.Contains(err.Error(), "limited to 20 characters") {
+		t.Errorf("expected IPMI password error, got %v", err)
+	}
+}
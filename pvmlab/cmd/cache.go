@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the cache of downloaded and built artifacts",
+	Long: `Manage the content-addressed cache of the artifacts pvmlab downloads or
+builds: the distro and provisioner images, the rootfs tarballs created by
+'distro pull' and the pxeboot stack docker tarball. 'distro pull',
+'vm create' and 'provisioner create' use the cached artifacts when they
+can't reach the network, so a cache exported on one machine can be imported
+on air-gapped machines and CI runners.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+}
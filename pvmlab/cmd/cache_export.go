@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"pvmlab/internal/cache"
+	"pvmlab/internal/config"
+	"pvmlab/internal/errors"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// cacheExportCmd represents the cache export command
+var cacheExportCmd = &cobra.Command{
+	Use:   "export <file>",
+	Short: "Exports the cache to a tarball",
+	Long: `Exports the cached artifacts to a tarball, to import them with
+'pvmlab cache import' on another machine.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := args[0]
+		cfg, err := config.New()
+		if err != nil {
+			return errors.E("cache-export", err)
+		}
+		c := cache.Open(cfg)
+		entries, err := c.List()
+		if err != nil {
+			return errors.E("cache-export", err)
+		}
+		if len(entries) == 0 {
+			return errors.E("cache-export", fmt.Errorf("the cache is empty"))
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			return errors.E("cache-export", err)
+		}
+		if err := c.Export(f); err != nil {
+			f.Close()
+			os.Remove(path)
+			return errors.E("cache-export", err)
+		}
+		if err := f.Close(); err != nil {
+			return errors.E("cache-export", err)
+		}
+		color.Green("✔ Exported %d artifact(s) to %s.", len(entries), path)
+		return nil
+	},
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheExportCmd)
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"os"
+	"pvmlab/internal/cache"
+	"pvmlab/internal/config"
+	"pvmlab/internal/errors"
+	"pvmlab/internal/util"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// cacheImportCmd represents the cache import command
+var cacheImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Imports a tarball exported by 'cache export'",
+	Long: `Imports the artifacts of a tarball exported by 'pvmlab cache export', plain
+or gzip-compressed. Each artifact is verified against its SHA-256 digest.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.New()
+		if err != nil {
+			return errors.E("cache-import", err)
+		}
+		f, err := os.Open(args[0])
+		if err != nil {
+			return errors.E("cache-import", err)
+		}
+		defer f.Close()
+
+		imported, err := cache.Open(cfg).Import(f)
+		if err != nil {
+			return errors.E("cache-import", err)
+		}
+		for _, e := range imported {
+			color.Cyan("i Imported %s %s (%s)", e.Kind, e.Name, util.FormatSize(e.Size))
+		}
+		color.Green("✔ Imported %d artifact(s) from %s.", len(imported), args[0])
+		return nil
+	},
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheImportCmd)
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"os"
+	"pvmlab/internal/cache"
+	"pvmlab/internal/config"
+	"pvmlab/internal/errors"
+	"pvmlab/internal/util"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+// cacheLsCmd represents the cache ls command
+var cacheLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "Lists the cached artifacts",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.New()
+		if err != nil {
+			return errors.E("cache-ls", err)
+		}
+		entries, err := cache.Open(cfg).List()
+		if err != nil {
+			return errors.E("cache-ls", err)
+		}
+
+		if structuredOutput() {
+			return printStructured(cmd.OutOrStdout(), entries)
+		}
+		if len(entries) == 0 {
+			color.Yellow("The cache is empty.")
+			return nil
+		}
+
+		var total int64
+		table := tablewriter.NewWriter(os.Stdout)
+		table.Header([]string{"KIND", "NAME", "SIZE", "SHA256", "ADDED", "SOURCE"})
+		for _, e := range entries {
+			total += e.Size
+			source := e.Key
+			if e.Kind == cache.KindRootfs {
+				source = "image " + shortDigest(e.From)
+			}
+			table.Append([]string{e.Kind, e.Name, util.FormatSize(e.Size), shortDigest(e.SHA256), e.AddedAt.Local().Format(time.DateTime), source})
+		}
+		table.Render()
+		color.Cyan("i %d artifact(s), %s.", len(entries), util.FormatSize(total))
+		return nil
+	},
+}
+
+// shortDigest abbreviates a SHA-256 digest like docker does.
+func shortDigest(digest string) string {
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheLsCmd)
+}
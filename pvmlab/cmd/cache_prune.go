@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"pvmlab/internal/cache"
+	"pvmlab/internal/config"
+	"pvmlab/internal/errors"
+	"pvmlab/internal/metadata"
+	"pvmlab/internal/util"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var cachePruneAll bool
+
+// cachePruneCmd represents the cache prune command
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Removes the cached artifacts that are no longer used",
+	Long: `Removes the cached images whose URL is no longer in distros.yaml or is not
+the provisioner image of this version of pvmlab, and the rootfs tarballs
+created from them, and the previous versions of the images. Use --all to
+remove all the artifacts.
+
+The images the disks of the VMs of all the labs are backed on are kept until
+the VMs are removed, even with --all. The pulled distros keep their images:
+only the cached copies are removed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.New()
+		if err != nil {
+			return errors.E("cache-prune", err)
+		}
+		c := cache.Open(cfg)
+
+		keep := func(cache.Entry) bool { return false }
+		if !cachePruneAll {
+			used := map[string]bool{}
+			for _, distro := range config.Distros {
+				for _, archInfo := range distro.Arch {
+					used[archInfo.Qcow2URL] = true
+				}
+			}
+			for _, arch := range []string{"aarch64", "x86_64"} {
+				url, _ := config.GetProvisionerImageURL(arch)
+				used[url] = true
+			}
+			entries, err := c.List()
+			if err != nil {
+				return errors.E("cache-prune", err)
+			}
+			images := map[string]bool{}
+			for _, e := range entries {
+				if e.Kind == cache.KindImage && used[e.Key] {
+					images[e.SHA256] = true
+				}
+			}
+			keep = func(e cache.Entry) bool {
+				switch e.Kind {
+				case cache.KindImage:
+					return used[e.Key]
+				case cache.KindRootfs:
+					return images[e.From]
+				}
+				return true
+			}
+		}
+
+		inUse := map[string]bool{}
+		if err := forEachVM(cfg, func(_, _ string, meta *metadata.Metadata) {
+			if meta.BaseImage != "" {
+				inUse[meta.BaseImage] = true
+			}
+		}); err != nil {
+			return errors.E("cache-prune", err)
+		}
+
+		removed, err := c.Prune(keep, inUse)
+		if err != nil {
+			return errors.E("cache-prune", err)
+		}
+		if len(removed) == 0 {
+			color.Green("✔ Nothing to prune.")
+			return nil
+		}
+		var total int64
+		for _, e := range removed {
+			total += e.Size
+			color.Cyan("i Removed %s %s (%s)", e.Kind, e.Name, util.FormatSize(e.Size))
+		}
+		color.Green("✔ Removed %d artifact(s), %s, from the cache.", len(removed), util.FormatSize(total))
+		return nil
+	},
+}
+
+func init() {
+	cacheCmd.AddCommand(cachePruneCmd)
+	cachePruneCmd.Flags().BoolVar(&cachePruneAll, "all", false, "Remove all the cached artifacts that no VM is backed on")
+}
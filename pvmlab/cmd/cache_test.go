@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"pvmlab/internal/cache"
+	"pvmlab/internal/config"
+	"strings"
+	"testing"
+)
+
+// seedCache adds an image of distros.yaml, an image that no longer is and
+// the rootfs tarballs created from them to the cache.
+func seedCache(t *testing.T) *cache.Cache {
+	t.Helper()
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := cache.Open(cfg)
+	dir := t.TempDir()
+	for _, url := range []string{"https://example.com/ubuntu-arm.qcow2", "https://example.com/old.qcow2"} {
+		path := filepath.Join(dir, filepath.Base(url))
+		if err := os.WriteFile(path, []byte(url), 0644); err != nil {
+			t.Fatal(err)
+		}
+		image, err := c.Add(cache.Entry{Key: url, Kind: cache.KindImage}, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rootfs := filepath.Join(dir, filepath.Base(url)+".tar.gz")
+		if err := os.WriteFile(rootfs, []byte("rootfs of "+url), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Add(cache.Entry{Key: cache.RootfsKey("ubuntu", image.SHA256), Kind: cache.KindRootfs, From: image.SHA256}, rootfs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+func TestCacheLsCommand(t *testing.T) {
+	setupMocks(t)
+	output, _, err := executeCommand(rootCmd, "cache", "ls")
+	if err != nil || !strings.Contains(output, "The cache is empty.") {
+		t.Errorf("expected an empty cache, got %q, %v", output, err)
+	}
+
+	seedCache(t)
+	output, _, err = executeCommand(rootCmd, "cache", "ls")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	for _, expected := range []string{"https://example.com/old.qcow2", "ubuntu-arm.qcow2", "rootfs", "4 artifact(s)"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected output to contain '%s', got '%s'", expected, output)
+		}
+	}
+}
+
+func TestCachePruneCommand(t *testing.T) {
+	setupMocks(t)
+	defer func() { cachePruneAll = false }()
+	c := seedCache(t)
+
+	output, _, err := executeCommand(rootCmd, "cache", "prune")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if !strings.Contains(output, "Removed 2 artifact(s)") {
+		t.Errorf("expected the old image and its rootfs to be removed, got %q", output)
+	}
+	entries, err := c.List()
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("expected 2 entries left, got %+v, %v", entries, err)
+	}
+	for _, e := range entries {
+		if strings.Contains(e.Key, "old") {
+			t.Errorf("expected %s to be pruned", e.Key)
+		}
+	}
+
+	if _, _, err := executeCommand(rootCmd, "cache", "prune", "--all"); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if entries, err := c.List(); err != nil || len(entries) != 0 {
+		t.Errorf("expected an empty cache, got %+v, %v", entries, err)
+	}
+}
+
+func TestCacheExportImportCommands(t *testing.T) {
+	setupMocks(t)
+	archive := filepath.Join(t.TempDir(), "cache.tar")
+	if _, _, err := executeCommand(rootCmd, "cache", "export", archive); err == nil {
+		t.Error("expected an error exporting an empty cache")
+	}
+
+	seedCache(t)
+	output, _, err := executeCommand(rootCmd, "cache", "export", archive)
+	if err != nil || !strings.Contains(output, "Exported 4 artifact(s)") {
+		t.Fatalf("expected the cache to be exported, got %q, %v", output, err)
+	}
+
+	// Import on another machine.
+	setupMocks(t)
+	output, _, err = executeCommand(rootCmd, "cache", "import", archive)
+	if err != nil || !strings.Contains(output, "Imported 4 artifact(s)") {
+		t.Fatalf("expected the cache to be imported, got %q, %v", output, err)
+	}
+	cfg, _ := config.New()
+	if e, err := cache.Open(cfg).Lookup("https://example.com/ubuntu-arm.qcow2"); err != nil || e == nil {
+		t.Errorf("expected the image to be imported, got %+v, %v", e, err)
+	}
+
+	if _, _, err := executeCommand(rootCmd, "cache", "import", filepath.Join(t.TempDir(), "missing.tar")); err == nil {
+		t.Error("expected an error for a missing archive")
+	}
+}
@@ -3,13 +3,11 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"pvmlab/internal/config"
 	"pvmlab/internal/metadata"
 	"pvmlab/internal/pidfile"
-	"pvmlab/internal/socketvmnet"
-	"strings"
+	"pvmlab/internal/qmp"
 	"time"
 
 	"github.com/fatih/color"
@@ -51,10 +49,15 @@ Use the --purge flag to remove the entire ~/.pvmlab directory.`,
 			_ = stopVM(cfg, vmName)
 		}
 
-		// Stop the socket_vmnet service
-		color.Cyan("i Stopping socket_vmnet service...")
-		if err := socketvmnet.StopSocketVmnet(); err != nil {
-			color.Yellow("! socket_vmnet service not running or could not be stopped: %v", err)
+		// Tear down the private network
+		network, err := newNetworkBackend(cfg)
+		if err != nil {
+			color.Yellow("! Could not determine the network backend: %v", err)
+		} else {
+			color.Cyan("i Tearing down %s network...", network.Name())
+			if err := network.Teardown(); err != nil {
+				color.Yellow("! %s network not running or could not be torn down: %v", network.Name(), err)
+			}
 		}
 
 		if purge {
@@ -98,10 +101,7 @@ func stopVM(cfg *config.Config, vmName string) error {
 		return nil
 	}
 
-	monitorPath := filepath.Join(cfg.GetAppDir(), "monitors", vmName+".sock")
-	cmd := exec.Command("socat", "-", monitorPath)
-	cmd.Stdin = strings.NewReader("system_powerdown\n")
-	if err := cmd.Run(); err != nil {
+	if _, err := qmp.Run(qmpSocketPath(cfg.GetAppDir(), vmName), "system_powerdown", nil, qmpTimeout); err != nil {
 		return fmt.Errorf("error sending powerdown command to %s: %w", vmName, err)
 	}
 
@@ -40,7 +40,7 @@ func TestCleanCommand(t *testing.T) {
 				pidfile.IsRunning = func(c *config.Config, name string) (bool, error) {
 					return false, nil
 				}
-				socketvmnet.StopSocketVmnet = func() error { return nil }
+				socketvmnet.StopSocketVmnet = func(string) error { return nil }
 			},
 			expectedError: "",
 			expectedOut:   "Cleaning directory:",
@@ -57,7 +57,7 @@ func TestCleanCommand(t *testing.T) {
 				pidfile.IsRunning = func(c *config.Config, name string) (bool, error) {
 					return false, nil
 				}
-				socketvmnet.StopSocketVmnet = func() error { return nil }
+				socketvmnet.StopSocketVmnet = func(string) error { return nil }
 			},
 			expectedError: "",
 			expectedOut:   "Purging entire pvmlab directory",
@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"log"
+	"os"
+	"path/filepath"
 	"pvmlab/internal/config"
 	"pvmlab/internal/metadata"
 	"sort"
@@ -30,3 +32,63 @@ func VmNameCompleter(cmd *cobra.Command, args []string, toComplete string) ([]st
 
 	return vmNames, cobra.ShellCompDirectiveNoFileComp
 }
+
+// VmNameFirstArgCompleter completes VM names for commands whose first
+// argument is a VM name and whose other arguments are free-form.
+func VmNameFirstArgCompleter(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return VmNameCompleter(cmd, args, toComplete)
+}
+
+// LabNameCompleter completes the names of the labs.
+func LabNameCompleter(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	cfg, err := config.New()
+	if err != nil {
+		log.Println("Error creating config for completion:", err)
+		return nil, cobra.ShellCompDirectiveError
+	}
+	labs, err := cfg.ListLabs()
+	if err != nil {
+		log.Println("Error getting lab list for completion:", err)
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	names := make([]string, 0, len(labs))
+	for _, lab := range labs {
+		names = append(names, lab.Name)
+	}
+	sort.Strings(names)
+
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// DistroNameCompleter completes the names of the pulled distributions.
+func DistroNameCompleter(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	cfg, err := config.New()
+	if err != nil {
+		log.Println("Error creating config for completion:", err)
+		return nil, cobra.ShellCompDirectiveError
+	}
+	entries, err := os.ReadDir(filepath.Join(cfg.GetSharedDir(), "images"))
+	if err != nil && !os.IsNotExist(err) {
+		log.Println("Error getting distribution list for completion:", err)
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
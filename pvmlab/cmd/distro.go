@@ -1,6 +1,12 @@
 package cmd
 
 import (
+	"path/filepath"
+	"pvmlab/internal/config"
+	"pvmlab/internal/distro"
+	"pvmlab/internal/metadata"
+	"sort"
+
 	"github.com/spf13/cobra"
 )
 
@@ -11,6 +17,77 @@ var distroCmd = &cobra.Command{
 	Long:  `Manage distributions that can be used to provision VMs.`,
 }
 
+// distroDir returns the directory of the pulled assets of an architecture of
+// a distribution.
+func distroDir(cfg *config.Config, distroName, arch string) string {
+	return filepath.Join(cfg.GetSharedDir(), "images", distroName, arch)
+}
+
+// forEachVM calls fn with the metadata of the VMs of all the labs.
+func forEachVM(cfg *config.Config, fn func(lab, name string, meta *metadata.Metadata)) error {
+	labs, err := cfg.ListLabs()
+	if err != nil {
+		return err
+	}
+	for _, lab := range labs {
+		allMeta, err := metadata.GetAll(labConfig(cfg, lab.Name))
+		if err != nil {
+			return err
+		}
+		for name, meta := range allMeta {
+			fn(lab.Name, name, meta)
+		}
+	}
+	return nil
+}
+
+// forEachDistroVM calls fn with the metadata of the VMs of all the labs
+// created from a distribution.
+func forEachDistroVM(cfg *config.Config, fn func(lab, name string, meta *metadata.Metadata)) error {
+	return forEachVM(cfg, func(lab, name string, meta *metadata.Metadata) {
+		if meta.Distro != "" {
+			fn(lab, name, meta)
+		}
+	})
+}
+
+// distroVMs returns the VMs of all the labs created from a distribution,
+// keyed by "<distro>/<arch>". The VMs of the labs other than the selected one
+// are prefixed with their lab.
+func distroVMs(cfg *config.Config) (map[string][]string, error) {
+	vms := map[string][]string{}
+	err := forEachDistroVM(cfg, func(lab, name string, meta *metadata.Metadata) {
+		if lab != cfg.LabName() {
+			name = lab + "/" + name
+		}
+		key := meta.Distro + "/" + meta.Arch
+		vms[key] = append(vms[key], name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, names := range vms {
+		sort.Strings(names)
+	}
+	return vms, nil
+}
+
+// pruneDistroKernels removes the kernels of the previous pulls of an
+// architecture of a distribution that none of the VMs of all the labs boots
+// anymore.
+func pruneDistroKernels(cfg *config.Config, distroName, arch string) error {
+	inUse := map[string]bool{}
+	err := forEachDistroVM(cfg, func(lab, name string, meta *metadata.Metadata) {
+		if meta.Distro == distroName && meta.Arch == arch {
+			inUse[meta.Kernel], inUse[meta.Initrd] = true, true
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return distro.PruneKernels(distroDir(cfg, distroName, arch), inUse)
+}
+
 func init() {
 	rootCmd.AddCommand(distroCmd)
 }
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"pvmlab/internal/config"
+	"pvmlab/internal/distro"
+	"pvmlab/internal/errors"
+	"syscall"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	distroImportName   string
+	distroImportFamily string
+	distroImportArch   string
+	distroImportQcow2  string
+	distroImportRootfs string
+	distroImportKernel string
+	distroImportInitrd string
+)
+
+// distroImportCmd represents the distro import command
+var distroImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import a custom image as a distribution for PXE booting",
+	Long: `Import a custom qcow2 image, or a rootfs tarball, as a distribution for PXE
+booting. The assets are created like 'pvmlab distro pull' does, using the
+--family of the distribution the image is based on, which is required, and
+the distribution is registered in distros.yaml so that VMs can be created
+from it.
+
+A rootfs tarball is booted with the newest kernel of its /boot, or with the
+--kernel and --initrd given. A distribution imported from a rootfs tarball
+has no qcow2 image, so its VMs must be created with --pxeboot.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if distroImportArch != "aarch64" && distroImportArch != "x86_64" {
+			return errors.E("distro-import", fmt.Errorf("--arch must be either 'aarch64' or 'x86_64'"))
+		}
+		if (distroImportQcow2 == "") == (distroImportRootfs == "") {
+			return errors.E("distro-import", fmt.Errorf("exactly one of --qcow2 or --rootfs is required"))
+		}
+
+		if distroImportQcow2 != "" {
+			if err := checkDockerMemory(); err != nil {
+				color.Yellow("! Warning: %v", err)
+			}
+		}
+
+		cfg, err := config.New()
+		if err != nil {
+			return errors.E("distro-import", err)
+		}
+
+		// Create a context that is cancelled on a SIGINT or SIGTERM.
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		opts := distro.ImportOptions{
+			Name:   distroImportName,
+			Family: distroImportFamily,
+			Arch:   distroImportArch,
+			Qcow2:  distroImportQcow2,
+			Rootfs: distroImportRootfs,
+			Kernel: distroImportKernel,
+			Initrd: distroImportInitrd,
+		}
+		if err := distro.Import(ctx, cfg, opts); err != nil {
+			if ctx.Err() == context.Canceled {
+				color.Yellow("\nOperation cancelled by user.")
+				return nil
+			}
+			return errors.E("distro-import", err)
+		}
+		if err := pruneDistroKernels(cfg, distroImportName, distroImportArch); err != nil {
+			color.Yellow("! Warning: could not remove the unused kernels: %v", err)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	distroCmd.AddCommand(distroImportCmd)
+	distroImportCmd.Flags().StringVar(&distroImportName, "name", "", "The name to register the distribution with (required)")
+	distroImportCmd.Flags().StringVar(&distroImportFamily, "family", "", "The distribution the image is based on: ubuntu, debian, fedora, rocky, almalinux or centos (required)")
+	distroImportCmd.MarkFlagRequired("name")
+	distroImportCmd.MarkFlagRequired("family")
+	distroImportCmd.Flags().StringVar(&distroImportArch, "arch", "aarch64", "The architecture of the image ('aarch64' or 'x86_64')")
+	distroImportCmd.Flags().StringVar(&distroImportQcow2, "qcow2", "", "The path of the qcow2 image to import")
+	distroImportCmd.Flags().StringVar(&distroImportRootfs, "rootfs", "", "The path of the rootfs tarball to import, instead of a qcow2 image")
+	distroImportCmd.Flags().StringVar(&distroImportKernel, "kernel", "", "The path of the kernel to boot the rootfs tarball with")
+	distroImportCmd.Flags().StringVar(&distroImportInitrd, "initrd", "", "The path of the initrd to boot the rootfs tarball with")
+}
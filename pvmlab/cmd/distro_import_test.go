@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"pvmlab/internal/config"
+	"pvmlab/internal/distro"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestDistroImportCmd(t *testing.T) {
+	setupMocks(t)
+	originalImport := distro.Import
+	defer func() { distro.Import = originalImport }()
+	var imported []distro.ImportOptions
+	distro.Import = func(ctx context.Context, cfg *config.Config, opts distro.ImportOptions) error {
+		imported = append(imported, opts)
+		return nil
+	}
+	// The flags keep their value, and whether they were set, across the
+	// executions of the command.
+	resetFlags := func() {
+		distroImportCmd.Flags().VisitAll(func(f *pflag.Flag) {
+			f.Value.Set(f.DefValue)
+			f.Changed = false
+		})
+	}
+	defer resetFlags()
+
+	tests := []struct {
+		name          string
+		args          []string
+		expectedError string
+	}{
+		{"missing name", []string{"distro", "import", "--family", "ubuntu", "--qcow2", "golden.qcow2"}, `required flag(s) "name" not set`},
+		{"missing family", []string{"distro", "import", "--name", "myos", "--qcow2", "golden.qcow2"}, `required flag(s) "family" not set`},
+		{"positional argument", []string{"distro", "import", "myos", "--name", "myos", "--family", "ubuntu", "--qcow2", "golden.qcow2"}, `unknown command "myos"`},
+		{"invalid arch", []string{"distro", "import", "--name", "myos", "--family", "ubuntu", "--arch", "arm64", "--qcow2", "golden.qcow2"}, "--arch must be either 'aarch64' or 'x86_64'"},
+		{"no image", []string{"distro", "import", "--name", "myos", "--family", "ubuntu"}, "exactly one of --qcow2 or --rootfs"},
+		{"both images", []string{"distro", "import", "--name", "myos", "--family", "ubuntu", "--qcow2", "golden.qcow2", "--rootfs", "rootfs.tar.gz"}, "exactly one of --qcow2 or --rootfs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			_, _, err := executeCommand(rootCmd, tt.args...)
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("expected an error containing %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+	if len(imported) != 0 {
+		t.Fatalf("expected no import, got %+v", imported)
+	}
+
+	resetFlags()
+	_, _, err := executeCommand(rootCmd, "distro", "import", "--name", "myos", "--family", "rocky", "--arch", "x86_64",
+		"--rootfs", "rootfs.tar.gz", "--kernel", "vmlinuz", "--initrd", "initrd.img")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := distro.ImportOptions{Name: "myos", Family: "rocky", Arch: "x86_64", Rootfs: "rootfs.tar.gz", Kernel: "vmlinuz", Initrd: "initrd.img"}
+	if len(imported) != 1 || imported[0] != expected {
+		t.Errorf("expected %+v to be imported, got %+v", expected, imported)
+	}
+}
@@ -1,36 +1,72 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"pvmlab/internal/config"
+	"pvmlab/internal/distro"
+	"pvmlab/internal/errors"
+	"pvmlab/internal/util"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
 )
 
+// distroLsEntry is an architecture of a distribution in the structured
+// output of 'distro ls'.
+type distroLsEntry struct {
+	Distro    string   `json:"distro"`
+	Arch      string   `json:"arch"`
+	Pulled    bool     `json:"pulled"`
+	Artifacts []string `json:"artifacts"`
+}
+
+// distroLocalEntry is a pulled architecture of a distribution in the
+// structured output of 'distro ls --local'.
+type distroLocalEntry struct {
+	Distro        string        `json:"distro"`
+	Arch          string        `json:"arch"`
+	KernelVersion string        `json:"kernel_version,omitempty"`
+	PulledAt      *time.Time    `json:"pulled_at,omitempty"`
+	Size          int64         `json:"size"`
+	Assets        []distroAsset `json:"assets"`
+	VMs           []string      `json:"vms"`
+}
+
+// distroAsset is a file of the pulled assets of a distribution.
+type distroAsset struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+var distroLsLocal bool
+
 var distroLsCmd = &cobra.Command{
 	Use:   "ls",
 	Short: "List available distributions",
-	Long:  `List available distributions that have been pulled.`, 
+	Long: `List available distributions that have been pulled. With --local, list the
+pulled assets instead: their size, kernel version, pull date and the VMs
+created from them.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg, err := config.New()
 		if err != nil {
 			return err
 		}
 
-		if len(config.Distros) == 0 {
+		if distroLsLocal {
+			return listLocalDistros(cmd, cfg)
+		}
+
+		if len(config.Distros) == 0 && !structuredOutput() {
 			color.Yellow("No distributions defined in the configuration.")
 			return nil
 		}
 
-		table := tablewriter.NewWriter(os.Stdout)
-		header := []string{"DISTRO", "ARCH", "STATUS", "ARTIFACTS"}
-		table.Header(header)
-
 		// Sort distro names for consistent output
 		distroNames := make([]string, 0, len(config.Distros))
 		for name := range config.Distros {
@@ -38,37 +74,58 @@ var distroLsCmd = &cobra.Command{
 		}
 		sort.Strings(distroNames)
 
+		entries := []distroLsEntry{}
 		for _, distroName := range distroNames {
-			distro := config.Distros[distroName]
-			for archName := range distro.Arch {
-				distroPath := filepath.Join(cfg.GetAppDir(), "images", distroName, archName)
+			distroConfig := config.Distros[distroName]
+			archNames := make([]string, 0, len(distroConfig.Arch))
+			for archName := range distroConfig.Arch {
+				archNames = append(archNames, archName)
+			}
+			sort.Strings(archNames)
+			for _, archName := range archNames {
+				distroPath := filepath.Join(cfg.GetSharedDir(), "images", distroName, archName)
 
-				vmlinuzPath := filepath.Join(distroPath, "vmlinuz")
 				modulesCpioGzPath := filepath.Join(distroPath, "modules.cpio.gz")
 
-				status := color.RedString("Not Pulled")
-				if _, errVmlinuz := os.Stat(vmlinuzPath); errVmlinuz == nil {
-					if _, errModules := os.Stat(modulesCpioGzPath); errModules == nil {
-						status = color.GreenString("Pulled")
+				entry := distroLsEntry{Distro: distroName, Arch: archName, Artifacts: []string{}}
+				archInfo := distroConfig.Arch[archName]
+				if kernel, _, err := distro.Assets(distroPath, &archInfo); err == nil {
+					if _, errVmlinuz := os.Stat(filepath.Join(distroPath, kernel)); errVmlinuz == nil {
+						if _, errModules := os.Stat(modulesCpioGzPath); errModules == nil {
+							entry.Pulled = true
+						}
 					}
 				}
 
 				artifacts, err := os.ReadDir(distroPath)
-				var artifactNames []string
 				if err == nil {
 					for _, artifact := range artifacts {
-						artifactNames = append(artifactNames, artifact.Name())
+						entry.Artifacts = append(entry.Artifacts, artifact.Name())
 					}
 				}
+				entries = append(entries, entry)
+			}
+		}
 
-				row := []string{
-					distroName,
-					archName,
-					status,
-					strings.Join(artifactNames, ", "),
-				}
-				table.Append(row)
+		if structuredOutput() {
+			return printStructured(cmd.OutOrStdout(), entries)
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		header := []string{"DISTRO", "ARCH", "STATUS", "ARTIFACTS"}
+		table.Header(header)
+		for _, entry := range entries {
+			status := color.RedString("Not Pulled")
+			if entry.Pulled {
+				status = color.GreenString("Pulled")
+			}
+			row := []string{
+				entry.Distro,
+				entry.Arch,
+				status,
+				strings.Join(entry.Artifacts, ", "),
 			}
+			table.Append(row)
 		}
 
 		table.Render()
@@ -77,6 +134,114 @@ var distroLsCmd = &cobra.Command{
 	},
 }
 
+func listLocalDistros(cmd *cobra.Command, cfg *config.Config) error {
+	entries, err := localDistros(cfg)
+	if err != nil {
+		return errors.E("distro-ls", err)
+	}
+
+	if structuredOutput() {
+		return printStructured(cmd.OutOrStdout(), entries)
+	}
+	if len(entries) == 0 {
+		color.Yellow("No distributions pulled. Pull one with 'pvmlab distro pull'.")
+		return nil
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.Header([]string{"DISTRO", "ARCH", "KERNEL", "SIZE", "PULLED", "USED BY", "ASSETS"})
+	var total int64
+	for _, entry := range entries {
+		kernel, pulledAt, usedBy := "-", "-", "-"
+		if entry.KernelVersion != "" {
+			kernel = entry.KernelVersion
+		}
+		if entry.PulledAt != nil {
+			pulledAt = entry.PulledAt.Local().Format(time.DateTime)
+		}
+		if len(entry.VMs) > 0 {
+			usedBy = strings.Join(entry.VMs, ", ")
+		}
+		assets := make([]string, 0, len(entry.Assets))
+		for _, asset := range entry.Assets {
+			assets = append(assets, fmt.Sprintf("%s (%s)", asset.Name, util.FormatSize(asset.Size)))
+		}
+		table.Append([]string{entry.Distro, entry.Arch, kernel, util.FormatSize(entry.Size), pulledAt, usedBy, strings.Join(assets, ", ")})
+		total += entry.Size
+	}
+	table.Render()
+	color.Cyan("i %d pulled distribution(s), %s.", len(entries), util.FormatSize(total))
+	return nil
+}
+
+// localDistros returns the pulled architectures of the distributions found in
+// the images directory, whether or not distros.yaml still lists them.
+func localDistros(cfg *config.Config) ([]distroLocalEntry, error) {
+	imagesDir := filepath.Join(cfg.GetSharedDir(), "images")
+	distroDirs, err := os.ReadDir(imagesDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", imagesDir, err)
+	}
+	vms, err := distroVMs(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error getting VM list: %w", err)
+	}
+
+	entries := []distroLocalEntry{}
+	for _, distroEntry := range distroDirs {
+		if !distroEntry.IsDir() {
+			continue
+		}
+		archDirs, err := os.ReadDir(filepath.Join(imagesDir, distroEntry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, archEntry := range archDirs {
+			if !archEntry.IsDir() {
+				continue
+			}
+			entry, err := localDistro(cfg, distroEntry.Name(), archEntry.Name())
+			if err != nil {
+				return nil, err
+			}
+			entry.VMs = vms[entry.Distro+"/"+entry.Arch]
+			if entry.VMs == nil {
+				entry.VMs = []string{}
+			}
+			entries = append(entries, *entry)
+		}
+	}
+	return entries, nil
+}
+
+// localDistro returns the pulled assets of an architecture of a distribution.
+func localDistro(cfg *config.Config, distroName, arch string) (*distroLocalEntry, error) {
+	dir := distroDir(cfg, distroName, arch)
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	entry := &distroLocalEntry{Distro: distroName, Arch: arch, Assets: []distroAsset{}}
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil {
+			return nil, err
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		entry.Assets = append(entry.Assets, distroAsset{Name: file.Name(), Size: info.Size()})
+		entry.Size += info.Size()
+	}
+	// The assets pulled before lock files have no kernel version nor date.
+	if lock, err := distro.ReadLock(dir); err == nil {
+		entry.KernelVersion = lock.KernelVersion
+		entry.PulledAt = &lock.PulledAt
+	}
+	return entry, nil
+}
+
 func init() {
 	distroCmd.AddCommand(distroLsCmd)
+	distroLsCmd.Flags().BoolVar(&distroLsLocal, "local", false, "List the pulled assets with their size, kernel version, pull date and the VMs using them")
 }
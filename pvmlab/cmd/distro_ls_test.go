@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"pvmlab/internal/config"
+	"pvmlab/internal/distro"
+	"pvmlab/internal/metadata"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDistroLsCommand(t *testing.T) {
+	setupMocks(t)
+	defer func() { outputFormat = outputTable }()
+
+	cfg, _ := config.New()
+	pulledDir := filepath.Join(cfg.GetAppDir(), "images", "ubuntu-24.04", "aarch64")
+	if err := os.MkdirAll(pulledDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"vmlinuz", "modules.cpio.gz"} {
+		if err := os.WriteFile(filepath.Join(pulledDir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output, _, err := executeCommand(rootCmd, "distro", "ls")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	for _, expected := range []string{"ubuntu-24.04", "Pulled", "Not Pulled", "modules.cpio.gz, vmlinuz"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected output to contain '%s', but got '%s'", expected, output)
+		}
+	}
+
+	output, _, err = executeCommand(rootCmd, "distro", "ls", "--output", "json")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	var entries []distroLsEntry
+	if err := json.Unmarshal([]byte(output), &entries); err != nil {
+		t.Fatalf("expected JSON output, got '%s': %v", output, err)
+	}
+	expected := []distroLsEntry{
+		{Distro: "ubuntu-24.04", Arch: "aarch64", Pulled: true, Artifacts: []string{"modules.cpio.gz", "vmlinuz"}},
+		{Distro: "ubuntu-24.04", Arch: "x86_64", Artifacts: []string{}},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+}
+
+// pullDistro creates the assets of a pulled distribution with its lock file.
+func pullDistro(t *testing.T, distroName, arch string) string {
+	t.Helper()
+	cfg, _ := config.New()
+	dir := filepath.Join(cfg.GetSharedDir(), "images", distroName, arch)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"image.qcow2": "qcow2", "vmlinuz-6.8.0-87-generic": "kernel", "modules.cpio.gz": "modules"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lock := &distro.Lock{
+		KernelVersion: "6.8.0-87-generic",
+		Kernel:        "vmlinuz-6.8.0-87-generic",
+		Initrd:        "initrd.img-6.8.0-87-generic",
+		PulledAt:      time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC),
+	}
+	if err := distro.WriteLock(dir, lock); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestDistroLsCommand_Local(t *testing.T) {
+	setupMocks(t)
+	defer func() {
+		outputFormat = outputTable
+		distroLsLocal = false
+	}()
+
+	output, _, err := executeCommand(rootCmd, "distro", "ls", "--local")
+	if err != nil || !strings.Contains(output, "No distributions pulled") {
+		t.Errorf("expected no pulled distribution, got %q, %v", output, err)
+	}
+
+	pullDistro(t, "ubuntu-24.04", "aarch64")
+	pullDistro(t, "custom", "x86_64")
+	metadata.GetAll = func(*config.Config) (map[string]*metadata.Metadata, error) {
+		return map[string]*metadata.Metadata{
+			"target1":     {Name: "target1", Distro: "ubuntu-24.04", Arch: "aarch64"},
+			"provisioner": {Name: "provisioner", Role: "provisioner", Arch: "aarch64"},
+		}, nil
+	}
+
+	output, _, err = executeCommand(rootCmd, "distro", "ls", "--local")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	for _, expected := range []string{"custom", "ubuntu-24.04", "6.8.0-87-generic", "target1", "image.qcow2 (5B)", "2 pulled distribution(s)"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected output to contain '%s', but got '%s'", expected, output)
+		}
+	}
+
+	output, _, err = executeCommand(rootCmd, "distro", "ls", "--local", "--output", "json")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	var entries []distroLocalEntry
+	if err := json.Unmarshal([]byte(output), &entries); err != nil {
+		t.Fatalf("expected JSON output, got '%s': %v", output, err)
+	}
+	if len(entries) != 2 || entries[0].Distro != "custom" || len(entries[0].VMs) != 0 {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	ubuntu := entries[1]
+	if ubuntu.KernelVersion != "6.8.0-87-generic" || ubuntu.PulledAt == nil || ubuntu.Size != int64(len("qcow2kernelmodules"))+ubuntu.Assets[0].Size ||
+		!reflect.DeepEqual(ubuntu.VMs, []string{"target1"}) {
+		t.Errorf("unexpected entry %+v", ubuntu)
+	}
+}
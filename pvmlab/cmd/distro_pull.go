@@ -72,6 +72,9 @@ var distroPullCmd = &cobra.Command{
 			}
 			return errors.E("distro-pull", err)
 		}
+		if err := pruneDistroKernels(cfg, distroName, distroPullArch); err != nil {
+			color.Yellow("! Warning: could not remove the unused kernels: %v", err)
+		}
 
 		return nil
 	},
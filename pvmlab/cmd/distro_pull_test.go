@@ -1,6 +1,12 @@
 package cmd
 
 import (
+	"os"
+	"path/filepath"
+	"pvmlab/internal/config"
+	"pvmlab/internal/distro"
+	"pvmlab/internal/metadata"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -114,3 +120,41 @@ func TestDistroPullCmd_ValidArchitectures(t *testing.T) {
 		})
 	}
 }
+
+func TestPruneDistroKernels(t *testing.T) {
+	setupMocks(t)
+	dir := pullDistro(t, "ubuntu-24.04", "aarch64")
+	retained := []string{"vmlinuz-6.8.0-86-generic", "initrd.img-6.8.0-86-generic", "vmlinuz-6.8.0-85-generic", "initrd.img-6.8.0-85-generic"}
+	for _, name := range retained {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lock, err := distro.ReadLock(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Retained = retained
+	if err := distro.WriteLock(dir, lock); err != nil {
+		t.Fatal(err)
+	}
+	metadata.GetAll = func(*config.Config) (map[string]*metadata.Metadata, error) {
+		return map[string]*metadata.Metadata{
+			"target1": {Name: "target1", Distro: "ubuntu-24.04", Arch: "aarch64", Kernel: retained[0], Initrd: retained[1]},
+			"target2": {Name: "target2", Distro: "ubuntu-24.04", Arch: "x86_64", Kernel: retained[2], Initrd: retained[3]},
+		}, nil
+	}
+
+	cfg, _ := config.New()
+	if err := pruneDistroKernels(cfg, "ubuntu-24.04", "aarch64"); err != nil {
+		t.Fatalf("pruneDistroKernels() failed: %v", err)
+	}
+	for i, name := range retained {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != (i < 2) {
+			t.Errorf("expected %s to exist: %v", name, i < 2)
+		}
+	}
+	if lock, err = distro.ReadLock(dir); err != nil || !reflect.DeepEqual(lock.Retained, retained[:2]) {
+		t.Errorf("expected the kernel of target1 to be retained, got %+v, %v", lock, err)
+	}
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"pvmlab/internal/config"
+	"pvmlab/internal/errors"
+	"pvmlab/internal/util"
+	"sort"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var distroRmArch string
+
+// distroRmCmd represents the distro rm command
+var distroRmCmd = &cobra.Command{
+	Use:   "rm <distro>",
+	Short: "Removes the pulled assets of a distribution",
+	Long: `Removes the pulled assets of a distribution: its qcow2 image, rootfs tarball,
+kernel, initrd and modules, for all its architectures or the one of --arch.
+The distribution can't be removed while VMs of any lab were created from it.
+The architectures imported by 'pvmlab distro import' are also removed from
+distros.yaml. The images stay in the artifact cache until 'pvmlab cache prune'.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: DistroNameCompleter,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if name != filepath.Base(name) || name == "." || name == ".." {
+			return errors.E("distro-rm", fmt.Errorf("invalid distribution name '%s'", name))
+		}
+		if distroRmArch != "" && distroRmArch != "aarch64" && distroRmArch != "x86_64" {
+			return errors.E("distro-rm", fmt.Errorf("--arch must be either 'aarch64' or 'x86_64'"))
+		}
+
+		cfg, err := config.New()
+		if err != nil {
+			return errors.E("distro-rm", err)
+		}
+
+		entries, err := localDistros(cfg)
+		if err != nil {
+			return errors.E("distro-rm", err)
+		}
+		var pulled []distroLocalEntry
+		for _, entry := range entries {
+			if entry.Distro == name && (distroRmArch == "" || entry.Arch == distroRmArch) {
+				pulled = append(pulled, entry)
+			}
+		}
+		if len(pulled) == 0 {
+			if distroRmArch != "" {
+				return errors.E("distro-rm", fmt.Errorf("distribution '%s' is not pulled for %s", name, distroRmArch))
+			}
+			return errors.E("distro-rm", fmt.Errorf("distribution '%s' is not pulled", name))
+		}
+
+		var inUse []string
+		for _, entry := range pulled {
+			inUse = append(inUse, entry.VMs...)
+		}
+		if len(inUse) > 0 {
+			sort.Strings(inUse)
+			return errors.E("distro-rm", fmt.Errorf("distribution '%s' is used by VMs %v. Remove them with 'pvmlab vm clean <name>' first", name, inUse))
+		}
+
+		for _, entry := range pulled {
+			if err := os.RemoveAll(distroDir(cfg, entry.Distro, entry.Arch)); err != nil {
+				return errors.E("distro-rm", fmt.Errorf("failed to remove %s (%s): %w", entry.Distro, entry.Arch, err))
+			}
+			// An imported architecture has nothing left to pull from.
+			if info, err := config.GetDistro(entry.Distro, entry.Arch); err == nil && info.IsImported() {
+				if err := cfg.UnregisterDistro(entry.Distro, entry.Arch); err != nil {
+					return errors.E("distro-rm", fmt.Errorf("failed to remove %s (%s) from distros.yaml: %w", entry.Distro, entry.Arch, err))
+				}
+			}
+			color.Green("✔ Removed %s (%s, %s).", entry.Distro, entry.Arch, util.FormatSize(entry.Size))
+		}
+		// Remove the directory of the distribution once it has no
+		// architecture left.
+		_ = os.Remove(filepath.Join(cfg.GetSharedDir(), "images", name))
+		return nil
+	},
+}
+
+func init() {
+	distroCmd.AddCommand(distroRmCmd)
+	distroRmCmd.Flags().StringVar(&distroRmArch, "arch", "", "The architecture to remove ('aarch64' or 'x86_64'), all of them if not set")
+}
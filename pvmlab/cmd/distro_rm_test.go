@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"pvmlab/internal/config"
+	"pvmlab/internal/metadata"
+	"strings"
+	"testing"
+)
+
+func TestDistroRmCommand(t *testing.T) {
+	setupMocks(t)
+	defer func() { distroRmArch = "" }()
+
+	armDir := pullDistro(t, "ubuntu-24.04", "aarch64")
+	amdDir := pullDistro(t, "ubuntu-24.04", "x86_64")
+	metadata.GetAll = func(*config.Config) (map[string]*metadata.Metadata, error) {
+		return map[string]*metadata.Metadata{
+			"target1": {Name: "target1", Distro: "ubuntu-24.04", Arch: "aarch64"},
+		}, nil
+	}
+
+	_, _, err := executeCommand(rootCmd, "distro", "rm", "ubuntu-24.04")
+	if err == nil || !strings.Contains(err.Error(), "used by VMs [target1]") {
+		t.Fatalf("expected the removal to be refused, got %v", err)
+	}
+	if _, err := os.Stat(armDir); err != nil {
+		t.Errorf("expected %s to be kept: %v", armDir, err)
+	}
+
+	output, _, err := executeCommand(rootCmd, "distro", "rm", "ubuntu-24.04", "--arch", "x86_64")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if !strings.Contains(output, "Removed ubuntu-24.04 (x86_64") {
+		t.Errorf("unexpected output %q", output)
+	}
+	if _, err := os.Stat(amdDir); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, got %v", amdDir, err)
+	}
+
+	distroRmArch = ""
+	metadata.GetAll = func(*config.Config) (map[string]*metadata.Metadata, error) {
+		return map[string]*metadata.Metadata{}, nil
+	}
+	if _, _, err := executeCommand(rootCmd, "distro", "rm", "ubuntu-24.04"); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(armDir)); !os.IsNotExist(err) {
+		t.Errorf("expected the distribution directory to be removed, got %v", err)
+	}
+
+	for _, args := range [][]string{{"ubuntu-24.04"}, {"../images"}, {"ubuntu-24.04", "--arch", "riscv64"}} {
+		if _, _, err := executeCommand(rootCmd, append([]string{"distro", "rm"}, args...)...); err == nil {
+			t.Errorf("expected an error for %v", args)
+		}
+		distroRmArch = ""
+	}
+}
+
+func TestDistroRmCommand_Imported(t *testing.T) {
+	setupMocks(t)
+	// Load the distros from distros.yaml rather than the fixed test ones.
+	newConfig := config.New
+	config.New = func() (*config.Config, error) {
+		cfg, err := newConfig()
+		if err != nil {
+			return nil, err
+		}
+		return cfg, cfg.LoadOrCreateDistros()
+	}
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.RegisterDistro("myos", "ubuntu", "x86_64", config.ArchInfo{Qcow2URL: "file:///srv/golden.qcow2"}); err != nil {
+		t.Fatal(err)
+	}
+	pullDistro(t, "myos", "x86_64")
+	pullDistro(t, "ubuntu-24.04", "x86_64")
+
+	for _, name := range []string{"myos", "ubuntu-24.04"} {
+		if _, _, err := executeCommand(rootCmd, "distro", "rm", name); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(cfg.GetSharedDir(), "distros.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "myos") {
+		t.Errorf("expected the imported distro to be removed from distros.yaml, got:\n%s", data)
+	}
+	if !strings.Contains(string(data), "name: ubuntu-24.04") {
+		t.Errorf("expected the pulled distro to be kept in distros.yaml, got:\n%s", data)
+	}
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"os/exec"
+	"pvmlab/internal/config"
+	"pvmlab/internal/qemu"
+	"runtime"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// lookPath is a variable to allow mocking in tests.
+var lookPath = exec.LookPath
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Reports what pvmlab detected on this host",
+	Long: `Reports the QEMU binaries, accelerators, UEFI firmware, tools and network backend
+that pvmlab will use on this host. Missing tools are reported as errors; missing
+per-architecture support is reported as a warning, as only the architectures you
+actually run are needed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		problems := 0
+		ok := func(format string, a ...interface{}) { color.Green("✔ "+format, a...) }
+		warn := func(format string, a ...interface{}) { color.Yellow("! "+format, a...) }
+		fail := func(format string, a ...interface{}) {
+			color.Red("✖ "+format, a...)
+			problems++
+		}
+
+		color.Cyan("i Host: %s/%s", runtime.GOOS, qemu.HostArch())
+
+		for _, arch := range []string{"aarch64", "x86_64"} {
+			color.Cyan("i %s guests:", arch)
+			binary := "qemu-system-" + arch
+			if path, err := lookPath(binary); err != nil {
+				warn("  %s: not found", binary)
+			} else {
+				ok("  %s: %s", binary, path)
+			}
+
+			accel := selectAccelerator(arch)
+			if accel.Name == "tcg" {
+				warn("  accelerator: tcg, cpu %s (%s)", accel.CPU(), accel.Reason)
+			} else {
+				ok("  accelerator: %s, cpu %s (%s)", accel.Name, accel.CPU(), accel.Reason)
+			}
+
+			firmware, err := findFirmware(arch)
+			switch {
+			case err != nil:
+				warn("  firmware: %v", err)
+			case firmware.Vars == "":
+				ok("  firmware: %s (unified)", firmware.Code)
+			default:
+				ok("  firmware: %s", firmware.Code)
+				ok("  firmware vars template: %s", firmware.Vars)
+			}
+		}
+
+		color.Cyan("i Tools:")
+		for _, tool := range []string{"qemu-img", "docker"} {
+			if path, err := lookPath(tool); err != nil {
+				fail("  %s: not found", tool)
+			} else {
+				ok("  %s: %s", tool, path)
+			}
+		}
+
+		cfg, err := config.New()
+		if err != nil {
+			return err
+		}
+		network, err := newNetworkBackend(cfg)
+		if err != nil {
+			fail("Network: %v", err)
+		} else {
+			color.Cyan("i Network backend: %s", network.Name())
+			for _, dep := range network.Dependencies() {
+				if path, err := lookPath(dep); err != nil {
+					fail("  %s: not found", dep)
+				} else {
+					ok("  %s: %s", dep, path)
+				}
+			}
+			running, err := network.IsRunning()
+			switch {
+			case err != nil:
+				fail("  status: %v", err)
+			case running:
+				ok("  status: running")
+			default:
+				warn("  status: stopped. Run 'pvmlab network setup' to start it")
+			}
+		}
+
+		if problems > 0 {
+			return fmt.Errorf("%d problem(s) found", problems)
+		}
+		color.Green("✔ No problems found.")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
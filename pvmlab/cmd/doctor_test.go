@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"errors"
+	"pvmlab/internal/config"
+	"pvmlab/internal/netbackend"
+	"pvmlab/internal/qemu"
+	"strings"
+	"testing"
+)
+
+func TestDoctorCommand(t *testing.T) {
+	tests := []struct {
+		name          string
+		missing       map[string]bool
+		network       *fakeNetwork
+		firmwareErr   error
+		expectedError string
+		expectedOut   []string
+	}{
+		{
+			name:    "everything available",
+			network: &fakeNetwork{running: true},
+			expectedOut: []string{
+				"qemu-system-aarch64: /usr/bin/qemu-system-aarch64",
+				"accelerator: kvm, cpu host (test)",
+				"firmware: /fw/code.fd",
+				"firmware vars template: /fw/vars.fd",
+				"Network backend: fake",
+				"status: running",
+				"No problems found",
+			},
+		},
+		{
+			name:        "missing architecture support is only a warning",
+			missing:     map[string]bool{"qemu-system-x86_64": true},
+			network:     &fakeNetwork{},
+			firmwareErr: errors.New("no firmware"),
+			expectedOut: []string{
+				"qemu-system-x86_64: not found",
+				"firmware: no firmware",
+				"status: stopped",
+				"No problems found",
+			},
+		},
+		{
+			name:          "missing tools are errors",
+			missing:       map[string]bool{"qemu-img": true, "docker": true},
+			network:       &fakeNetwork{running: true},
+			expectedError: "2 problem(s) found",
+			expectedOut:   []string{"qemu-img: not found", "docker: not found"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupMocks(t)
+			originalLookPath, originalFindFirmware, originalSelectAccelerator := lookPath, findFirmware, selectAccelerator
+			defer func() {
+				lookPath, findFirmware, selectAccelerator = originalLookPath, originalFindFirmware, originalSelectAccelerator
+			}()
+
+			lookPath = func(file string) (string, error) {
+				if tt.missing[file] {
+					return "", errors.New("not found")
+				}
+				return "/usr/bin/" + file, nil
+			}
+			findFirmware = func(arch string) (*qemu.Firmware, error) {
+				if tt.firmwareErr != nil {
+					return nil, tt.firmwareErr
+				}
+				return &qemu.Firmware{Code: "/fw/code.fd", Vars: "/fw/vars.fd"}, nil
+			}
+			selectAccelerator = func(arch string) qemu.Accelerator {
+				return qemu.Accelerator{Name: "kvm", Reason: "test"}
+			}
+			newNetworkBackend = func(*config.Config) (netbackend.Backend, error) { return tt.network, nil }
+
+			output, _, err := executeCommand(rootCmd, "doctor")
+
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("expected error to contain '%s', got '%v'", tt.expectedError, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, expected := range tt.expectedOut {
+				if !strings.Contains(output, expected) {
+					t.Errorf("expected output to contain '%s', got '%s'", expected, output)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// ipCmd represents the ip command
+var ipCmd = &cobra.Command{
+	Use:   "ip",
+	Short: "Manage the IP addresses of the VMs",
+	Long: `Manage the IP addresses of the VMs of a lab. The addresses of the target VMs
+are allocated from the subnets of the provisioner with 'vm create --ip auto',
+skipping the addresses of the other VMs and the dynamic range of the
+provisioner's DHCP server.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ipCmd)
+}
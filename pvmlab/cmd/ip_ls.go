@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"os"
+	"pvmlab/internal/config"
+	"pvmlab/internal/errors"
+	"pvmlab/internal/ipam"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+// ipLsOutput is the structured output of 'ip ls'.
+type ipLsOutput struct {
+	Pools       []*ipam.Pool      `json:"pools"`
+	Allocations []ipam.Allocation `json:"allocations"`
+}
+
+// ipLsCmd represents the ip ls command
+var ipLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "Lists the IP addresses of the VMs and their conflicts",
+	Long: `Lists the subnets of the provisioner with their DHCP ranges, and the IP
+addresses of the VMs. Addresses used by several VMs, outside of the
+provisioner's subnets or inside a DHCP range are reported as conflicts.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.New()
+		if err != nil {
+			return errors.E("ip-ls", err)
+		}
+		pools, allocations, err := ipam.List(cfg)
+		if err != nil {
+			return errors.E("ip-ls", err)
+		}
+
+		if structuredOutput() {
+			out := ipLsOutput{Pools: pools, Allocations: allocations}
+			if out.Pools == nil {
+				out.Pools = []*ipam.Pool{}
+			}
+			if out.Allocations == nil {
+				out.Allocations = []ipam.Allocation{}
+			}
+			return printStructured(cmd.OutOrStdout(), out)
+		}
+
+		if len(pools) == 0 {
+			color.Yellow("! No provisioner found, addresses can't be allocated until one is created.")
+		}
+		for _, pool := range pools {
+			color.Cyan("i Subnet %s: provisioner %s, DHCP range %s-%s", pool.Subnet, pool.Gateway, pool.DHCPStart, pool.DHCPEnd)
+		}
+		if len(allocations) == 0 {
+			color.Yellow("No VMs have been created yet.")
+			return nil
+		}
+
+		var conflicts int
+		table := tablewriter.NewWriter(os.Stdout)
+		table.Header([]string{"ADDRESS", "VM", "ROLE", "STATUS"})
+		for _, a := range allocations {
+			status := color.GreenString("ok")
+			if len(a.Conflicts) > 0 {
+				conflicts++
+				status = color.RedString(strings.Join(a.Conflicts, ", "))
+			}
+			table.Append([]string{a.Address, a.VM, a.Role, status})
+		}
+		table.Render()
+
+		if conflicts > 0 {
+			color.Yellow("! %d address(es) have conflicts.", conflicts)
+		}
+		return nil
+	},
+}
+
+func init() {
+	ipCmd.AddCommand(ipLsCmd)
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"encoding/json"
+	"pvmlab/internal/config"
+	"pvmlab/internal/metadata"
+	"strings"
+	"testing"
+)
+
+func TestIPLsCommand(t *testing.T) {
+	vms := map[string]*metadata.Metadata{
+		"provisioner": {Name: "provisioner", Role: "provisioner", IP: "192.168.100.1", Subnet: "192.168.100.0/24"},
+		"vm1":         {Name: "vm1", Role: "target", IP: "192.168.100.2"},
+		"vm2":         {Name: "vm2", Role: "target", IP: "192.168.100.2"},
+		"vm3":         {Name: "vm3", Role: "target", IP: "192.168.100.120"},
+	}
+
+	tests := []struct {
+		name        string
+		args        []string
+		vms         map[string]*metadata.Metadata
+		expectedOut []string
+	}{
+		{
+			name: "allocations and conflicts",
+			args: []string{"ip", "ls"},
+			vms:  vms,
+			expectedOut: []string{
+				"Subnet 192.168.100.0/24: provisioner 192.168.100.1, DHCP range 192.168.100.100-192.168.100.200",
+				"also used by VM 'vm2'",
+				"inside the DHCP range 192.168.100.100-192.168.100.200",
+				"3 address(es) have conflicts.",
+			},
+		},
+		{
+			name:        "no provisioner",
+			args:        []string{"ip", "ls"},
+			vms:         map[string]*metadata.Metadata{},
+			expectedOut: []string{"No provisioner found", "No VMs have been created yet."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupMocks(t)
+			metadata.GetAll = func(*config.Config) (map[string]*metadata.Metadata, error) {
+				return tt.vms, nil
+			}
+
+			output, _, err := executeCommand(rootCmd, tt.args...)
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			for _, expected := range tt.expectedOut {
+				if !strings.Contains(output, expected) {
+					t.Errorf("expected output to contain '%s', got '%s'", expected, output)
+				}
+			}
+		})
+	}
+
+	t.Run("json output", func(t *testing.T) {
+		setupMocks(t)
+		defer func() { outputFormat = outputTable }()
+		metadata.GetAll = func(*config.Config) (map[string]*metadata.Metadata, error) {
+			return vms, nil
+		}
+
+		output, _, err := executeCommand(rootCmd, "ip", "ls", "-o", "json")
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+		var got ipLsOutput
+		if err := json.Unmarshal([]byte(output), &got); err != nil {
+			t.Fatalf("failed to parse output %q: %v", output, err)
+		}
+		if len(got.Pools) != 1 || got.Pools[0].DHCPStart != "192.168.100.100" {
+			t.Errorf("unexpected pools %+v", got.Pools)
+		}
+		if len(got.Allocations) != 4 || len(got.Allocations[1].Conflicts) != 1 {
+			t.Errorf("unexpected allocations %+v", got.Allocations)
+		}
+	})
+}
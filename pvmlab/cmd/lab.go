@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"pvmlab/internal/config"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var labFile string
+
+// labName is the value of the global --lab flag.
+var labName string
+
+// labCmd represents the lab command
+var labCmd = &cobra.Command{
+	Use:   "lab",
+	Short: "Manage labs and their topology",
+	Long: `Manage labs: isolated sets of VMs, each with its own provisioner, private
+network and subnet, so that several labs can live side by side on one host.
+The VMs of a lab can also be described by a YAML topology file and applied or
+destroyed at once.
+
+The lab used by the other commands is the one given by the global --lab flag,
+or else the one selected by 'pvmlab lab switch', or else the default lab.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// runWithFlags invokes another command's RunE as if it had been called from
+// the command line with the given flags. Empty values are skipped so that the
+// command's defaults apply. The flags are reset to their defaults afterwards
+// so that the next invocation starts from a clean slate.
+func runWithFlags(c *cobra.Command, flags map[string]string, args []string) error {
+	defer func() {
+		for name := range flags {
+			if f := c.Flags().Lookup(name); f != nil {
+				resetFlag(f)
+			}
+		}
+	}()
+	for name, value := range flags {
+		if value == "" {
+			continue
+		}
+		if err := c.Flags().Set(name, value); err != nil {
+			return fmt.Errorf("failed to set --%s for '%s': %w", name, c.CommandPath(), err)
+		}
+	}
+	return c.RunE(c, args)
+}
+
+// resetFlag restores the default value of a flag. Setting a slice flag, such
+// as the repeatable --disk of 'vm create', appends to its value rather than
+// replacing it, so slice flags are emptied instead: none of them has a default.
+func resetFlag(f *pflag.Flag) {
+	if v, ok := f.Value.(pflag.SliceValue); ok {
+		_ = v.Replace(nil)
+	} else {
+		_ = f.Value.Set(f.DefValue)
+	}
+	f.Changed = false
+}
+
+// selectLab makes the lab given by the global --lab flag the one every
+// config.New call of this process (and of the commands it spawns) points to.
+func selectLab() error {
+	if labName == "" {
+		return nil
+	}
+	if err := config.ValidateLabName(labName); err != nil {
+		return err
+	}
+	return os.Setenv("PVMLAB_LAB", labName)
+}
+
+// labConfig returns a copy of cfg pointing to another lab.
+func labConfig(cfg *config.Config, name string) *config.Config {
+	labCfg := *cfg
+	labCfg.SetLabName(name)
+	return &labCfg
+}
+
+// checkLabSubnet checks that the IP addresses given in CIDR format belong to
+// the subnets of the selected lab.
+func checkLabSubnet(cfg *config.Config, addrs ...string) error {
+	lab, err := cfg.Lab()
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if addr == "" {
+			continue
+		}
+		ok, err := lab.Contains(addr)
+		if err != nil {
+			return fmt.Errorf("invalid IP/CIDR address '%s': %w", addr, err)
+		}
+		if !ok {
+			return fmt.Errorf("IP address %s is outside of the subnets of lab '%s' (%s, %s)", addr, lab.Name, lab.Subnet, lab.SubnetV6)
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(labCmd)
+	rootCmd.PersistentFlags().StringVar(&labName, "lab", "", "The lab to use instead of the current one (see 'pvmlab lab switch')")
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"pvmlab/internal/config"
+	"pvmlab/internal/errors"
+	"pvmlab/internal/metadata"
+	"pvmlab/internal/pidfile"
+	"pvmlab/internal/topology"
+	"strconv"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var labApplyWait, labApplyNoStart bool
+
+// labApplyCmd represents the lab apply command
+var labApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Creates and starts the VMs described in a topology file",
+	Long: `Reads a lab topology file and creates and starts whatever is missing.
+VMs that already exist are left untouched, so the command can be re-run safely.
+The provisioner is always created and started before the targets.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		topo, err := topology.Load(labFile)
+		if err != nil {
+			return errors.E("lab-apply", err)
+		}
+
+		cfg, err := config.New()
+		if err != nil {
+			return errors.E("lab-apply", err)
+		}
+
+		p := topo.Provisioner
+		existingProvisioner, err := metadata.FindProvisioner(cfg)
+		if err != nil {
+			return errors.E("lab-apply", fmt.Errorf("error checking for existing provisioner: %w", err))
+		}
+		switch existingProvisioner {
+		case "":
+			if err := runWithFlags(provisionerCreateCmd, map[string]string{
+				"ip":                       p.IP,
+				"ipv6":                     p.IPv6,
+				"mac":                      p.MAC,
+				"arch":                     p.Arch,
+				"disk-size":                p.DiskSize,
+				"docker-pxeboot-stack-tar": p.DockerPxebootStackTar,
+				"docker-images-path":       p.DockerImagesPath,
+				"vms-path":                 p.VMsPath,
+			}, []string{p.Name}); err != nil {
+				return errors.E("lab-apply", fmt.Errorf("failed to create provisioner '%s': %w", p.Name, err))
+			}
+		case p.Name:
+			color.Cyan("i Provisioner '%s' already exists, skipping creation.", p.Name)
+			warnOnDrift(cfg, p.Name, p.Arch, p.IP)
+		default:
+			return errors.E("lab-apply", fmt.Errorf("a different provisioner named '%s' already exists. Only one provisioner is allowed", existingProvisioner))
+		}
+
+		for _, t := range topo.Targets {
+			existingVM, err := metadata.FindVM(cfg, t.Name)
+			if err != nil {
+				return errors.E("lab-apply", fmt.Errorf("error checking for existing VM: %w", err))
+			}
+			if existingVM != "" {
+				color.Cyan("i VM '%s' already exists, skipping creation.", t.Name)
+				warnOnDrift(cfg, t.Name, t.Arch, t.IP)
+				continue
+			}
+			if err := runWithFlags(vmCreateCmd, map[string]string{
+				"ip":        t.IP,
+				"ipv6":      t.IPv6,
+				"mac":       t.MAC,
+				"arch":      t.Arch,
+				"distro":    t.Distro,
+				"disk-size": t.DiskSize,
+				"pxeboot":   strconv.FormatBool(t.PxeBoot),
+			}, []string{t.Name}); err != nil {
+				return errors.E("lab-apply", fmt.Errorf("failed to create VM '%s': %w", t.Name, err))
+			}
+		}
+
+		if labApplyNoStart {
+			color.Green("✔ Lab applied successfully (VMs not started).")
+			return nil
+		}
+
+		if err := startLabVM(cfg, p.Name); err != nil {
+			return errors.E("lab-apply", err)
+		}
+		for _, t := range topo.Targets {
+			if err := startLabVM(cfg, t.Name); err != nil {
+				return errors.E("lab-apply", err)
+			}
+		}
+
+		color.Green("✔ Lab applied successfully.")
+		return nil
+	},
+}
+
+// startLabVM starts a VM unless it is already running.
+func startLabVM(cfg *config.Config, vmName string) error {
+	running, err := pidfile.IsRunning(cfg, vmName)
+	if err != nil {
+		return fmt.Errorf("error checking status of VM '%s': %w", vmName, err)
+	}
+	if running {
+		color.Cyan("i VM '%s' is already running.", vmName)
+		return nil
+	}
+	if err := runWithFlags(vmStartCmd, map[string]string{
+		"wait": strconv.FormatBool(labApplyWait),
+	}, []string{vmName}); err != nil {
+		return fmt.Errorf("failed to start VM '%s': %w", vmName, err)
+	}
+	return nil
+}
+
+// warnOnDrift warns when an existing VM no longer matches its description in
+// the topology file. Existing VMs are never modified by apply.
+func warnOnDrift(cfg *config.Config, vmName, wantArch, wantIP string) {
+	meta, err := metadata.Load(cfg, vmName)
+	if err != nil {
+		color.Yellow("! Warning: could not load metadata for '%s': %v", vmName, err)
+		return
+	}
+	if wantArch == "" {
+		wantArch = "aarch64"
+	}
+	if meta.Arch != "" && meta.Arch != wantArch {
+		color.Yellow("! Warning: VM '%s' has arch %s but the topology specifies %s. Destroy and re-apply to change it.", vmName, meta.Arch, wantArch)
+	}
+	if parsedIP, _, err := net.ParseCIDR(wantIP); err == nil && meta.IP != "" && meta.IP != parsedIP.String() {
+		color.Yellow("! Warning: VM '%s' has IP %s but the topology specifies %s. Destroy and re-apply to change it.", vmName, meta.IP, parsedIP)
+	}
+}
+
+func init() {
+	labCmd.AddCommand(labApplyCmd)
+	labApplyCmd.Flags().StringVarP(&labFile, "file", "f", "", "Path to the lab topology file")
+	labApplyCmd.MarkFlagRequired("file")
+	labApplyCmd.Flags().BoolVar(&labApplyWait, "wait", false, "Wait for cloud-init, or the installation of PXE boot VMs, to complete on each started VM.")
+	labApplyCmd.Flags().BoolVar(&labApplyNoStart, "no-start", false, "Only create missing VMs, do not start them.")
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"pvmlab/internal/config"
+	"pvmlab/internal/metadata"
+	"pvmlab/internal/pidfile"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+const testTopology = `
+provisioner:
+  name: provisioner
+  ip: 192.168.100.1/24
+targets:
+  - name: client1
+    distro: ubuntu-24.04
+    ip: 192.168.100.2/24
+  - name: client2
+    arch: x86_64
+    distro: ubuntu-24.04
+    ip: 192.168.100.3/24
+    pxeboot: true
+`
+
+func writeTopology(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "lab.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write topology: %v", err)
+	}
+	return path
+}
+
+// mockRunE replaces the RunE of a command for the duration of a test.
+func mockRunE(t *testing.T, c *cobra.Command, fn func(cmd *cobra.Command, args []string) error) {
+	t.Helper()
+	original := c.RunE
+	c.RunE = fn
+	t.Cleanup(func() { c.RunE = original })
+}
+
+func TestLabApplyCommand(t *testing.T) {
+	type call struct {
+		cmd, vm, ip, arch string
+		pxeboot, wait     bool
+	}
+
+	tests := []struct {
+		name          string
+		args          []string
+		existing      map[string]string
+		running       map[string]bool
+		expectedCalls []call
+		expectedError string
+		expectedOut   string
+	}{
+		{
+			name: "creates and starts everything",
+			args: []string{"--wait"},
+			expectedCalls: []call{
+				{cmd: "provisioner-create", vm: "provisioner", ip: "192.168.100.1/24", arch: "aarch64"},
+				{cmd: "vm-create", vm: "client1", ip: "192.168.100.2/24", arch: "aarch64"},
+				{cmd: "vm-create", vm: "client2", ip: "192.168.100.3/24", arch: "x86_64", pxeboot: true},
+				{cmd: "vm-start", vm: "provisioner", wait: true},
+				{cmd: "vm-start", vm: "client1", wait: true},
+				{cmd: "vm-start", vm: "client2", wait: true},
+			},
+			expectedOut: "Lab applied successfully",
+		},
+		{
+			name:     "skips existing and running vms",
+			existing: map[string]string{"provisioner": "provisioner", "client1": "target"},
+			running:  map[string]bool{"provisioner": true},
+			expectedCalls: []call{
+				{cmd: "vm-create", vm: "client2", ip: "192.168.100.3/24", arch: "x86_64", pxeboot: true},
+				{cmd: "vm-start", vm: "client1"},
+				{cmd: "vm-start", vm: "client2"},
+			},
+			expectedOut: "VM 'client1' already exists, skipping creation",
+		},
+		{
+			name:        "no start",
+			args:        []string{"--no-start"},
+			existing:    map[string]string{"provisioner": "provisioner", "client1": "target", "client2": "target"},
+			expectedOut: "VMs not started",
+		},
+		{
+			name:          "different provisioner exists",
+			existing:      map[string]string{"other": "provisioner"},
+			expectedError: "a different provisioner named 'other' already exists",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupMocks(t)
+			labApplyWait, labApplyNoStart = false, false
+
+			metadata.FindProvisioner = func(*config.Config) (string, error) {
+				for name, role := range tt.existing {
+					if role == provisionerRole {
+						return name, nil
+					}
+				}
+				return "", nil
+			}
+			metadata.FindVM = func(_ *config.Config, name string) (string, error) {
+				if _, ok := tt.existing[name]; ok {
+					return name, nil
+				}
+				return "", nil
+			}
+			pidfile.IsRunning = func(_ *config.Config, name string) (bool, error) {
+				return tt.running[name], nil
+			}
+
+			var calls []call
+			mockRunE(t, provisionerCreateCmd, func(cmd *cobra.Command, args []string) error {
+				calls = append(calls, call{cmd: "provisioner-create", vm: args[0], ip: provIP, arch: provArch})
+				return nil
+			})
+			mockRunE(t, vmCreateCmd, func(cmd *cobra.Command, args []string) error {
+				calls = append(calls, call{cmd: "vm-create", vm: args[0], ip: ip, arch: arch, pxeboot: pxeboot})
+				return nil
+			})
+			mockRunE(t, vmStartCmd, func(cmd *cobra.Command, args []string) error {
+				calls = append(calls, call{cmd: "vm-start", vm: args[0], wait: wait})
+				return nil
+			})
+
+			args := append([]string{"lab", "apply", "-f", writeTopology(t, testTopology)}, tt.args...)
+			output, _, err := executeCommand(rootCmd, args...)
+
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing '%s', got '%v'", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(output, tt.expectedOut) {
+				t.Errorf("expected output to contain '%s', got '%s'", tt.expectedOut, output)
+			}
+			if len(calls) != len(tt.expectedCalls) {
+				t.Fatalf("expected calls %+v, got %+v", tt.expectedCalls, calls)
+			}
+			for i := range calls {
+				if calls[i] != tt.expectedCalls[i] {
+					t.Errorf("call %d: expected %+v, got %+v", i, tt.expectedCalls[i], calls[i])
+				}
+			}
+			// Flags must be reset to their defaults after each invocation.
+			if ip != "" || pxeboot || wait || arch != "aarch64" {
+				t.Errorf("flags were not reset: ip=%q pxeboot=%v wait=%v arch=%q", ip, pxeboot, wait, arch)
+			}
+		})
+	}
+}
+
+func TestLabApplyCommand_InvalidFile(t *testing.T) {
+	setupMocks(t)
+	_, _, err := executeCommand(rootCmd, "lab", "apply", "-f", writeTopology(t, "targets: []"))
+	if err == nil || !strings.Contains(err.Error(), "provisioner: name is required") {
+		t.Fatalf("expected validation error, got '%v'", err)
+	}
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"pvmlab/internal/config"
+	"pvmlab/internal/errors"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	labSubnet   string
+	labSubnetV6 string
+	labSwitch   bool
+)
+
+// labCreateCmd represents the lab create command
+var labCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Creates a new lab",
+	Long: `Creates a new, empty lab with its own VMs, provisioner, subnet and private network.
+
+The addresses of the lab's VMs must belong to its subnets, which default to
+192.168.<100+N>.0/24 and fd00:cafe:babe:<N>::/64, where N is the lab's index,
+and must not overlap with the subnets of the other labs.
+
+Each lab has its own private network: a bridge named pvmlab<N> on Linux, a
+socket_vmnet service named io.github.pallotron.pvmlab.socket_vmnet.<name> on
+macOS (install it with 'sudo pvmlab --lab <name> system setup-launchd').
+Images and distros are shared by all labs.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		cfg, err := config.New()
+		if err != nil {
+			return errors.E("lab-create", err)
+		}
+		lab, err := cfg.CreateLab(name, labSubnet, labSubnetV6)
+		if err != nil {
+			return errors.E("lab-create", err)
+		}
+		color.Green("✔ Lab '%s' created with subnets %s and %s.", lab.Name, lab.Subnet, lab.SubnetV6)
+
+		if labSwitch {
+			if err := cfg.SetCurrentLab(lab.Name); err != nil {
+				return errors.E("lab-create", err)
+			}
+			color.Green("✔ Switched to lab '%s'.", lab.Name)
+		} else {
+			color.Cyan("i Use it with 'pvmlab --lab %s ...' or 'pvmlab lab switch %s'.", lab.Name, lab.Name)
+		}
+		return nil
+	},
+}
+
+func init() {
+	labCmd.AddCommand(labCreateCmd)
+	labCreateCmd.Flags().StringVar(&labSubnet, "subnet", "", "The IPv4 subnet of the lab (e.g. 192.168.101.0/24)")
+	labCreateCmd.Flags().StringVar(&labSubnetV6, "subnet-v6", "", "The IPv6 subnet of the lab (e.g. fd00:cafe:babe:1::/64)")
+	labCreateCmd.Flags().BoolVar(&labSwitch, "switch", false, "Make the new lab the current one")
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"pvmlab/internal/config"
+	"pvmlab/internal/errors"
+	"pvmlab/internal/metadata"
+	"pvmlab/internal/topology"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// labDestroyCmd represents the lab destroy command
+var labDestroyCmd = &cobra.Command{
+	Use:   "destroy",
+	Short: "Stops and removes the VMs described in a topology file",
+	Long: `Stops and removes every VM described in a lab topology file.
+Targets are removed first, then the provisioner. VMs that do not exist are skipped
+and VMs that are not part of the topology are never touched.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		topo, err := topology.Load(labFile)
+		if err != nil {
+			return errors.E("lab-destroy", err)
+		}
+
+		cfg, err := config.New()
+		if err != nil {
+			return errors.E("lab-destroy", err)
+		}
+
+		names := make([]string, 0, len(topo.Targets)+1)
+		for i := len(topo.Targets) - 1; i >= 0; i-- {
+			names = append(names, topo.Targets[i].Name)
+		}
+		names = append(names, topo.Provisioner.Name)
+
+		for _, name := range names {
+			existing, err := metadata.FindVM(cfg, name)
+			if err != nil {
+				return errors.E("lab-destroy", fmt.Errorf("error checking for existing VM: %w", err))
+			}
+			if existing == "" {
+				color.Cyan("i VM '%s' does not exist, skipping.", name)
+				continue
+			}
+			if err := cleanSingleVM(name); err != nil {
+				return errors.E("lab-destroy", err)
+			}
+		}
+
+		color.Green("✔ Lab destroyed successfully.")
+		return nil
+	},
+}
+
+func init() {
+	labCmd.AddCommand(labDestroyCmd)
+	labDestroyCmd.Flags().StringVarP(&labFile, "file", "f", "", "Path to the lab topology file")
+	labDestroyCmd.MarkFlagRequired("file")
+}
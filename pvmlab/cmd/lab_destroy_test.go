@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"pvmlab/internal/config"
+	"pvmlab/internal/metadata"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestLabDestroyCommand(t *testing.T) {
+	setupMocks(t)
+
+	metadata.FindVM = func(_ *config.Config, name string) (string, error) {
+		if name == "client1" {
+			return "", nil
+		}
+		return name, nil
+	}
+	var deleted []string
+	metadata.Delete = func(_ *config.Config, name string) error {
+		deleted = append(deleted, name)
+		return nil
+	}
+	mockRunE(t, vmStopCmd, func(cmd *cobra.Command, args []string) error {
+		return nil
+	})
+
+	output, _, err := executeCommand(rootCmd, "lab", "destroy", "-f", writeTopology(t, testTopology))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"client2", "provisioner"}
+	if !reflect.DeepEqual(deleted, want) {
+		t.Errorf("expected VMs %v to be removed in order, got %v", want, deleted)
+	}
+	if !strings.Contains(output, "VM 'client1' does not exist, skipping") {
+		t.Errorf("expected missing VM to be skipped, got '%s'", output)
+	}
+	if !strings.Contains(output, "Lab destroyed successfully") {
+		t.Errorf("expected success message, got '%s'", output)
+	}
+}
+
+func TestLabDestroyCommand_LinkedClones(t *testing.T) {
+	setupMocks(t)
+
+	metadata.FindVM = func(_ *config.Config, name string) (string, error) {
+		return name, nil
+	}
+	metadata.FindClones = func(_ *config.Config, name string) ([]string, error) {
+		if name == "client2" {
+			return []string{"copy1"}, nil
+		}
+		return nil, nil
+	}
+	var deleted []string
+	metadata.Delete = func(_ *config.Config, name string) error {
+		deleted = append(deleted, name)
+		return nil
+	}
+	mockRunE(t, vmStopCmd, func(cmd *cobra.Command, args []string) error {
+		return nil
+	})
+
+	_, _, err := executeCommand(rootCmd, "lab", "destroy", "-f", writeTopology(t, testTopology))
+	if err == nil || !strings.Contains(err.Error(), "linked clones copy1") {
+		t.Fatalf("expected the linked clones to be reported, got %v", err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("expected no VM to be removed, got %v", deleted)
+	}
+}
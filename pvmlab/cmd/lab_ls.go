@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"os"
+	"pvmlab/internal/config"
+	"pvmlab/internal/errors"
+	"pvmlab/internal/metadata"
+	"pvmlab/internal/pidfile"
+	"strconv"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+// labLsEntry is a lab in the structured output of 'lab ls'.
+type labLsEntry struct {
+	*config.Lab
+	Current bool `json:"current"`
+	VMs     int  `json:"vms"`
+	Running int  `json:"running"`
+}
+
+// labLsCmd represents the lab ls command
+var labLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "Lists the labs",
+	Long: `Lists the labs with their subnets and number of VMs. The lab used by the
+other commands is marked as current.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.New()
+		if err != nil {
+			return errors.E("lab-ls", err)
+		}
+		labs, err := cfg.ListLabs()
+		if err != nil {
+			return errors.E("lab-ls", err)
+		}
+
+		entries := make([]labLsEntry, 0, len(labs))
+		for _, lab := range labs {
+			entry := labLsEntry{Lab: lab, Current: lab.Name == cfg.LabName()}
+			labCfg := labConfig(cfg, lab.Name)
+			allMeta, err := metadata.GetAll(labCfg)
+			if err != nil {
+				return errors.E("lab-ls", err)
+			}
+			entry.VMs = len(allMeta)
+			for name := range allMeta {
+				if running, _ := pidfile.IsRunning(labCfg, name); running {
+					entry.Running++
+				}
+			}
+			entries = append(entries, entry)
+		}
+
+		if structuredOutput() {
+			return printStructured(cmd.OutOrStdout(), entries)
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.Header([]string{"NAME", "SUBNET", "SUBNET V6", "VMS", "RUNNING"})
+		for _, entry := range entries {
+			name := entry.Name
+			if entry.Current {
+				name = color.GreenString("* " + name)
+			}
+			subnet, subnetV6 := entry.Subnet, entry.SubnetV6
+			if subnet == "" {
+				subnet = "any"
+			}
+			if subnetV6 == "" {
+				subnetV6 = "any"
+			}
+			table.Append([]string{name, subnet, subnetV6, strconv.Itoa(entry.VMs), strconv.Itoa(entry.Running)})
+		}
+		table.Render()
+		return nil
+	},
+}
+
+func init() {
+	labCmd.AddCommand(labLsCmd)
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"pvmlab/internal/config"
+	"pvmlab/internal/errors"
+	"pvmlab/internal/metadata"
+	"pvmlab/internal/pidfile"
+	"sort"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// labRmCmd represents the lab rm command
+var labRmCmd = &cobra.Command{
+	Use:   "rm <name>",
+	Short: "Removes a lab and all its VMs",
+	Long: `Removes a lab: the disks, metadata and logs of all its VMs, and its private
+network. The VMs of the lab must be stopped first. The default lab can't be
+removed, use 'pvmlab clean' instead. If the lab was the current one, the
+default lab becomes current.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: LabNameCompleter,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		cfg, err := config.New()
+		if err != nil {
+			return errors.E("lab-rm", err)
+		}
+		if name == config.DefaultLab {
+			return errors.E("lab-rm", fmt.Errorf("the default lab can't be removed, use 'pvmlab clean' instead"))
+		}
+		if _, err := cfg.LoadLab(name); err != nil {
+			return errors.E("lab-rm", err)
+		}
+
+		labCfg := labConfig(cfg, name)
+		allMeta, err := metadata.GetAll(labCfg)
+		if err != nil {
+			return errors.E("lab-rm", fmt.Errorf("error getting VM list: %w", err))
+		}
+		var running []string
+		for vmName := range allMeta {
+			if ok, _ := pidfile.IsRunning(labCfg, vmName); ok {
+				running = append(running, vmName)
+			}
+		}
+		if len(running) > 0 {
+			sort.Strings(running)
+			return errors.E("lab-rm", fmt.Errorf("lab '%s' has running VMs: %v. Stop them with 'pvmlab --lab %s vm stop <name>' first", name, running, name))
+		}
+
+		// Release the host side of the lab's network, e.g. its bridge and
+		// the TAP devices of its VMs.
+		network, err := newNetworkBackend(labCfg)
+		if err != nil {
+			color.Yellow("! Warning: could not determine the network backend: %v", err)
+		} else {
+			for vmName := range allMeta {
+				if err := network.ReleaseVM(vmName); err != nil {
+					color.Yellow("! Warning: could not release network resources for %s: %v", vmName, err)
+				}
+			}
+			if running, err := network.IsRunning(); err == nil && running {
+				color.Cyan("i Tearing down %s network of lab '%s'...", network.Name(), name)
+				if err := network.Teardown(); err != nil {
+					color.Yellow("! Warning: could not tear down the %s network: %v", network.Name(), err)
+				}
+			}
+		}
+
+		if err := cfg.RemoveLab(name); err != nil {
+			return errors.E("lab-rm", err)
+		}
+		color.Green("✔ Lab '%s' removed.", name)
+		return nil
+	},
+}
+
+func init() {
+	labCmd.AddCommand(labRmCmd)
+}
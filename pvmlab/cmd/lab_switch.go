@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"pvmlab/internal/config"
+	"pvmlab/internal/errors"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// labSwitchCmd represents the lab switch command
+var labSwitchCmd = &cobra.Command{
+	Use:               "switch <name>",
+	Short:             "Makes a lab the current one",
+	Long:              `Makes a lab the current one, used by the other commands when --lab is not given.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: LabNameCompleter,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		cfg, err := config.New()
+		if err != nil {
+			return errors.E("lab-switch", err)
+		}
+		if err := cfg.SetCurrentLab(name); err != nil {
+			return errors.E("lab-switch", err)
+		}
+		color.Green("✔ Switched to lab '%s'.", name)
+		return nil
+	},
+}
+
+func init() {
+	labCmd.AddCommand(labSwitchCmd)
+}
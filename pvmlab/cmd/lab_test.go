@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"encoding/json"
+	"pvmlab/internal/config"
+	"pvmlab/internal/metadata"
+	"pvmlab/internal/netbackend"
+	"pvmlab/internal/pidfile"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestLabCommands(t *testing.T) {
+	setupMocks(t)
+	network := &fakeNetwork{running: true}
+	var networkLab string
+	newNetworkBackend = func(cfg *config.Config) (netbackend.Backend, error) {
+		networkLab = cfg.LabName()
+		return network, nil
+	}
+	// Each lab has one VM, named after it.
+	metadata.GetAll = func(cfg *config.Config) (map[string]*metadata.Metadata, error) {
+		name := cfg.LabName() + "-vm"
+		return map[string]*metadata.Metadata{name: {Name: name}}, nil
+	}
+
+	output, _, err := executeCommand(rootCmd, "lab", "create", "fedora")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(output, "Lab 'fedora' created with subnets 192.168.101.0/24 and fd00:cafe:babe:1::/64") {
+		t.Errorf("unexpected output: %s", output)
+	}
+	if _, _, err := executeCommand(rootCmd, "lab", "create", "fedora"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected an already exists error, got %v", err)
+	}
+
+	if _, _, err := executeCommand(rootCmd, "lab", "switch", "fedora"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg, _ := config.New()
+	if cfg.CurrentLab() != "fedora" {
+		t.Errorf("expected 'fedora' to be the current lab, got '%s'", cfg.CurrentLab())
+	}
+
+	output, _, err = executeCommand(rootCmd, "--lab", "fedora", "lab", "ls", "-o", "json")
+	outputFormat = outputTable
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var entries []labLsEntry
+	if err := json.Unmarshal([]byte(output), &entries); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, output)
+	}
+	if len(entries) != 2 || entries[0].Name != config.DefaultLab || entries[1].Name != "fedora" {
+		t.Fatalf("unexpected labs: %s", output)
+	}
+	if entries[0].Current || !entries[1].Current || entries[1].VMs != 1 || entries[1].Subnet != "192.168.101.0/24" {
+		t.Errorf("unexpected labs: %s", output)
+	}
+
+	if _, _, err := executeCommand(rootCmd, "lab", "rm", config.DefaultLab); err == nil || !strings.Contains(err.Error(), "can't be removed") {
+		t.Errorf("expected the default lab not to be removable, got %v", err)
+	}
+	output, _, err = executeCommand(rootCmd, "lab", "rm", "fedora")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(output, "Lab 'fedora' removed") {
+		t.Errorf("unexpected output: %s", output)
+	}
+	if networkLab != "fedora" || strings.Join(network.released, ",") != "fedora-vm" || strings.Join(network.calls, ",") != "teardown" {
+		t.Errorf("expected the network of the lab to be released, got lab '%s', %v, %v", networkLab, network.released, network.calls)
+	}
+	if cfg.CurrentLab() != config.DefaultLab {
+		t.Errorf("expected the default lab to be current again, got '%s'", cfg.CurrentLab())
+	}
+	if _, _, err := executeCommand(rootCmd, "lab", "switch", "fedora"); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("expected a missing lab error, got %v", err)
+	}
+}
+
+func TestLabRmCommand_RunningVMs(t *testing.T) {
+	setupMocks(t)
+	cfg, _ := config.New()
+	if _, err := cfg.CreateLab("fedora", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	metadata.GetAll = func(*config.Config) (map[string]*metadata.Metadata, error) {
+		return map[string]*metadata.Metadata{"prov": {Name: "prov"}}, nil
+	}
+	pidfile.IsRunning = func(*config.Config, string) (bool, error) { return true, nil }
+
+	_, _, err := executeCommand(rootCmd, "lab", "rm", "fedora")
+	if err == nil || !strings.Contains(err.Error(), "lab 'fedora' has running VMs: [prov]") {
+		t.Errorf("expected a running VMs error, got %v", err)
+	}
+}
+
+func TestLabFlag(t *testing.T) {
+	setupMocks(t)
+	cfg, _ := config.New()
+	if _, err := cfg.CreateLab("fedora", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := executeCommand(rootCmd, "--lab", "Not_Valid", "vm", "list"); err == nil || !strings.Contains(err.Error(), "invalid lab name") {
+		t.Errorf("expected an invalid lab name error, got %v", err)
+	}
+
+	// The addresses of the VMs must belong to the subnets of the lab.
+	_, _, err := executeCommand(rootCmd, "--lab", "fedora", "provisioner", "create", "prov", "--ip", "192.168.100.1/24")
+	if err == nil || !strings.Contains(err.Error(), "IP address 192.168.100.1/24 is outside of the subnets of lab 'fedora'") {
+		t.Errorf("expected an out of subnet error, got %v", err)
+	}
+}
+
+func TestRunWithFlags_ResetsFlags(t *testing.T) {
+	var name string
+	var disks, seen []string
+	c := &cobra.Command{
+		Use: "test",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			seen = append([]string{name}, disks...)
+			return nil
+		},
+	}
+	c.Flags().StringVar(&name, "name", "default", "")
+	c.Flags().StringArrayVar(&disks, "disk", nil, "")
+
+	// Each invocation starts from the defaults, including the repeatable
+	// flags.
+	for range 2 {
+		if err := runWithFlags(c, map[string]string{"name": "vm1", "disk": "10G"}, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := []string{"vm1", "10G"}; !reflect.DeepEqual(seen, want) {
+			t.Errorf("expected the command to see %v, got %v", want, seen)
+		}
+		if name != "default" || len(disks) != 0 {
+			t.Errorf("expected the flags to be reset, got --name %q and --disk %v", name, disks)
+		}
+	}
+}
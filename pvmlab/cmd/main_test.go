@@ -3,17 +3,22 @@ package cmd
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"io"
 	"os"
 	"pvmlab/internal/cloudinit"
 	"pvmlab/internal/config"
 	"pvmlab/internal/downloader"
 	"pvmlab/internal/metadata"
+	"pvmlab/internal/netbackend"
 	"pvmlab/internal/netutil"
 	"pvmlab/internal/pidfile"
+	"pvmlab/internal/qmp"
 	"pvmlab/internal/socketvmnet"
 	"pvmlab/internal/ssh"
+	"pvmlab/internal/util"
 	"testing"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
@@ -66,17 +71,30 @@ func TestMain(m *testing.M) {
 	originalCreateDisk := createDisk
 	originalCreateISO := createISO
 	originalCloudInitCreateISO := cloudinit.CreateISO
-	originalMetadataSave := metadata.Save
 	originalMetadataLoad := metadata.Load
 	originalMetadataFindProvisioner := metadata.FindProvisioner
 	originalMetadataFindVM := metadata.FindVM
 	originalMetadataGetAll := metadata.GetAll
 	originalMetadataDelete := metadata.Delete
+	originalMetadataWrite := metadata.Write
+	originalMetadataUpdate := metadata.Update
+	originalMetadataCreate := metadata.Create
+	originalMetadataCheck := metadata.Check
+	originalMetadataFindClones := metadata.FindClones
 	originalSSHGenerateKey := ssh.GenerateKey
 	originalSocketVmnetIsSocketVmnetRunning := socketvmnet.IsSocketVmnetRunning
 	originalPidfileIsRunning := pidfile.IsRunning
 	originalNetutilFindRandomPort := netutil.FindRandomPort
 	originalPidfileRead := pidfile.Read
+	originalPidfileStartTime := pidfile.StartTime
+	originalNewNetworkBackend := newNetworkBackend
+	originalCreateFirmwareStore := createFirmwareStore
+	originalQMPRun := qmp.Run
+	originalQMPQueryStatus := qmp.QueryStatus
+	originalQMPPowerdown := qmp.Powerdown
+	originalQMPRequestPowerdown := qmp.RequestPowerdown
+	originalStartVMProcess := startVMProcess
+	originalFetchVirtualMedia := fetchVirtualMedia
 
 	// Defer restoration of original functions
 	defer func() {
@@ -85,17 +103,30 @@ func TestMain(m *testing.M) {
 		createDisk = originalCreateDisk
 		createISO = originalCreateISO
 		cloudinit.CreateISO = originalCloudInitCreateISO
-		metadata.Save = originalMetadataSave
 		metadata.Load = originalMetadataLoad
 		metadata.FindProvisioner = originalMetadataFindProvisioner
 		metadata.FindVM = originalMetadataFindVM
 		metadata.GetAll = originalMetadataGetAll
 		metadata.Delete = originalMetadataDelete
+		metadata.Write = originalMetadataWrite
+		metadata.Update = originalMetadataUpdate
+		metadata.Create = originalMetadataCreate
+		metadata.Check = originalMetadataCheck
+		metadata.FindClones = originalMetadataFindClones
 		ssh.GenerateKey = originalSSHGenerateKey
 		socketvmnet.IsSocketVmnetRunning = originalSocketVmnetIsSocketVmnetRunning
 		pidfile.IsRunning = originalPidfileIsRunning
 		netutil.FindRandomPort = originalNetutilFindRandomPort
 		pidfile.Read = originalPidfileRead
+		pidfile.StartTime = originalPidfileStartTime
+		newNetworkBackend = originalNewNetworkBackend
+		createFirmwareStore = originalCreateFirmwareStore
+		qmp.Run = originalQMPRun
+		qmp.QueryStatus = originalQMPQueryStatus
+		qmp.Powerdown = originalQMPPowerdown
+		qmp.RequestPowerdown = originalQMPRequestPowerdown
+		startVMProcess = originalStartVMProcess
+		fetchVirtualMedia = originalFetchVirtualMedia
 	}()
 
 	// Run tests
@@ -105,9 +136,15 @@ func TestMain(m *testing.M) {
 // setupMocks resets all mocks to default successful behavior and configures a temporary app directory.
 func setupMocks(t *testing.T) {
 	tempDir := t.TempDir()
+	// The global --lab flag keeps its value across executions.
+	labName = ""
+	t.Setenv("PVMLAB_LAB", "")
 	config.New = func() (*config.Config, error) {
 		cfg := &config.Config{}
 		cfg.SetHomeDir(tempDir)
+		if lab := os.Getenv("PVMLAB_LAB"); lab != "" {
+			cfg.SetLabName(lab)
+		}
 		// Manually populate Distros for testing
 		config.Distros = map[string]config.Distro{
 			"ubuntu-24.04": {
@@ -130,7 +167,7 @@ func setupMocks(t *testing.T) {
 		return cfg, nil
 	}
 	downloader.DownloadImageIfNotExists = func(ctx context.Context, imagePath, imageUrl string) error {
-		return nil
+		return os.WriteFile(imagePath, []byte(imageUrl), 0644)
 	}
 	createDisk = func(ctx context.Context, imagePath, vmDiskPath, diskSize string) error {
 		return nil
@@ -141,9 +178,6 @@ func setupMocks(t *testing.T) {
 	cloudinit.CreateISO = func(ctx context.Context, vmName, role, appDir, isoPath, ip, ipv6, mac, tar, image string) error {
 		return nil
 	}
-	metadata.Save = func(*config.Config, string, string, string, string, string, string, string, string, string, string, string, string, string, string, int, bool, string) error {
-		return nil
-	}
 	metadata.Load = func(*config.Config, string) (*metadata.Metadata, error) {
 		return &metadata.Metadata{}, nil
 	}
@@ -159,6 +193,39 @@ func setupMocks(t *testing.T) {
 	metadata.Delete = func(*config.Config, string) error {
 		return nil
 	}
+	metadata.Write = func(*config.Config, *metadata.Metadata) error {
+		return nil
+	}
+	// Update and Create go through the Load and Write mocks, so that tests
+	// only need to mock those.
+	metadata.Update = func(cfg *config.Config, vmName string, fn func(*metadata.Metadata) error) (*metadata.Metadata, error) {
+		meta, err := metadata.Load(cfg, vmName)
+		if err != nil {
+			return nil, err
+		}
+		if err := fn(meta); err != nil {
+			return nil, err
+		}
+		return meta, metadata.Write(cfg, meta)
+	}
+	metadata.Create = func(cfg *config.Config, meta *metadata.Metadata, allocate func(map[string]*metadata.Metadata) error) error {
+		if allocate != nil {
+			allMeta, err := metadata.GetAll(cfg)
+			if err != nil {
+				return err
+			}
+			if err := allocate(allMeta); err != nil {
+				return err
+			}
+		}
+		return metadata.Write(cfg, meta)
+	}
+	metadata.Check = func(*config.Config, bool) ([]metadata.Problem, error) {
+		return nil, nil // The store is consistent by default
+	}
+	metadata.FindClones = func(*config.Config, string) ([]string, error) {
+		return nil, nil // No VM has linked clones by default
+	}
 	ssh.GenerateKey = func(keyPath string) error {
 		// Create a dummy public key file in the temp directory
 		pubKeyPath := keyPath + ".pub"
@@ -167,7 +234,7 @@ func setupMocks(t *testing.T) {
 		}
 		return nil
 	}
-	socketvmnet.IsSocketVmnetRunning = func() (bool, error) {
+	socketvmnet.IsSocketVmnetRunning = func(string) (bool, error) {
 		return true, nil
 	}
 	pidfile.IsRunning = func(c *config.Config, name string) (bool, error) {
@@ -179,4 +246,31 @@ func setupMocks(t *testing.T) {
 	pidfile.Read = func(c *config.Config, name string) (int, error) {
 		return 0, os.ErrNotExist
 	}
+	pidfile.StartTime = func(c *config.Config, name string) (time.Time, error) {
+		return time.Time{}, os.ErrNotExist
+	}
+	newNetworkBackend = func(*config.Config) (netbackend.Backend, error) {
+		return netbackend.NewSocketVmnet(), nil
+	}
+	createFirmwareStore = func(src, dst string) error {
+		return util.CopyFile(src, dst, 0644)
+	}
+	qmp.Run = func(socketPath, command string, args any, timeout time.Duration) (json.RawMessage, error) {
+		return json.RawMessage("{}"), nil
+	}
+	qmp.QueryStatus = func(socketPath string, timeout time.Duration) (*qmp.Status, error) {
+		return &qmp.Status{Status: "running", Running: true}, nil
+	}
+	qmp.Powerdown = func(socketPath string, timeout time.Duration) error {
+		return nil
+	}
+	qmp.RequestPowerdown = func(socketPath string, timeout time.Duration) error {
+		return nil
+	}
+	startVMProcess = func(vmName, boot string) error {
+		return nil
+	}
+	fetchVirtualMedia = func(ctx context.Context, image, dst string) error {
+		return nil
+	}
 }
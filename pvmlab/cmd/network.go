@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// networkCmd represents the network command
+var networkCmd = &cobra.Command{
+	Use:   "network",
+	Short: "Manage the private lab network",
+	Long: `Manage the host side of the private lab network.
+On macOS the network is provided by the socket_vmnet service, on Linux by a bridge
+with one TAP device per VM. Set PVMLAB_NETWORK_BACKEND to 'socket_vmnet' or 'bridge'
+to override the platform default.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(networkCmd)
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"pvmlab/internal/config"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// networkSetupCmd represents the network setup command
+var networkSetupCmd = &cobra.Command{
+	Use:   "setup",
+	Short: "Brings the private lab network up",
+	Long:  `Brings the private lab network up: starts the socket_vmnet service on macOS, creates the bridge on Linux.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.New()
+		if err != nil {
+			return err
+		}
+		network, err := newNetworkBackend(cfg)
+		if err != nil {
+			return err
+		}
+		color.Cyan("i Setting up %s network... (this may require sudo password)", network.Name())
+		if err := network.Setup(); err != nil {
+			return err
+		}
+		color.Green("✔ %s network is up.", network.Name())
+		return nil
+	},
+}
+
+func init() {
+	networkCmd.AddCommand(networkSetupCmd)
+}
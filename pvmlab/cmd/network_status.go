@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"pvmlab/internal/config"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// networkStatusCmd represents the network status command
+var networkStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Checks the status of the private lab network",
+	Long:  `Checks whether the private lab network is up.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.New()
+		if err != nil {
+			return err
+		}
+		network, err := newNetworkBackend(cfg)
+		if err != nil {
+			return err
+		}
+		running, err := network.IsRunning()
+		if err != nil {
+			return err
+		}
+
+		if structuredOutput() {
+			return printStructured(cmd.OutOrStdout(), serviceStatus{Name: network.Name(), Running: running})
+		}
+
+		if running {
+			color.Green("✔ %s network is running.", network.Name())
+		} else {
+			color.Yellow("i %s network is stopped.", network.Name())
+		}
+		return nil
+	},
+}
+
+func init() {
+	networkCmd.AddCommand(networkStatusCmd)
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"pvmlab/internal/config"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// networkTeardownCmd represents the network teardown command
+var networkTeardownCmd = &cobra.Command{
+	Use:   "teardown",
+	Short: "Tears the private lab network down",
+	Long:  `Tears the private lab network down: stops the socket_vmnet service on macOS, deletes the bridge on Linux.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.New()
+		if err != nil {
+			return err
+		}
+		network, err := newNetworkBackend(cfg)
+		if err != nil {
+			return err
+		}
+		color.Cyan("i Tearing down %s network... (this may require sudo password)", network.Name())
+		if err := network.Teardown(); err != nil {
+			return err
+		}
+		color.Green("✔ %s network is down.", network.Name())
+		return nil
+	},
+}
+
+func init() {
+	networkCmd.AddCommand(networkTeardownCmd)
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"errors"
+	"pvmlab/internal/config"
+	"pvmlab/internal/netbackend"
+	"strings"
+	"testing"
+)
+
+// fakeNetwork is a network backend recording the calls made to it.
+type fakeNetwork struct {
+	netbackend.SocketVmnet
+	running  bool
+	err      error
+	calls    []string
+	released []string
+}
+
+func (f *fakeNetwork) Name() string { return "fake" }
+
+func (f *fakeNetwork) Setup() error {
+	f.calls = append(f.calls, "setup")
+	return f.err
+}
+
+func (f *fakeNetwork) Teardown() error {
+	f.calls = append(f.calls, "teardown")
+	return f.err
+}
+
+func (f *fakeNetwork) IsRunning() (bool, error) {
+	return f.running, f.err
+}
+
+func (f *fakeNetwork) ReleaseVM(vmName string) error {
+	f.released = append(f.released, vmName)
+	return nil
+}
+
+func TestNetworkCommands(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		network       *fakeNetwork
+		expectedCalls []string
+		expectedError string
+		expectedOut   string
+	}{
+		{
+			name:          "setup",
+			args:          []string{"network", "setup"},
+			network:       &fakeNetwork{},
+			expectedCalls: []string{"setup"},
+			expectedOut:   "fake network is up",
+		},
+		{
+			name:          "setup fails",
+			args:          []string{"network", "setup"},
+			network:       &fakeNetwork{err: errors.New("permission denied")},
+			expectedCalls: []string{"setup"},
+			expectedError: "permission denied",
+		},
+		{
+			name:          "teardown",
+			args:          []string{"network", "teardown"},
+			network:       &fakeNetwork{},
+			expectedCalls: []string{"teardown"},
+			expectedOut:   "fake network is down",
+		},
+		{
+			name:        "status running",
+			args:        []string{"network", "status"},
+			network:     &fakeNetwork{running: true},
+			expectedOut: "fake network is running",
+		},
+		{
+			name:        "status stopped",
+			args:        []string{"network", "status"},
+			network:     &fakeNetwork{},
+			expectedOut: "fake network is stopped",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupMocks(t)
+			newNetworkBackend = func(*config.Config) (netbackend.Backend, error) { return tt.network, nil }
+
+			output, _, err := executeCommand(rootCmd, tt.args...)
+
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("expected error to contain '%s', got '%v'", tt.expectedError, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(output, tt.expectedOut) {
+				t.Errorf("expected output to contain '%s', got '%s'", tt.expectedOut, output)
+			}
+			if strings.Join(tt.network.calls, ",") != strings.Join(tt.expectedCalls, ",") {
+				t.Errorf("expected calls %v, got %v", tt.expectedCalls, tt.network.calls)
+			}
+		})
+	}
+}
+
+func TestNetworkCommand_UnknownBackend(t *testing.T) {
+	setupMocks(t)
+	t.Setenv("PVMLAB_NETWORK_BACKEND", "carrier-pigeon")
+	newNetworkBackend = labNetworkBackend
+
+	_, _, err := executeCommand(rootCmd, "network", "status")
+	if err == nil || !strings.Contains(err.Error(), "unknown network backend 'carrier-pigeon'") {
+		t.Errorf("expected unknown backend error, got '%v'", err)
+	}
+}
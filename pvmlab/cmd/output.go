@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/fatih/color"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats of the list and status commands.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// serviceStatus is the structured output of the status commands of
+// services, e.g. 'socket_vmnet status'.
+type serviceStatus struct {
+	Name    string `json:"name"`
+	Running bool   `json:"running"`
+}
+
+// outputFormat is the value of the global --output flag.
+var outputFormat = outputTable
+
+func validateOutputFormat() error {
+	switch outputFormat {
+	case outputTable, outputJSON, outputYAML:
+		return nil
+	default:
+		return fmt.Errorf("invalid --output value: %s. Must be 'table', 'json' or 'yaml'", outputFormat)
+	}
+}
+
+// structuredOutput returns whether the output is machine-readable, in which
+// case commands must not print anything else to stdout.
+func structuredOutput() bool {
+	return outputFormat == outputJSON || outputFormat == outputYAML
+}
+
+// warnf prints a warning in yellow, to w, usually the stderr of the command,
+// when the output is structured so that it doesn't corrupt it.
+func warnf(w io.Writer, format string, a ...any) {
+	if structuredOutput() {
+		fmt.Fprintln(w, color.YellowString(format, a...))
+		return
+	}
+	color.Yellow(format, a...)
+}
+
+// printStructured writes v to w in the JSON or YAML output format. The YAML
+// output uses the same field names as the JSON output.
+func printStructured(w io.Writer, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if outputFormat == outputJSON {
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+
+	// JSON is valid YAML, so parsing it keeps the JSON field names and order.
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	resetYAMLStyle(&node)
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// resetYAMLStyle drops the flow and quoting styles of nodes parsed from
+// JSON, so that they are written in the usual block style.
+func resetYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetYAMLStyle(child)
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputTable, "Output format of the list and status commands: table, json or yaml")
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrintStructured(t *testing.T) {
+	defer func() { outputFormat = outputTable }()
+
+	v := []struct {
+		Name    string   `json:"name"`
+		Version string   `json:"version"`
+		Running bool     `json:"running"`
+		Disks   []string `json:"disks,omitempty"`
+	}{
+		{Name: "vm1", Version: "24.04", Running: true, Disks: []string{"data1"}},
+	}
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format: outputJSON,
+			expected: `[
+  {
+    "name": "vm1",
+    "version": "24.04",
+    "running": true,
+    "disks": [
+      "data1"
+    ]
+  }
+]
+`,
+		},
+		{
+			format: outputYAML,
+			expected: `- name: vm1
+  version: "24.04"
+  running: true
+  disks:
+    - data1
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			outputFormat = tt.format
+			var buf bytes.Buffer
+			if err := printStructured(&buf, v); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestOutputFlagValidation(t *testing.T) {
+	setupMocks(t)
+	defer func() { outputFormat = outputTable }()
+
+	_, _, err := executeCommand(rootCmd, "vm", "list", "--output", "xml")
+	if err == nil || err.Error() != "invalid --output value: xml. Must be 'table', 'json' or 'yaml'" {
+		t.Errorf("expected an invalid output error, got %v", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"pvmlab/internal/cache"
 	"pvmlab/internal/cloudinit"
 	"pvmlab/internal/config"
 	"pvmlab/internal/downloader"
@@ -15,6 +16,7 @@ import (
 	"pvmlab/internal/netutil"
 	"pvmlab/internal/ssh"
 	"syscall"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
@@ -22,7 +24,8 @@ import (
 
 var (
 	provIP, provIPv6, provMAC, provPxebootStackTar, provDockerImagesPath string
-	provVMsPath, provDiskSize, provArch                                 string
+	provVMsPath, provDiskSize, provArch                                  string
+	provResourceFlags                                                    vmResources
 )
 
 // provisionerCreateCmd represents the create command
@@ -55,21 +58,28 @@ var provisionerCreateCmd = &cobra.Command{
 			return errors.E("provisioner-create", fmt.Errorf("--ip must be specified for the provisioner VM"))
 		}
 
+		if err := provResourceFlags.validate(cmd); err != nil {
+			return errors.E("provisioner-create", err)
+		}
+
 		cfg, err := config.New()
 		if err != nil {
 			return errors.E("provisioner-create", err)
 		}
 		appDir := cfg.GetAppDir()
 
-		if err := createDirectories(appDir); err != nil {
+		if err := createDirectories(cfg); err != nil {
 			return errors.E("provisioner-create", fmt.Errorf("failed to create app directories: %w", err))
 		}
 
+		if err := checkLabSubnet(cfg, provIP, provIPv6); err != nil {
+			return errors.E("provisioner-create", err)
+		}
 		if err := metadata.CheckForDuplicateIPs(cfg, provIP, provIPv6); err != nil {
 			return errors.E("provisioner-create", err)
 		}
 
-		finalDockerImagesPath, err := resolvePath(provDockerImagesPath, filepath.Join(appDir, "docker_images"))
+		finalDockerImagesPath, err := resolvePath(provDockerImagesPath, filepath.Join(cfg.GetSharedDir(), "docker_images"))
 		if err != nil {
 			return errors.E("provisioner-create", err)
 		}
@@ -92,15 +102,32 @@ var provisionerCreateCmd = &cobra.Command{
 					return errors.E("provisioner-create", fmt.Errorf("failed to create docker images directory: %w", err))
 				}
 				destTarPath := filepath.Join(finalDockerImagesPath, filepath.Base(absTarPath))
+				// The previous tarball may be a link to the cached one.
+				if err := os.Remove(destTarPath); err != nil && !os.IsNotExist(err) {
+					return errors.E("provisioner-create", fmt.Errorf("failed to remove previous pxeboot stack tar file: %w", err))
+				}
 				if err := copyFile(absTarPath, destTarPath); err != nil {
 					return errors.E("provisioner-create", fmt.Errorf("failed to copy pxeboot stack tar file: %w", err))
 				}
 				// Set the tarball name to be passed to the script
 				provPxebootStackTar = filepath.Base(absTarPath)
+				// Cache the tarball for the next provisioners, e.g. offline.
+				if _, err := cache.Open(cfg).Add(cache.Entry{Key: cache.PxeBootStackKey, Kind: cache.KindContainer}, destTarPath); err != nil {
+					color.Yellow("! Failed to add the pxeboot stack tarball to the cache: %v", err)
+				}
 			} else {
 				// The flag was used but the file doesn't exist. This is an error.
 				return errors.E("provisioner-create", fmt.Errorf("specified --docker-pxeboot-stack-tar not found at %s", absTarPath))
 			}
+		} else if entry, err := cache.Open(cfg).Lookup(cache.PxeBootStackKey); err == nil && entry != nil {
+			color.Cyan("i Using the cached pxeboot stack tarball %s (added on %s).", entry.Name, entry.AddedAt.Local().Format(time.DateOnly))
+			if err := os.MkdirAll(finalDockerImagesPath, 0755); err != nil {
+				return errors.E("provisioner-create", fmt.Errorf("failed to create docker images directory: %w", err))
+			}
+			if err := cache.Open(cfg).Place(entry, filepath.Join(finalDockerImagesPath, entry.Name)); err != nil {
+				return errors.E("provisioner-create", err)
+			}
+			provPxebootStackTar = entry.Name
 		} else {
 			// The flag was not used. Set the tarball name to empty so the script inside the VM will pull from the registry.
 			color.Cyan("i No local docker tarball specified. Provisioner will pull latest image from registry.")
@@ -127,11 +154,16 @@ var provisionerCreateCmd = &cobra.Command{
 
 		vmDiskPath := filepath.Join(appDir, "vms", vmName+".qcow2")
 		imageUrl, imageName := config.GetProvisionerImageURL(provArch)
-		imagePath := filepath.Join(appDir, "images", imageName)
-		if err := downloader.DownloadImageIfNotExists(ctx, imagePath, imageUrl); err != nil {
+		imagePath := filepath.Join(cfg.GetSharedDir(), "images", imageName)
+		c := cache.Open(cfg)
+		if err := c.Download(ctx, imagePath, imageUrl, downloader.Verification{}); err != nil {
 			return errors.E("provisioner-create", err)
 		}
-		if err := createDisk(ctx, imagePath, vmDiskPath, provDiskSize); err != nil {
+		baseImage, err := c.BaseImage(imageUrl, imagePath)
+		if err != nil {
+			return errors.E("provisioner-create", fmt.Errorf("failed to add the image to the cache: %w", err))
+		}
+		if err := createDisk(ctx, c.BlobPath(baseImage), vmDiskPath, provDiskSize); err != nil {
 			return errors.E("provisioner-create", err)
 		}
 		isoPath := filepath.Join(appDir, "configs", "cloud-init", vmName+".iso")
@@ -169,7 +201,26 @@ var provisionerCreateCmd = &cobra.Command{
 			return errors.E("provisioner-create", fmt.Errorf("could not find an available SSH port: %w", err))
 		}
 
-		if err := metadata.Save(cfg, vmName, provisionerRole, provArch, ipForMetadata, subnetForMetadata, ipv6ForMetadata, subnetv6ForMetadata, macForMetadata, provPxebootStackTar, finalDockerImagesPath, finalVMsPath, string(sshPubKey), "", "", sshPort, false, ""); err != nil {
+		meta := &metadata.Metadata{
+			Name:             vmName,
+			Role:             provisionerRole,
+			Arch:             provArch,
+			IP:               ipForMetadata,
+			Subnet:           subnetForMetadata,
+			IPv6:             ipv6ForMetadata,
+			SubnetV6:         subnetv6ForMetadata,
+			MAC:              macForMetadata,
+			PxeBootStackTar:  provPxebootStackTar,
+			DockerImagesPath: finalDockerImagesPath,
+			VMsPath:          finalVMsPath,
+			SSHKey:           string(sshPubKey),
+			SSHPort:          sshPort,
+			BaseImage:        baseImage.SHA256,
+		}
+		if err := provResourceFlags.apply(cmd, meta); err != nil {
+			return errors.E("provisioner-create", err)
+		}
+		if err := metadata.Write(cfg, meta); err != nil {
 			color.Yellow("Warning: failed to save VM metadata: %v", err)
 		}
 		color.Green("✔ Provisioner VM '%s' created successfully.", vmName)
@@ -189,4 +240,6 @@ func init() {
 
 	provisionerCreateCmd.Flags().StringVar(&provDockerImagesPath, "docker-images-path", "", "Path to docker images to share with the provisioner VM")
 	provisionerCreateCmd.Flags().StringVar(&provVMsPath, "vms-path", "", "Path to vms to share with the provisioner VM")
+
+	addResourceFlags(provisionerCreateCmd, &provResourceFlags)
 }
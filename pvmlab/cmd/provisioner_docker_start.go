@@ -44,7 +44,7 @@ var provisionerDockerStartCmd = &cobra.Command{
 
 		appDir := cfg.GetAppDir()
 
-		dockerImagesDir := filepath.Join(appDir, "docker_images")
+		dockerImagesDir := filepath.Join(cfg.GetSharedDir(), "docker_images")
 		if err := os.MkdirAll(dockerImagesDir, 0755); err != nil {
 			return fmt.Errorf("error creating docker_images directory: %w", err)
 		}
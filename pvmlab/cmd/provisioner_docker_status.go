@@ -15,6 +15,18 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// dockerContainer is a container as printed by 'docker ps --format json'.
+// Unmarshalling matches the keys case-insensitively, so the lowercase tags
+// only affect the structured output.
+type dockerContainer struct {
+	ID      string `json:"id"`
+	Image   string `json:"image"`
+	Command string `json:"command"`
+	Status  string `json:"status"`
+	Ports   string `json:"ports"`
+	Names   string `json:"names"`
+}
+
 var provisionerDockerStatusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Show docker container status in the provisioner",
@@ -32,7 +44,9 @@ var provisionerDockerStatusCmd = &cobra.Command{
 			return fmt.Errorf("no provisioner found. Please create one with 'pvmlab provisioner create'")
 		}
 		vmName := prov
-		color.Cyan("i Getting docker status for %s", vmName)
+		if !structuredOutput() {
+			color.Cyan("i Getting docker status for %s", vmName)
+		}
 
 		meta, err := metadata.Load(cfg, vmName)
 		if err != nil {
@@ -61,19 +75,26 @@ var provisionerDockerStatusCmd = &cobra.Command{
 		}
 
 		// Parse the JSON output and print a table
-		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-		if len(lines) == 0 || (len(lines) == 1 && strings.TrimSpace(lines[0]) == "") {
-			color.Yellow("No docker containers found.")
-			return nil
+		containers := []dockerContainer{}
+		for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+			if strings.Contains(line, "Warning: Permanently added") {
+				continue
+			}
+			var container dockerContainer
+			if err := json.Unmarshal([]byte(line), &container); err != nil {
+				// Ignore lines that are not valid JSON
+				continue
+			}
+			containers = append(containers, container)
 		}
 
-		type DockerPsJSON struct {
-			ID      string `json:"ID"`
-			Image   string `json:"Image"`
-			Command string `json:"Command"`
-			Status  string `json:"Status"`
-			Ports   string `json:"Ports"`
-			Names   string `json:"Names"`
+		if structuredOutput() {
+			return printStructured(cmd.OutOrStdout(), containers)
+		}
+
+		if len(containers) == 0 {
+			color.Yellow("No docker containers found.")
+			return nil
 		}
 
 		table := tablewriter.NewWriter(os.Stdout)
@@ -81,15 +102,7 @@ var provisionerDockerStatusCmd = &cobra.Command{
 
 		table.Header(header)
 
-		for _, line := range lines {
-			if strings.Contains(line, "Warning: Permanently added") {
-				continue
-			}
-			var container DockerPsJSON
-			if err := json.Unmarshal([]byte(line), &container); err != nil {
-				// Ignore lines that are not valid JSON
-				continue
-			}
+		for _, container := range containers {
 			if container.Ports == "" {
 				container.Ports = "N/A"
 			}
@@ -18,6 +18,12 @@ var rootCmd = &cobra.Command{
 	// SilenceErrors is used to prevent cobra from printing the error,
 	// as we handle it ourselves in the Execute function.
 	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateOutputFormat(); err != nil {
+			return err
+		}
+		return selectLab()
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Print the help message if no subcommand is provided
 		return cmd.Help()
@@ -6,7 +6,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"pvmlab/internal/config"
-	"pvmlab/internal/socketvmnet"
+	"pvmlab/internal/netbackend"
 	"pvmlab/internal/ssh"
 	"time"
 
@@ -25,10 +25,11 @@ var assetsOnly bool
 var setupCmd = &cobra.Command{
 	Use:   "setup",
 	Short: "Checks for and installs dependencies.",
-	Long: `Checks for and installs dependencies (Homebrew, cdrtools, socat, socket_vmnet, qemu).
+	Long: `Checks for and installs dependencies (qemu, docker and the network backend's tools:
+Homebrew and socket_vmnet on macOS, iproute2 and iptables on Linux).
 Creates the ~/.pvmlab/ directory structure.
 Generates the SSH key pair and saves it to ~/.pvmlab/ssh/.
-Make sure launchd is configured to launch the socket_vmnet service.`,
+Make sure the private network is up (the socket_vmnet service on macOS, the bridge on Linux).`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		color.Cyan("i Setting up pvmlab...")
 
@@ -39,7 +40,7 @@ Make sure launchd is configured to launch the socket_vmnet service.`,
 
 		appDir := cfg.GetAppDir()
 
-		if err := createDirectories(appDir); err != nil {
+		if err := createDirectories(cfg); err != nil {
 			return err
 		}
 
@@ -55,11 +56,16 @@ Make sure launchd is configured to launch the socket_vmnet service.`,
 		s.Stop()
 
 		if !assetsOnly {
-			if err := checkDependencies(); err != nil {
+			network, err := newNetworkBackend(cfg)
+			if err != nil {
 				return err
 			}
 
-			if err := checkSocketVmnetStatus(); err != nil {
+			if err := checkDependencies(network); err != nil {
+				return err
+			}
+
+			if err := checkNetworkStatus(network); err != nil {
 				return err
 			}
 		}
@@ -69,21 +75,24 @@ Make sure launchd is configured to launch the socket_vmnet service.`,
 	},
 }
 
-var createDirectories = func(appDir string) error {
+// createDirectories creates the directories of the selected lab and the
+// directories shared by all labs.
+var createDirectories = func(cfg *config.Config) error {
 	s := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
 	s.Suffix = " Creating directory structure..."
 	s.Start()
 	defer s.Stop()
 
+	appDir := cfg.GetAppDir()
 	dirs := []string{
-		filepath.Join(appDir, "images"),
+		filepath.Join(cfg.GetSharedDir(), "images"),
+		filepath.Join(cfg.GetSharedDir(), "docker_images"),
 		filepath.Join(appDir, "vms"),
 		filepath.Join(appDir, "pids"),
 		filepath.Join(appDir, "logs"),
 		filepath.Join(appDir, "monitors"),
 		filepath.Join(appDir, "ssh"),
 		filepath.Join(appDir, "configs", "cloud-init"),
-		filepath.Join(appDir, "docker_images"),
 	}
 	for _, dir := range dirs {
 		if err := os.MkdirAll(dir, 0755); err != nil {
@@ -95,33 +104,33 @@ var createDirectories = func(appDir string) error {
 	return nil
 }
 
-func checkSocketVmnetStatus() error {
+func checkNetworkStatus(network netbackend.Backend) error {
 	s := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
-	s.Suffix = " Checking socket_vmnet service status..."
+	s.Suffix = fmt.Sprintf(" Checking %s network status...", network.Name())
 	s.Start()
 	defer s.Stop()
 
-	running, err := socketvmnet.IsSocketVmnetRunning()
+	running, err := network.IsRunning()
 	if err != nil {
-		s.FinalMSG = color.RedString("✖ Error checking socket_vmnet status.\n")
+		s.FinalMSG = color.RedString("✖ Error checking %s network status.\n", network.Name())
 		return err
 	}
 
 	if running {
-		s.FinalMSG = color.GreenString("✔ %s service is already running.\n", socketvmnet.ServiceName)
+		s.FinalMSG = color.GreenString("✔ %s network is already running.\n", network.Name())
 	} else {
-		s.FinalMSG = color.YellowString("i %s service is stopped. Run `pvmlab socket_vmnet start` to start it.\n", socketvmnet.ServiceName)
+		s.FinalMSG = color.YellowString("i %s network is stopped. Run `pvmlab network setup` to start it.\n", network.Name())
 	}
 	return nil
 }
 
-func checkDependencies() error {
+func checkDependencies(network netbackend.Backend) error {
 	s := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
 	s.Suffix = " Checking dependencies..."
 	s.Start()
 	defer s.Stop()
 
-	dependencies := []string{"brew", "mkisofs", "socat", "qemu-system-aarch64", "docker"}
+	dependencies := append(network.Dependencies(), "qemu-system-aarch64", "docker")
 
 	for _, dep := range dependencies {
 		cmd := execCommand("which", dep)
@@ -131,6 +140,11 @@ func checkDependencies() error {
 		}
 	}
 
+	if network.Name() != netbackend.SocketVmnetName {
+		s.FinalMSG = color.GreenString("✔ Dependencies checked successfully.\n")
+		return nil
+	}
+
 	// Special check for socket_vmnet
 	socketVmnetPaths := []string{
 		"/opt/homebrew/opt/socket_vmnet/bin/socket_vmnet",
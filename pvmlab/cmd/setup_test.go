@@ -3,6 +3,8 @@ package cmd
 import (
 	"fmt"
 	"os/exec"
+	"pvmlab/internal/config"
+	"pvmlab/internal/netbackend"
 	"pvmlab/internal/socketvmnet"
 	"pvmlab/internal/ssh"
 	"strings"
@@ -56,7 +58,7 @@ func TestSetupCommand(t *testing.T) {
 			args: []string{"setup"},
 			setupMocks: func() {
 				ssh.GenerateKey = func(string) error { return nil }
-				socketvmnet.IsSocketVmnetRunning = func() (bool, error) { return false, nil }
+				socketvmnet.IsSocketVmnetRunning = func(string) (bool, error) { return false, nil }
 			},
 			expectedError: "",
 			expectedOut:   "Setup completed successfully",
@@ -67,7 +69,8 @@ func TestSetupCommand(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Reset mocks to default success behavior
 			ssh.GenerateKey = func(string) error { return nil }
-			socketvmnet.IsSocketVmnetRunning = func() (bool, error) { return true, nil }
+			socketvmnet.IsSocketVmnetRunning = func(string) (bool, error) { return true, nil }
+			newNetworkBackend = func(*config.Config) (netbackend.Backend, error) { return netbackend.NewSocketVmnet(), nil }
 			execCommand = func(_ string, _ ...string) *exec.Cmd {
 				cmd := exec.Command("true")
 				return cmd
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"pvmlab/internal/config"
 	"pvmlab/internal/socketvmnet"
 
 	"github.com/fatih/color"
@@ -13,16 +14,27 @@ var socketVmnetServiceStatusCmd = &cobra.Command{
 	Short: "Checks the status of the socket_vmnet service",
 	Long:  `Checks the status of the socket_vmnet service using launchctl.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		color.Cyan("i Checking socket_vmnet service status... (this may require sudo password)")
-		running, err := socketvmnet.IsSocketVmnetRunning()
+		if !structuredOutput() {
+			color.Cyan("i Checking socket_vmnet service status... (this may require sudo password)")
+		}
+		cfg, err := config.New()
+		if err != nil {
+			return err
+		}
+		service := socketvmnet.GetServiceName(cfg.LabName())
+		running, err := socketvmnet.IsSocketVmnetRunning(cfg.LabName())
 		if err != nil {
 			return err
 		}
 
+		if structuredOutput() {
+			return printStructured(cmd.OutOrStdout(), serviceStatus{Name: service, Running: running})
+		}
+
 		if running {
-			color.Green("✔ %s service is running.", socketvmnet.ServiceName)
+			color.Green("✔ %s service is running.", service)
 		} else {
-			color.Yellow("i %s service is stopped.", socketvmnet.ServiceName)
+			color.Yellow("i %s service is stopped.", service)
 		}
 		return nil
 	},
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"pvmlab/internal/config"
 	"pvmlab/internal/socketvmnet"
 
 	"github.com/fatih/color"
@@ -14,10 +15,14 @@ var serviceStopCmd = &cobra.Command{
 	Long:  `Stops the socket_vmnet service using launchctl.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		color.Cyan("i Stopping socket_vmnet service... (this may require sudo password)")
-		if err := socketvmnet.StopSocketVmnet(); err != nil {
+		cfg, err := config.New()
+		if err != nil {
 			return err
 		}
-		color.Green("✔ %s service stopped successfully.", socketvmnet.ServiceName)
+		if err := socketvmnet.StopSocketVmnet(cfg.LabName()); err != nil {
+			return err
+		}
+		color.Green("✔ %s service stopped successfully.", socketvmnet.GetServiceName(cfg.LabName()))
 		return nil
 	},
 }
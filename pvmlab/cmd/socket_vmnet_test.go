@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
 	"pvmlab/internal/socketvmnet"
 	"strings"
 	"testing"
@@ -17,7 +18,7 @@ func TestSocketVmnetStatusCommand(t *testing.T) {
 		{
 			name: "status when running",
 			setupMocks: func() {
-				socketvmnet.IsSocketVmnetRunning = func() (bool, error) { return true, nil }
+				socketvmnet.IsSocketVmnetRunning = func(string) (bool, error) { return true, nil }
 			},
 			expectedError: "",
 			expectedOut:   "service is running",
@@ -25,7 +26,7 @@ func TestSocketVmnetStatusCommand(t *testing.T) {
 		{
 			name: "status when stopped",
 			setupMocks: func() {
-				socketvmnet.IsSocketVmnetRunning = func() (bool, error) { return false, nil }
+				socketvmnet.IsSocketVmnetRunning = func(string) (bool, error) { return false, nil }
 			},
 			expectedError: "",
 			expectedOut:   "service is stopped",
@@ -33,7 +34,7 @@ func TestSocketVmnetStatusCommand(t *testing.T) {
 		{
 			name: "status returns error",
 			setupMocks: func() {
-				socketvmnet.IsSocketVmnetRunning = func() (bool, error) { return false, errors.New("launchctl error") }
+				socketvmnet.IsSocketVmnetRunning = func(string) (bool, error) { return false, errors.New("launchctl error") }
 			},
 			expectedError: "launchctl error",
 		},
@@ -61,6 +62,21 @@ func TestSocketVmnetStatusCommand(t *testing.T) {
 	}
 }
 
+func TestSocketVmnetStatusCommand_JSON(t *testing.T) {
+	setupMocks(t)
+	defer func() { outputFormat = outputTable }()
+	socketvmnet.IsSocketVmnetRunning = func(string) (bool, error) { return true, nil }
+
+	output, _, err := executeCommand(rootCmd, "socket_vmnet", "status", "--output", "json")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	expected := fmt.Sprintf("{\n  \"name\": \"%s\",\n  \"running\": true\n}\n", socketvmnet.ServiceName)
+	if output != expected {
+		t.Errorf("expected output '%s', but got '%s'", expected, output)
+	}
+}
+
 func TestSocketVmnetStartCommand(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -71,7 +87,7 @@ func TestSocketVmnetStartCommand(t *testing.T) {
 		{
 			name: "start success",
 			setupMocks: func() {
-				socketvmnet.StartSocketVmnet = func() error { return nil }
+				socketvmnet.StartSocketVmnet = func(string) error { return nil }
 			},
 			expectedError: "",
 			expectedOut:   "service started successfully",
@@ -79,7 +95,7 @@ func TestSocketVmnetStartCommand(t *testing.T) {
 		{
 			name: "start fails",
 			setupMocks: func() {
-				socketvmnet.StartSocketVmnet = func() error { return errors.New("launchctl start failed") }
+				socketvmnet.StartSocketVmnet = func(string) error { return errors.New("launchctl start failed") }
 			},
 			expectedError: "launchctl start failed",
 		},
@@ -117,7 +133,7 @@ func TestSocketVmnetStopCommand(t *testing.T) {
 		{
 			name: "stop success",
 			setupMocks: func() {
-				socketvmnet.StopSocketVmnet = func() error { return nil }
+				socketvmnet.StopSocketVmnet = func(string) error { return nil }
 			},
 			expectedError: "",
 			expectedOut:   "service stopped successfully",
@@ -125,7 +141,7 @@ func TestSocketVmnetStopCommand(t *testing.T) {
 		{
 			name: "stop fails",
 			setupMocks: func() {
-				socketvmnet.StopSocketVmnet = func() error { return errors.New("launchctl stop failed") }
+				socketvmnet.StopSocketVmnet = func(string) error { return errors.New("launchctl stop failed") }
 			},
 			expectedError: "launchctl stop failed",
 		},
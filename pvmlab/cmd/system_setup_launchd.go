@@ -6,7 +6,10 @@ import (
 	"os"
 	"path/filepath"
 	"pvmlab/internal/assets"
+	"pvmlab/internal/config"
+	"pvmlab/internal/socketvmnet"
 	"pvmlab/internal/util"
+	"strings"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
@@ -30,16 +33,27 @@ It performs the following operations:
 1. Creates /opt/pvmlab/libexec/
 2. Installs socket_vmnet_wrapper.sh to /opt/pvmlab/libexec/
 3. Installs io.github.pallotron.pvmlab.socket_vmnet.plist to /Library/LaunchDaemons/
-4. Loads and starts the service via launchctl`,
+4. Loads and starts the service via launchctl
+
+Each lab has its own service. As sudo doesn't keep the lab selected with
+'pvmlab lab switch', pass --lab to set up the service of a lab other than the
+default one, e.g. 'sudo pvmlab --lab fedora system setup-launchd'. The service
+is then named io.github.pallotron.pvmlab.socket_vmnet.<lab>.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if osGeteuid() != 0 {
 			return fmt.Errorf("this command must be run as root (use sudo)")
 		}
 
-		color.Cyan("i Setting up socket_vmnet launchd service...")
+		lab := labName
+		if lab == "" {
+			lab = config.DefaultLab
+		}
+		service := socketvmnet.GetServiceName(lab)
+
+		color.Cyan("i Setting up %s launchd service...", service)
 
 		// Find source files
-		wrapperSource, plistSource, err := extractEmbeddedFiles()
+		wrapperSource, plistSource, err := extractEmbeddedFiles(lab)
 		if err != nil {
 			return err
 		}
@@ -61,8 +75,7 @@ It performs the following operations:
 		color.Green("✔ Installed wrapper script to %s", destWrapper)
 
 		// 3. Install plist
-		plistName := "io.github.pallotron.pvmlab.socket_vmnet.plist"
-		destPlist := filepath.Join("/Library/LaunchDaemons", plistName)
+		destPlist := socketvmnet.GetPlistPath(lab)
 
 		// Stop existing service if running
 		// We ignore errors here as it might not be loaded
@@ -74,7 +87,7 @@ It performs the following operations:
 		color.Green("✔ Installed plist to %s", destPlist)
 
 		// 4. Load and start service
-		serviceTarget := "system/io.github.pallotron.pvmlab.socket_vmnet"
+		serviceTarget := "system/" + service
 
 		if err := utilRunCommand("launchctl", "enable", serviceTarget); err != nil {
 			return fmt.Errorf("failed to enable service: %w", err)
@@ -93,7 +106,22 @@ It performs the following operations:
 	},
 }
 
-func extractEmbeddedFiles() (string, string, error) {
+// labPlist adapts the embedded plist to the service of a lab: the service and
+// its log directory are suffixed with the lab name, which is passed to the
+// wrapper script.
+func labPlist(lab string) []byte {
+	plist := string(assets.SocketVMNetPlist)
+	if lab == config.DefaultLab {
+		return []byte(plist)
+	}
+	plist = strings.Replace(plist, "<string>"+socketvmnet.ServiceName+"</string>", "<string>"+socketvmnet.GetServiceName(lab)+"</string>", 1)
+	plist = strings.ReplaceAll(plist, socketvmnet.GetLogDir(config.DefaultLab)+"/", socketvmnet.GetLogDir(lab)+"/")
+	wrapper := "<string>/opt/pvmlab/libexec/socket_vmnet_wrapper.sh</string>"
+	plist = strings.Replace(plist, wrapper, wrapper+"\n\t\t\t<string>"+lab+"</string>", 1)
+	return []byte(plist)
+}
+
+func extractEmbeddedFiles(lab string) (string, string, error) {
 	wrapperTempFile, err := ioutil.TempFile("", "socket_vmnet_wrapper_*.sh")
 	if err != nil {
 		return "", "", fmt.Errorf("failed to create temporary wrapper file: %w", err)
@@ -110,7 +138,7 @@ func extractEmbeddedFiles() (string, string, error) {
 	}
 	defer plistTempFile.Close()
 
-	if _, err := plistTempFile.Write(assets.SocketVMNetPlist); err != nil {
+	if _, err := plistTempFile.Write(labPlist(lab)); err != nil {
 		return "", "", fmt.Errorf("failed to write embedded plist to temporary file: %w", err)
 	}
 
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -77,4 +78,29 @@ func TestSystemSetupLaunchdCmd(t *testing.T) {
 			}
 		}
 	})
-}
\ No newline at end of file
+
+	t.Run("Lab", func(t *testing.T) {
+		runCommandCalls = []string{}
+		labName = "fedora"
+		defer func() { labName = "" }()
+
+		if err := systemSetupLaunchdCmd.RunE(systemSetupLaunchdCmd, []string{}); err != nil {
+			t.Fatalf("Expected success, got error: %v", err)
+		}
+		expected := "launchctl kickstart -kp system/io.github.pallotron.pvmlab.socket_vmnet.fedora"
+		if len(runCommandCalls) != 4 || runCommandCalls[3] != expected {
+			t.Errorf("Expected the service of the lab to be started, got %v", runCommandCalls)
+		}
+
+		plist := string(labPlist("fedora"))
+		for _, want := range []string{
+			"<string>io.github.pallotron.pvmlab.socket_vmnet.fedora</string>",
+			"<string>/var/log/vmlab.socket_vmnet.fedora/stderr</string>",
+			"<string>/opt/pvmlab/libexec/socket_vmnet_wrapper.sh</string>\n\t\t\t<string>fedora</string>",
+		} {
+			if !strings.Contains(plist, want) {
+				t.Errorf("Expected the plist to contain '%s', got:\n%s", want, plist)
+			}
+		}
+	})
+}
@@ -1,6 +1,16 @@
 package cmd
 
 import (
+	"fmt"
+	"path/filepath"
+	"pvmlab/internal/config"
+	"pvmlab/internal/metadata"
+	"pvmlab/internal/pidfile"
+	"pvmlab/internal/qmp"
+	"pvmlab/internal/util"
+	"strconv"
+	"time"
+
 	"github.com/spf13/cobra"
 )
 
@@ -14,6 +24,109 @@ var vmCmd = &cobra.Command{
 	},
 }
 
+const (
+	defaultCPUs                = 2
+	defaultProvisionerMemoryMB = 4096
+	defaultTargetMemoryMB      = 2048
+)
+
+// vmResources holds the values of the flags controlling a VM's CPUs, memory
+// and machine type.
+type vmResources struct {
+	cpus     int
+	memory   string
+	cpuModel string
+	machine  string
+}
+
+// addResourceFlags registers the resource flags on cmd.
+func addResourceFlags(cmd *cobra.Command, r *vmResources) {
+	cmd.Flags().IntVar(&r.cpus, "cpus", 0, fmt.Sprintf("The number of virtual CPUs (default %d)", defaultCPUs))
+	cmd.Flags().StringVar(&r.memory, "memory", "", fmt.Sprintf("The amount of memory, e.g. 8G or 4096M (default %dM for the provisioner, %dM for targets)", defaultProvisionerMemoryMB, defaultTargetMemoryMB))
+	cmd.Flags().StringVar(&r.cpuModel, "cpu-model", "", "The QEMU CPU model, e.g. cortex-a72 or Skylake-Server (default: host, or max when emulating)")
+	cmd.Flags().StringVar(&r.machine, "machine", "", "The QEMU machine type and options, e.g. virt,gic-version=2 (default: virt on aarch64, q35 on x86_64)")
+}
+
+// validate checks the values of the resource flags set on cmd.
+func (r *vmResources) validate(cmd *cobra.Command) error {
+	if cmd.Flags().Changed("cpus") && r.cpus < 1 {
+		return fmt.Errorf("--cpus must be at least 1")
+	}
+	if cmd.Flags().Changed("memory") {
+		if _, err := parseMemory(r.memory); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply copies the resource flags set on cmd to meta.
+func (r *vmResources) apply(cmd *cobra.Command, meta *metadata.Metadata) error {
+	if err := r.validate(cmd); err != nil {
+		return err
+	}
+	if cmd.Flags().Changed("cpus") {
+		meta.CPUs = r.cpus
+	}
+	if cmd.Flags().Changed("memory") {
+		meta.MemoryMB, _ = parseMemory(r.memory)
+	}
+	if cmd.Flags().Changed("cpu-model") {
+		meta.CPUModel = r.cpuModel
+	}
+	if cmd.Flags().Changed("machine") {
+		meta.Machine = r.machine
+	}
+	return nil
+}
+
+// parseMemory converts a memory size like "8G" or "512M" to MiB. Like QEMU's
+// -m option, a number without a unit is a size in MiB.
+func parseMemory(memory string) (int, error) {
+	if mb, err := strconv.Atoi(memory); err == nil {
+		if mb < 1 {
+			return 0, fmt.Errorf("invalid --memory '%s': must be positive", memory)
+		}
+		return mb, nil
+	}
+	size, err := util.ParseSize(memory)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --memory '%s': %w", memory, err)
+	}
+	const mib = 1024 * 1024
+	if size < mib || size%mib != 0 {
+		return 0, fmt.Errorf("invalid --memory '%s': must be a positive multiple of 1M", memory)
+	}
+	return int(size / mib), nil
+}
+
+// qmpTimeout bounds QMP commands that complete immediately.
+const qmpTimeout = 5 * time.Second
+
+// qmpSocketPath returns the path of the QMP socket of a VM.
+func qmpSocketPath(appDir, vmName string) string {
+	return filepath.Join(appDir, "monitors", vmName+".sock")
+}
+
+// runQMPCommand sends a QMP command without arguments to a running VM.
+func runQMPCommand(vmName, command string) error {
+	cfg, err := config.New()
+	if err != nil {
+		return err
+	}
+	running, err := pidfile.IsRunning(cfg, vmName)
+	if err != nil {
+		return fmt.Errorf("could not check status of VM '%s': %w", vmName, err)
+	}
+	if !running {
+		return fmt.Errorf("VM '%s' is not running", vmName)
+	}
+	if _, err := qmp.Run(qmpSocketPath(cfg.GetAppDir(), vmName), command, nil, qmpTimeout); err != nil {
+		return fmt.Errorf("failed to send '%s' to VM '%s': %w", command, vmName, err)
+	}
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(vmCmd)
 }
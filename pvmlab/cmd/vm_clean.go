@@ -1,11 +1,16 @@
 package cmd
 
 import (
+	"cmp"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"pvmlab/internal/cloudinit"
 	"pvmlab/internal/config"
+	"pvmlab/internal/installstatus"
 	"pvmlab/internal/metadata"
+	"slices"
 	"strings"
 
 	"github.com/fatih/color"
@@ -29,14 +34,21 @@ var vmCleanCmd = &cobra.Command{
 		if len(args) == 0 {
 			return fmt.Errorf("a vm-name is required when --all is not specified")
 		}
-		vmName := args[0]
-		return cleanSingleVM(vmName)
+		return cleanSingleVM(args[0])
 	},
 }
 
 func cleanSingleVM(vmName string) error {
 	color.Cyan("i Cleaning VM: %s", vmName)
 
+	cfg, err := config.New()
+	if err != nil {
+		return err
+	}
+	if err := checkNoClones(cfg, vmName, "clean"); err != nil {
+		return err
+	}
+
 	// First, stop the VM if it's running
 	if err := vmStopCmd.RunE(&cobra.Command{}, []string{vmName}); err != nil {
 		// Ignore "not running" errors, as the goal is to clean up.
@@ -45,12 +57,27 @@ func cleanSingleVM(vmName string) error {
 		}
 	}
 
-	cfg, err := config.New()
-	if err != nil {
-		return err
-	}
 	appDir := cfg.GetAppDir()
 
+	// Release the host side of the VM's network, e.g. its TAP device
+	if network, err := newNetworkBackend(cfg); err != nil {
+		color.Yellow("! Warning: could not determine the network backend: %v", err)
+	} else if err := network.ReleaseVM(vmName); err != nil {
+		color.Yellow("! Warning: could not release network resources for %s: %v", vmName, err)
+	}
+
+	// Data disks and the install status are only known from the metadata,
+	// so look them up before removing it.
+	var metaPaths []string
+	if meta, err := metadata.Load(cfg, vmName); err == nil {
+		for _, disk := range meta.Disks {
+			metaPaths = append(metaPaths, dataDiskPath(appDir, vmName, disk.Name))
+		}
+		if meta.MAC != "" {
+			metaPaths = append(metaPaths, installstatus.Path(filepath.Join(appDir, "vms"), meta.MAC))
+		}
+	}
+
 	// Remove the metadata file
 	if err := metadata.Delete(cfg, vmName); err != nil {
 		color.Yellow("! Warning: could not remove metadata file for %s: %v", vmName, err)
@@ -60,12 +87,17 @@ func cleanSingleVM(vmName string) error {
 		filepath.Join(appDir, "vms", vmName+".qcow2"),
 		filepath.Join(appDir, "vms", vmName+"-vars.fd"),
 		filepath.Join(appDir, "vms", vmName+"-code.fd"), // Added for x86_64 UEFI
+		virtualMediaPath(appDir, vmName),
+		cloudinit.UserDataPath(filepath.Join(appDir, "vms"), vmName),
+		cloudinit.VendorDataPath(filepath.Join(appDir, "vms"), vmName),
+		filepath.Join(appDir, "vms", "snapshots", vmName),
 		filepath.Join(appDir, "configs", "cloud-init", vmName+".iso"),
 		filepath.Join(appDir, "configs", "cloud-init", vmName),
 		filepath.Join(appDir, "logs", vmName+".log"),
 		filepath.Join(appDir, "pids", vmName+".pid"),
 		filepath.Join(appDir, "monitors", vmName+".sock"),
 	}
+	filesToRemove = append(filesToRemove, metaPaths...)
 	for _, path := range filesToRemove {
 		if err := os.RemoveAll(path); err != nil {
 			// Ignore errors if the path doesn't exist
@@ -96,7 +128,20 @@ func cleanAllVMs() error {
 		return nil
 	}
 
-	for vmName := range allMeta {
+	// Linked clones are cleaned before the VMs backing their disks.
+	depth := func(vmName string) int {
+		d := 0
+		for meta := allMeta[vmName]; meta != nil && meta.CloneOf != "" && d < len(allMeta); meta = allMeta[meta.CloneOf] {
+			d++
+		}
+		return d
+	}
+	vmNames := slices.Collect(maps.Keys(allMeta))
+	slices.SortFunc(vmNames, func(a, b string) int {
+		return cmp.Or(cmp.Compare(depth(b), depth(a)), strings.Compare(a, b))
+	})
+
+	for _, vmName := range vmNames {
 		if err := cleanSingleVM(vmName); err != nil {
 			color.Red("! Error cleaning VM '%s': %v", vmName, err)
 			// Continue to try cleaning other VMs
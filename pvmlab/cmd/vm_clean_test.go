@@ -4,7 +4,9 @@ import (
 	"errors"
 	"pvmlab/internal/config"
 	"pvmlab/internal/metadata"
+	"pvmlab/internal/netbackend"
 	"pvmlab/internal/pidfile"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -125,3 +127,43 @@ func TestVMCleanCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestVMCleanAllClonesFirst(t *testing.T) {
+	setupMocks(t)
+	cleanAll = false
+	metadata.GetAll = func(*config.Config) (map[string]*metadata.Metadata, error) {
+		return map[string]*metadata.Metadata{
+			"golden": {Name: "golden"},
+			"copy1":  {Name: "copy1", CloneOf: "golden"},
+			"copy2":  {Name: "copy2", CloneOf: "copy1"},
+			"other":  {Name: "other"},
+		}, nil
+	}
+	var deleted []string
+	metadata.Delete = func(_ *config.Config, name string) error {
+		deleted = append(deleted, name)
+		return nil
+	}
+
+	if _, _, err := executeCommand(rootCmd, "vm", "clean", "--all"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"copy2", "copy1", "golden", "other"}
+	if !reflect.DeepEqual(deleted, want) {
+		t.Errorf("expected VMs %v to be removed in order, got %v", want, deleted)
+	}
+}
+
+func TestVMCleanReleasesNetwork(t *testing.T) {
+	setupMocks(t)
+	cleanAll = false
+	network := &fakeNetwork{}
+	newNetworkBackend = func(*config.Config) (netbackend.Backend, error) { return network, nil }
+
+	if _, _, err := executeCommand(rootCmd, "vm", "clean", "test-vm"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(network.released) != 1 || network.released[0] != "test-vm" {
+		t.Errorf("expected network resources of 'test-vm' to be released, got %v", network.released)
+	}
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"pvmlab/internal/cloudinit"
+	"pvmlab/internal/config"
+	"pvmlab/internal/errors"
+	"pvmlab/internal/metadata"
+	"pvmlab/internal/pidfile"
+	"pvmlab/internal/util"
+	"strings"
+	"syscall"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var cloneIP, cloneIPv6, cloneMAC string
+
+// vmCloneCmd represents the vm clone command
+var vmCloneCmd = &cobra.Command{
+	Use:   "clone <source-vm> <new-vm>",
+	Short: "Creates a linked clone of a stopped VM",
+	Long: `Creates a new target VM whose disk is a qcow2 overlay backed by the disk of
+a stopped source VM. The clone gets a copy of the source's UEFI variables and
+user-data, a new MAC address and a new cloud-init ISO, which also gives the
+clones of PXE installed VMs a new cloud-init identity.
+
+The source VM backs the disks of its clones: it cannot be started, reverted to
+a snapshot or cleaned while it has clones.`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: VmNameFirstArgCompleter,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Create a context that is cancelled on a SIGINT or SIGTERM.
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		srcName, vmName := args[0], args[1]
+		color.Cyan("i Cloning VM '%s' to '%s'", srcName, vmName)
+
+		if cloneIP == "" {
+			return errors.E("vm-clone", fmt.Errorf("the --ip flag is required"))
+		}
+
+		cfg, err := config.New()
+		if err != nil {
+			return errors.E("vm-clone", err)
+		}
+		appDir := cfg.GetAppDir()
+
+		srcMeta, err := metadata.Load(cfg, srcName)
+		if err != nil {
+			return errors.E("vm-clone", fmt.Errorf("failed to load metadata for source VM '%s': %w", srcName, err))
+		}
+		if srcMeta.Role == provisionerRole {
+			return errors.E("vm-clone", fmt.Errorf("the provisioner VM cannot be cloned"))
+		}
+		running, err := pidfile.IsRunning(cfg, srcName)
+		if err != nil {
+			return errors.E("vm-clone", fmt.Errorf("error checking VM status: %w", err))
+		}
+		if running {
+			return errors.E("vm-clone", fmt.Errorf("source VM '%s' is running. Stop it with 'pvmlab vm stop %s' first", srcName, srcName))
+		}
+
+		// The addresses set to 'auto' are allocated when the clone is created
+		// below.
+		vmIP, vmIPv6 := staticAddress(cloneIP), staticAddress(cloneIPv6)
+		if err := validateIP(vmIP); err != nil {
+			return err
+		}
+		if err := validateIPv6(vmIPv6); err != nil {
+			return err
+		}
+
+		if err := checkLabSubnet(cfg, vmIP, vmIPv6); err != nil {
+			return errors.E("vm-clone", err)
+		}
+		if err := checkExistingVMs(cfg, vmName, targetRole); err != nil {
+			return errors.E("vm-clone", err)
+		}
+
+		macForMetadata, err := getMac(cloneMAC)
+		if err != nil {
+			return errors.E("vm-clone", err)
+		}
+
+		meta := *srcMeta
+		meta.Name = vmName
+		meta.MAC = macForMetadata
+		meta.SSHPort = 0
+		meta.CloneOf = srcName
+		meta.VirtualMedia = ""
+		// Reserve the name and addresses of the clone before creating its
+		// files, and release them if the cloning fails.
+		if err := metadata.Create(cfg, &meta, func(allMeta map[string]*metadata.Metadata) error {
+			var err error
+			if vmIP, vmIPv6, err = allocateIPs(cfg, cloneIP, cloneIPv6, allMeta); err != nil {
+				return err
+			}
+			return setAddresses(&meta, vmIP, vmIPv6)
+		}); err != nil {
+			return errors.E("vm-clone", err)
+		}
+		created := false
+		defer func() {
+			if !created {
+				abortCreate(cfg, vmName, meta.Disks)
+			}
+		}()
+
+		srcDiskPath := filepath.Join(appDir, "vms", srcName+".qcow2")
+		vmDiskPath := filepath.Join(appDir, "vms", vmName+".qcow2")
+		if err := createOverlayDisk(ctx, srcDiskPath, vmDiskPath); err != nil {
+			return errors.E("vm-clone", err)
+		}
+		for _, disk := range srcMeta.Disks {
+			if err := createOverlayDisk(ctx, dataDiskPath(appDir, srcName, disk.Name), dataDiskPath(appDir, vmName, disk.Name)); err != nil {
+				return errors.E("vm-clone", err)
+			}
+		}
+
+		// Copy the UEFI variables so the clone keeps the source's boot entries.
+		for _, suffix := range []string{"-vars.fd", "-code.fd"} {
+			srcPath := filepath.Join(appDir, "vms", srcName+suffix)
+			if !util.FileExists(srcPath) {
+				continue
+			}
+			if err := util.CopyFile(srcPath, filepath.Join(appDir, "vms", vmName+suffix), 0644); err != nil {
+				return errors.E("vm-clone", fmt.Errorf("failed to copy UEFI variables: %w", err))
+			}
+		}
+
+		// The clone gets the user-data and vendor-data of the source.
+		vmsDir := filepath.Join(appDir, "vms")
+		for _, path := range []func(string, string) string{cloudinit.UserDataPath, cloudinit.VendorDataPath} {
+			srcPath := path(vmsDir, srcName)
+			if !util.FileExists(srcPath) {
+				continue
+			}
+			if err := util.CopyFile(srcPath, path(vmsDir, vmName), 0644); err != nil {
+				return errors.E("vm-clone", fmt.Errorf("failed to copy cloud-init data: %w", err))
+			}
+		}
+
+		// The clone needs its own ISO. Its instance-id is derived from the VM
+		// name, so cloud-init runs again in the clone, and its network-config
+		// matches the new MAC. The NoCloud datasource prefers it to the seed
+		// directory the PXE installer wrote to the disk of the source.
+		isoPath := filepath.Join(appDir, "configs", "cloud-init", vmName+".iso")
+		if err := cloudinit.CreateISO(
+			ctx, vmName, targetRole, appDir, isoPath, vmIP, vmIPv6, macForMetadata,
+			"", "",
+		); err != nil {
+			return errors.E("vm-clone", err)
+		}
+
+		created = true
+
+		color.Green("✔ VM '%s' cloned from '%s' successfully.", vmName, srcName)
+		if srcMeta.PxeBoot {
+			color.Cyan("i Start it with 'pvmlab vm start %s --boot disk' to boot the installed system.", vmName)
+		}
+		return nil
+	},
+}
+
+// createOverlayDisk creates a qcow2 disk backed by another VM's disk.
+var createOverlayDisk = func(ctx context.Context, backingDiskPath, vmDiskPath string) error {
+	cmd := exec.CommandContext(ctx, "qemu-img", "create", "-f", "qcow2", "-F", "qcow2", "-b", backingDiskPath, vmDiskPath)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create overlay disk: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// checkNoClones returns an error if other VMs are linked clones of vmName,
+// since changing its disk would corrupt theirs.
+func checkNoClones(cfg *config.Config, vmName, action string) error {
+	clones, err := metadata.FindClones(cfg, vmName)
+	if err != nil {
+		return fmt.Errorf("error checking for linked clones: %w", err)
+	}
+	if len(clones) > 0 {
+		return fmt.Errorf("cannot %s VM '%s': its disk backs the linked clones %s. Clean them first", action, vmName, strings.Join(clones, ", "))
+	}
+	return nil
+}
+
+func init() {
+	vmCmd.AddCommand(vmCloneCmd)
+	vmCloneCmd.Flags().StringVar(&cloneIP, "ip", "", "The static IP address for the clone in CIDR format (e.g. 192.168.1.2/24), or 'auto' to allocate one")
+	vmCloneCmd.Flags().StringVar(&cloneIPv6, "ipv6", "", "The static IPv6 address for the clone in CIDR format (e.g. fd00:cafe:babe::2/64), or 'auto' to allocate one")
+	vmCloneCmd.Flags().StringVar(&cloneMAC, "mac", "", "The MAC address of the clone (default: randomly generated)")
+}
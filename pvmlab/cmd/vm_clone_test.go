@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"pvmlab/internal/cloudinit"
+	"pvmlab/internal/config"
+	"pvmlab/internal/metadata"
+	"pvmlab/internal/pidfile"
+	"strings"
+	"testing"
+)
+
+func TestVMCloneCommand(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		srcMeta       *metadata.Metadata
+		running       bool
+		expectedError string
+		expectISO     bool
+	}{
+		{
+			name:      "clone cloud image VM",
+			args:      []string{"vm", "clone", "golden", "copy1", "--ip", "192.168.100.20/24", "--ipv6", "fd00:cafe:babe::20/64"},
+			srcMeta:   &metadata.Metadata{Name: "golden", Role: targetRole, Arch: "aarch64", IP: "192.168.100.10", IPv6: "fd00:cafe:babe::10", MAC: "52:54:00:00:00:10", Distro: "ubuntu-24.04", SSHPort: 2222},
+			expectISO: true,
+		},
+		{
+			name:      "clone pxeboot VM",
+			args:      []string{"vm", "clone", "golden", "copy1", "--ip", "192.168.100.20/24"},
+			srcMeta:   &metadata.Metadata{Name: "golden", Role: targetRole, Arch: "x86_64", IP: "192.168.100.10", MAC: "52:54:00:00:00:10", PxeBoot: true, Distro: "ubuntu-24.04", Kernel: "vmlinuz", Initrd: "initrd"},
+			expectISO: true,
+		},
+		{
+			name:          "missing ip",
+			args:          []string{"vm", "clone", "golden", "copy1"},
+			srcMeta:       &metadata.Metadata{Name: "golden", Role: targetRole},
+			expectedError: "the --ip flag is required",
+		},
+		{
+			name:          "source running",
+			args:          []string{"vm", "clone", "golden", "copy1", "--ip", "192.168.100.20/24"},
+			srcMeta:       &metadata.Metadata{Name: "golden", Role: targetRole},
+			running:       true,
+			expectedError: "source VM 'golden' is running",
+		},
+		{
+			name:          "provisioner",
+			args:          []string{"vm", "clone", "provisioner", "copy1", "--ip", "192.168.100.20/24"},
+			srcMeta:       &metadata.Metadata{Name: "provisioner", Role: provisionerRole},
+			expectedError: "the provisioner VM cannot be cloned",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupMocks(t)
+			cloneIP, cloneIPv6, cloneMAC = "", "", ""
+			t.Cleanup(func() { cloneIP, cloneIPv6, cloneMAC = "", "", "" })
+			originalCreateOverlayDisk := createOverlayDisk
+			t.Cleanup(func() { createOverlayDisk = originalCreateOverlayDisk })
+
+			cfg, _ := config.New()
+			vmsDir := filepath.Join(cfg.GetAppDir(), "vms")
+			if err := os.MkdirAll(vmsDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(vmsDir, tt.srcMeta.Name+"-vars.fd"), []byte("vars"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(cloudinit.UserDataPath(vmsDir, tt.srcMeta.Name), []byte("packages: [htop]"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			metadata.Load = func(c *config.Config, name string) (*metadata.Metadata, error) {
+				return tt.srcMeta, nil
+			}
+			pidfile.IsRunning = func(c *config.Config, name string) (bool, error) {
+				return tt.running, nil
+			}
+			var backingDisk string
+			createOverlayDisk = func(ctx context.Context, backingDiskPath, vmDiskPath string) error {
+				backingDisk = backingDiskPath
+				return nil
+			}
+			var isoCreated bool
+			cloudinit.CreateISO = func(ctx context.Context, vmName, role, appDir, isoPath, ip, ipv6, mac, tar, image string) error {
+				isoCreated = true
+				if vmName != "copy1" || ip != "192.168.100.20/24" || mac == tt.srcMeta.MAC {
+					t.Errorf("unexpected ISO parameters: name=%s ip=%s mac=%s", vmName, ip, mac)
+				}
+				return nil
+			}
+			var saved *metadata.Metadata
+			metadata.Write = func(c *config.Config, meta *metadata.Metadata) error {
+				saved = meta
+				return nil
+			}
+
+			_, _, err := executeCommand(rootCmd, tt.args...)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing '%s', got '%v'", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if backingDisk != filepath.Join(vmsDir, "golden.qcow2") {
+				t.Errorf("expected overlay backed by golden.qcow2, got %s", backingDisk)
+			}
+			if _, err := os.Stat(filepath.Join(vmsDir, "copy1-vars.fd")); err != nil {
+				t.Errorf("expected UEFI vars to be copied: %v", err)
+			}
+			if _, err := os.Stat(cloudinit.UserDataPath(vmsDir, "copy1")); err != nil {
+				t.Errorf("expected user-data to be copied: %v", err)
+			}
+			if isoCreated != tt.expectISO {
+				t.Errorf("expected ISO created = %v, got %v", tt.expectISO, isoCreated)
+			}
+			if saved == nil {
+				t.Fatal("expected metadata to be saved")
+			}
+			if saved.Name != "copy1" || saved.CloneOf != "golden" || saved.IP != "192.168.100.20" || saved.Subnet != "192.168.100.0/24" {
+				t.Errorf("unexpected metadata: %+v", saved)
+			}
+			if saved.MAC == "" || saved.MAC == tt.srcMeta.MAC || saved.SSHPort != 0 {
+				t.Errorf("expected a new MAC and no SSH port, got %+v", saved)
+			}
+			if saved.Arch != tt.srcMeta.Arch || saved.PxeBoot != tt.srcMeta.PxeBoot || saved.Distro != tt.srcMeta.Distro {
+				t.Errorf("expected settings to be inherited from the source, got %+v", saved)
+			}
+		})
+	}
+}
+
+func TestVMCloneSourceProtected(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "start", args: []string{"vm", "start", "golden"}},
+		{name: "clean", args: []string{"vm", "clean", "golden"}},
+		{name: "snapshot revert", args: []string{"vm", "snapshot", "revert", "golden", "blank"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupMocks(t)
+			metadata.FindClones = func(c *config.Config, name string) ([]string, error) {
+				return []string{"copy1", "copy2"}, nil
+			}
+			_, _, err := executeCommand(rootCmd, tt.args...)
+			if err == nil || !strings.Contains(err.Error(), "its disk backs the linked clones copy1, copy2") {
+				t.Errorf("expected linked clones error, got '%v'", err)
+			}
+		})
+	}
+}
+
+func TestVMCloneCommand_RemovesFilesOnFailure(t *testing.T) {
+	setupMocks(t)
+	cloneIP, cloneIPv6, cloneMAC = "", "", ""
+	t.Cleanup(func() { cloneIP, cloneIPv6, cloneMAC = "", "", "" })
+	originalCreateOverlayDisk := createOverlayDisk
+	t.Cleanup(func() { createOverlayDisk = originalCreateOverlayDisk })
+
+	cfg, _ := config.New()
+	vmsDir := filepath.Join(cfg.GetAppDir(), "vms")
+	if err := os.MkdirAll(vmsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(vmsDir, "golden-vars.fd"), []byte("vars"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cloudinit.UserDataPath(vmsDir, "golden"), []byte("packages: [htop]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	srcMeta := &metadata.Metadata{Name: "golden", Role: targetRole, Arch: "aarch64", MAC: "52:54:00:00:00:10", Disks: []metadata.Disk{{Name: "data", Size: "1G"}}}
+	metadata.Load = func(c *config.Config, name string) (*metadata.Metadata, error) {
+		return srcMeta, nil
+	}
+	createOverlayDisk = func(ctx context.Context, backingDiskPath, vmDiskPath string) error {
+		return os.WriteFile(vmDiskPath, []byte("overlay"), 0644)
+	}
+	cloudinit.CreateISO = func(ctx context.Context, vmName, role, appDir, isoPath, ip, ipv6, mac, tar, image string) error {
+		return fmt.Errorf("no space left")
+	}
+	var deleted string
+	metadata.Delete = func(_ *config.Config, vmName string) error {
+		deleted = vmName
+		return nil
+	}
+
+	_, _, err := executeCommand(rootCmd, "vm", "clone", "golden", "copy1", "--ip", "192.168.100.20/24")
+	if err == nil || !strings.Contains(err.Error(), "no space left") {
+		t.Fatalf("expected the ISO error, got %v", err)
+	}
+	if deleted != "copy1" {
+		t.Errorf("expected the name of the clone to be released, got %q", deleted)
+	}
+	for _, path := range []string{
+		filepath.Join(vmsDir, "copy1.qcow2"),
+		dataDiskPath(cfg.GetAppDir(), "copy1", "data"),
+		filepath.Join(vmsDir, "copy1-vars.fd"),
+		cloudinit.UserDataPath(vmsDir, "copy1"),
+	} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %v", path, err)
+		}
+	}
+}
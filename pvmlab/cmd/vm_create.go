@@ -11,10 +11,12 @@ import (
 	"os/signal"
 	"path"
 	"path/filepath"
+	"pvmlab/internal/cache"
 	"pvmlab/internal/cloudinit"
 	"pvmlab/internal/config"
-	"pvmlab/internal/downloader"
+	"pvmlab/internal/distro"
 	"pvmlab/internal/errors"
+	"pvmlab/internal/ipam"
 	"pvmlab/internal/metadata"
 	"pvmlab/internal/qemu"
 	"pvmlab/internal/ssh"
@@ -36,6 +38,9 @@ const (
 var (
 	ip, ipv6, mac, diskSize, arch string
 	pxeboot                       bool
+	vmResourceFlags               vmResources
+	dataDisks                     []string
+	userDataPath, vendorDataPath  string
 
 	// readFile is a wrapper around os.ReadFile to allow mocking in tests.
 	readFile = os.ReadFile
@@ -63,6 +68,27 @@ var vmCreateCmd = &cobra.Command{
 			return errors.E("vm-create", fmt.Errorf("--distro is required for --pxeboot. Run 'pvmlab distro ls' to see a list of available distributions"))
 		}
 
+		if err := vmResourceFlags.validate(cmd); err != nil {
+			return errors.E("vm-create", err)
+		}
+
+		// Name and validate the data disks before creating anything.
+		diskMeta := &metadata.Metadata{}
+		for _, spec := range dataDisks {
+			disk, err := parseDiskSpec(spec)
+			if err != nil {
+				return errors.E("vm-create", err)
+			}
+			if _, err := addDisk(diskMeta, disk); err != nil {
+				return errors.E("vm-create", err)
+			}
+		}
+
+		userData, vendorData, err := readUserData(userDataPath, vendorDataPath)
+		if err != nil {
+			return errors.E("vm-create", err)
+		}
+
 		cfg, err := config.New()
 		if err != nil {
 			return errors.E("vm-create", err)
@@ -75,19 +101,22 @@ var vmCreateCmd = &cobra.Command{
 			return nil
 		}
 
-		if err := validateIP(ip); err != nil {
+		// The addresses set to 'auto' are allocated when the VM is created
+		// below.
+		vmIP, vmIPv6 := staticAddress(ip), staticAddress(ipv6)
+		if err := validateIP(vmIP); err != nil {
 			return err
 		}
 
-		if err := validateIPv6(ipv6); err != nil {
+		if err := validateIPv6(vmIPv6); err != nil {
 			return err
 		}
 
 		appDir := cfg.GetAppDir()
-		if err := createDirectories(appDir); err != nil {
+		if err := createDirectories(cfg); err != nil {
 			return errors.E("vm-create", fmt.Errorf("failed to create app directories: %w", err))
 		}
-		if err := metadata.CheckForDuplicateIPs(cfg, ip, ipv6); err != nil {
+		if err := checkLabSubnet(cfg, vmIP, vmIPv6); err != nil {
 			return errors.E("vm-create", err)
 		}
 
@@ -109,15 +138,56 @@ var vmCreateCmd = &cobra.Command{
 			return errors.E("vm-create", fmt.Errorf("failed to read ssh public key: %w", err))
 		}
 
+		meta := &metadata.Metadata{
+			Name:         vmName,
+			Role:         targetRole,
+			Arch:         arch,
+			MAC:          macForMetadata,
+			SSHKey:       string(sshPubKey),
+			PxeBoot:      pxeboot,
+			Distro:       distroName,
+			DistroFamily: config.Distros[distroName].DistroName,
+			Disks:        diskMeta.Disks,
+		}
+		if err := vmResourceFlags.apply(cmd, meta); err != nil {
+			return errors.E("vm-create", err)
+		}
+		// Reserve the name and addresses of the VM before creating its files,
+		// and release them if the creation fails.
+		if err := metadata.Create(cfg, meta, func(allMeta map[string]*metadata.Metadata) error {
+			var err error
+			if vmIP, vmIPv6, err = allocateIPs(cfg, ip, ipv6, allMeta); err != nil {
+				return err
+			}
+			return setAddresses(meta, vmIP, vmIPv6)
+		}); err != nil {
+			return errors.E("vm-create", err)
+		}
+		created := false
+		defer func() {
+			if !created {
+				abortCreate(cfg, vmName, meta.Disks)
+			}
+		}()
+
+		if err := cloudinit.StoreUserData(filepath.Join(appDir, "vms"), vmName, userData, vendorData); err != nil {
+			return errors.E("vm-create", err)
+		}
+
 		vmDiskPath := filepath.Join(appDir, "vms", vmName+".qcow2")
+		var kernel, initrd string
 		if pxeboot {
-			distroPath := filepath.Join(appDir, "images", distroName, arch)
+			distroPath := filepath.Join(cfg.GetSharedDir(), "images", distroName, arch)
 			distroInfo, err := config.GetDistro(distroName, arch)
 			if err != nil {
 				return errors.E("vm-create", fmt.Errorf("failed to get distro info: %w", err))
 			}
-			kernelPath := filepath.Join(distroPath, filepath.Base(distroInfo.KernelPath))
-			initrdPath := filepath.Join(distroPath, filepath.Base(distroInfo.InitrdPath))
+			kernel, initrd, err = distro.Assets(distroPath, distroInfo)
+			if err != nil {
+				return errors.E("vm-create", fmt.Errorf("%w. Please run 'pvmlab distro pull --distro %s --arch %s' first", err, distroName, arch))
+			}
+			kernelPath := filepath.Join(distroPath, kernel)
+			initrdPath := filepath.Join(distroPath, initrd)
 
 			if _, err := os.Stat(kernelPath); os.IsNotExist(err) {
 				return errors.E("vm-create", fmt.Errorf("kernel image not found at %s. Please run 'pvmlab distro pull --distro %s --arch %s' first", kernelPath, distroName, arch))
@@ -134,62 +204,50 @@ var vmCreateCmd = &cobra.Command{
 			if err != nil {
 				return errors.E("vm-create", fmt.Errorf("failed to get distro info for non-pxeboot target: %w", err))
 			}
-			imageUrl := distroInfo.Qcow2URL
+			if distroInfo.Qcow2URL == "" {
+				return errors.E("vm-create", fmt.Errorf("distro '%s' was imported from a rootfs tarball and has no qcow2 image, it can only be used with --pxeboot", distroName))
+			}
 			imageName := path.Base(distroInfo.Qcow2URL)
 
-			distroPath := filepath.Join(appDir, "images", distroName, arch)
+			distroPath := filepath.Join(cfg.GetSharedDir(), "images", distroName, arch)
 			if err := os.MkdirAll(distroPath, 0755); err != nil {
 				return errors.E("vm-create", fmt.Errorf("failed to create distro image directory: %w", err))
 			}
 			imagePath := filepath.Join(distroPath, imageName)
-			if err := downloader.DownloadImageIfNotExists(ctx, imagePath, imageUrl); err != nil {
+			if err := distro.DownloadImage(ctx, cfg, distroInfo, imagePath); err != nil {
 				return errors.E("vm-create", err)
 			}
-			if err := createDisk(ctx, imagePath, vmDiskPath, diskSize); err != nil {
+			// The disk is backed on the cached image, which isn't replaced
+			// when the image is updated upstream.
+			c := cache.Open(cfg)
+			baseImage, err := c.BaseImage(distroInfo.Qcow2URL, imagePath)
+			if err != nil {
+				return errors.E("vm-create", fmt.Errorf("failed to add the image to the cache: %w", err))
+			}
+			if err := createDisk(ctx, c.BlobPath(baseImage), vmDiskPath, diskSize); err != nil {
 				return errors.E("vm-create", err)
 			}
+			meta.BaseImage = baseImage.SHA256
 			isoPath := filepath.Join(appDir, "configs", "cloud-init", vmName+".iso")
 			if err := cloudinit.CreateISO(
-				ctx, vmName, targetRole, appDir, isoPath, ip, ipv6, macForMetadata,
+				ctx, vmName, targetRole, appDir, isoPath, vmIP, vmIPv6, macForMetadata,
 				"", "",
 			); err != nil {
 				return errors.E("vm-create", err)
 			}
 		}
 
-		var ipForMetadata, subnetForMetadata string
-		if ip != "" {
-			parsedIP, parsedCIDR, err := net.ParseCIDR(ip)
-			if err != nil {
-				return fmt.Errorf("internal error: failed to parse already validated IP/CIDR '%s': %w", ip, err)
-			}
-			ipForMetadata = parsedIP.String()
-			subnetForMetadata = parsedCIDR.String()
-		}
-
-		var ipv6ForMetadata, subnetv6ForMetadata string
-		if ipv6 != "" {
-			parsedIP, parsedCIDR, err := net.ParseCIDR(ipv6)
-			if err != nil {
-				return fmt.Errorf("internal error: failed to parse already validated IPv6/CIDR '%s': %w", ipv6, err)
-			}
-			ipv6ForMetadata = parsedIP.String()
-			subnetv6ForMetadata = parsedCIDR.String()
-		}
-
-		var kernel, initrd string
-		if distroName != "" {
-			distroInfo, err := config.GetDistro(distroName, arch)
-			if err != nil {
-				return errors.E("vm-create", fmt.Errorf("failed to get distro info: %w", err))
+		for _, disk := range diskMeta.Disks {
+			if err := createBlankDisk(ctx, dataDiskPath(appDir, vmName, disk.Name), disk.Size); err != nil {
+				return errors.E("vm-create", err)
 			}
-			kernel = filepath.Base(distroInfo.KernelPath)
-			initrd = filepath.Base(distroInfo.InitrdPath)
 		}
 
-		if err := metadata.Save(cfg, vmName, targetRole, arch, ipForMetadata, subnetForMetadata, ipv6ForMetadata, subnetv6ForMetadata, macForMetadata, "", "", "", string(sshPubKey), kernel, initrd, 0, pxeboot, distroName); err != nil {
-			color.Yellow("Warning: failed to save VM metadata: %v", err)
+		meta.Kernel, meta.Initrd = kernel, initrd
+		if err := metadata.Write(cfg, meta); err != nil {
+			return errors.E("vm-create", fmt.Errorf("failed to save VM metadata: %w", err))
 		}
+		created = true
 		color.Green("✔ Target VM '%s' created successfully.", vmName)
 
 		return nil
@@ -214,6 +272,109 @@ func validateIPv6(ipv6 string) error {
 	return nil
 }
 
+// setAddresses sets the addresses and subnets of a VM from its addresses in
+// CIDR notation, which may be empty.
+func setAddresses(meta *metadata.Metadata, ip, ipv6 string) error {
+	meta.IP, meta.Subnet, meta.IPv6, meta.SubnetV6 = "", "", "", ""
+	if ip != "" {
+		parsedIP, parsedCIDR, err := net.ParseCIDR(ip)
+		if err != nil {
+			return fmt.Errorf("internal error: failed to parse already validated IP/CIDR '%s': %w", ip, err)
+		}
+		meta.IP = parsedIP.String()
+		meta.Subnet = parsedCIDR.String()
+	}
+	if ipv6 != "" {
+		parsedIP, parsedCIDR, err := net.ParseCIDR(ipv6)
+		if err != nil {
+			return fmt.Errorf("internal error: failed to parse already validated IPv6/CIDR '%s': %w", ipv6, err)
+		}
+		meta.IPv6 = parsedIP.String()
+		meta.SubnetV6 = parsedCIDR.String()
+	}
+	return nil
+}
+
+// abortCreate removes the files created for a VM whose creation failed, and
+// releases its name and addresses.
+func abortCreate(cfg *config.Config, vmName string, disks []metadata.Disk) {
+	appDir := cfg.GetAppDir()
+	vmsDir := filepath.Join(appDir, "vms")
+	paths := []string{
+		filepath.Join(vmsDir, vmName+".qcow2"),
+		filepath.Join(vmsDir, vmName+"-vars.fd"),
+		filepath.Join(vmsDir, vmName+"-code.fd"),
+		cloudinit.UserDataPath(vmsDir, vmName),
+		cloudinit.VendorDataPath(vmsDir, vmName),
+		filepath.Join(appDir, "configs", "cloud-init", vmName+".iso"),
+		filepath.Join(appDir, "configs", "cloud-init", vmName),
+	}
+	for _, disk := range disks {
+		paths = append(paths, dataDiskPath(appDir, vmName, disk.Name))
+	}
+	for _, path := range paths {
+		if err := os.RemoveAll(path); err != nil {
+			color.Yellow("! Warning: could not remove path %s: %v", path, err)
+		}
+	}
+	if err := metadata.Delete(cfg, vmName); err != nil {
+		color.Yellow("! Warning: could not remove metadata file for %s: %v", vmName, err)
+	}
+}
+
+// staticAddress returns an address given with --ip or --ipv6, or an empty
+// string if it is to be allocated.
+func staticAddress(addr string) string {
+	if addr == ipam.Auto {
+		return ""
+	}
+	return addr
+}
+
+// allocateIPs replaces the addresses set to 'auto' by the next free ones of
+// the provisioner's subnets, and checks that the others are not used by the
+// VMs of allMeta. It is called by metadata.Create, under the store lock.
+func allocateIPs(cfg *config.Config, ip, ipv6 string, allMeta map[string]*metadata.Metadata) (string, string, error) {
+	if err := metadata.CheckForDuplicateIPsIn(allMeta, staticAddress(ip), staticAddress(ipv6)); err != nil {
+		return "", "", err
+	}
+	var err error
+	if ip == ipam.Auto {
+		if ip, err = ipam.Allocate(cfg, ipam.FamilyIPv4, allMeta); err != nil {
+			return "", "", fmt.Errorf("failed to allocate an IP address: %w", err)
+		}
+		color.Cyan("i Allocated IP address: %s", ip)
+	}
+	if ipv6 == ipam.Auto {
+		if ipv6, err = ipam.Allocate(cfg, ipam.FamilyIPv6, allMeta); err != nil {
+			return "", "", fmt.Errorf("failed to allocate an IPv6 address: %w", err)
+		}
+		color.Cyan("i Allocated IPv6 address: %s", ipv6)
+	}
+	return ip, ipv6, nil
+}
+
+// readUserData reads the files given with --user-data and --vendor-data, if
+// any, and checks that they can be merged with the generated cloud-init
+// configuration.
+func readUserData(userDataPath, vendorDataPath string) ([]byte, []byte, error) {
+	var data [2][]byte
+	for i, f := range []struct{ flag, path string }{{"--user-data", userDataPath}, {"--vendor-data", vendorDataPath}} {
+		if f.path == "" {
+			continue
+		}
+		content, err := readFile(f.path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s file: %w", f.flag, err)
+		}
+		if err := cloudinit.ValidateCloudConfig(content); err != nil {
+			return nil, nil, fmt.Errorf("invalid %s file %s: %w", f.flag, f.path, err)
+		}
+		data[i] = content
+	}
+	return data[0], data[1], nil
+}
+
 func validateMac(mac string) error {
 	if mac != "" {
 		// regex for mac address
@@ -415,9 +576,9 @@ func init() {
 
 	vmCreateCmd.Flags().StringVar(&mac, "mac", "", "The MAC address of the VM")
 
-	vmCreateCmd.Flags().StringVar(&ip, "ip", "", "The static IP address for the VM in CIDR format (e.g. 192.168.1.2/24)")
+	vmCreateCmd.Flags().StringVar(&ip, "ip", "", "The static IP address for the VM in CIDR format (e.g. 192.168.1.2/24), or 'auto' to allocate one")
 
-	vmCreateCmd.Flags().StringVar(&ipv6, "ipv6", "", "The static IPv6 address for the VM in CIDR format (e.g. fd00:cafe:babe::2/64)")
+	vmCreateCmd.Flags().StringVar(&ipv6, "ipv6", "", "The static IPv6 address for the VM in CIDR format (e.g. fd00:cafe:babe::2/64), or 'auto' to allocate one")
 
 	vmCreateCmd.Flags().StringVar(&diskSize, "disk-size", "15G", "The size of the VM disk")
 
@@ -427,48 +588,27 @@ func init() {
 
 	vmCreateCmd.Flags().StringVar(&distroName, "distro", "", "The distribution for the VM (e.g. ubuntu-24.04)")
 
-}
+	addResourceFlags(vmCreateCmd, &vmResourceFlags)
+	vmCreateCmd.Flags().StringArrayVar(&dataDisks, "disk", nil, "Add a data disk: size[,bus=virtio|nvme|scsi|sata][,serial=...] (repeatable)")
 
-func suggestNextIP(cfg *config.Config) error {
-	provisioner, err := metadata.GetProvisioner(cfg)
-	if err != nil {
-		return fmt.Errorf("failed to get provisioner metadata: %w", err)
-	}
-	if provisioner == nil {
-		return fmt.Errorf("provisioner VM not found. Please create a provisioner first")
-	}
+	vmCreateCmd.Flags().StringVar(&userDataPath, "user-data", "", "A #cloud-config file merged into the generated cloud-init user-data")
 
-	_, ipNet, err := net.ParseCIDR(provisioner.IP + "/24")
-	if err != nil {
-		return fmt.Errorf("failed to parse provisioner IP CIDR: %w", err)
-	}
+	vmCreateCmd.Flags().StringVar(&vendorDataPath, "vendor-data", "", "A #cloud-config file used as the cloud-init vendor-data")
 
-	ip4 := ipNet.IP.To4()
-	if ip4 == nil {
-		return fmt.Errorf("provisioner IP is not a valid IPv4 address")
-	}
+}
 
+func suggestNextIP(cfg *config.Config) error {
 	allMeta, err := metadata.GetAll(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to get all VM metadata: %w", err)
 	}
-
-	usedIPs := make(map[string]bool)
-	for _, meta := range allMeta {
-		if meta.IP != "" {
-			usedIPs[meta.IP] = true
-		}
-	}
-
-	for i := 2; i < 255; i++ {
-		ip := net.IPv4(ip4[0], ip4[1], ip4[2], byte(i))
-		if !usedIPs[ip.String()] {
-			color.Yellow("The --ip flag is required.")
-			color.Cyan("  To create a VM with the next available IP, run:")
-			fmt.Printf("  pvmlab vm create <vm-name> --distro <distro> --ip %s/24\n", ip.String())
-			return nil
-		}
+	next, err := ipam.Allocate(cfg, ipam.FamilyIPv4, allMeta)
+	if err != nil {
+		return err
 	}
-
-	return fmt.Errorf("no available IPs in the range 100-254")
+	color.Yellow("The --ip flag is required.")
+	color.Cyan("  To create a VM with the next available IP, run:")
+	fmt.Printf("  pvmlab vm create <vm-name> --distro <distro> --ip %s\n", next)
+	color.Cyan("  or let pvmlab allocate it with --ip auto.")
+	return nil
 }
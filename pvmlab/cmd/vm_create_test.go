@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"pvmlab/internal/cloudinit"
 	"pvmlab/internal/config"
 	"pvmlab/internal/downloader"
@@ -75,20 +77,44 @@ func TestSuggestNextIP(t *testing.T) {
 			},
 			expectedOutput: "pvmlab vm create <vm-name> --distro <distro> --ip 192.168.100.2/24",
 		},
+		{
+			name: "DHCP range is skipped",
+			provisioner: &metadata.Metadata{
+				IP: "192.168.100.1",
+			},
+			vms:            fillIPs("192.168.100.", 2, 99),
+			expectedOutput: "pvmlab vm create <vm-name> --distro <distro> --ip 192.168.100.201/24",
+		},
+		{
+			name: "Subnet of the provisioner",
+			provisioner: &metadata.Metadata{
+				IP:     "10.0.0.1",
+				Subnet: "10.0.0.0/16",
+			},
+			vms:            map[string]*metadata.Metadata{},
+			expectedOutput: "--ip 10.0.0.2/16",
+		},
+		{
+			name:        "No provisioner",
+			vms:         map[string]*metadata.Metadata{},
+			expectError: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Mock metadata functions
-			originalGetProvisioner := metadata.GetProvisioner
-			metadata.GetProvisioner = func(cfg *config.Config) (*metadata.Metadata, error) {
-				return tt.provisioner, nil
+			vms := map[string]*metadata.Metadata{}
+			for name, meta := range tt.vms {
+				vms[name] = meta
+			}
+			if tt.provisioner != nil {
+				tt.provisioner.Role = "provisioner"
+				vms["provisioner"] = tt.provisioner
 			}
-			defer func() { metadata.GetProvisioner = originalGetProvisioner }()
-
 			originalGetAll := metadata.GetAll
 			metadata.GetAll = func(cfg *config.Config) (map[string]*metadata.Metadata, error) {
-				return tt.vms, nil
+				return vms, nil
 			}
 			defer func() { metadata.GetAll = originalGetAll }()
 
@@ -108,21 +134,176 @@ func TestSuggestNextIP(t *testing.T) {
 				return
 			}
 
-			if !strings.Contains(string(out), tt.expectedOutput) {
+			if !tt.expectError && !strings.Contains(string(out), tt.expectedOutput) {
 				t.Errorf("suggestNextIP() output = %q, want to contain %q", string(out), tt.expectedOutput)
 			}
 		})
 	}
 }
 
+// fillIPs returns VMs using the addresses prefix+first to prefix+last.
+func fillIPs(prefix string, first, last int) map[string]*metadata.Metadata {
+	vms := map[string]*metadata.Metadata{}
+	for i := first; i <= last; i++ {
+		name := fmt.Sprintf("vm%d", i)
+		vms[name] = &metadata.Metadata{Name: name, IP: fmt.Sprintf("%s%d", prefix, i)}
+	}
+	return vms
+}
+
+func TestVMCreateCommand_AutoIP(t *testing.T) {
+	setupMocks(t)
+	metadata.GetAll = func(*config.Config) (map[string]*metadata.Metadata, error) {
+		return map[string]*metadata.Metadata{
+			"provisioner": {
+				Name: "provisioner", Role: "provisioner",
+				IP: "192.168.100.1", Subnet: "192.168.100.0/24",
+				IPv6: "fd00:cafe:babe::1", SubnetV6: "fd00:cafe:babe::/64",
+			},
+			"vm1": {Name: "vm1", Role: "target", IP: "192.168.100.2", IPv6: "fd00:cafe:babe::2"},
+		}, nil
+	}
+	var saved *metadata.Metadata
+	metadata.Write = func(_ *config.Config, meta *metadata.Metadata) error {
+		saved = meta
+		return nil
+	}
+	defer func() {
+		for _, name := range []string{"ip", "ipv6", "distro"} {
+			f := vmCreateCmd.Flags().Lookup(name)
+			_ = f.Value.Set(f.DefValue)
+			f.Changed = false
+		}
+	}()
+
+	output, _, err := executeCommand(rootCmd, "vm", "create", "vm2", "--distro", "ubuntu-24.04", "--ip", "auto", "--ipv6", "auto")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if !strings.Contains(output, "Allocated IP address: 192.168.100.3/24") {
+		t.Errorf("expected the allocated address in the output, got '%s'", output)
+	}
+	if saved == nil {
+		t.Fatal("expected the metadata to be saved")
+	}
+	if saved.IP != "192.168.100.3" || saved.Subnet != "192.168.100.0/24" {
+		t.Errorf("expected IP 192.168.100.3 in 192.168.100.0/24, got %s in %s", saved.IP, saved.Subnet)
+	}
+	if saved.IPv6 != "fd00:cafe:babe::3" {
+		t.Errorf("expected IPv6 fd00:cafe:babe::3, got %s", saved.IPv6)
+	}
+}
+
+func TestVMCreateCommand_ReleasesNameOnFailure(t *testing.T) {
+	setupMocks(t)
+	var created, deleted string
+	metadata.Create = func(_ *config.Config, meta *metadata.Metadata, _ func(map[string]*metadata.Metadata) error) error {
+		created = meta.Name
+		return nil
+	}
+	metadata.Delete = func(_ *config.Config, vmName string) error {
+		deleted = vmName
+		return nil
+	}
+	createDisk = func(ctx context.Context, imagePath, vmDiskPath, diskSize string) error {
+		return fmt.Errorf("disk full")
+	}
+	defer func() {
+		for _, name := range []string{"ip", "distro", "user-data"} {
+			f := vmCreateCmd.Flags().Lookup(name)
+			_ = f.Value.Set(f.DefValue)
+			f.Changed = false
+		}
+	}()
+	userDataFile := filepath.Join(t.TempDir(), "user-data.yaml")
+	if err := os.WriteFile(userDataFile, []byte("#cloud-config\npackages:\n  - htop\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err := executeCommand(rootCmd, "vm", "create", "vm2", "--distro", "ubuntu-24.04", "--ip", "192.168.100.3/24", "--user-data", userDataFile)
+	if err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("expected the disk error, got %v", err)
+	}
+	if created != "vm2" || deleted != "vm2" {
+		t.Errorf("expected the name to be reserved then released, got created=%q deleted=%q", created, deleted)
+	}
+	// The files created before the failure are removed with the name.
+	cfg, _ := config.New()
+	if _, err := os.Stat(cloudinit.UserDataPath(filepath.Join(cfg.GetAppDir(), "vms"), "vm2")); !os.IsNotExist(err) {
+		t.Errorf("expected the user-data of the failed VM to be removed, got %v", err)
+	}
+}
+
+func TestVMCreateCommand_UserData(t *testing.T) {
+	tests := []struct {
+		name          string
+		userData      string
+		expectedError string
+	}{
+		{
+			name:     "cloud-config",
+			userData: "#cloud-config\npackages:\n  - htop\n",
+		},
+		{
+			name:          "shell script",
+			userData:      "#!/bin/sh\necho hello\n",
+			expectedError: "invalid --user-data file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupMocks(t)
+			metadata.GetAll = func(*config.Config) (map[string]*metadata.Metadata, error) {
+				return map[string]*metadata.Metadata{
+					"provisioner": {Name: "provisioner", Role: "provisioner", IP: "192.168.100.1", Subnet: "192.168.100.0/24"},
+				}, nil
+			}
+			defer func() {
+				for _, name := range []string{"ip", "distro", "user-data", "vendor-data"} {
+					f := vmCreateCmd.Flags().Lookup(name)
+					_ = f.Value.Set(f.DefValue)
+					f.Changed = false
+				}
+			}()
+			userDataFile := filepath.Join(t.TempDir(), "user-data.yaml")
+			if err := os.WriteFile(userDataFile, []byte(tt.userData), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, _, err := executeCommand(rootCmd, "vm", "create", "vm1", "--distro", "ubuntu-24.04", "--ip", "auto", "--user-data", userDataFile)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing '%s', got '%v'", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			cfg, _ := config.New()
+			stored, err := os.ReadFile(cloudinit.UserDataPath(filepath.Join(cfg.GetAppDir(), "vms"), "vm1"))
+			if err != nil {
+				t.Fatalf("expected the user-data to be stored with the VM: %v", err)
+			}
+			if string(stored) != tt.userData {
+				t.Errorf("expected stored user-data %q, got %q", tt.userData, stored)
+			}
+		})
+	}
+}
+
 func TestVMCreateCommand(t *testing.T) {
 	// Disable color output for consistent testing
 	color.NoColor = true
 
 	// Mock external dependencies
 	originalConfigNew := config.New
+	homeDir := t.TempDir()
 	config.New = func() (*config.Config, error) {
-		return &config.Config{}, nil
+		cfg := &config.Config{}
+		cfg.SetHomeDir(homeDir)
+		return cfg, nil
 	}
 	defer func() { config.New = originalConfigNew }()
 
@@ -164,11 +345,17 @@ func TestVMCreateCommand(t *testing.T) {
 	defer func() { config.GetDistro = originalConfigGetDistro }()
 
 	originalDownloadImageIfNotExists := downloader.DownloadImageIfNotExists
-	downloader.DownloadImageIfNotExists = func(ctx context.Context, imagePath, imageUrl string) error { return nil }
+	downloader.DownloadImageIfNotExists = func(ctx context.Context, imagePath, imageUrl string) error {
+		return os.WriteFile(imagePath, []byte(imageUrl), 0644)
+	}
 	defer func() { downloader.DownloadImageIfNotExists = originalDownloadImageIfNotExists }()
 
 	originalCreateDisk := createDisk
-	createDisk = func(ctx context.Context, imagePath, vmDiskPath, diskSize string) error { return nil }
+	var backingPath string
+	createDisk = func(ctx context.Context, imagePath, vmDiskPath, diskSize string) error {
+		backingPath = imagePath
+		return nil
+	}
 	defer func() { createDisk = originalCreateDisk }()
 
 	originalCreateBlankDisk := createBlankDisk
@@ -188,12 +375,12 @@ func TestVMCreateCommand(t *testing.T) {
 	defer func() { util.ParseSize = originalUtilParseSize }()
 
 	originalCreateDirectories := createDirectories
-	createDirectories = func(appDir string) error { return nil }
+	createDirectories = func(*config.Config) error { return nil }
 	defer func() { createDirectories = originalCreateDirectories }()
 
-	originalCheckForDuplicateIPs := metadata.CheckForDuplicateIPs
-	metadata.CheckForDuplicateIPs = func(cfg *config.Config, ip, ipv6 string) error { return nil }
-	defer func() { metadata.CheckForDuplicateIPs = originalCheckForDuplicateIPs }()
+	originalCheckForDuplicateIPsIn := metadata.CheckForDuplicateIPsIn
+	metadata.CheckForDuplicateIPsIn = func(map[string]*metadata.Metadata, string, string) error { return nil }
+	defer func() { metadata.CheckForDuplicateIPsIn = originalCheckForDuplicateIPsIn }()
 
 	originalCheckExistingVMs := checkExistingVMs
 	checkExistingVMs = func(cfg *config.Config, vmName, role string) error { return nil }
@@ -208,10 +395,35 @@ func TestVMCreateCommand(t *testing.T) {
 	vmCreateCmd.Flags().Set("arch", "x86_64")
 	vmCreateCmd.Flags().Set("ip", "192.168.100.2/24")
 	vmCreateCmd.Flags().Set("disk-size", "20G")
+	vmCreateCmd.Flags().Set("cpus", "4")
+	vmCreateCmd.Flags().Set("memory", "2G")
+	defer func() {
+		for _, name := range []string{"cpus", "memory"} {
+			f := vmCreateCmd.Flags().Lookup(name)
+			_ = f.Value.Set(f.DefValue)
+			f.Changed = false
+		}
+	}()
+
+	originalMetadataWrite := metadata.Write
+	var saved *metadata.Metadata
+	metadata.Write = func(cfg *config.Config, meta *metadata.Metadata) error {
+		saved = meta
+		return nil
+	}
+	defer func() { metadata.Write = originalMetadataWrite }()
 
 	// Execute the command
 	err := vmCreateCmd.RunE(vmCreateCmd, []string{"test-vm"})
 
 	// Assert no error
 	assert.NoError(t, err, "vmCreateCmd.RunE should not return an error")
+	if assert.NotNil(t, saved, "metadata should be saved") {
+		assert.Equal(t, "192.168.100.2", saved.IP)
+		assert.Equal(t, 4, saved.CPUs)
+		assert.Equal(t, 2048, saved.MemoryMB)
+		// The disk is backed on the cached image.
+		assert.Len(t, saved.BaseImage, 64)
+		assert.Equal(t, filepath.Join(homeDir, ".pvmlab", "cache", "blobs", "sha256", saved.BaseImage), backingPath)
+	}
 }
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"pvmlab/internal/metadata"
+	"pvmlab/internal/util"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	diskBusVirtio = "virtio"
+	diskBusNVMe   = "nvme"
+	diskBusSCSI   = "scsi"
+	diskBusSATA   = "sata"
+
+	// maxSATADisks is the number of ports of the AHCI controller.
+	maxSATADisks = 6
+
+	// rootDiskSerial is the serial number of every VM's root disk.
+	rootDiskSerial = "pvmlab-root"
+)
+
+// serialRegex matches serial numbers accepted by all disk buses. virtio-blk
+// and NVMe serials are limited to 20 characters.
+var serialRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,20}$`)
+
+// vmDiskCmd represents the vm disk command
+var vmDiskCmd = &cobra.Command{
+	Use:   "disk",
+	Short: "Manage the data disks of a VM",
+	Long: `Manage the data disks attached to a VM in addition to its root disk.
+Disks can be attached to the virtio, nvme, scsi or sata bus.`,
+}
+
+// parseDiskSpec parses a disk specification of the form
+// size[,bus=virtio|nvme|scsi|sata][,serial=...].
+func parseDiskSpec(spec string) (metadata.Disk, error) {
+	parts := strings.Split(spec, ",")
+	disk := metadata.Disk{Size: parts[0], Bus: diskBusVirtio}
+	if _, err := util.ParseSize(disk.Size); err != nil {
+		return disk, fmt.Errorf("invalid disk '%s': %w", spec, err)
+	}
+	for _, part := range parts[1:] {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return disk, fmt.Errorf("invalid disk '%s': expected key=value, got '%s'", spec, part)
+		}
+		switch key {
+		case "bus":
+			disk.Bus = value
+		case "serial":
+			disk.Serial = value
+		default:
+			return disk, fmt.Errorf("invalid disk '%s': unknown option '%s'", spec, key)
+		}
+	}
+	switch disk.Bus {
+	case diskBusVirtio, diskBusNVMe, diskBusSCSI, diskBusSATA:
+	default:
+		return disk, fmt.Errorf("invalid disk '%s': bus must be one of virtio, nvme, scsi or sata", spec)
+	}
+	if disk.Serial != "" && !serialRegex.MatchString(disk.Serial) {
+		return disk, fmt.Errorf("invalid disk '%s': serial must be 1-20 letters, digits, '_', '.' or '-'", spec)
+	}
+	if disk.Serial == rootDiskSerial {
+		return disk, fmt.Errorf("invalid disk '%s': serial '%s' is reserved for the root disk", spec, rootDiskSerial)
+	}
+	return disk, nil
+}
+
+// addDisk names a new disk and appends it to the VM's disks.
+func addDisk(meta *metadata.Metadata, disk metadata.Disk) (metadata.Disk, error) {
+	used := map[string]bool{}
+	sata := 0
+	for _, d := range meta.Disks {
+		used[d.Name] = true
+		if d.Serial != "" && d.Serial == disk.Serial {
+			return disk, fmt.Errorf("disk '%s' already uses serial '%s'", d.Name, d.Serial)
+		}
+		if d.Bus == diskBusSATA {
+			sata++
+		}
+	}
+	if disk.Bus == diskBusSATA && sata >= maxSATADisks {
+		return disk, fmt.Errorf("a VM can have at most %d sata disks", maxSATADisks)
+	}
+	for i := 1; ; i++ {
+		name := fmt.Sprintf("data%d", i)
+		if !used[name] {
+			disk.Name = name
+			break
+		}
+	}
+	meta.Disks = append(meta.Disks, disk)
+	return disk, nil
+}
+
+// dataDiskPath returns the path of the image of a VM's data disk.
+func dataDiskPath(appDir, vmName, diskName string) string {
+	return filepath.Join(appDir, "vms", vmName+"-"+diskName+".qcow2")
+}
+
+// dataDiskArgs returns the QEMU arguments attaching the VM's data disks.
+func dataDiskArgs(appDir, vmName string, disks []metadata.Disk) []string {
+	var args []string
+	var scsi, sata bool
+	sataPort := 0
+	for _, disk := range disks {
+		id := "disk-" + disk.Name
+		args = append(args, "-drive", fmt.Sprintf("file=%s,format=qcow2,if=none,id=%s", dataDiskPath(appDir, vmName, disk.Name), id))
+
+		var device string
+		switch disk.Bus {
+		case diskBusNVMe:
+			// NVMe controllers require a serial number.
+			serial := disk.Serial
+			if serial == "" {
+				serial = "pvmlab-" + disk.Name
+			}
+			args = append(args, "-device", fmt.Sprintf("nvme,drive=%s,serial=%s", id, serial))
+			continue
+		case diskBusSCSI:
+			if !scsi {
+				args = append(args, "-device", "virtio-scsi-pci,id=scsi0")
+				scsi = true
+			}
+			device = fmt.Sprintf("scsi-hd,drive=%s,bus=scsi0.0", id)
+		case diskBusSATA:
+			if !sata {
+				args = append(args, "-device", "ich9-ahci,id=ahci0")
+				sata = true
+			}
+			device = fmt.Sprintf("ide-hd,drive=%s,bus=ahci0.%d", id, sataPort)
+			sataPort++
+		default:
+			device = fmt.Sprintf("virtio-blk-pci,drive=%s", id)
+		}
+		if disk.Serial != "" {
+			device += ",serial=" + disk.Serial
+		}
+		args = append(args, "-device", device)
+	}
+	return args
+}
+
+func init() {
+	vmCmd.AddCommand(vmDiskCmd)
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"pvmlab/internal/config"
+	"pvmlab/internal/metadata"
+	"pvmlab/internal/pidfile"
+	"syscall"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// vmDiskAddCmd represents the vm disk add command
+var vmDiskAddCmd = &cobra.Command{
+	Use:   "add <vm-name> <size[,bus=virtio|nvme|scsi|sata][,serial=...]>",
+	Short: "Adds a data disk to a stopped VM",
+	Example: `  pvmlab vm disk add my-target 20G
+  pvmlab vm disk add my-target 100G,bus=nvme,serial=NVME0001`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: VmNameFirstArgCompleter,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Create a context that is cancelled on a SIGINT or SIGTERM.
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		vmName := args[0]
+		disk, err := parseDiskSpec(args[1])
+		if err != nil {
+			return err
+		}
+
+		cfg, err := config.New()
+		if err != nil {
+			return err
+		}
+		running, err := pidfile.IsRunning(cfg, vmName)
+		if err != nil {
+			return fmt.Errorf("error checking VM status: %w", err)
+		}
+		if running {
+			return fmt.Errorf("VM '%s' is running. Stop it with 'pvmlab vm stop %s' first", vmName, vmName)
+		}
+
+		// The disk is named and created while the metadata is locked, so
+		// that concurrent additions get different names.
+		if _, err := metadata.Update(cfg, vmName, func(meta *metadata.Metadata) error {
+			if disk, err = addDisk(meta, disk); err != nil {
+				return err
+			}
+			if err := createBlankDisk(ctx, dataDiskPath(cfg.GetAppDir(), vmName, disk.Name), disk.Size); err != nil {
+				return fmt.Errorf("failed to create disk: %w", err)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		color.Green("✔ Disk '%s' (%s, %s) added to VM '%s'.", disk.Name, disk.Size, disk.Bus, vmName)
+		return nil
+	},
+}
+
+func init() {
+	vmDiskCmd.AddCommand(vmDiskAddCmd)
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"pvmlab/internal/config"
+	"pvmlab/internal/metadata"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+// vmDiskLsCmd represents the vm disk ls command
+var vmDiskLsCmd = &cobra.Command{
+	Use:               "ls <vm-name>",
+	Short:             "Lists the data disks of a VM",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: VmNameCompleter,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+
+		cfg, err := config.New()
+		if err != nil {
+			return err
+		}
+		meta, err := metadata.Load(cfg, vmName)
+		if err != nil {
+			return fmt.Errorf("error loading VM metadata: %w", err)
+		}
+
+		if len(meta.Disks) == 0 {
+			color.Yellow("VM '%s' has no data disks.", vmName)
+			return nil
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.Header([]string{"NAME", "SIZE", "BUS", "SERIAL", "IMAGE"})
+		for _, disk := range meta.Disks {
+			serial := disk.Serial
+			if serial == "" {
+				serial = "N/A"
+			}
+			table.Append([]string{disk.Name, disk.Size, disk.Bus, serial, dataDiskPath(cfg.GetAppDir(), vmName, disk.Name)})
+		}
+		table.Render()
+		return nil
+	},
+}
+
+func init() {
+	vmDiskCmd.AddCommand(vmDiskLsCmd)
+}
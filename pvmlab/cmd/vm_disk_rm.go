@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"pvmlab/internal/config"
+	"pvmlab/internal/metadata"
+	"pvmlab/internal/pidfile"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// vmDiskRmCmd represents the vm disk rm command
+var vmDiskRmCmd = &cobra.Command{
+	Use:               "rm <vm-name> <disk-name>",
+	Short:             "Removes a data disk from a stopped VM and deletes its image",
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: VmNameFirstArgCompleter,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName, diskName := args[0], args[1]
+
+		cfg, err := config.New()
+		if err != nil {
+			return err
+		}
+		running, err := pidfile.IsRunning(cfg, vmName)
+		if err != nil {
+			return fmt.Errorf("error checking VM status: %w", err)
+		}
+		if running {
+			return fmt.Errorf("VM '%s' is running. Stop it with 'pvmlab vm stop %s' first", vmName, vmName)
+		}
+		if err := checkNoClones(cfg, vmName, "remove a disk of"); err != nil {
+			return err
+		}
+
+		if _, err := metadata.Update(cfg, vmName, func(meta *metadata.Metadata) error {
+			index := -1
+			for i, disk := range meta.Disks {
+				if disk.Name == diskName {
+					index = i
+					break
+				}
+			}
+			if index == -1 {
+				return fmt.Errorf("VM '%s' has no disk named '%s'", vmName, diskName)
+			}
+			meta.Disks = append(meta.Disks[:index], meta.Disks[index+1:]...)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		path := dataDiskPath(cfg.GetAppDir(), vmName, diskName)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			color.Yellow("! Warning: could not remove disk image %s: %v", path, err)
+		}
+
+		color.Green("✔ Disk '%s' removed from VM '%s'.", diskName, vmName)
+		return nil
+	},
+}
+
+func init() {
+	vmDiskCmd.AddCommand(vmDiskRmCmd)
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"pvmlab/internal/config"
+	"pvmlab/internal/metadata"
+	"pvmlab/internal/pidfile"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDiskSpec(t *testing.T) {
+	tests := []struct {
+		spec          string
+		want          metadata.Disk
+		expectedError string
+	}{
+		{spec: "20G", want: metadata.Disk{Size: "20G", Bus: "virtio"}},
+		{spec: "100G,bus=nvme,serial=NVME0001", want: metadata.Disk{Size: "100G", Bus: "nvme", Serial: "NVME0001"}},
+		{spec: "1T,serial=sata-1,bus=sata", want: metadata.Disk{Size: "1T", Bus: "sata", Serial: "sata-1"}},
+		{spec: "big", expectedError: "invalid size format"},
+		{spec: "10G,bus=ide", expectedError: "bus must be one of"},
+		{spec: "10G,nvme", expectedError: "expected key=value"},
+		{spec: "10G,cache=none", expectedError: "unknown option 'cache'"},
+		{spec: "10G,serial=way-too-long-serial-number", expectedError: "serial must be 1-20"},
+		{spec: "10G,serial=pvmlab-root", expectedError: "reserved for the root disk"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseDiskSpec(tt.spec)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing '%s', got '%v'", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddDisk(t *testing.T) {
+	meta := &metadata.Metadata{Disks: []metadata.Disk{
+		{Name: "data1", Size: "10G", Bus: "sata"},
+		{Name: "data3", Size: "10G", Bus: "nvme", Serial: "NVME1"},
+	}}
+
+	disk, err := addDisk(meta, metadata.Disk{Size: "5G", Bus: "virtio"})
+	if err != nil {
+		t.Fatalf("addDisk() failed: %v", err)
+	}
+	if disk.Name != "data2" {
+		t.Errorf("expected the first free name 'data2', got '%s'", disk.Name)
+	}
+	if len(meta.Disks) != 3 {
+		t.Errorf("expected 3 disks, got %d", len(meta.Disks))
+	}
+
+	if _, err := addDisk(meta, metadata.Disk{Size: "5G", Bus: "nvme", Serial: "NVME1"}); err == nil || !strings.Contains(err.Error(), "already uses serial") {
+		t.Errorf("expected duplicate serial error, got %v", err)
+	}
+
+	for i := 0; i < maxSATADisks-1; i++ {
+		if _, err := addDisk(meta, metadata.Disk{Size: "1G", Bus: "sata"}); err != nil {
+			t.Fatalf("addDisk() failed: %v", err)
+		}
+	}
+	if _, err := addDisk(meta, metadata.Disk{Size: "1G", Bus: "sata"}); err == nil || !strings.Contains(err.Error(), "at most 6 sata disks") {
+		t.Errorf("expected too many sata disks error, got %v", err)
+	}
+}
+
+func TestDataDiskArgs(t *testing.T) {
+	disks := []metadata.Disk{
+		{Name: "data1", Bus: "virtio", Serial: "V1"},
+		{Name: "data2", Bus: "nvme"},
+		{Name: "data3", Bus: "scsi"},
+		{Name: "data4", Bus: "scsi"},
+		{Name: "data5", Bus: "sata", Serial: "S1"},
+		{Name: "data6", Bus: "sata"},
+	}
+	got := dataDiskArgs("/app", "vm1", disks)
+	want := []string{
+		"-drive", "file=/app/vms/vm1-data1.qcow2,format=qcow2,if=none,id=disk-data1",
+		"-device", "virtio-blk-pci,drive=disk-data1,serial=V1",
+		"-drive", "file=/app/vms/vm1-data2.qcow2,format=qcow2,if=none,id=disk-data2",
+		"-device", "nvme,drive=disk-data2,serial=pvmlab-data2",
+		"-drive", "file=/app/vms/vm1-data3.qcow2,format=qcow2,if=none,id=disk-data3",
+		"-device", "virtio-scsi-pci,id=scsi0",
+		"-device", "scsi-hd,drive=disk-data3,bus=scsi0.0",
+		"-drive", "file=/app/vms/vm1-data4.qcow2,format=qcow2,if=none,id=disk-data4",
+		"-device", "scsi-hd,drive=disk-data4,bus=scsi0.0",
+		"-drive", "file=/app/vms/vm1-data5.qcow2,format=qcow2,if=none,id=disk-data5",
+		"-device", "ich9-ahci,id=ahci0",
+		"-device", "ide-hd,drive=disk-data5,bus=ahci0.0,serial=S1",
+		"-drive", "file=/app/vms/vm1-data6.qcow2,format=qcow2,if=none,id=disk-data6",
+		"-device", "ide-hd,drive=disk-data6,bus=ahci0.1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected args:\ngot:  %v\nwant: %v", got, want)
+	}
+}
+
+func TestVMDiskCommands(t *testing.T) {
+	setupMocks(t)
+	cfg, _ := config.New()
+	appDir := cfg.GetAppDir()
+	if err := os.MkdirAll(filepath.Join(appDir, "vms"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	meta := &metadata.Metadata{Name: "test-vm", Role: "target"}
+	metadata.Load = func(c *config.Config, name string) (*metadata.Metadata, error) {
+		return meta, nil
+	}
+	metadata.Write = func(c *config.Config, m *metadata.Metadata) error {
+		meta = m
+		return nil
+	}
+	originalCreateBlankDisk := createBlankDisk
+	defer func() { createBlankDisk = originalCreateBlankDisk }()
+	var created []string
+	createBlankDisk = func(ctx context.Context, vmDiskPath, diskSize string) error {
+		created = append(created, filepath.Base(vmDiskPath)+":"+diskSize)
+		return os.WriteFile(vmDiskPath, nil, 0644)
+	}
+
+	if _, _, err := executeCommand(rootCmd, "vm", "disk", "add", "test-vm", "20G,bus=nvme"); err != nil {
+		t.Fatalf("vm disk add failed: %v", err)
+	}
+	if _, _, err := executeCommand(rootCmd, "vm", "disk", "add", "test-vm", "10G"); err != nil {
+		t.Fatalf("vm disk add failed: %v", err)
+	}
+	if want := []string{"test-vm-data1.qcow2:20G", "test-vm-data2.qcow2:10G"}; !reflect.DeepEqual(created, want) {
+		t.Errorf("unexpected disks created: got %v, want %v", created, want)
+	}
+
+	out, _, err := executeCommand(rootCmd, "vm", "disk", "ls", "test-vm")
+	if err != nil {
+		t.Fatalf("vm disk ls failed: %v", err)
+	}
+	if !strings.Contains(out, "data1") || !strings.Contains(out, "nvme") || !strings.Contains(out, "data2") {
+		t.Errorf("expected both disks in output, got: %s", out)
+	}
+
+	if _, _, err := executeCommand(rootCmd, "vm", "disk", "rm", "test-vm", "data1"); err != nil {
+		t.Fatalf("vm disk rm failed: %v", err)
+	}
+	if want := []metadata.Disk{{Name: "data2", Size: "10G", Bus: "virtio"}}; !reflect.DeepEqual(meta.Disks, want) {
+		t.Errorf("unexpected disks after rm: got %+v, want %+v", meta.Disks, want)
+	}
+	if _, err := os.Stat(filepath.Join(appDir, "vms", "test-vm-data1.qcow2")); !os.IsNotExist(err) {
+		t.Errorf("expected disk image to be removed")
+	}
+
+	if _, _, err := executeCommand(rootCmd, "vm", "disk", "rm", "test-vm", "data7"); err == nil || !strings.Contains(err.Error(), "has no disk named 'data7'") {
+		t.Errorf("expected missing disk error, got %v", err)
+	}
+
+	pidfile.IsRunning = func(c *config.Config, name string) (bool, error) {
+		return true, nil
+	}
+	if _, _, err := executeCommand(rootCmd, "vm", "disk", "add", "test-vm", "10G"); err == nil || !strings.Contains(err.Error(), "is running") {
+		t.Errorf("expected running VM error, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"pvmlab/internal/config"
+	"pvmlab/internal/metadata"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var vmFsckRepair bool
+
+// vmFsckCmd represents the vm fsck command
+var vmFsckCmd = &cobra.Command{
+	Use:   "fsck",
+	Short: "Checks the VM metadata store for corrupted records",
+	Long: `Checks the VM metadata files in ~/.pvmlab/vms for problems that other
+commands silently skip: files that can't be parsed, records whose name doesn't
+match their file, leftovers of interrupted writes, unknown roles and IP or MAC
+addresses used by several VMs.
+
+With --repair, unreadable records are moved aside to <name>.json.corrupt,
+names are fixed and leftovers removed. The other problems must be fixed by
+hand. The command fails if problems are left.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.New()
+		if err != nil {
+			return err
+		}
+
+		problems, err := metadata.Check(cfg, vmFsckRepair)
+		if structuredOutput() {
+			if printErr := printStructured(cmd.OutOrStdout(), problemsOrEmpty(problems)); printErr != nil {
+				return printErr
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("error checking the VM metadata store: %w", err)
+		}
+
+		var left int
+		for _, p := range problems {
+			if !p.Repaired {
+				left++
+			}
+			if structuredOutput() {
+				continue
+			}
+			switch {
+			case p.Repaired:
+				color.Green("✔ %s: %s (repaired: %s)", p.Path, p.Description, p.Repair)
+			case p.Repair != "":
+				color.Yellow("! %s: %s (run with --repair to %s)", p.Path, p.Description, p.Repair)
+			default:
+				color.Yellow("! %s: %s", p.Path, p.Description)
+			}
+		}
+
+		if left > 0 {
+			return fmt.Errorf("found %d problem(s) in the VM metadata store", left)
+		}
+		if !structuredOutput() {
+			color.Green("✔ The VM metadata store is consistent.")
+		}
+		return nil
+	},
+}
+
+// problemsOrEmpty makes sure no problems are printed as an empty list rather
+// than null.
+func problemsOrEmpty(problems []metadata.Problem) []metadata.Problem {
+	if problems == nil {
+		return []metadata.Problem{}
+	}
+	return problems
+}
+
+func init() {
+	vmCmd.AddCommand(vmFsckCmd)
+	vmFsckCmd.Flags().BoolVar(&vmFsckRepair, "repair", false, "Repair the problems that can be repaired")
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"errors"
+	"pvmlab/internal/config"
+	"pvmlab/internal/metadata"
+	"strings"
+	"testing"
+)
+
+func TestVMFsckCommand(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		problems       []metadata.Problem
+		checkErr       error
+		expectedRepair bool
+		expectedOut    []string
+		expectedError  string
+	}{
+		{
+			name:        "consistent store",
+			args:        []string{"vm", "fsck"},
+			expectedOut: []string{"The VM metadata store is consistent."},
+		},
+		{
+			name: "problems found",
+			args: []string{"vm", "fsck"},
+			problems: []metadata.Problem{
+				{Path: "/vms/broken.json", Description: "unreadable record", Repair: "move it aside to broken.json.corrupt"},
+				{Path: "/vms/vm2.json", Description: "IP address 192.168.100.2 is also used by VM 'vm1'"},
+			},
+			expectedOut: []string{
+				"/vms/broken.json: unreadable record (run with --repair to move it aside to broken.json.corrupt)",
+				"/vms/vm2.json: IP address 192.168.100.2 is also used by VM 'vm1'",
+			},
+			expectedError: "found 2 problem(s)",
+		},
+		{
+			name:           "all problems repaired",
+			args:           []string{"vm", "fsck", "--repair"},
+			problems:       []metadata.Problem{{Path: "/vms/.vm1.json.1.tmp", Description: "leftover of an interrupted write", Repair: "remove the file", Repaired: true}},
+			expectedRepair: true,
+			expectedOut:    []string{"(repaired: remove the file)", "The VM metadata store is consistent."},
+		},
+		{
+			name:          "check error",
+			args:          []string{"vm", "fsck"},
+			checkErr:      errors.New("permission denied"),
+			expectedError: "error checking the VM metadata store: permission denied",
+		},
+		{
+			name:        "json output",
+			args:        []string{"vm", "fsck", "-o", "json"},
+			expectedOut: []string{"[]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupMocks(t)
+			defer func() { vmFsckRepair, outputFormat = false, outputTable }()
+			var gotRepair bool
+			metadata.Check = func(_ *config.Config, repair bool) ([]metadata.Problem, error) {
+				gotRepair = repair
+				return tt.problems, tt.checkErr
+			}
+
+			output, _, err := executeCommand(rootCmd, tt.args...)
+
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("expected error to contain '%s', but got '%v'", tt.expectedError, err)
+				}
+			} else if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			if gotRepair != tt.expectedRepair {
+				t.Errorf("expected repair to be %v, got %v", tt.expectedRepair, gotRepair)
+			}
+			for _, expected := range tt.expectedOut {
+				if !strings.Contains(output, expected) {
+					t.Errorf("expected output to contain '%s', but got '%s'", expected, output)
+				}
+			}
+		})
+	}
+}
@@ -2,22 +2,39 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"pvmlab/internal/config"
 	"pvmlab/internal/metadata"
 	"pvmlab/internal/pidfile"
+	"pvmlab/internal/qmp"
 	"sort"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
 )
 
+// vmListEntry is a VM in the structured output of 'vm list': its metadata
+// plus its runtime state.
+type vmListEntry struct {
+	*metadata.Metadata
+	Status        string     `json:"status"`
+	Running       bool       `json:"running"`
+	PID           int        `json:"pid,omitempty"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	UptimeSeconds int64      `json:"uptime_seconds,omitempty"`
+}
+
 // vmListCmd represents the list command
 var vmListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "Lists all created VMs and their status",
-	Long:  `Lists all VMs that have been created, showing their role, IP, MAC, and running status.`,
+	Long: `Lists all VMs that have been created, showing their role, IP, MAC, and run status (Running, Paused or Stopped).
+
+With --output json or yaml, the full metadata of each VM is printed along with
+its runtime state: status, PID, start time and uptime.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg, err := config.New()
 		if err != nil {
@@ -29,33 +46,49 @@ var vmListCmd = &cobra.Command{
 			return fmt.Errorf("error getting VM list: %w", err)
 		}
 
-		if len(allMeta) == 0 {
-			color.Yellow("No VMs have been created yet.")
-			return nil
-		}
-
-		table := tablewriter.NewWriter(os.Stdout)
-		header := []string{"NAME", "ARCH", "BOOT TYPE", "PRIVATE IP", "PRIVATE IPV6", "MAC", "DISTRO", "STATUS"}
-		table.Header(header)
 		// Sort VM names for consistent output
 		vmNames := make([]string, 0, len(allMeta))
 		for name := range allMeta {
 			vmNames = append(vmNames, name)
 		}
 		sort.Strings(vmNames)
+
+		entries := make([]vmListEntry, 0, len(vmNames))
 		for _, vmName := range vmNames {
-			meta := allMeta[vmName]
-			status := color.RedString("Stopped")
-			isRunning, err := pidfile.IsRunning(cfg, vmName)
-			if err != nil {
-				color.Yellow("! Warning: could not check status for %s: %v", vmName, err)
+			entries = append(entries, vmRuntimeState(cfg, allMeta[vmName], cmd.ErrOrStderr()))
+		}
+
+		if structuredOutput() {
+			return printStructured(cmd.OutOrStdout(), entries)
+		}
+
+		// Unreadable records are skipped above, point at them. Outdated
+		// records are upgraded on load, so they are not worth a warning.
+		if problems, err := metadata.Check(cfg, false); err == nil {
+			var count int
+			for _, p := range problems {
+				if p.Kind != metadata.ProblemOutdated {
+					count++
+				}
 			}
-			if isRunning {
-				status = color.GreenString("Running")
+			if count > 0 {
+				color.Yellow("! Warning: found %d problem(s) in the VM metadata store, run 'pvmlab vm fsck' for details.", count)
 			}
-			displayName := vmName
+		}
+
+		if len(allMeta) == 0 {
+			color.Yellow("No VMs have been created yet.")
+			return nil
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		header := []string{"NAME", "ARCH", "BOOT TYPE", "PRIVATE IP", "PRIVATE IPV6", "MAC", "DISTRO", "STATUS"}
+		table.Header(header)
+		for _, entry := range entries {
+			meta := entry.Metadata
+			displayName := meta.Name
 			if meta.Role == "provisioner" {
-				displayName = color.RedString(vmName)
+				displayName = color.RedString(meta.Name)
 			}
 			ipv6 := meta.IPv6
 			if ipv6 == "" {
@@ -85,7 +118,7 @@ var vmListCmd = &cobra.Command{
 				ipv6,
 				meta.MAC,
 				distroToDisplay,
-				status,
+				colorStatus(entry.Status),
 			}
 			table.Append(row)
 		}
@@ -94,6 +127,63 @@ var vmListCmd = &cobra.Command{
 	},
 }
 
+// vmRuntimeState returns the metadata of a VM along with its runtime state.
+// Warnings go to errOut with a structured output.
+func vmRuntimeState(cfg *config.Config, meta *metadata.Metadata, errOut io.Writer) vmListEntry {
+	entry := vmListEntry{Metadata: meta, Status: "stopped"}
+	isRunning, err := pidfile.IsRunning(cfg, meta.Name)
+	if err != nil {
+		warnf(errOut, "! Warning: could not check status for %s: %v", meta.Name, err)
+	}
+	if !isRunning {
+		return entry
+	}
+	entry.Running = true
+	entry.Status = runStatus(cfg.GetAppDir(), meta.Name)
+	if pid, err := pidfile.Read(cfg, meta.Name); err == nil {
+		entry.PID = pid
+	}
+	if started, err := pidfile.StartTime(cfg, meta.Name); err == nil {
+		entry.StartedAt = &started
+		entry.UptimeSeconds = int64(time.Since(started).Seconds())
+	}
+	return entry
+}
+
+// runStatus returns the status of a running VM as reported by QMP, e.g.
+// running or paused, or shutdown-pending if its guest was asked to power off
+// and is still running. VMs whose QMP socket can't be queried are reported as
+// running.
+func runStatus(appDir, vmName string) string {
+	status := "running"
+	if s, err := qmp.QueryStatus(qmpSocketPath(appDir, vmName), qmpTimeout); err == nil {
+		status = s.Status
+	}
+	if status == "running" && powerdownPending(appDir, vmName) {
+		return "shutdown-pending"
+	}
+	return status
+}
+
+// colorStatus formats a VM status for the table output.
+func colorStatus(status string) string {
+	switch status {
+	case "stopped":
+		return color.RedString("Stopped")
+	case "running":
+		return color.GreenString("Running")
+	case "paused":
+		return color.YellowString("Paused")
+	case "shutdown-pending":
+		return color.YellowString("Shutdown pending")
+	// QEMU runs without -no-shutdown, so it exits when the guest shuts down
+	// and the shutdown status is never reported.
+	default:
+		// e.g. inmigrate, internal-error or guest-panicked.
+		return color.YellowString(status)
+	}
+}
+
 func init() {
 	vmCmd.AddCommand(vmListCmd)
 }
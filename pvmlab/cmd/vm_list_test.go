@@ -1,11 +1,20 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
 	"pvmlab/internal/config"
 	"pvmlab/internal/metadata"
 	"pvmlab/internal/pidfile"
+	"pvmlab/internal/qmp"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/fatih/color"
 )
 
 func TestVMListCommand(t *testing.T) {
@@ -64,6 +73,52 @@ func TestVMListCommand(t *testing.T) {
 			},
 			expectedOut: []string{"vm1", "Stopped", "vm2", "Running"},
 		},
+		{
+			name: "paused vm",
+			setupMocks: func() {
+				metadata.GetAll = func(c *config.Config) (map[string]*metadata.Metadata, error) {
+					return map[string]*metadata.Metadata{
+						"test-vm": {Name: "test-vm", Role: "target", IP: "1.1.1.1", MAC: "aa:bb:cc"},
+					}, nil
+				}
+				pidfile.IsRunning = func(c *config.Config, name string) (bool, error) {
+					return true, nil
+				}
+				qmp.QueryStatus = func(socketPath string, timeout time.Duration) (*qmp.Status, error) {
+					return &qmp.Status{Status: "paused"}, nil
+				}
+			},
+			expectedOut: []string{"test-vm", "Paused"},
+		},
+		{
+			name: "running vm without qmp",
+			setupMocks: func() {
+				metadata.GetAll = func(c *config.Config) (map[string]*metadata.Metadata, error) {
+					return map[string]*metadata.Metadata{
+						"test-vm": {Name: "test-vm", Role: "target", IP: "1.1.1.1", MAC: "aa:bb:cc"},
+					}, nil
+				}
+				pidfile.IsRunning = func(c *config.Config, name string) (bool, error) {
+					return true, nil
+				}
+				qmp.QueryStatus = func(socketPath string, timeout time.Duration) (*qmp.Status, error) {
+					return nil, fmt.Errorf("failed to connect to QMP socket")
+				}
+			},
+			expectedOut: []string{"test-vm", "Running"},
+		},
+		{
+			name: "corrupted records",
+			setupMocks: func() {
+				metadata.Check = func(*config.Config, bool) ([]metadata.Problem, error) {
+					return []metadata.Problem{
+						{Kind: metadata.ProblemUnreadable, Path: "broken.json", Description: "unreadable record"},
+						{Kind: metadata.ProblemOutdated, Path: "old.json", Description: "outdated schema version 1"},
+					}, nil
+				}
+			},
+			expectedOut: []string{"found 1 problem(s) in the VM metadata store, run 'pvmlab vm fsck'", "No VMs have been created yet."},
+		},
 	}
 
 	for _, tt := range tests {
@@ -84,3 +139,126 @@ func TestVMListCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestRunStatus_ShutdownPending(t *testing.T) {
+	setupMocks(t)
+	appDir := t.TempDir()
+	pidPath := filepath.Join(appDir, "pids", "vm1.pid")
+	if err := os.MkdirAll(filepath.Dir(pidPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pidPath, []byte("123"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if status := runStatus(appDir, "vm1"); status != "running" {
+		t.Errorf("expected running, got %s", status)
+	}
+
+	markPowerdown(appDir, "vm1")
+	if status := runStatus(appDir, "vm1"); status != "shutdown-pending" {
+		t.Errorf("expected shutdown-pending, got %s", status)
+	}
+	if !strings.Contains(colorStatus("shutdown-pending"), "Shutdown pending") {
+		t.Errorf("unexpected table status %q", colorStatus("shutdown-pending"))
+	}
+
+	// A request made before the VM was started again is stale.
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(powerdownPath(appDir, "vm1"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if status := runStatus(appDir, "vm1"); status != "running" {
+		t.Errorf("expected running with a stale request, got %s", status)
+	}
+
+	cleanupFiles("vm1", appDir)
+	if _, err := os.Stat(powerdownPath(appDir, "vm1")); !os.IsNotExist(err) {
+		t.Errorf("expected the request to be removed when the VM stops, got %v", err)
+	}
+}
+
+func TestVMListCommand_StructuredOutput(t *testing.T) {
+	setupMocks(t)
+	defer func() { outputFormat = outputTable }()
+
+	started := time.Now().Add(-90 * time.Second)
+	metadata.GetAll = func(c *config.Config) (map[string]*metadata.Metadata, error) {
+		return map[string]*metadata.Metadata{
+			"vm1": {Name: "vm1", Role: "target", IP: "1.1.1.1", MAC: "aa:bb:cc"},
+			"vm2": {Name: "vm2", Role: "provisioner", IP: "2.2.2.2", MAC: "dd:ee:ff", SSHPort: 2222},
+		}, nil
+	}
+	pidfile.IsRunning = func(c *config.Config, name string) (bool, error) {
+		return name == "vm2", nil
+	}
+	pidfile.Read = func(c *config.Config, name string) (int, error) {
+		return 4242, nil
+	}
+	pidfile.StartTime = func(c *config.Config, name string) (time.Time, error) {
+		return started, nil
+	}
+
+	output, _, err := executeCommand(rootCmd, "vm", "list", "--output", "json")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	var entries []map[string]any
+	if err := json.Unmarshal([]byte(output), &entries); err != nil {
+		t.Fatalf("expected JSON output, got '%s': %v", output, err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 VMs, got %d", len(entries))
+	}
+	if entries[0]["name"] != "vm1" || entries[0]["status"] != "stopped" || entries[0]["running"] != false || entries[0]["pid"] != nil {
+		t.Errorf("unexpected stopped VM: %v", entries[0])
+	}
+	if entries[1]["name"] != "vm2" || entries[1]["status"] != "running" || entries[1]["pid"] != float64(4242) || entries[1]["ssh_port"] != float64(2222) {
+		t.Errorf("unexpected running VM: %v", entries[1])
+	}
+	if uptime, _ := entries[1]["uptime_seconds"].(float64); uptime < 90 {
+		t.Errorf("expected an uptime of at least 90s, got %v", entries[1]["uptime_seconds"])
+	}
+
+	output, _, err = executeCommand(rootCmd, "vm", "list", "-o", "yaml")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if !strings.Contains(output, "  name: vm1\n") || !strings.Contains(output, "  pid: 4242\n") {
+		t.Errorf("unexpected YAML output: %s", output)
+	}
+}
+
+func TestVMListCommand_StructuredOutputWarnings(t *testing.T) {
+	setupMocks(t)
+	defer func() { outputFormat = outputTable }()
+
+	metadata.GetAll = func(c *config.Config) (map[string]*metadata.Metadata, error) {
+		return map[string]*metadata.Metadata{"vm1": {Name: "vm1", Role: "target"}}, nil
+	}
+	pidfile.IsRunning = func(c *config.Config, name string) (bool, error) {
+		return false, fmt.Errorf("permission denied")
+	}
+
+	// The warnings go to stderr, leaving stdout parseable.
+	var stdout, stderr bytes.Buffer
+	originalColorOutput := color.Output
+	color.Output = &stdout
+	defer func() {
+		color.Output = originalColorOutput
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+	}()
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetErr(&stderr)
+	rootCmd.SetArgs([]string{"vm", "list", "--output", "json"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	var entries []map[string]any
+	if err := json.Unmarshal(stdout.Bytes(), &entries); err != nil || len(entries) != 1 {
+		t.Fatalf("expected JSON output, got '%s': %v", stdout.String(), err)
+	}
+	if !strings.Contains(stderr.String(), "could not check status for vm1: permission denied") {
+		t.Errorf("expected the warning on stderr, got '%s'", stderr.String())
+	}
+}
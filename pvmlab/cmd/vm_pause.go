@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// vmPauseCmd represents the vm pause command
+var vmPauseCmd = &cobra.Command{
+	Use:               "pause <vm-name>",
+	Short:             "Pauses a running VM",
+	Long:              `Pauses a running VM's virtual CPUs. The VM keeps its memory and can be resumed with 'pvmlab vm resume'.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: VmNameCompleter,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		color.Cyan("i Pausing VM: %s", vmName)
+		if err := runQMPCommand(vmName, "stop"); err != nil {
+			return err
+		}
+		color.Green("✔ VM '%s' paused.", vmName)
+		return nil
+	},
+}
+
+func init() {
+	vmCmd.AddCommand(vmPauseCmd)
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"pvmlab/internal/config"
+	"pvmlab/internal/pidfile"
+	"pvmlab/internal/qmp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVMQMPCommands(t *testing.T) {
+	tests := []struct {
+		name            string
+		args            []string
+		running         bool
+		qmpErr          error
+		expectedCommand string
+		expectedOut     string
+		expectedError   string
+	}{
+		{
+			name:            "pause",
+			args:            []string{"vm", "pause", "test-vm"},
+			running:         true,
+			expectedCommand: "stop",
+			expectedOut:     "VM 'test-vm' paused.",
+		},
+		{
+			name:            "resume",
+			args:            []string{"vm", "resume", "test-vm"},
+			running:         true,
+			expectedCommand: "cont",
+			expectedOut:     "VM 'test-vm' resumed.",
+		},
+		{
+			name:            "reset",
+			args:            []string{"vm", "reset", "test-vm"},
+			running:         true,
+			expectedCommand: "system_reset",
+			expectedOut:     "VM 'test-vm' reset.",
+		},
+		{
+			name:          "vm not running",
+			args:          []string{"vm", "pause", "test-vm"},
+			expectedError: "VM 'test-vm' is not running",
+		},
+		{
+			name:          "qmp error",
+			args:          []string{"vm", "resume", "test-vm"},
+			running:       true,
+			qmpErr:        fmt.Errorf("failed to connect to QMP socket"),
+			expectedError: "failed to send 'cont' to VM 'test-vm'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupMocks(t)
+			pidfile.IsRunning = func(c *config.Config, name string) (bool, error) {
+				return tt.running, nil
+			}
+			var gotSocket, gotCommand string
+			qmp.Run = func(socketPath, command string, args any, timeout time.Duration) (json.RawMessage, error) {
+				gotSocket, gotCommand = socketPath, command
+				return json.RawMessage("{}"), tt.qmpErr
+			}
+
+			output, _, err := executeCommand(rootCmd, tt.args...)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("expected error to contain '%s', but got '%v'", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			if gotCommand != tt.expectedCommand {
+				t.Errorf("expected QMP command '%s', got '%s'", tt.expectedCommand, gotCommand)
+			}
+			if filepath.Base(gotSocket) != "test-vm.sock" {
+				t.Errorf("unexpected QMP socket '%s'", gotSocket)
+			}
+			if !strings.Contains(output, tt.expectedOut) {
+				t.Errorf("expected output to contain '%s', but got '%s'", tt.expectedOut, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// vmResetCmd represents the vm reset command
+var vmResetCmd = &cobra.Command{
+	Use:               "reset <vm-name>",
+	Short:             "Resets a running VM",
+	Long:              `Resets a running VM, like pressing its reset button. The guest is not shut down cleanly.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: VmNameCompleter,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		color.Cyan("i Resetting VM: %s", vmName)
+		if err := runQMPCommand(vmName, "system_reset"); err != nil {
+			return err
+		}
+		color.Green("✔ VM '%s' reset.", vmName)
+		return nil
+	},
+}
+
+func init() {
+	vmCmd.AddCommand(vmResetCmd)
+}
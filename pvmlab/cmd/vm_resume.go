@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// vmResumeCmd represents the vm resume command
+var vmResumeCmd = &cobra.Command{
+	Use:               "resume <vm-name>",
+	Short:             "Resumes a paused VM",
+	Long:              `Resumes the virtual CPUs of a VM paused with 'pvmlab vm pause'.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: VmNameCompleter,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		color.Cyan("i Resuming VM: %s", vmName)
+		if err := runQMPCommand(vmName, "cont"); err != nil {
+			return err
+		}
+		color.Green("✔ VM '%s' resumed.", vmName)
+		return nil
+	},
+}
+
+func init() {
+	vmCmd.AddCommand(vmResumeCmd)
+}
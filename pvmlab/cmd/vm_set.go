@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"pvmlab/internal/config"
+	"pvmlab/internal/metadata"
+	"pvmlab/internal/pidfile"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var setResourceFlags vmResources
+
+// vmSetCmd represents the vm set command
+var vmSetCmd = &cobra.Command{
+	Use:   "set <vm-name>",
+	Short: "Changes the CPU, memory and machine settings of a stopped VM",
+	Long: `Changes the CPU, memory and machine settings of a stopped VM. Only the
+flags that are given are changed. Pass an empty value to --cpu-model or
+--machine to go back to the default.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: VmNameCompleter,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+
+		if !cmd.Flags().Changed("cpus") && !cmd.Flags().Changed("memory") &&
+			!cmd.Flags().Changed("cpu-model") && !cmd.Flags().Changed("machine") {
+			return fmt.Errorf("at least one of --cpus, --memory, --cpu-model or --machine must be specified")
+		}
+
+		cfg, err := config.New()
+		if err != nil {
+			return err
+		}
+
+		running, err := pidfile.IsRunning(cfg, vmName)
+		if err != nil {
+			return fmt.Errorf("error checking VM status: %w", err)
+		}
+		if running {
+			return fmt.Errorf("VM '%s' is running. Stop it with 'pvmlab vm stop %s' first", vmName, vmName)
+		}
+
+		if _, err := metadata.Update(cfg, vmName, func(meta *metadata.Metadata) error {
+			return setResourceFlags.apply(cmd, meta)
+		}); err != nil {
+			return fmt.Errorf("failed to update VM metadata: %w", err)
+		}
+
+		color.Green("✔ VM '%s' updated. The changes take effect the next time it starts.", vmName)
+		return nil
+	},
+}
+
+func init() {
+	vmCmd.AddCommand(vmSetCmd)
+	addResourceFlags(vmSetCmd, &setResourceFlags)
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"pvmlab/internal/config"
+	"pvmlab/internal/metadata"
+	"pvmlab/internal/pidfile"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func resetSetFlags() {
+	for _, name := range []string{"cpus", "memory", "cpu-model", "machine"} {
+		f := vmSetCmd.Flags().Lookup(name)
+		_ = f.Value.Set(f.DefValue)
+		f.Changed = false
+	}
+}
+
+func TestVMSetCommand(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		meta          *metadata.Metadata
+		running       bool
+		expectedMeta  *metadata.Metadata
+		expectedError string
+	}{
+		{
+			name:         "set cpus and memory",
+			args:         []string{"vm", "set", "test-vm", "--cpus", "4", "--memory", "8G"},
+			meta:         &metadata.Metadata{Name: "test-vm", Role: "target", CPUModel: "cortex-a72"},
+			expectedMeta: &metadata.Metadata{Name: "test-vm", Role: "target", CPUs: 4, MemoryMB: 8192, CPUModel: "cortex-a72"},
+		},
+		{
+			name:         "memory in MiB and machine",
+			args:         []string{"vm", "set", "test-vm", "--memory", "3072", "--machine", "q35,smm=on"},
+			meta:         &metadata.Metadata{Name: "test-vm", Role: "target", CPUs: 4},
+			expectedMeta: &metadata.Metadata{Name: "test-vm", Role: "target", CPUs: 4, MemoryMB: 3072, Machine: "q35,smm=on"},
+		},
+		{
+			name:         "reset cpu model",
+			args:         []string{"vm", "set", "test-vm", "--cpu-model", ""},
+			meta:         &metadata.Metadata{Name: "test-vm", Role: "target", CPUModel: "cortex-a72"},
+			expectedMeta: &metadata.Metadata{Name: "test-vm", Role: "target"},
+		},
+		{
+			name:          "no flags",
+			args:          []string{"vm", "set", "test-vm"},
+			meta:          &metadata.Metadata{Name: "test-vm"},
+			expectedError: "at least one of --cpus, --memory, --cpu-model or --machine must be specified",
+		},
+		{
+			name:          "running vm",
+			args:          []string{"vm", "set", "test-vm", "--cpus", "4"},
+			meta:          &metadata.Metadata{Name: "test-vm"},
+			running:       true,
+			expectedError: "VM 'test-vm' is running",
+		},
+		{
+			name:          "invalid cpus",
+			args:          []string{"vm", "set", "test-vm", "--cpus", "0"},
+			meta:          &metadata.Metadata{Name: "test-vm"},
+			expectedError: "--cpus must be at least 1",
+		},
+		{
+			name:          "invalid memory",
+			args:          []string{"vm", "set", "test-vm", "--memory", "512K"},
+			meta:          &metadata.Metadata{Name: "test-vm"},
+			expectedError: "must be a positive multiple of 1M",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupMocks(t)
+			t.Cleanup(resetSetFlags)
+			metadata.Load = func(c *config.Config, name string) (*metadata.Metadata, error) {
+				return tt.meta, nil
+			}
+			pidfile.IsRunning = func(c *config.Config, name string) (bool, error) {
+				return tt.running, nil
+			}
+			var saved *metadata.Metadata
+			metadata.Write = func(c *config.Config, meta *metadata.Metadata) error {
+				saved = meta
+				return nil
+			}
+
+			_, _, err := executeCommand(rootCmd, tt.args...)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing '%s', got '%v'", tt.expectedError, err)
+				}
+				if saved != nil {
+					t.Errorf("expected metadata not to be saved")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if saved == nil || !reflect.DeepEqual(saved, tt.expectedMeta) {
+				t.Errorf("unexpected metadata: got %+v, want %+v", saved, tt.expectedMeta)
+			}
+		})
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{in: "2048", want: 2048},
+		{in: "8G", want: 8192},
+		{in: "512M", want: 512},
+		{in: "1T", want: 1024 * 1024},
+		{in: "0", wantErr: true},
+		{in: "1536K", wantErr: true},
+		{in: "lots", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseMemory(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseMemory(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseMemory(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
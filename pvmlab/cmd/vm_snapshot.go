@@ -0,0 +1,284 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"pvmlab/internal/config"
+	"pvmlab/internal/metadata"
+	"pvmlab/internal/pidfile"
+	"pvmlab/internal/qemu"
+	"pvmlab/internal/qmp"
+	"pvmlab/internal/util"
+	"regexp"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// snapshotTimeout bounds QMP commands that save or load the whole VM
+// state, which can take a while for VMs with a lot of memory.
+const snapshotTimeout = 5 * time.Minute
+
+var (
+	snapshotNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	allDigitsRegex    = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// vmSnapshotCmd represents the vm snapshot command
+var vmSnapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Manage VM snapshots",
+	Long: `Manage snapshots of a VM's disk and UEFI variables.
+
+Snapshots of stopped VMs are taken with qemu-img and only cover the disks.
+Snapshots of running VMs are taken over QMP and also include
+the memory and device state, so reverting resumes the VM where it was.`,
+}
+
+// snapshotTarget holds everything needed to snapshot a single VM.
+type snapshotTarget struct {
+	cfg     *config.Config
+	vmName  string
+	appDir  string
+	running bool
+	// provisioner is true for the provisioner, whose shared host directory
+	// prevents QEMU from saving its state.
+	provisioner bool
+	// disks are the VM's root disk followed by its data disks.
+	disks []string
+	// firmware is the VM's writable UEFI flash image, if any.
+	firmware string
+	// firmwareQcow2 is true if firmware can hold internal snapshots.
+	firmwareQcow2 bool
+}
+
+func newSnapshotTarget(vmName string) (*snapshotTarget, error) {
+	cfg, err := config.New()
+	if err != nil {
+		return nil, err
+	}
+	meta, err := metadata.Load(cfg, vmName)
+	if err != nil {
+		return nil, fmt.Errorf("VM '%s' not found: %w", vmName, err)
+	}
+	running, err := pidfile.IsRunning(cfg, vmName)
+	if err != nil {
+		return nil, fmt.Errorf("could not check status of VM '%s': %w", vmName, err)
+	}
+
+	appDir := cfg.GetAppDir()
+	t := &snapshotTarget{
+		cfg:         cfg,
+		vmName:      vmName,
+		appDir:      appDir,
+		running:     running,
+		provisioner: meta.Role == "provisioner",
+		disks:       []string{filepath.Join(appDir, "vms", vmName+".qcow2")},
+	}
+	for _, disk := range meta.Disks {
+		t.disks = append(t.disks, dataDiskPath(appDir, vmName, disk.Name))
+	}
+	for _, suffix := range []string{"-vars.fd", "-code.fd"} {
+		path := filepath.Join(appDir, "vms", vmName+suffix)
+		if !util.FileExists(path) {
+			continue
+		}
+		t.firmware = path
+		if t.firmwareQcow2, err = qemu.IsQcow2(path); err != nil {
+			return nil, fmt.Errorf("failed to inspect UEFI flash image: %w", err)
+		}
+		break
+	}
+	return t, nil
+}
+
+func (t *snapshotTarget) socketPath() string {
+	return qmpSocketPath(t.appDir, t.vmName)
+}
+
+// firmwareCopyDir is where the raw UEFI flash image of VMs created before
+// qcow2 flash images were introduced is saved for each snapshot.
+func (t *snapshotTarget) firmwareCopyDir(name string) string {
+	return filepath.Join(t.appDir, "vms", "snapshots", t.vmName, name)
+}
+
+// checkLiveSnapshot returns an error if the running VM can't be snapshotted
+// over QMP.
+func (t *snapshotTarget) checkLiveSnapshot() error {
+	if t.provisioner {
+		return fmt.Errorf("VM '%s' is the provisioner, which shares a host directory and cannot be snapshotted while it is running, stop it with 'pvmlab vm stop %s' first", t.vmName, t.vmName)
+	}
+	if t.firmware != "" && !t.firmwareQcow2 {
+		return fmt.Errorf("the UEFI flash image of VM '%s' is a raw file and cannot be snapshotted while the VM is running, stop the VM with 'pvmlab vm stop %s' first", t.vmName, t.vmName)
+	}
+	return nil
+}
+
+func (t *snapshotTarget) create(name string) error {
+	if t.running {
+		if err := t.checkLiveSnapshot(); err != nil {
+			return err
+		}
+		_, err := qmp.RunHMP(t.socketPath(), "savevm "+name, snapshotTimeout)
+		return err
+	}
+
+	// Delete the snapshot from the images already snapshotted if a later one
+	// fails, so that no partial snapshot is left behind.
+	var done []string
+	rollback := func(err error) error {
+		for _, image := range done {
+			if delErr := qemu.Snapshot("-d", name, image); delErr != nil {
+				color.Yellow("! Warning: could not delete snapshot '%s' from %s: %v", name, image, delErr)
+			}
+		}
+		return err
+	}
+
+	images := append([]string{}, t.disks...)
+	if t.firmwareQcow2 {
+		images = append(images, t.firmware)
+	}
+	for _, image := range images {
+		if err := qemu.Snapshot("-c", name, image); err != nil {
+			return rollback(err)
+		}
+		done = append(done, image)
+	}
+	if t.firmware == "" || t.firmwareQcow2 {
+		return nil
+	}
+	dir := t.firmwareCopyDir(name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return rollback(err)
+	}
+	if err := util.CopyFile(t.firmware, filepath.Join(dir, filepath.Base(t.firmware)), 0644); err != nil {
+		os.RemoveAll(dir)
+		return rollback(err)
+	}
+	return nil
+}
+
+func (t *snapshotTarget) revert(name string) error {
+	if err := checkNoClones(t.cfg, t.vmName, "revert"); err != nil {
+		return err
+	}
+	if t.running {
+		if err := t.checkLiveSnapshot(); err != nil {
+			return err
+		}
+		_, err := qmp.RunHMP(t.socketPath(), "loadvm "+name, snapshotTimeout)
+		return err
+	}
+
+	// Everything is checked before any image is reverted, so that a
+	// failure doesn't leave the VM half reverted.
+	images, err := t.snapshotImages(name)
+	if err != nil {
+		return err
+	}
+	saved := filepath.Join(t.firmwareCopyDir(name), filepath.Base(t.firmware))
+	if t.firmware != "" && !t.firmwareQcow2 && !util.FileExists(saved) {
+		return fmt.Errorf("no saved UEFI flash image found for snapshot '%s'", name)
+	}
+
+	for _, image := range images {
+		if err := qemu.Snapshot("-a", name, image); err != nil {
+			return err
+		}
+	}
+	if t.firmware == "" || t.firmwareQcow2 {
+		return nil
+	}
+	return util.CopyFile(saved, t.firmware, 0644)
+}
+
+func (t *snapshotTarget) delete(name string) error {
+	if t.running {
+		_, err := qmp.RunHMP(t.socketPath(), "delvm "+name, snapshotTimeout)
+		return err
+	}
+
+	images, err := t.snapshotImages(name)
+	if err != nil {
+		return err
+	}
+	for _, image := range images {
+		if err := qemu.Snapshot("-d", name, image); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(t.firmwareCopyDir(name))
+}
+
+// snapshotImages returns the images of the stopped VM that have the given
+// snapshot. The root disk and a qcow2 UEFI flash image must have it, while
+// data disks added after the snapshot was taken don't and are skipped.
+func (t *snapshotTarget) snapshotImages(name string) ([]string, error) {
+	var images []string
+	for i, disk := range t.disks {
+		ok, err := hasSnapshot(disk, name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			images = append(images, disk)
+			continue
+		}
+		if i == 0 {
+			return nil, fmt.Errorf("snapshot '%s' not found for VM '%s'", name, t.vmName)
+		}
+		color.Yellow("! Data disk %s has no snapshot '%s', it was probably added after the snapshot and is left unchanged.", filepath.Base(disk), name)
+	}
+	if t.firmwareQcow2 {
+		ok, err := hasSnapshot(t.firmware, name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("snapshot '%s' not found in the UEFI flash image of VM '%s'", name, t.vmName)
+		}
+		images = append(images, t.firmware)
+	}
+	return images, nil
+}
+
+// hasSnapshot reports whether the image has an internal snapshot with the
+// given name.
+func hasSnapshot(image, name string) (bool, error) {
+	snapshots, err := qemu.ListSnapshots(image)
+	if err != nil {
+		return false, err
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (t *snapshotTarget) list() ([]qemu.SnapshotInfo, error) {
+	if t.running {
+		out, err := qmp.RunHMP(t.socketPath(), "info snapshots", 10*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		return qemu.ParseSnapshotList(out), nil
+	}
+	return qemu.ListSnapshots(t.disks[0])
+}
+
+func validateSnapshotName(name string) error {
+	// QEMU treats all-digit names as snapshot IDs.
+	if !snapshotNameRegex.MatchString(name) || allDigitsRegex.MatchString(name) {
+		return fmt.Errorf("invalid snapshot name '%s': it must start with a letter or digit, contain only letters, digits, '_', '.' or '-', and not be a number", name)
+	}
+	return nil
+}
+
+func init() {
+	vmCmd.AddCommand(vmSnapshotCmd)
+}
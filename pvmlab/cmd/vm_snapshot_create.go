@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// vmSnapshotCreateCmd represents the vm snapshot create command
+var vmSnapshotCreateCmd = &cobra.Command{
+	Use:   "create <vm-name> <snapshot-name>",
+	Short: "Creates a snapshot of a VM",
+	Long: `Creates a snapshot of a VM's disk and UEFI variables.
+
+If the VM is running, the snapshot also includes its memory and device state.
+The provisioner shares a host directory with the VM and cannot be snapshotted
+while it is running.`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: VmNameFirstArgCompleter,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName, name := args[0], args[1]
+		if err := validateSnapshotName(name); err != nil {
+			return err
+		}
+		target, err := newSnapshotTarget(vmName)
+		if err != nil {
+			return err
+		}
+		if target.running {
+			if err := target.checkLiveSnapshot(); err != nil {
+				return err
+			}
+		}
+
+		color.Cyan("i Creating snapshot '%s' of VM '%s'...", name, vmName)
+		if err := target.create(name); err != nil {
+			return fmt.Errorf("failed to create snapshot: %w", err)
+		}
+		color.Green("✔ Snapshot '%s' of VM '%s' created.", name, vmName)
+		return nil
+	},
+}
+
+func init() {
+	vmSnapshotCmd.AddCommand(vmSnapshotCreateCmd)
+}
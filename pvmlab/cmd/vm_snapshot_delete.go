@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// vmSnapshotDeleteCmd represents the vm snapshot delete command
+var vmSnapshotDeleteCmd = &cobra.Command{
+	Use:               "delete <vm-name> <snapshot-name>",
+	Short:             "Deletes a VM snapshot",
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: VmNameFirstArgCompleter,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName, name := args[0], args[1]
+		target, err := newSnapshotTarget(vmName)
+		if err != nil {
+			return err
+		}
+
+		color.Cyan("i Deleting snapshot '%s' of VM '%s'...", name, vmName)
+		if err := target.delete(name); err != nil {
+			return fmt.Errorf("failed to delete snapshot: %w", err)
+		}
+		color.Green("✔ Snapshot '%s' of VM '%s' deleted.", name, vmName)
+		return nil
+	},
+}
+
+func init() {
+	vmSnapshotCmd.AddCommand(vmSnapshotDeleteCmd)
+}
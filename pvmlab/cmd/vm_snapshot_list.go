@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+// vmSnapshotListCmd represents the vm snapshot list command
+var vmSnapshotListCmd = &cobra.Command{
+	Use:               "list <vm-name>",
+	Short:             "Lists the snapshots of a VM",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: VmNameFirstArgCompleter,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		target, err := newSnapshotTarget(vmName)
+		if err != nil {
+			return err
+		}
+
+		snapshots, err := target.list()
+		if err != nil {
+			return fmt.Errorf("failed to list snapshots: %w", err)
+		}
+		if len(snapshots) == 0 {
+			color.Yellow("VM '%s' has no snapshots.", vmName)
+			return nil
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.Header([]string{"NAME", "VM STATE SIZE", "DATE", "VM CLOCK"})
+		for _, s := range snapshots {
+			if err := table.Append([]string{s.Name, s.VMSize, s.Date, s.VMClock}); err != nil {
+				return err
+			}
+		}
+		return table.Render()
+	},
+}
+
+func init() {
+	vmSnapshotCmd.AddCommand(vmSnapshotListCmd)
+}
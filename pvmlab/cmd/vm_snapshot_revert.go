@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// vmSnapshotRevertCmd represents the vm snapshot revert command
+var vmSnapshotRevertCmd = &cobra.Command{
+	Use:   "revert <vm-name> <snapshot-name>",
+	Short: "Reverts a VM to a snapshot",
+	Long: `Reverts a VM's disk and UEFI variables to a snapshot.
+
+If the VM is running, its memory and device state are restored too. This
+requires a snapshot that was taken while the VM was running. Data disks
+added after the snapshot was taken are left unchanged.`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: VmNameFirstArgCompleter,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName, name := args[0], args[1]
+		target, err := newSnapshotTarget(vmName)
+		if err != nil {
+			return err
+		}
+
+		color.Cyan("i Reverting VM '%s' to snapshot '%s'...", vmName, name)
+		if err := target.revert(name); err != nil {
+			return fmt.Errorf("failed to revert snapshot: %w", err)
+		}
+		color.Green("✔ VM '%s' reverted to snapshot '%s'.", vmName, name)
+		return nil
+	},
+}
+
+func init() {
+	vmSnapshotCmd.AddCommand(vmSnapshotRevertCmd)
+}
@@ -0,0 +1,357 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"pvmlab/internal/config"
+	"pvmlab/internal/metadata"
+	"pvmlab/internal/pidfile"
+	"pvmlab/internal/qemu"
+	"pvmlab/internal/qmp"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockSnapshotBackends records the qemu-img and QMP calls made by the
+// snapshot commands.
+func mockSnapshotBackends(t *testing.T) (*[]string, string) {
+	t.Helper()
+	originalSnapshot := qemu.Snapshot
+	originalListSnapshots := qemu.ListSnapshots
+	originalRunHMP := qmp.RunHMP
+	t.Cleanup(func() {
+		qemu.Snapshot = originalSnapshot
+		qemu.ListSnapshots = originalListSnapshots
+		qmp.RunHMP = originalRunHMP
+	})
+
+	// The snapshots of each image, by file name.
+	snapshots := map[string][]string{}
+	var calls []string
+	qemu.Snapshot = func(op, name, imagePath string) error {
+		image := filepath.Base(imagePath)
+		calls = append(calls, fmt.Sprintf("qemu-img %s %s %s", op, name, image))
+		switch op {
+		case "-c":
+			snapshots[image] = append(snapshots[image], name)
+		case "-d":
+			snapshots[image] = slices.DeleteFunc(snapshots[image], func(s string) bool { return s == name })
+		}
+		return nil
+	}
+	qemu.ListSnapshots = func(imagePath string) ([]qemu.SnapshotInfo, error) {
+		image := filepath.Base(imagePath)
+		calls = append(calls, "qemu-img -l "+image)
+		var infos []qemu.SnapshotInfo
+		for i, name := range snapshots[image] {
+			infos = append(infos, qemu.SnapshotInfo{ID: fmt.Sprint(i + 1), Name: name, VMSize: "0 B", Date: "2025-01-01 10:00:00", VMClock: "00:00:00.000"})
+		}
+		return infos, nil
+	}
+	qmp.RunHMP = func(socketPath, command string, timeout time.Duration) (string, error) {
+		calls = append(calls, "qmp "+command)
+		if command == "info snapshots" {
+			return "ID        TAG               VM SIZE                DATE     VM CLOCK     ICOUNT\n" +
+				"--        live               512 MiB 2025-01-01 10:00:00 00:01:00.000          0", nil
+		}
+		return "", nil
+	}
+
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	appDir := cfg.GetAppDir()
+	if err := os.MkdirAll(filepath.Join(appDir, "vms"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return &calls, appDir
+}
+
+func writeFirmwareStore(t *testing.T, path string, qcow2 bool) {
+	t.Helper()
+	content := []byte("raw uefi vars")
+	if qcow2 {
+		content = []byte("QFI\xfb qcow2 uefi vars")
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVMSnapshotStopped(t *testing.T) {
+	setupMocks(t)
+	calls, appDir := mockSnapshotBackends(t)
+	writeFirmwareStore(t, filepath.Join(appDir, "vms", "test-vm-vars.fd"), true)
+
+	for _, op := range []string{"create", "revert"} {
+		if _, _, err := executeCommand(rootCmd, "vm", "snapshot", op, "test-vm", "installed"); err != nil {
+			t.Fatalf("vm snapshot %s failed: %v", op, err)
+		}
+	}
+	out, _, err := executeCommand(rootCmd, "vm", "snapshot", "list", "test-vm")
+	if err != nil {
+		t.Fatalf("vm snapshot list failed: %v", err)
+	}
+	if !strings.Contains(out, "installed") {
+		t.Errorf("expected snapshot 'installed' in output, got: %s", out)
+	}
+	if _, _, err := executeCommand(rootCmd, "vm", "snapshot", "delete", "test-vm", "installed"); err != nil {
+		t.Fatalf("vm snapshot delete failed: %v", err)
+	}
+
+	want := []string{
+		"qemu-img -c installed test-vm.qcow2",
+		"qemu-img -c installed test-vm-vars.fd",
+		"qemu-img -l test-vm.qcow2",
+		"qemu-img -l test-vm-vars.fd",
+		"qemu-img -a installed test-vm.qcow2",
+		"qemu-img -a installed test-vm-vars.fd",
+		"qemu-img -l test-vm.qcow2",
+		"qemu-img -l test-vm.qcow2",
+		"qemu-img -l test-vm-vars.fd",
+		"qemu-img -d installed test-vm.qcow2",
+		"qemu-img -d installed test-vm-vars.fd",
+	}
+	if !reflect.DeepEqual(*calls, want) {
+		t.Errorf("unexpected calls:\ngot:  %v\nwant: %v", *calls, want)
+	}
+}
+
+func TestVMSnapshotRevertDiskAddedLater(t *testing.T) {
+	setupMocks(t)
+	calls, appDir := mockSnapshotBackends(t)
+	writeFirmwareStore(t, filepath.Join(appDir, "vms", "test-vm-vars.fd"), true)
+	disks := []metadata.Disk{{Name: "data1"}}
+	metadata.Load = func(*config.Config, string) (*metadata.Metadata, error) {
+		return &metadata.Metadata{Name: "test-vm", Disks: disks}, nil
+	}
+
+	if _, _, err := executeCommand(rootCmd, "vm", "snapshot", "create", "test-vm", "installed"); err != nil {
+		t.Fatalf("vm snapshot create failed: %v", err)
+	}
+	// A disk added with 'vm disk add' after the snapshot doesn't have it.
+	disks = append(disks, metadata.Disk{Name: "data2"})
+	*calls = nil
+
+	if _, _, err := executeCommand(rootCmd, "vm", "snapshot", "revert", "test-vm", "installed"); err != nil {
+		t.Fatalf("vm snapshot revert failed: %v", err)
+	}
+	want := []string{
+		"qemu-img -l test-vm.qcow2",
+		"qemu-img -l test-vm-data1.qcow2",
+		"qemu-img -l test-vm-data2.qcow2",
+		"qemu-img -l test-vm-vars.fd",
+		"qemu-img -a installed test-vm.qcow2",
+		"qemu-img -a installed test-vm-data1.qcow2",
+		"qemu-img -a installed test-vm-vars.fd",
+	}
+	if !reflect.DeepEqual(*calls, want) {
+		t.Errorf("unexpected calls:\ngot:  %v\nwant: %v", *calls, want)
+	}
+
+	// Nothing is reverted if the root disk doesn't have the snapshot.
+	*calls = nil
+	_, _, err := executeCommand(rootCmd, "vm", "snapshot", "revert", "test-vm", "missing")
+	if err == nil || !strings.Contains(err.Error(), "snapshot 'missing' not found") {
+		t.Fatalf("expected a snapshot not found error, got %v", err)
+	}
+	if !reflect.DeepEqual(*calls, []string{"qemu-img -l test-vm.qcow2"}) {
+		t.Errorf("expected no image to be reverted, got %v", *calls)
+	}
+}
+
+func TestVMSnapshotStoppedRawFirmware(t *testing.T) {
+	setupMocks(t)
+	calls, appDir := mockSnapshotBackends(t)
+	varsPath := filepath.Join(appDir, "vms", "test-vm-code.fd")
+	writeFirmwareStore(t, varsPath, false)
+
+	if _, _, err := executeCommand(rootCmd, "vm", "snapshot", "create", "test-vm", "blank"); err != nil {
+		t.Fatalf("vm snapshot create failed: %v", err)
+	}
+	saved := filepath.Join(appDir, "vms", "snapshots", "test-vm", "blank", "test-vm-code.fd")
+	if _, err := os.Stat(saved); err != nil {
+		t.Fatalf("expected raw UEFI image to be saved: %v", err)
+	}
+
+	if err := os.WriteFile(varsPath, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := executeCommand(rootCmd, "vm", "snapshot", "revert", "test-vm", "blank"); err != nil {
+		t.Fatalf("vm snapshot revert failed: %v", err)
+	}
+	content, _ := os.ReadFile(varsPath)
+	if string(content) != "raw uefi vars" {
+		t.Errorf("expected UEFI image to be restored, got %q", content)
+	}
+
+	if _, _, err := executeCommand(rootCmd, "vm", "snapshot", "delete", "test-vm", "blank"); err != nil {
+		t.Fatalf("vm snapshot delete failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(saved)); !os.IsNotExist(err) {
+		t.Errorf("expected saved UEFI image to be removed")
+	}
+
+	want := []string{
+		"qemu-img -c blank test-vm.qcow2",
+		"qemu-img -l test-vm.qcow2",
+		"qemu-img -a blank test-vm.qcow2",
+		"qemu-img -l test-vm.qcow2",
+		"qemu-img -d blank test-vm.qcow2",
+	}
+	if !reflect.DeepEqual(*calls, want) {
+		t.Errorf("unexpected calls:\ngot:  %v\nwant: %v", *calls, want)
+	}
+}
+
+func TestVMSnapshotCreateRollback(t *testing.T) {
+	setupMocks(t)
+	calls, appDir := mockSnapshotBackends(t)
+	writeFirmwareStore(t, filepath.Join(appDir, "vms", "test-vm-vars.fd"), true)
+	metadata.Load = func(*config.Config, string) (*metadata.Metadata, error) {
+		return &metadata.Metadata{Name: "test-vm", Disks: []metadata.Disk{{Name: "data1"}, {Name: "data2"}}}, nil
+	}
+	mockSnapshot := qemu.Snapshot
+	qemu.Snapshot = func(op, name, imagePath string) error {
+		mockSnapshot(op, name, imagePath)
+		if op == "-c" && filepath.Base(imagePath) == "test-vm-data2.qcow2" {
+			return fmt.Errorf("No space left on device")
+		}
+		return nil
+	}
+
+	_, _, err := executeCommand(rootCmd, "vm", "snapshot", "create", "test-vm", "installed")
+	if err == nil || !strings.Contains(err.Error(), "No space left on device") {
+		t.Fatalf("expected the error of the failed disk, got %v", err)
+	}
+	want := []string{
+		"qemu-img -c installed test-vm.qcow2",
+		"qemu-img -c installed test-vm-data1.qcow2",
+		"qemu-img -c installed test-vm-data2.qcow2",
+		"qemu-img -d installed test-vm.qcow2",
+		"qemu-img -d installed test-vm-data1.qcow2",
+	}
+	if !reflect.DeepEqual(*calls, want) {
+		t.Errorf("unexpected calls:\ngot:  %v\nwant: %v", *calls, want)
+	}
+}
+
+func TestVMSnapshotRunning(t *testing.T) {
+	setupMocks(t)
+	calls, appDir := mockSnapshotBackends(t)
+	pidfile.IsRunning = func(c *config.Config, name string) (bool, error) {
+		return true, nil
+	}
+	writeFirmwareStore(t, filepath.Join(appDir, "vms", "test-vm-vars.fd"), true)
+
+	for _, op := range []string{"create", "revert", "delete"} {
+		if _, _, err := executeCommand(rootCmd, "vm", "snapshot", op, "test-vm", "live"); err != nil {
+			t.Fatalf("vm snapshot %s failed: %v", op, err)
+		}
+	}
+	out, _, err := executeCommand(rootCmd, "vm", "snapshot", "list", "test-vm")
+	if err != nil {
+		t.Fatalf("vm snapshot list failed: %v", err)
+	}
+	if !strings.Contains(out, "512 MiB") {
+		t.Errorf("expected live snapshot in output, got: %s", out)
+	}
+
+	want := []string{
+		"qmp savevm live",
+		"qmp loadvm live",
+		"qmp delvm live",
+		"qmp info snapshots",
+	}
+	if !reflect.DeepEqual(*calls, want) {
+		t.Errorf("unexpected calls:\ngot:  %v\nwant: %v", *calls, want)
+	}
+}
+
+func TestVMSnapshotErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		setup         func(t *testing.T, appDir string)
+		expectedError string
+	}{
+		{
+			name:          "missing snapshot name",
+			args:          []string{"vm", "snapshot", "create", "test-vm"},
+			expectedError: "accepts 2 arg(s), received 1",
+		},
+		{
+			name:          "numeric snapshot name",
+			args:          []string{"vm", "snapshot", "create", "test-vm", "1"},
+			expectedError: "invalid snapshot name '1'",
+		},
+		{
+			name:          "invalid snapshot name",
+			args:          []string{"vm", "snapshot", "create", "test-vm", "bad name"},
+			expectedError: "invalid snapshot name",
+		},
+		{
+			name: "live snapshot with raw firmware",
+			args: []string{"vm", "snapshot", "create", "test-vm", "live"},
+			setup: func(t *testing.T, appDir string) {
+				pidfile.IsRunning = func(c *config.Config, name string) (bool, error) {
+					return true, nil
+				}
+				writeFirmwareStore(t, filepath.Join(appDir, "vms", "test-vm-vars.fd"), false)
+			},
+			expectedError: "cannot be snapshotted while the VM is running",
+		},
+		{
+			name: "running provisioner",
+			args: []string{"vm", "snapshot", "create", "provisioner", "live"},
+			setup: func(t *testing.T, appDir string) {
+				metadata.Load = func(*config.Config, string) (*metadata.Metadata, error) {
+					return &metadata.Metadata{Name: "provisioner", Role: "provisioner"}, nil
+				}
+				pidfile.IsRunning = func(c *config.Config, name string) (bool, error) {
+					return true, nil
+				}
+				qmp.RunHMP = func(socketPath, command string, timeout time.Duration) (string, error) {
+					t.Errorf("unexpected QMP command %q", command)
+					return "", nil
+				}
+			},
+			expectedError: "is the provisioner, which shares a host directory and cannot be snapshotted while it is running",
+		},
+		{
+			name: "qmp error",
+			args: []string{"vm", "snapshot", "revert", "test-vm", "missing"},
+			setup: func(t *testing.T, appDir string) {
+				pidfile.IsRunning = func(c *config.Config, name string) (bool, error) {
+					return true, nil
+				}
+				qmp.RunHMP = func(socketPath, command string, timeout time.Duration) (string, error) {
+					return "", fmt.Errorf("Snapshot 'missing' does not exist")
+				}
+			},
+			expectedError: "Snapshot 'missing' does not exist",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupMocks(t)
+			_, appDir := mockSnapshotBackends(t)
+			if tt.setup != nil {
+				tt.setup(t, appDir)
+			}
+			_, _, err := executeCommand(rootCmd, tt.args...)
+			if err == nil {
+				t.Fatalf("expected error containing '%s', got nil", tt.expectedError)
+			}
+			if !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("expected error containing '%s', got '%v'", tt.expectedError, err)
+			}
+		})
+	}
+}
@@ -8,13 +8,15 @@ import (
 	"os/signal"
 	"path/filepath"
 	"pvmlab/internal/config"
+	"pvmlab/internal/installstatus"
 	"pvmlab/internal/metadata"
+	"pvmlab/internal/netbackend"
 	"pvmlab/internal/netutil"
 	"pvmlab/internal/pidfile"
-	"pvmlab/internal/socketvmnet"
+	"pvmlab/internal/qemu"
+	"pvmlab/internal/util"
 	"pvmlab/internal/waiter"
 	"strconv"
-	"strings"
 	"syscall"
 	"time"
 
@@ -32,6 +34,21 @@ type vmStartOptions struct {
 	cfg    *config.Config
 	meta   *metadata.Metadata
 	appDir string
+	// sharedDir holds the images and docker images shared by all labs.
+	sharedDir string
+	network   netbackend.Backend
+}
+
+// newNetworkBackend returns the backend attaching the VMs of the selected lab
+// to its private network. It is a variable to allow mocking in tests.
+var newNetworkBackend = labNetworkBackend
+
+func labNetworkBackend(cfg *config.Config) (netbackend.Backend, error) {
+	lab, err := cfg.Lab()
+	if err != nil {
+		return nil, err
+	}
+	return netbackend.Default(lab)
 }
 
 // vmStartCmd represents the start command
@@ -45,25 +62,16 @@ var vmStartCmd = &cobra.Command{
 		if wait && interactive {
 			return fmt.Errorf("the --wait and --interactive flags are mutually exclusive")
 		}
-		if bootOverride != "" && bootOverride != "disk" && bootOverride != "pxe" {
-			return fmt.Errorf("invalid --boot value: %s. Must be 'disk' or 'pxe'", bootOverride)
+		if bootOverride != "" && bootOverride != "disk" && bootOverride != "pxe" && bootOverride != "cdrom" {
+			return fmt.Errorf("invalid --boot value: %s. Must be 'disk', 'pxe' or 'cdrom'", bootOverride)
 		}
 
 		opts, err := gatherVMInfo(args[0])
 		if err != nil {
 			return err
 		}
-
-		isPxeBoot := opts.meta.PxeBoot
-		switch bootOverride {
-		case "pxe":
-			isPxeBoot = true
-		case "disk":
-			isPxeBoot = false
-		}
-
-		if wait && isPxeBoot {
-			return fmt.Errorf("the --wait flag is not supported for PXE boot VMs")
+		if bootOverride == "cdrom" && opts.meta.VirtualMedia == "" {
+			return fmt.Errorf("cannot boot VM '%s' from cdrom: no virtual media is inserted", opts.vmName)
 		}
 
 		qemuArgs, err := buildQEMUArgs(opts)
@@ -90,6 +98,14 @@ var vmStartCmd = &cobra.Command{
 			}()
 		}
 
+		// Forget the outcome of a previous installation, so that --wait
+		// follows the one about to start.
+		if isPXEBoot(opts.meta) {
+			if err := installstatus.Clear(installStatusDir(opts), opts.meta.MAC); err != nil {
+				return fmt.Errorf("failed to clear the previous install status: %w", err)
+			}
+		}
+
 		if err := runQEMU(ctx, opts, qemuArgs); err != nil {
 			// Check if the error was due to context cancellation
 			if ctx.Err() == context.Canceled {
@@ -109,6 +125,27 @@ var vmStartCmd = &cobra.Command{
 	},
 }
 
+// isPXEBoot returns whether the VM boots from the network, taking the --boot
+// flag into account.
+func isPXEBoot(meta *metadata.Metadata) bool {
+	switch bootOverride {
+	case "pxe":
+		return true
+	case "disk":
+		return false
+	}
+	return meta.PxeBoot
+}
+
+// installStatusDir returns the directory the boot handler of the provisioner
+// persists the install status of PXE booted VMs to.
+func installStatusDir(opts *vmStartOptions) string {
+	if provisioner, err := metadata.GetProvisioner(opts.cfg); err == nil && provisioner.VMsPath != "" {
+		return provisioner.VMsPath
+	}
+	return filepath.Join(opts.appDir, "vms")
+}
+
 func gatherVMInfo(vmName string) (*vmStartOptions, error) {
 	color.Cyan("i Starting VM: %s", vmName)
 
@@ -129,12 +166,22 @@ func gatherVMInfo(vmName string) (*vmStartOptions, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error loading VM metadata: %w", err)
 	}
+	if err := checkNoClones(cfg, vmName, "start"); err != nil {
+		return nil, err
+	}
+
+	network, err := newNetworkBackend(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	opts := &vmStartOptions{
-		vmName: vmName,
-		cfg:    cfg,
-		meta:   meta,
-		appDir: cfg.GetAppDir(),
+		vmName:    vmName,
+		cfg:       cfg,
+		meta:      meta,
+		appDir:    cfg.GetAppDir(),
+		sharedDir: cfg.GetSharedDir(),
+		network:   network,
 	}
 
 	// Check for necessary files
@@ -152,64 +199,81 @@ func gatherVMInfo(vmName string) (*vmStartOptions, error) {
 	return opts, nil
 }
 
-var uefiVarsTemplatePath = "/opt/homebrew/share/qemu/edk2-arm-vars.fd"
+var (
+	// findFirmware and selectAccelerator are variables to allow mocking in tests.
+	findFirmware      = qemu.FindFirmware
+	selectAccelerator = qemu.SelectAccelerator
+)
 
-func findFile(paths []string) (string, error) {
-	for _, path := range paths {
-		if _, err := os.Stat(path); err == nil {
-			return path, nil
+// createFirmwareStore creates a VM's writable UEFI flash image from a raw
+// template. It is a variable to allow mocking in tests.
+var createFirmwareStore = qemu.ConvertToQcow2
+
+// ensureFirmwareStore creates the VM's writable UEFI flash image if it does
+// not exist yet and returns its format. New images are qcow2 so that they can
+// be included in snapshots; images created by older versions are raw.
+func ensureFirmwareStore(template, path string) (string, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := createFirmwareStore(template, path); err != nil {
+			return "", err
 		}
 	}
-	return "", fmt.Errorf("could not find file in any of the following locations: %s", strings.Join(paths, ", "))
+	isQcow2, err := qemu.IsQcow2(path)
+	if err != nil {
+		return "", err
+	}
+	if isQcow2 {
+		return "qcow2", nil
+	}
+	return "raw", nil
 }
 
 func buildQEMUArgs(opts *vmStartOptions) ([]string, error) {
 	pidPath := filepath.Join(opts.appDir, "pids", opts.vmName+".pid")
-	monitorPath := filepath.Join(opts.appDir, "monitors", opts.vmName+".sock")
+	qmpPath := filepath.Join(opts.appDir, "monitors", opts.vmName+".sock")
 	logPath := filepath.Join(opts.appDir, "logs", opts.vmName+".log")
 	vmDiskPath := filepath.Join(opts.appDir, "vms", opts.vmName+".qcow2")
 
-	var qemuBinary, codePath string
-	if opts.meta.Arch == "aarch64" {
-		qemuBinary = "qemu-system-aarch64"
-		paths := []string{
-			"/usr/share/qemu-efi-aarch64/QEMU_EFI.fd",
-			"/opt/homebrew/share/qemu/edk2-aarch64-code.fd",
-		}
-		var err error
-		codePath, err = findFile(paths)
-		if err != nil {
-			return nil, err
-		}
-	} else { // x86_64
-		qemuBinary = "qemu-system-x86_64"
-		paths := []string{
-			"/usr/share/OVMF/OVMF_CODE.fd",
-			"/usr/share/qemu/OVMF.fd",
-			"/usr/share/ovmf/OVMF.fd",
-			"/opt/homebrew/share/qemu/edk2-x86_64-code.fd",
-		}
-		var err error
-		codePath, err = findFile(paths)
-		if err != nil {
-			return nil, err
-		}
+	qemuBinary := "qemu-system-" + opts.meta.Arch
+	if opts.meta.Arch != "aarch64" && opts.meta.Arch != "x86_64" {
+		return nil, fmt.Errorf("unsupported architecture: %s", opts.meta.Arch)
 	}
+	firmware, err := findFirmware(opts.meta.Arch)
+	if err != nil {
+		return nil, err
+	}
+	accel := selectAccelerator(opts.meta.Arch)
 
 	machineType := "virt,gic-version=3"
+	if accel.Name == "kvm" {
+		// Let KVM pick the GIC version the host supports.
+		machineType = "virt,gic-version=host"
+	}
 	if opts.meta.Arch == "x86_64" {
 		machineType = "q35"
 	}
+	if opts.meta.Machine != "" {
+		machineType = opts.meta.Machine
+	}
 
-	// Determine the effective boot mode
-	isPxeBoot := opts.meta.PxeBoot
-	switch bootOverride {
-	case "pxe":
-		isPxeBoot = true
-	case "disk":
-		isPxeBoot = false
+	cpus := opts.meta.CPUs
+	if cpus == 0 {
+		cpus = defaultCPUs
+	}
+	memoryMB := opts.meta.MemoryMB
+	if memoryMB == 0 {
+		memoryMB = defaultTargetMemoryMB
+		if opts.meta.Role == provisionerRole {
+			memoryMB = defaultProvisionerMemoryMB
+		}
+	}
+	cpuModel := opts.meta.CPUModel
+	if cpuModel == "" {
+		cpuModel = accel.CPU()
 	}
 
+	isPxeBoot := isPXEBoot(opts.meta)
+
 	// Use a more compatible NIC for PXE booting, as the EDK II firmware for aarch64
 	// does not have a built-in virtio-net driver, and the loadable ROM is x86-64.
 	// When x86-64 support is added, we can use the virtio-net device with its ROM.
@@ -222,55 +286,63 @@ func buildQEMUArgs(opts *vmStartOptions) ([]string, error) {
 	qemuArgs := []string{
 		qemuBinary,
 		"-M", machineType,
-		"-smp", "2",
+		"-smp", strconv.Itoa(cpus),
+		"-m", strconv.Itoa(memoryMB),
 	}
 
-	if opts.meta.Arch == "aarch64" {
-		// AARCH64 requires separate code and vars pflash drives.
-		varsTemplatePath := uefiVarsTemplatePath
+	// VMs created before split firmware was supported on x86_64 keep using
+	// their writable copy of a unified image.
+	vmCodePath := filepath.Join(opts.appDir, "vms", opts.vmName+"-code.fd")
+	if firmware.Vars != "" && !util.FileExists(vmCodePath) {
+		// Separate read-only code and per-VM vars pflash drives.
 		vmVarsPath := filepath.Join(opts.appDir, "vms", opts.vmName+"-vars.fd")
-		if _, err := os.Stat(vmVarsPath); os.IsNotExist(err) {
-			input, err := os.ReadFile(varsTemplatePath)
-			if err != nil {
-				return nil, fmt.Errorf("failed to read UEFI vars template: %w", err)
-			}
-			if err := os.WriteFile(vmVarsPath, input, 0644); err != nil {
-				return nil, fmt.Errorf("failed to write UEFI vars file: %w", err)
-			}
+		varsFormat, err := ensureFirmwareStore(firmware.Vars, vmVarsPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create UEFI vars file: %w", err)
 		}
 		qemuArgs = append(qemuArgs,
-			"-drive", fmt.Sprintf("if=pflash,format=raw,readonly=on,file=%s", codePath),
-			"-drive", fmt.Sprintf("if=pflash,format=raw,file=%s", vmVarsPath),
+			"-drive", fmt.Sprintf("if=pflash,format=raw,readonly=on,file=%s", firmware.Code),
+			"-drive", fmt.Sprintf("if=pflash,format=%s,file=%s", varsFormat, vmVarsPath),
 		)
 	} else {
-		// x86_64 uses a unified pflash drive, but we need a writable copy for settings.
-		vmCodePath := filepath.Join(opts.appDir, "vms", opts.vmName+"-code.fd")
-		if _, err := os.Stat(vmCodePath); os.IsNotExist(err) {
-			input, err := os.ReadFile(codePath)
-			if err != nil {
-				return nil, fmt.Errorf("failed to read UEFI code template: %w", err)
-			}
-			if err := os.WriteFile(vmCodePath, input, 0644); err != nil {
-				return nil, fmt.Errorf("failed to write UEFI code file: %w", err)
-			}
+		// A unified image holds code and vars, so each VM needs a writable copy.
+		codeFormat, err := ensureFirmwareStore(firmware.Code, vmCodePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create UEFI code file: %w", err)
 		}
-		qemuArgs = append(qemuArgs, "-drive", fmt.Sprintf("if=pflash,format=raw,file=%s", vmCodePath))
+		qemuArgs = append(qemuArgs, "-drive", fmt.Sprintf("if=pflash,format=%s,file=%s", codeFormat, vmCodePath))
 	}
 
 	qemuArgs = append(qemuArgs,
-		"-drive", fmt.Sprintf("file=%s,format=qcow2,if=virtio", vmDiskPath),
+		// The serial lets the PXE installer find the root disk among the data disks.
+		"-drive", fmt.Sprintf("file=%s,format=qcow2,if=virtio,serial=%s", vmDiskPath, rootDiskSerial),
 		"-pidfile", pidPath,
-		"-monitor", fmt.Sprintf("unix:%s,server,nowait", monitorPath),
+		"-qmp", fmt.Sprintf("unix:%s,server,nowait", qmpPath),
 	)
 
-	// The ISO drive is only attached if the VM was created with one.
-	if !opts.meta.PxeBoot {
-		isoPath := filepath.Join(opts.appDir, "configs", "cloud-init", opts.vmName+".iso")
-		qemuArgs = append(qemuArgs, "-drive", fmt.Sprintf("file=%s,format=raw,if=virtio", isoPath))
+	qemuArgs = append(qemuArgs, dataDiskArgs(opts.appDir, opts.vmName, opts.meta.Disks)...)
+
+	// The ISO drive is only attached if the VM was created with one. PXE boot
+	// VMs have one when they are clones of an installed VM.
+	isoPath := filepath.Join(opts.appDir, "configs", "cloud-init", opts.vmName+".iso")
+	if !opts.meta.PxeBoot || util.FileExists(isoPath) {
+		qemuArgs = append(qemuArgs, "-drive", fmt.Sprintf("file=%s,format=raw,if=virtio,readonly=on", isoPath))
 	}
 	if isPxeBoot {
 		qemuArgs = append(qemuArgs, "-boot", "menu=on")
 	}
+	// The virtual CD drive holds the ISO image inserted by the BMC.
+	if opts.meta.VirtualMedia != "" {
+		cdrom := "scsi-cd,drive=vmedia0,bus=vmedia-scsi.0"
+		if bootOverride == "cdrom" {
+			cdrom += ",bootindex=0"
+		}
+		qemuArgs = append(qemuArgs,
+			"-drive", fmt.Sprintf("file=%s,format=raw,if=none,id=vmedia0,media=cdrom,readonly=on", virtualMediaPath(opts.appDir, opts.vmName)),
+			"-device", "virtio-scsi-pci,id=vmedia-scsi",
+			"-device", cdrom,
+		)
+	}
 
 	if interactive {
 		qemuArgs = append(qemuArgs, "-nographic", "-chardev", "stdio,id=char0,mux=on,signal=off", "-serial", "chardev:char0", "-mon", "chardev=char0")
@@ -283,14 +355,19 @@ func buildQEMUArgs(opts *vmStartOptions) ([]string, error) {
 		if err != nil {
 			return nil, fmt.Errorf("could not find an available SSH port: %w", err)
 		}
-		opts.meta.SSHPort = sshPort
-		if err := metadata.Save(opts.cfg, opts.vmName, opts.meta.Role, opts.meta.Arch, opts.meta.IP, opts.meta.Subnet, opts.meta.IPv6, opts.meta.SubnetV6, opts.meta.MAC, opts.meta.PxeBootStackTar, opts.meta.DockerImagesPath, opts.meta.VMsPath, opts.meta.SSHKey, opts.meta.Kernel, opts.meta.Initrd, opts.meta.SSHPort, opts.meta.PxeBoot, opts.meta.Distro); err != nil {
+		// Only update the SSH port, so that changes made to the metadata by
+		// other commands since it was loaded are kept.
+		if _, err := metadata.Update(opts.cfg, opts.vmName, func(meta *metadata.Metadata) error {
+			meta.SSHPort = sshPort
+			return nil
+		}); err != nil {
 			return nil, fmt.Errorf("failed to save updated metadata with new SSH port: %w", err)
 		}
+		opts.meta.SSHPort = sshPort
 
 		finalDockerImagesPath := opts.meta.DockerImagesPath
 		if finalDockerImagesPath == "" {
-			finalDockerImagesPath = filepath.Join(opts.appDir, "docker_images")
+			finalDockerImagesPath = filepath.Join(opts.sharedDir, "docker_images")
 		}
 		finalVMsPath := opts.meta.VMsPath
 		if finalVMsPath == "" {
@@ -298,49 +375,34 @@ func buildQEMUArgs(opts *vmStartOptions) ([]string, error) {
 		}
 
 		qemuArgs = append(qemuArgs,
-			"-m", "4096",
 			"-device", fmt.Sprintf("%s,netdev=net0", netDevice),
 			"-netdev", fmt.Sprintf("user,id=net0,hostfwd=tcp::%d-:22,ipv6=on,ipv4=on,ipv6-net=fd00::/64", opts.meta.SSHPort),
 			"-device", fmt.Sprintf("%s,netdev=net1,mac=%s", netDevice, opts.meta.MAC),
-			"-netdev", "socket,id=net1,fd=3",
+			"-netdev", opts.network.Netdev("net1", opts.vmName),
 
 			"-virtfs", fmt.Sprintf("local,path=%s,mount_tag=host_share_docker_images,security_model=passthrough", finalDockerImagesPath),
 			"-virtfs", fmt.Sprintf("local,path=%s,mount_tag=host_share_vms,security_model=passthrough", finalVMsPath),
-			"-virtfs", fmt.Sprintf("local,path=%s,mount_tag=host_share_images,security_model=passthrough", filepath.Join(opts.appDir, "images")),
+			"-virtfs", fmt.Sprintf("local,path=%s,mount_tag=host_share_images,security_model=passthrough", filepath.Join(opts.sharedDir, "images")),
 		)
 	} else { // target
-		qemuArgs = append(qemuArgs, "-m", "2048", "-device", fmt.Sprintf("%s,netdev=net0,mac=%s", netDevice, opts.meta.MAC), "-netdev", "socket,id=net0,fd=3")
+		qemuArgs = append(qemuArgs, "-device", fmt.Sprintf("%s,netdev=net0,mac=%s", netDevice, opts.meta.MAC), "-netdev", opts.network.Netdev("net0", opts.vmName))
 	}
 
-	if opts.meta.Arch == "aarch64" {
-		accel := os.Getenv("PVMLAB_QEMU_ACCEL")
-		if accel == "" {
-			accel = "hvf"
-		}
-		cpu := "host"
-		if accel == "tcg" {
-			cpu = "max"
-		}
-		qemuArgs = append(qemuArgs, "-cpu", cpu, "-accel", accel)
-	} else {
-		qemuArgs = append(qemuArgs, "-cpu", "max")
-	}
+	qemuArgs = append(qemuArgs, "-cpu", cpuModel, "-accel", accel.Name)
 
 	return qemuArgs, nil
 }
 
 func runQEMU(ctx context.Context, opts *vmStartOptions, qemuArgs []string) error {
-	socketPath, err := socketvmnet.GetSocketPath()
-	if err != nil {
-		return fmt.Errorf("error getting socket_vmnet path: %w", err)
+	if err := opts.network.PrepareVM(opts.vmName); err != nil {
+		return fmt.Errorf("error preparing %s network for VM '%s': %w", opts.network.Name(), opts.vmName, err)
 	}
-	clientPath, err := getSocketVMNetClientPath()
+
+	finalCmd, err := opts.network.WrapCommand(qemuArgs)
 	if err != nil {
-		return fmt.Errorf("error getting socket_vmnet_client path: %w", err)
+		return err
 	}
 
-	finalCmd := append([]string{clientPath, socketPath}, qemuArgs...)
-
 	cmdRun := exec.CommandContext(ctx, finalCmd[0], finalCmd[1:]...)
 	if interactive {
 		return runInteractiveSession(cmdRun)
@@ -426,7 +488,11 @@ func waitForVM(opts *vmStartOptions) error {
 	timeoutDuration := time.Duration(timeoutSeconds) * time.Second
 	sshKeyPath := filepath.Join(opts.appDir, "ssh", "vm_rsa")
 
-	if opts.meta.Role == "provisioner" {
+	if isPXEBoot(opts.meta) {
+		if err := waiter.ForInstall(installStatusDir(opts), opts.meta.MAC, timeoutDuration); err != nil {
+			return err
+		}
+	} else if opts.meta.Role == "provisioner" {
 		if err := waiter.ForPort("localhost", opts.meta.SSHPort, timeoutDuration); err != nil {
 			return err
 		}
@@ -449,32 +515,10 @@ func waitForVM(opts *vmStartOptions) error {
 	return nil
 }
 
-func getSocketVMNetClientPath() (string, error) {
-	// if PVMLAB_SOCKET_VMNET_PATH is set use the client in that directory
-	if path := os.Getenv("PVMLAB_SOCKET_VMNET_CLIENT"); path != "" {
-		return path, nil
-	}
-
-	paths := []string{
-		"/opt/homebrew/opt/socket_vmnet/bin/socket_vmnet_client",
-	}
-	for _, p := range paths {
-		if _, err := os.Stat(p); err == nil {
-			return p, nil
-		}
-	}
-	cmd := exec.Command("which", "socket_vmnet_client")
-	out, err := cmd.Output()
-	if err != nil {
-		return "", fmt.Errorf("socket_vmnet_client not found in standard paths or via 'which'. Please install it")
-	}
-	return strings.TrimSpace(string(out)), nil
-}
-
 func init() {
 	vmCmd.AddCommand(vmStartCmd)
-	vmStartCmd.Flags().BoolVar(&wait, "wait", false, "Wait for cloud-init to complete before exiting.")
+	vmStartCmd.Flags().BoolVar(&wait, "wait", false, "Wait for cloud-init, or the installation of PXE boot VMs, to complete before exiting.")
 	vmStartCmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Attach to the VM's serial console.")
-	vmStartCmd.Flags().StringVar(&bootOverride, "boot", "", "Override boot device (disk or pxe)")
+	vmStartCmd.Flags().StringVar(&bootOverride, "boot", "", "Override boot device (disk, pxe or cdrom)")
 	vmStartCmd.Flags().BoolVar(&installerNoReboot, "installer-no-reboot", false, "Do not reboot after successful installation.")
 }
@@ -5,8 +5,11 @@ import (
 	"os"
 	"path/filepath"
 	"pvmlab/internal/config"
+	"pvmlab/internal/installstatus"
 	"pvmlab/internal/metadata"
+	"pvmlab/internal/netbackend"
 	"pvmlab/internal/pidfile"
+	"pvmlab/internal/qemu"
 	"strings"
 	"testing"
 )
@@ -53,6 +56,22 @@ func TestVMStartCommand(t *testing.T) {
 			},
 			expectedError: "not found",
 		},
+		{
+			name: "cdrom boot without virtual media",
+			args: []string{"vm", "start", "test-vm", "--boot", "cdrom"},
+			setupMocks: func() {
+				cfg, _ := config.New()
+				appDir := cfg.GetAppDir()
+				for _, path := range []string{
+					filepath.Join(appDir, "vms", "test-vm.qcow2"),
+					filepath.Join(appDir, "configs", "cloud-init", "test-vm.iso"),
+				} {
+					os.MkdirAll(filepath.Dir(path), 0755)
+					os.WriteFile(path, nil, 0644)
+				}
+			},
+			expectedError: "no virtual media is inserted",
+		},
 	}
 
 	for _, tt := range tests {
@@ -81,11 +100,16 @@ func TestVMStartCommand(t *testing.T) {
 func TestBuildQEMUArgs(t *testing.T) {
 	// This test focuses specifically on the logic of building the QEMU command line.
 	tests := []struct {
-		name           string
-		opts           *vmStartOptions
-		expectedArgs   []string
-		unexpectedArgs []string
-		expectedError  string
+		name            string
+		opts            *vmStartOptions
+		accel           string
+		unifiedFirmware bool
+		legacyCodeFile  bool
+		cloudInitISO    bool
+		boot            string
+		expectedArgs    []string
+		unexpectedArgs  []string
+		expectedError   string
 	}{
 		{
 			name: "basic target vm",
@@ -127,13 +151,40 @@ func TestBuildQEMUArgs(t *testing.T) {
 				meta:   &metadata.Metadata{Role: "target", Arch: "aarch64", MAC: "aa:bb:cc", PxeBoot: true},
 			},
 			expectedArgs: []string{
-				"-boot", "n",
+				"-boot", "menu=on",
 				"-device", "virtio-net-pci,netdev=net0,mac=aa:bb:cc", // virtio-net-pci for PXE
 			},
 			unexpectedArgs: []string{
 				"cloud-init", // No ISO for PXE boot
 			},
 		},
+		{
+			name: "clone of a pxeboot target vm",
+			opts: &vmStartOptions{
+				vmName: "pxe-clone",
+				meta:   &metadata.Metadata{Role: "target", Arch: "aarch64", MAC: "aa:bb:cc", PxeBoot: true, CloneOf: "pxe-target"},
+			},
+			cloudInitISO: true,
+			boot:         "disk",
+			expectedArgs: []string{
+				"-drive", "file=/configs/cloud-init/pxe-clone.iso,format=raw,if=virtio",
+			},
+		},
+		{
+			name: "target vm with bridge network",
+			opts: &vmStartOptions{
+				vmName:  "test-target",
+				meta:    &metadata.Metadata{Role: "target", Arch: "aarch64", MAC: "aa:bb:cc"},
+				network: netbackend.NewBridge("pvmlab0"),
+			},
+			expectedArgs: []string{
+				"-device", "virtio-net-pci,netdev=net0,mac=aa:bb:cc",
+				"-netdev", "tap,id=net0,ifname=" + netbackend.TapName("test-target") + ",script=no,downscript=no",
+			},
+			unexpectedArgs: []string{
+				"fd=3",
+			},
+		},
 		{
 			name: "x86_64 vm",
 			opts: &vmStartOptions{
@@ -143,33 +194,184 @@ func TestBuildQEMUArgs(t *testing.T) {
 			expectedArgs: []string{
 				"qemu-system-x86_64",
 				"-M", "q35",
+				"-drive", "if=pflash,format=raw,readonly=on,file=/firmware/code.fd",
+				"-drive", "if=pflash,format=raw,file=/vms/x86-vm-vars.fd",
 				"-cpu", "max",
+				"-accel", "tcg",
+			},
+			unexpectedArgs: []string{
+				"gic-version=3",
+			},
+		},
+		{
+			name: "x86_64 vm with unified firmware",
+			opts: &vmStartOptions{
+				vmName: "x86-vm",
+				meta:   &metadata.Metadata{Role: "target", Arch: "x86_64", MAC: "aa:bb:cc"},
+			},
+			unifiedFirmware: true,
+			expectedArgs: []string{
+				"-drive", "if=pflash,format=raw,file=/vms/x86-vm-code.fd",
+			},
+			unexpectedArgs: []string{
+				"readonly=on,file=",
+				"-vars.fd",
+			},
+		},
+		{
+			name: "x86_64 vm created with a unified firmware copy",
+			opts: &vmStartOptions{
+				vmName: "x86-vm",
+				meta:   &metadata.Metadata{Role: "target", Arch: "x86_64", MAC: "aa:bb:cc"},
+			},
+			legacyCodeFile: true,
+			expectedArgs: []string{
+				"-drive", "if=pflash,format=raw,file=/vms/x86-vm-code.fd",
+			},
+			unexpectedArgs: []string{
+				"-vars.fd",
+			},
+		},
+		{
+			name: "aarch64 vm with kvm",
+			opts: &vmStartOptions{
+				vmName: "kvm-vm",
+				meta:   &metadata.Metadata{Role: "target", Arch: "aarch64", MAC: "aa:bb:cc"},
+			},
+			accel: "kvm",
+			expectedArgs: []string{
+				"-M", "virt,gic-version=host",
+				"-cpu", "host",
+				"-accel", "kvm",
+			},
+		},
+		{
+			name: "default resources",
+			opts: &vmStartOptions{
+				vmName: "test-target",
+				meta:   &metadata.Metadata{Role: "target", Arch: "aarch64", MAC: "aa:bb:cc"},
+			},
+			expectedArgs: []string{
+				"-smp 2 -m 2048",
+			},
+		},
+		{
+			name: "custom resources",
+			opts: &vmStartOptions{
+				vmName: "big-target",
+				meta: &metadata.Metadata{
+					Role: "target", Arch: "aarch64", MAC: "aa:bb:cc",
+					CPUs: 8, MemoryMB: 16384, CPUModel: "cortex-a72", Machine: "virt,gic-version=2",
+				},
+			},
+			expectedArgs: []string{
+				"-M virt,gic-version=2 -smp 8 -m 16384",
+				"-cpu cortex-a72 -accel hvf",
 			},
 			unexpectedArgs: []string{
 				"gic-version=3",
+				"-m 2048",
+				"-cpu host",
+			},
+		},
+		{
+			name: "target vm with data disks",
+			opts: &vmStartOptions{
+				vmName: "disk-target",
+				meta: &metadata.Metadata{
+					Role: "target", Arch: "aarch64", MAC: "aa:bb:cc",
+					Disks: []metadata.Disk{{Name: "data1", Size: "10G", Bus: "nvme", Serial: "NVME1"}},
+				},
+			},
+			expectedArgs: []string{
+				"-drive", "file=/vms/disk-target.qcow2,format=qcow2,if=virtio,serial=pvmlab-root",
+				"-drive", "file=/vms/disk-target-data1.qcow2,format=qcow2,if=none,id=disk-data1",
+				"-device", "nvme,drive=disk-data1,serial=NVME1",
+			},
+		},
+		{
+			name: "target vm booting from virtual media",
+			opts: &vmStartOptions{
+				vmName: "media-target",
+				meta:   &metadata.Metadata{Role: "target", Arch: "aarch64", MAC: "aa:bb:cc", VirtualMedia: "http://example.com/boot.iso"},
+			},
+			boot: "cdrom",
+			expectedArgs: []string{
+				"-drive", "file=/vms/media-target-media.iso,format=raw,if=none,id=vmedia0,media=cdrom,readonly=on",
+				"-device", "virtio-scsi-pci,id=vmedia-scsi",
+				"-device", "scsi-cd,drive=vmedia0,bus=vmedia-scsi.0,bootindex=0",
 			},
 		},
+		{
+			name: "unsupported architecture",
+			opts: &vmStartOptions{
+				vmName: "test-target",
+				meta:   &metadata.Metadata{Role: "target", Arch: "riscv64"},
+			},
+			expectedError: "unsupported architecture: riscv64",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			setupMocks(t)
+			bootOverride = tt.boot
+			defer func() { bootOverride = "" }()
 
 			// Create a temporary directory for app files
 			tempDir := t.TempDir()
 			tt.opts.appDir = tempDir
+			tt.opts.sharedDir = tempDir
+			if tt.opts.network == nil {
+				tt.opts.network = netbackend.NewSocketVmnet()
+			}
 			if err := os.MkdirAll(filepath.Join(tempDir, "vms"), 0755); err != nil {
 				t.Fatalf("failed to create temp vms dir: %v", err)
 			}
 
-			// Create a dummy UEFI vars file to avoid dependency on host system
-			dummyUefiVarsPath := filepath.Join(tempDir, "dummy-uefi-vars.fd")
-			if err := os.WriteFile(dummyUefiVarsPath, []byte(""), 0644); err != nil {
-				t.Fatalf("failed to create dummy uefi vars file: %v", err)
+			// Create dummy firmware files to avoid dependency on host system
+			firmwareDir := filepath.Join(tempDir, "firmware")
+			if err := os.MkdirAll(firmwareDir, 0755); err != nil {
+				t.Fatalf("failed to create dummy firmware dir: %v", err)
+			}
+			firmware := &qemu.Firmware{Code: filepath.Join(firmwareDir, "code.fd")}
+			if !tt.unifiedFirmware {
+				firmware.Vars = filepath.Join(firmwareDir, "vars.fd")
+			}
+			for _, path := range []string{firmware.Code, firmware.Vars} {
+				if path != "" {
+					if err := os.WriteFile(path, []byte(""), 0644); err != nil {
+						t.Fatalf("failed to create dummy firmware file: %v", err)
+					}
+				}
+			}
+			if tt.cloudInitISO {
+				isoDir := filepath.Join(tempDir, "configs", "cloud-init")
+				if err := os.MkdirAll(isoDir, 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(isoDir, tt.opts.vmName+".iso"), []byte(""), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.legacyCodeFile {
+				if err := os.WriteFile(filepath.Join(tempDir, "vms", tt.opts.vmName+"-code.fd"), []byte(""), 0644); err != nil {
+					t.Fatalf("failed to create legacy code file: %v", err)
+				}
+			}
+			originalFindFirmware, originalSelectAccelerator := findFirmware, selectAccelerator
+			defer func() { findFirmware, selectAccelerator = originalFindFirmware, originalSelectAccelerator }()
+			findFirmware = func(arch string) (*qemu.Firmware, error) { return firmware, nil }
+			selectAccelerator = func(arch string) qemu.Accelerator {
+				switch {
+				case tt.accel != "":
+					return qemu.Accelerator{Name: tt.accel}
+				case arch == "aarch64":
+					return qemu.Accelerator{Name: "hvf"}
+				default:
+					return qemu.Accelerator{Name: "tcg"}
+				}
 			}
-			originalUefiVarsPath := uefiVarsTemplatePath
-			uefiVarsTemplatePath = dummyUefiVarsPath
-			defer func() { uefiVarsTemplatePath = originalUefiVarsPath }()
 
 			// The buildQEMUArgs function relies on info gathered in gatherVMInfo.
 			// We can simulate that the necessary files exist by not returning an error
@@ -194,6 +396,7 @@ func TestBuildQEMUArgs(t *testing.T) {
 				expected = strings.Replace(expected, "/vms", filepath.Join(tempDir, "vms"), 1)
 				expected = strings.Replace(expected, "/configs", filepath.Join(tempDir, "configs"), 1)
 				expected = strings.Replace(expected, "/docker_images", filepath.Join(tempDir, "docker_images"), 1)
+				expected = strings.Replace(expected, "/firmware", firmwareDir, 1)
 
 				if !strings.Contains(argString, expected) {
 					t.Errorf("expected QEMU args to contain '%s', but they did not. Got: %s", expected, argString)
@@ -207,3 +410,53 @@ func TestBuildQEMUArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestWaitForVM_PXE(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        string
+		expectedError string
+	}{
+		{
+			name:   "installation succeeded",
+			status: `{"phase": 7, "total_phases": 7, "phase_name": "Finalization", "state": "succeeded"}`,
+		},
+		{
+			name:          "installation failed",
+			status:        `{"phase": 4, "total_phases": 7, "phase_name": "Disk Preparation", "state": "failed", "error": "no disk found"}`,
+			expectedError: "installation failed in phase 4/7 (Disk Preparation): no disk found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupMocks(t)
+			defer func() { bootOverride = "" }()
+			bootOverride = "pxe"
+
+			cfg, _ := config.New()
+			opts := &vmStartOptions{
+				vmName: "target1",
+				cfg:    cfg,
+				meta:   &metadata.Metadata{Name: "target1", Role: "target", MAC: "52:54:00:00:00:01"},
+				appDir: cfg.GetAppDir(),
+			}
+			path := installstatus.Path(installStatusDir(opts), opts.meta.MAC)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(tt.status), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := waitForVM(opts)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("expected error to contain '%s', but got '%v'", tt.expectedError, err)
+				}
+			} else if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+		})
+	}
+}
@@ -3,11 +3,11 @@ package cmd
 
 import (
 	"fmt"
-	"net"
 	"os"
 	"path/filepath"
 	"pvmlab/internal/config"
 	"pvmlab/internal/pidfile"
+	"pvmlab/internal/qmp"
 	"syscall"
 	"time"
 
@@ -17,11 +17,15 @@ import (
 
 var syscallKill = syscall.Kill
 
+// gracefulShutdownTimeout is how long the guest has to power off after an
+// ACPI shutdown request.
+const gracefulShutdownTimeout = 10 * time.Second
+
 // vmStopCmd represents the stop command
 var vmStopCmd = &cobra.Command{
 	Use:   "stop <vm-name>",
 	Short: "Stops a VM",
-	Long:  `Stops a VM. It first attempts a graceful shutdown, then resorts to force-stopping the process.`,
+	Long:  `Stops a VM. It first asks the guest to power off over QMP, then resorts to force-stopping the process.`,
 	Args:  cobra.ExactArgs(1),
 	ValidArgsFunction: VmNameCompleter,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -42,26 +46,26 @@ var vmStopCmd = &cobra.Command{
 			return fmt.Errorf("error reading PID file: %w", err)
 		}
 
-		// 1. Attempt Graceful Shutdown via Monitor
-		monitorPath := filepath.Join(appDir, "monitors", vmName+".sock")
-		if _, err := os.Stat(monitorPath); err == nil {
+		// 1. Attempt Graceful Shutdown via QMP
+		socketPath := qmpSocketPath(appDir, vmName)
+		if _, err := os.Stat(socketPath); err == nil {
 			color.Cyan("i Attempting graceful shutdown...")
-			conn, err := net.DialTimeout("unix", monitorPath, 1*time.Second)
-			if err == nil {
-				defer conn.Close()
-				_, err := conn.Write([]byte("system_powerdown\n"))
-				if err == nil {
-					// Wait up to 10 seconds for the process to exit
-					for i := 0; i < 10; i++ {
-						if !isProcessRunning(pid) {
-							color.Green("✔ Graceful shutdown successful.")
-							cleanupFiles(vmName, appDir)
-							return nil
-						}
-						time.Sleep(1 * time.Second)
+			// Record the request first, for 'vm list' to show it while the
+			// guest shuts down.
+			markPowerdown(appDir, vmName)
+			if err := qmp.Powerdown(socketPath, gracefulShutdownTimeout); err != nil {
+				color.Yellow("! VM did not shut down gracefully (%v), proceeding to force stop.", err)
+			} else {
+				// QEMU exits right after reporting the shutdown.
+				for i := 0; i < 5; i++ {
+					if !isProcessRunning(pid) {
+						color.Green("✔ Graceful shutdown successful.")
+						cleanupFiles(vmName, appDir)
+						return nil
 					}
-					color.Yellow("! VM did not shut down gracefully, proceeding to force stop.")
+					time.Sleep(1 * time.Second)
 				}
+				color.Yellow("! QEMU did not exit after the guest shut down, proceeding to force stop.")
 			}
 		}
 
@@ -108,15 +112,44 @@ var isProcessRunning = func(pid int) bool {
 	return err == nil
 }
 
+// powerdownPath returns the path of the file recording that the guest of a VM
+// was asked to power off.
+func powerdownPath(appDir, vmName string) string {
+	return filepath.Join(appDir, "pids", vmName+".powerdown")
+}
+
+// markPowerdown records that the guest of a running VM was asked to power
+// off, for the VM to show as shutdown-pending until QEMU exits.
+func markPowerdown(appDir, vmName string) {
+	if err := os.WriteFile(powerdownPath(appDir, vmName), nil, 0644); err != nil {
+		color.Yellow("! Warning: could not record the shutdown request: %v", err)
+	}
+}
+
+// powerdownPending returns whether the guest of a running VM was asked to
+// power off since QEMU was started. Requests recorded before the VM was last
+// started are ignored.
+func powerdownPending(appDir, vmName string) bool {
+	marker, err := os.Stat(powerdownPath(appDir, vmName))
+	if err != nil {
+		return false
+	}
+	pid, err := os.Stat(filepath.Join(appDir, "pids", vmName+".pid"))
+	return err == nil && !marker.ModTime().Before(pid.ModTime())
+}
+
 func cleanupFiles(vmName string, appDir string) {
 	pidPath := filepath.Join(appDir, "pids", vmName+".pid")
-	monitorPath := filepath.Join(appDir, "monitors", vmName+".sock")
+	socketPath := qmpSocketPath(appDir, vmName)
 
 	if err := os.Remove(pidPath); err != nil && !os.IsNotExist(err) {
 		color.Yellow("! Warning: could not remove pid file: %v", err)
 	}
-	if err := os.Remove(monitorPath); err != nil && !os.IsNotExist(err) {
-		color.Yellow("! Warning: could not remove monitor socket: %v", err)
+	if err := os.Remove(powerdownPath(appDir, vmName)); err != nil && !os.IsNotExist(err) {
+		color.Yellow("! Warning: could not remove the shutdown request: %v", err)
+	}
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		color.Yellow("! Warning: could not remove QMP socket: %v", err)
 	}
 }
 
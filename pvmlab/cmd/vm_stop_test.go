@@ -1,11 +1,15 @@
 package cmd
 
 import (
+	"os"
+	"path/filepath"
 	"pvmlab/internal/config"
 	"pvmlab/internal/pidfile"
+	"pvmlab/internal/qmp"
 	"strings"
 	"syscall"
 	"testing"
+	"time"
 )
 
 func TestVMStopCommand(t *testing.T) {
@@ -48,6 +52,29 @@ func TestVMStopCommand(t *testing.T) {
 			expectedError: "",
 			expectedOut:   "VM 'test-vm' stopped successfully",
 		},
+		{
+			name: "graceful shutdown over qmp",
+			args: []string{"vm", "stop", "test-vm"},
+			setupMocks: func() {
+				pidfile.Read = func(c *config.Config, name string) (int, error) {
+					return 123, nil
+				}
+				cfg, _ := config.New()
+				socketPath := qmpSocketPath(cfg.GetAppDir(), "test-vm")
+				os.MkdirAll(filepath.Dir(socketPath), 0755)
+				os.WriteFile(socketPath, nil, 0644)
+				powerdownCalled := false
+				qmp.Powerdown = func(path string, timeout time.Duration) error {
+					powerdownCalled = path == socketPath
+					return nil
+				}
+				isProcessRunning = func(pid int) bool {
+					return !powerdownCalled
+				}
+			},
+			expectedError: "",
+			expectedOut:   "Graceful shutdown successful",
+		},
 		{
 			name: "forceful shutdown success",
 			args: []string{"vm", "stop", "test-vm"},
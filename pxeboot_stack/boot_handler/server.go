@@ -7,10 +7,12 @@ import (
 	"fmt"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -158,27 +160,46 @@ func buildTargetNetworkConfig(mac string) *NetplanConfig {
 	return cfg
 }
 
-// VM represents the structure of the VM's JSON definition file.
+// VM represents the structure of the VM's JSON definition file. The files are
+// written by pvmlab, which saves the records it migrates to a newer metadata
+// schema as soon as it loads them, so the records read here are expected to
+// be current; other fields, like schema_version, are ignored.
 type VM struct {
-	Name    string `json:"name"`
-	Arch    string `json:"arch"`
-	Distro  string `json:"distro"`
-	MAC     string `json:"mac"`
-	SSHKey  string `json:"ssh_key"`
-	Kernel  string `json:"kernel,omitempty"`
-	Initrd  string `json:"initrd,omitempty"`
-	PxeBoot bool   `json:"pxeboot,omitempty"`
+	Name         string `json:"name"`
+	Arch         string `json:"arch"`
+	Distro       string `json:"distro"`
+	DistroFamily string `json:"distro_family,omitempty"`
+	MAC          string `json:"mac"`
+	SSHKey       string `json:"ssh_key"`
+	Kernel       string `json:"kernel,omitempty"`
+	Initrd       string `json:"initrd,omitempty"`
+	PxeBoot      bool   `json:"pxeboot,omitempty"`
 }
 
 // InstallerConfig is the configuration provided to the installer running in the initrd.
 type InstallerConfig struct {
 	CloudInitURL    string `json:"cloud_init_url"`
 	Distro          string `json:"distro"`
+	DistroFamily    string `json:"distro_family,omitempty"`
 	Arch            string `json:"arch"`
 	RootfsURL       string `json:"rootfs_url"`
 	KmodsURL        string `json:"kmods_url"`
 	KernelURL       string `json:"kernel_url"`
 	RebootOnSuccess bool   `json:"reboot_on_success"`
+	StatusURL       string `json:"status_url"`
+}
+
+// InstallStatus is the progress of the installer of a VM, as reported by the
+// installer and read back by 'pvmlab vm start --wait'.
+type InstallStatus struct {
+	VM          string    `json:"vm"`
+	MAC         string    `json:"mac"`
+	Phase       int       `json:"phase"`
+	TotalPhases int       `json:"total_phases,omitempty"`
+	PhaseName   string    `json:"phase_name"`
+	State       string    `json:"state"`
+	Error       string    `json:"error,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 type httpServer struct {
@@ -215,21 +236,118 @@ func (s *httpServer) configHandler(w http.ResponseWriter, r *http.Request) {
 	config := &InstallerConfig{
 		CloudInitURL:    fmt.Sprintf("%s/cloud-init/%s", baseURL, vm.Name),
 		Distro:          vm.Distro,
+		DistroFamily:    vm.DistroFamily,
 		Arch:            vm.Arch,
 		RootfsURL:       fmt.Sprintf("%s/images/%s/%s/rootfs.tar.gz", baseURL, vm.Distro, vm.Arch),
 		KmodsURL:        fmt.Sprintf("%s/images/%s/%s/modules.cpio.gz", baseURL, vm.Distro, vm.Arch),
 		KernelURL:       fmt.Sprintf("%s/images/%s/%s/%s", baseURL, vm.Distro, vm.Arch, vm.Kernel),
 		RebootOnSuccess: rebootOnSuccess,
+		StatusURL:       fmt.Sprintf("%s/status/%s", baseURL, mac),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(config)
 }
 
+// installStatusPath returns the path of the file the status of the installer
+// of the VM with the given MAC address is persisted to.
+func (s *httpServer) installStatusPath(mac string) string {
+	name := strings.ReplaceAll(strings.ToLower(mac), ":", "-") + ".json"
+	return filepath.Join(s.vmsDir, "install-status", name)
+}
+
+// statusHandler stores (POST) and returns (GET) the installation status of a VM.
+func (s *httpServer) statusHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 3 || parts[2] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	// The MAC address names the status file, so it must not be a path.
+	hw, err := net.ParseMAC(parts[2])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid MAC address '%s'", parts[2]), http.StatusBadRequest)
+		return
+	}
+	mac := hw.String()
+	path := s.installStatusPath(mac)
+
+	switch r.Method {
+	case http.MethodGet:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	case http.MethodPost:
+		vm, err := s.findVMByMAC(mac)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		var status InstallStatus
+		if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid status: %v", err), http.StatusBadRequest)
+			return
+		}
+		switch status.State {
+		case "running", "succeeded", "failed":
+		default:
+			http.Error(w, fmt.Sprintf("Invalid state '%s'", status.State), http.StatusBadRequest)
+			return
+		}
+		status.VM = vm.Name
+		status.MAC = vm.MAC
+		status.UpdatedAt = time.Now().UTC()
+
+		if err := writeJSONFile(path, &status); err != nil {
+			log.Printf("Error saving install status for %s: %v", vm.Name, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Install status for %s: phase %d (%s) %s %s", vm.Name, status.Phase, status.PhaseName, status.State, status.Error)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeJSONFile writes v to path through a temporary file, so that readers
+// never see a partially written file.
+func writeJSONFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// Concurrent writers each get their own temporary file.
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed.
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
 func (s *httpServer) cloudInitHandler(w http.ResponseWriter, r *http.Request) {
 	parts := strings.Split(r.URL.Path, "/")
 	if len(parts) < 4 {
-		errorMsg := fmt.Sprintf("Invalid cloud-init request path: %s. Path should be /cloud-init/<vm_name>/(meta-data|user-data|network-config)", r.URL.Path)
+		errorMsg := fmt.Sprintf("Invalid cloud-init request path: %s. Path should be /cloud-init/<vm_name>/(meta-data|user-data|vendor-data|network-config)", r.URL.Path)
 		log.Print(errorMsg)
 		w.Write([]byte(errorMsg))
 		http.NotFound(w, r)
@@ -253,30 +371,128 @@ func (s *httpServer) cloudInitHandler(w http.ResponseWriter, r *http.Request) {
 		data = buildTargetMetaData(vm.Name, vm.SSHKey)
 	case "user-data":
 		data = buildTargetUserData()
+	case "vendor-data":
+		// Only supplied by 'pvmlab vm create --vendor-data'.
 	case "network-config":
 		data = buildTargetNetworkConfig(vm.MAC)
 	default:
-		http.Error(w, "Invalid file type requested. Please use /cloud-init/<vm_name>/(meta-data|user-data|network-config)", http.StatusBadRequest)
+		http.Error(w, "Invalid file type requested. Please use /cloud-init/<vm_name>/(meta-data|user-data|vendor-data|network-config)", http.StatusBadRequest)
 		return
 	}
 
-	yamlData, err := marshal(data)
-	if err != nil {
-		log.Printf("Error marshalling %s for %s: %v", fileType, vmName, err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+	var yamlData []byte
+	if data != nil {
+		yamlData, err = marshal(data)
+		if err != nil {
+			log.Printf("Error marshalling %s for %s: %v", fileType, vmName, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 	}
 
-	if fileType == "user-data" {
-		userData := append([]byte("## template: jinja\n#cloud-config\n"), yamlData...)
-		w.Header().Set("Content-Type", "text/yaml")
-		w.Write(userData)
-	} else {
-		w.Header().Set("Content-Type", "text/yaml")
+	// Merge the user-data and vendor-data supplied with 'pvmlab vm create',
+	// stored next to the VM's definition.
+	if fileType == "user-data" || fileType == "vendor-data" {
+		yamlData, err = mergeStored(filepath.Join(s.vmsDir, vm.Name+"-"+fileType+".yaml"), yamlData)
+		if err != nil {
+			log.Printf("Error merging %s for %s: %v", fileType, vmName, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/yaml")
+	switch {
+	case fileType == "user-data":
+		w.Write(append([]byte("## template: jinja\n#cloud-config\n"), yamlData...))
+	case fileType == "vendor-data" && len(yamlData) > 0:
+		w.Write(append([]byte("#cloud-config\n"), yamlData...))
+	default:
 		w.Write(yamlData)
 	}
 }
 
+// mergeStored deep-merges the #cloud-config document stored at path, if any,
+// into generated: mappings are merged key by key, lists are appended to and
+// other values are replaced. This is the merge pvmlab applies to the
+// cloud-init ISO of the VMs that don't boot from the network.
+func mergeStored(path string, generated []byte) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return generated, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	override, err := parseCloudConfig(data)
+	if err != nil || override == nil {
+		return generated, err
+	}
+	base, err := parseCloudConfig(generated)
+	if err != nil {
+		return nil, err
+	}
+	if base == nil {
+		base = &yaml.Node{Kind: yaml.MappingNode}
+	}
+	return marshal(mergeNodes(base, override))
+}
+
+// parseCloudConfig returns the top-level mapping of a #cloud-config
+// document, or nil if the document is empty.
+func parseCloudConfig(data []byte) (*yaml.Node, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("not a valid #cloud-config YAML document: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	node := doc.Content[0]
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("not a #cloud-config document: expected a YAML mapping at the top level")
+	}
+	// Drop the #cloud-config header, which is added back to the merged
+	// document.
+	header := []*yaml.Node{&doc, node}
+	if len(node.Content) > 0 {
+		header = append(header, node.Content[0])
+	}
+	for _, n := range header {
+		n.HeadComment = strings.TrimSpace(strings.TrimPrefix(n.HeadComment, "#cloud-config"))
+	}
+	return node, nil
+}
+
+func mergeNodes(base, override *yaml.Node) *yaml.Node {
+	switch {
+	case base.Kind == yaml.MappingNode && override.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(override.Content); i += 2 {
+			key, value := override.Content[i], override.Content[i+1]
+			found := false
+			for j := 0; j+1 < len(base.Content); j += 2 {
+				if base.Content[j].Value == key.Value {
+					base.Content[j+1] = mergeNodes(base.Content[j+1], value)
+					found = true
+					break
+				}
+			}
+			if !found {
+				base.Content = append(base.Content, key, value)
+			}
+		}
+		return base
+	case base.Kind == yaml.SequenceNode && override.Kind == yaml.SequenceNode:
+		base.Content = append(base.Content, override.Content...)
+		return base
+	default:
+		return override
+	}
+}
+
 func (s *httpServer) ipxeHandler(w http.ResponseWriter, r *http.Request) {
 	mac := r.URL.Query().Get("mac")
 	if mac == "" {
@@ -368,6 +584,7 @@ func main() {
 	http.HandleFunc("/ipxe", server.ipxeHandler)
 	http.HandleFunc("/cloud-init/", server.cloudInitHandler)
 	http.HandleFunc("/config/", server.configHandler)
+	http.HandleFunc("/status/", server.statusHandler)
 	log.Printf("Starting PXE boot server on :8080, watching VM definitions in %s", *vmsDir)
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
@@ -1,15 +1,19 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestIpxeHandler(t *testing.T) {
@@ -22,7 +26,7 @@ func TestIpxeHandler(t *testing.T) {
 
 	// Create a mock VM JSON file
 	vmMAC := "52:54:00:12:34:56"
-			vmJSON := fmt.Sprintf(`{
+	vmJSON := fmt.Sprintf(`{
 			"name": "test-vm",
 			"arch": "aarch64",
 			"distro": "ubuntu-24.04",
@@ -31,7 +35,8 @@ func TestIpxeHandler(t *testing.T) {
 			"kernel": "vmlinuz-generic",
 			"initrd": "initrd-generic.img",
 			"pxeboot": true
-		}`, vmMAC)	vmFile := filepath.Join(tmpDir, "test-vm.json")
+		}`, vmMAC)
+	vmFile := filepath.Join(tmpDir, "test-vm.json")
 	if err := os.WriteFile(vmFile, []byte(vmJSON), 0644); err != nil {
 		t.Fatalf("Failed to write mock VM JSON: %v", err)
 	}
@@ -67,23 +72,11 @@ boot
 			mac:            vmMAC,
 			expectedStatus: http.StatusOK,
 			expectedBody: `#!ipxe
-
-set kernel_args ip=dhcp console=ttyS0,115200 config_url=http://${next-server}/config/${mac}
-
-# Use custom installer initrd for PXE boot installations
-set initrd http://${next-server}/initrds/initrd.gz
-set kernel http://${next-server}/images/ubuntu-24.04/aarch64/vmlinuz-generic
-
-echo "==> VM Name: test-vm"
-echo "==> MAC: 52:54:00:12:34:56"
-echo "==> Distro: ubuntu-24.04"
-echo "==> Arch: aarch64"
-echo "==> Kernel: ${kernel} ${kernel_args}"
-echo "==> Initrd: ${initrd}"
-
-kernel ${kernel} ${kernel_args} || shell
-initrd ${initrd} || shell
-boot || shell
+echo Booting test-vm (aarch64)
+set base-url http://192.168.100.1/images/ubuntu-24.04
+kernel ${base-url}/vmlinuz quiet autoinstall
+initrd ${base-url}/initrd
+boot
 `,
 		},
 		{
@@ -146,6 +139,201 @@ boot || shell
 	}
 }
 
+func TestStatusHandler(t *testing.T) {
+	tmpDir := t.TempDir()
+	vmMAC := "52:54:00:12:34:56"
+	vmJSON := fmt.Sprintf(`{"name": "test-vm", "arch": "aarch64", "distro": "ubuntu-24.04", "mac": "%s", "pxeboot": true}`, vmMAC)
+	if err := os.WriteFile(filepath.Join(tmpDir, "test-vm.json"), []byte(vmJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server := &httpServer{vmsDir: tmpDir}
+
+	// The cases run in order against the same server.
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{"GET before any status", "GET", "/status/" + vmMAC, "", http.StatusNotFound},
+		{"POST running", "POST", "/status/" + vmMAC, `{"phase": 2, "total_phases": 5, "phase_name": "partition", "state": "running"}`, http.StatusNoContent},
+		{"POST invalid state", "POST", "/status/" + vmMAC, `{"phase": 3, "phase_name": "format", "state": "done"}`, http.StatusBadRequest},
+		{"POST invalid JSON", "POST", "/status/" + vmMAC, `{"state": `, http.StatusBadRequest},
+		{"POST unknown MAC", "POST", "/status/00:00:00:00:00:00", `{"phase": 1, "state": "running"}`, http.StatusNotFound},
+		{"GET unknown MAC", "GET", "/status/00:00:00:00:00:00", "", http.StatusNotFound},
+		{"MAC missing", "POST", "/status/", `{"phase": 1, "state": "running"}`, http.StatusNotFound},
+		{"method not allowed", "PUT", "/status/" + vmMAC, `{"phase": 1, "state": "running"}`, http.StatusMethodNotAllowed},
+		{"GET with a lowercase MAC", "GET", "/status/" + strings.ToLower(vmMAC), "", http.StatusOK},
+		{"GET invalid MAC", "GET", "/status/..%2F..%2Ftest-vm", "", http.StatusBadRequest},
+		{"POST invalid MAC", "POST", "/status/not-a-mac", `{"phase": 1, "state": "running"}`, http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(server.statusHandler).ServeHTTP(rr, req)
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v (%s)", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+		})
+	}
+
+	// The rejected updates left the stored status alone.
+	req := httptest.NewRequest("GET", "/status/"+vmMAC, nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.statusHandler).ServeHTTP(rr, req)
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected a JSON content type, got %q", ct)
+	}
+	var status InstallStatus
+	if err := json.NewDecoder(rr.Body).Decode(&status); err != nil {
+		t.Fatalf("could not decode the status: %v", err)
+	}
+	if status.VM != "test-vm" || status.MAC != vmMAC || status.Phase != 2 || status.TotalPhases != 5 ||
+		status.PhaseName != "partition" || status.State != "running" || status.UpdatedAt.IsZero() {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestCloudInitHandler_MergeStored(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"merged-vm.json": `{"name": "merged-vm", "mac": "52:54:00:00:00:01", "ssh_key": "ssh-ed25519 test"}`,
+		"plain-vm.json":  `{"name": "plain-vm", "mac": "52:54:00:00:00:02", "ssh_key": "ssh-ed25519 test"}`,
+		"broken-vm.json": `{"name": "broken-vm", "mac": "52:54:00:00:00:03", "ssh_key": "ssh-ed25519 test"}`,
+		"merged-vm-user-data.yaml": `#cloud-config
+ssh_pwauth: false
+packages:
+  - htop
+runcmd:
+  - echo hello
+chpasswd:
+  expire: true
+`,
+		"merged-vm-vendor-data.yaml": `#cloud-config
+write_files:
+  - path: /etc/motd
+    content: hello
+`,
+		"broken-vm-user-data.yaml": "#cloud-config\n- not a mapping\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := &httpServer{vmsDir: tmpDir}
+
+	get := func(t *testing.T, path string) *httptest.ResponseRecorder {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(server.cloudInitHandler).ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr
+	}
+	// parse checks the header of a #cloud-config response and returns its
+	// content.
+	parse := func(t *testing.T, rr *httptest.ResponseRecorder, header string) map[string]any {
+		t.Helper()
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		body, ok := strings.CutPrefix(rr.Body.String(), header)
+		if !ok {
+			t.Fatalf("expected the response to start with %q, got:\n%s", header, rr.Body.String())
+		}
+		var doc map[string]any
+		if err := yaml.Unmarshal([]byte(body), &doc); err != nil {
+			t.Fatalf("could not parse the response: %v\n%s", err, body)
+		}
+		return doc
+	}
+
+	t.Run("user-data is merged", func(t *testing.T) {
+		doc := parse(t, get(t, "/cloud-init/merged-vm/user-data"), "## template: jinja\n#cloud-config\n")
+		if doc["ssh_pwauth"] != false {
+			t.Errorf("expected the stored ssh_pwauth to replace the generated one, got %v", doc["ssh_pwauth"])
+		}
+		if !reflect.DeepEqual(doc["packages"], []any{"htop"}) {
+			t.Errorf("expected the stored packages to be added, got %v", doc["packages"])
+		}
+		runcmd, _ := doc["runcmd"].([]any)
+		if len(runcmd) != len(buildTargetUserData().RunCmd)+1 || runcmd[len(runcmd)-1] != "echo hello" {
+			t.Errorf("expected the stored runcmd to be appended to the generated one, got %v", runcmd)
+		}
+		chpasswd, _ := doc["chpasswd"].(map[string]any)
+		if chpasswd["expire"] != true || chpasswd["users"] == nil {
+			t.Errorf("expected chpasswd to be merged key by key, got %v", doc["chpasswd"])
+		}
+		if users, _ := doc["users"].([]any); len(users) != 1 {
+			t.Errorf("expected the generated users to be kept, got %v", doc["users"])
+		}
+	})
+
+	t.Run("vendor-data is served", func(t *testing.T) {
+		doc := parse(t, get(t, "/cloud-init/merged-vm/vendor-data"), "#cloud-config\n")
+		expected := []any{map[string]any{"path": "/etc/motd", "content": "hello"}}
+		if !reflect.DeepEqual(doc["write_files"], expected) {
+			t.Errorf("expected the stored write_files, got %v", doc["write_files"])
+		}
+	})
+
+	t.Run("user-data without stored document", func(t *testing.T) {
+		doc := parse(t, get(t, "/cloud-init/plain-vm/user-data"), "## template: jinja\n#cloud-config\n")
+		if doc["ssh_pwauth"] != true || doc["packages"] != nil {
+			t.Errorf("expected the generated user-data, got %v", doc)
+		}
+	})
+
+	t.Run("empty vendor-data without stored document", func(t *testing.T) {
+		rr := get(t, "/cloud-init/plain-vm/vendor-data")
+		if rr.Code != http.StatusOK || rr.Body.Len() != 0 {
+			t.Errorf("expected an empty vendor-data, got %v %q", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("invalid stored document", func(t *testing.T) {
+		if rr := get(t, "/cloud-init/broken-vm/user-data"); rr.Code != http.StatusInternalServerError {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusInternalServerError)
+		}
+	})
+}
+
+func TestMergeStored(t *testing.T) {
+	tests := []struct {
+		name      string
+		stored    *string
+		generated string
+		expected  string
+	}{
+		{"no stored document", nil, "a: 1\n", "a: 1\n"},
+		{"empty stored document", ptr("#cloud-config\n"), "a: 1\n", "a: 1\n"},
+		{"nothing generated", ptr("#cloud-config\nb: 2\n"), "", "b: 2\n"},
+		{"scalars are replaced", ptr("#cloud-config\na: 2\n"), "a: 1\n", "a: 2\n"},
+		{"lists are appended to", ptr("#cloud-config\na:\n  - y\n"), "a:\n  - x\n", "a:\n  - x\n  - y\n"},
+		{"mappings are merged", ptr("#cloud-config\na:\n  b: 3\n  c: 4\n"), "a:\n  b: 2\n", "a:\n  b: 3\n  c: 4\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "user-data.yaml")
+			if tc.stored != nil {
+				if err := os.WriteFile(path, []byte(*tc.stored), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := mergeStored(path, []byte(tc.generated))
+			if err != nil {
+				t.Fatalf("mergeStored() failed: %v", err)
+			}
+			if string(got) != tc.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func ptr(s string) *string { return &s }
+
 func TestFindVMByMAC(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "pvmlab-test-findvm")
 	if err != nil {
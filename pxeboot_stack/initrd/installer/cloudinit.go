@@ -73,6 +73,16 @@ func fetchCloudInitData(baseURL string) (*CloudInitData, error) {
 	cloudInit.NetworkConfig = string(networkConfigBytes)
 	log.Info("Network-config fetched (%d bytes)", len(networkConfigBytes))
 
+	// Fetch vendor-data, which older boot handlers don't serve
+	log.Info("Fetching vendor-data...")
+	vendorDataBytes, err := fetchURL(baseURL + "/vendor-data")
+	if err != nil {
+		log.Warn("Failed to fetch vendor-data, skipping it: %v", err)
+	} else {
+		cloudInit.VendorData = string(vendorDataBytes)
+		log.Info("Vendor-data fetched (%d bytes)", len(vendorDataBytes))
+	}
+
 	return cloudInit, nil
 }
 
@@ -107,6 +117,15 @@ func configureSystem(cloudInit *CloudInitData) error {
 		return fmt.Errorf("failed to write network-config: %w", err)
 	}
 
+	// Write vendor-data
+	if cloudInit.VendorData != "" {
+		log.Info("Writing vendor-data...")
+		vendorDataPath := filepath.Join(cloudInitDir, "vendor-data")
+		if err := os.WriteFile(vendorDataPath, []byte(cloudInit.VendorData), 0644); err != nil {
+			return fmt.Errorf("failed to write vendor-data: %w", err)
+		}
+	}
+
 	log.Info("Cloud-init configuration written")
 
 	return nil
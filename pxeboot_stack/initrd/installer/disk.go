@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"installer/log"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
@@ -12,20 +14,12 @@ import (
 func prepareDisk() (string, error) {
 	log.Info("Detecting disks...")
 
-	// Find the first available disk (usually /dev/sda or /dev/vda)
-	var targetDisk string
-	for _, disk := range []string{"/dev/vda", "/dev/sda", "/dev/nvme0n1"} {
-		if _, err := os.Stat(disk); err == nil {
-			targetDisk = disk
-			break
-		}
+	targetDisk, err := findTargetDisk()
+	if err != nil {
+		return "", err
 	}
 
-	if targetDisk == "" {
-		return "", fmt.Errorf("no suitable disk found")
-	}
-
-	log.Info("Found disk: %s", targetDisk)
+	log.Info("Installing to disk: %s", targetDisk)
 
 	// Print disk information for debugging
 	log.Info("Dumping disk information...")
@@ -64,7 +58,8 @@ func prepareDisk() (string, error) {
 
 	// Determine partition naming scheme
 	var efiPart, rootPart string
-	if strings.Contains(targetDisk, "nvme") {
+	if last := targetDisk[len(targetDisk)-1]; last >= '0' && last <= '9' {
+		// e.g. /dev/nvme0n1p1 or /dev/mmcblk0p1
 		efiPart = targetDisk + "p1"
 		rootPart = targetDisk + "p2"
 	} else {
@@ -109,3 +104,94 @@ func prepareDisk() (string, error) {
 
 	return targetDisk, nil
 }
+
+// rootDiskSerial is the serial number pvmlab gives to the root disk of its VMs.
+const rootDiskSerial = "pvmlab-root"
+
+// skippedDevices are the prefixes of block devices that are never install targets.
+var skippedDevices = []string{"loop", "ram", "zram", "sr", "fd", "dm-", "md", "nbd"}
+
+// findTargetDisk returns the disk to install to. VMs can have several disks on
+// different buses, so it looks for the disk with pvmlab's root serial number
+// and otherwise falls back to the first virtio, then SCSI/SATA, then NVMe disk.
+func findTargetDisk() (string, error) {
+	entries, err := os.ReadDir("/sys/block")
+	if err != nil {
+		return "", fmt.Errorf("failed to list block devices: %w", err)
+	}
+
+	var disks []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if isSkippedDevice(name) {
+			continue
+		}
+		if readSysBlock(name, "removable") == "1" || readSysBlock(name, "size") == "0" {
+			continue
+		}
+		serial := diskSerial(name)
+		log.Info("Found disk: /dev/%s (serial: %s)", name, serial)
+		if serial == rootDiskSerial {
+			return "/dev/" + name, nil
+		}
+		disks = append(disks, name)
+	}
+	if len(disks) == 0 {
+		return "", fmt.Errorf("no suitable disk found")
+	}
+
+	sort.SliceStable(disks, func(i, j int) bool {
+		pi, pj := diskPriority(disks[i]), diskPriority(disks[j])
+		if pi != pj {
+			return pi < pj
+		}
+		return disks[i] < disks[j]
+	})
+	return "/dev/" + disks[0], nil
+}
+
+func isSkippedDevice(name string) bool {
+	for _, prefix := range skippedDevices {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func diskPriority(name string) int {
+	switch {
+	case strings.HasPrefix(name, "vd"):
+		return 0
+	case strings.HasPrefix(name, "sd"):
+		return 1
+	case strings.HasPrefix(name, "nvme"):
+		return 2
+	default:
+		return 3
+	}
+}
+
+// diskSerial returns the serial number of a disk as reported by virtio-blk,
+// NVMe or SCSI/SATA (VPD page 0x80) devices.
+func diskSerial(name string) string {
+	if serial := readSysBlock(name, "serial"); serial != "" {
+		return serial
+	}
+	if serial := readSysBlock(name, "device/serial"); serial != "" {
+		return serial
+	}
+	// The VPD page starts with a 4 byte header.
+	if page := readSysBlock(name, "device/vpd_pg80"); len(page) > 4 {
+		return strings.TrimSpace(strings.Trim(page[4:], "\x00"))
+	}
+	return ""
+}
+
+func readSysBlock(name, attr string) string {
+	data, err := os.ReadFile(filepath.Join("/sys/block", name, attr))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -73,8 +73,12 @@ func finalize(rebootOnSuccess bool, arch string, distro string, diskPath string)
 	var pkgManagerCmd []string
 
 	switch {
-	case strings.HasPrefix(distro, "ubuntu"):
+	case strings.HasPrefix(distro, "ubuntu"), strings.HasPrefix(distro, "debian"):
+		// Debian and Ubuntu share the same GRUB packages and tools.
 		bootloaderID = "ubuntu"
+		if strings.HasPrefix(distro, "debian") {
+			bootloaderID = "debian"
+		}
 		grubConfigCmd = "update-grub"
 		grubInstallCmd = "grub-install"
 		pkgManagerCmd = []string{"apt-get", "install", "-y"}
@@ -99,6 +103,19 @@ func finalize(rebootOnSuccess bool, arch string, distro string, diskPath string)
 			requiredPkgs = []string{"grub2-efi-aa64", "dracut-config-generic"}
 		}
 
+	case elFamily(distro) != "":
+		// The RHEL-family distros are installed like Fedora, their EFI
+		// directory is named after the distro.
+		bootloaderID = elFamily(distro)
+		grubConfigCmd = "grub2-mkconfig -o /boot/grub2/grub.cfg"
+		grubInstallCmd = "grub2-install"
+		pkgManagerCmd = []string{"dnf", "install", "-y"}
+		if arch == "x86_64" {
+			requiredPkgs = []string{"grub2-efi-x64", "grub2-efi-x64-modules", "grubby", "dracut-config-generic"}
+		} else {
+			requiredPkgs = []string{"grub2-efi-aa64", "grub2-efi-aa64-modules", "grubby", "dracut-config-generic"}
+		}
+
 	default:
 		return fmt.Errorf("unsupported distro for grub config generation: %s", distro)
 	}
@@ -152,7 +169,13 @@ LABEL=UEFI      /boot/efi       vfat    umask=0077        0       1
 		if err := runCommand("chroot", "/mnt/target", "update-initramfs", "-c", "-k", "all"); err != nil {
 			return fmt.Errorf("update-initramfs failed: %w", err)
 		}
-	case strings.HasPrefix(distro, "fedora"):
+	case strings.HasPrefix(distro, "debian"):
+		// The Debian cloud images ship the initramfs of their kernel, which
+		// is updated for the new disk layout and fstab.
+		if err := runCommand("chroot", "/mnt/target", "update-initramfs", "-u", "-k", "all"); err != nil {
+			return fmt.Errorf("update-initramfs failed: %w", err)
+		}
+	case strings.HasPrefix(distro, "fedora"), elFamily(distro) != "":
 		kernelVersion, err := findKernelVersion("/mnt/target/lib/modules")
 		if err != nil {
 			return fmt.Errorf("could not determine kernel version for initramfs generation: %w", err)
@@ -176,9 +199,11 @@ LABEL=UEFI      /boot/efi       vfat    umask=0077        0       1
 				filteredArgs = append(filteredArgs, arg)
 			}
 		}
-		// Add SELinux disable parameter for the first boot
-		// TODO: make SELinux work.
-		filteredArgs = append(filteredArgs, "selinux=0")
+		if elFamily(distro) == "" {
+			// Add SELinux disable parameter for the first boot
+			// TODO: make SELinux work.
+			filteredArgs = append(filteredArgs, "selinux=0")
+		}
 		newCmdline := strings.Join(filteredArgs, " ")
 
 		// Construct the new GRUB_CMDLINE_LINUX_DEFAULT line
@@ -230,6 +255,24 @@ LABEL=UEFI      /boot/efi       vfat    umask=0077        0       1
 		if err := runCommand("chroot", "/mnt/target", "ln", "-sf", "boot/"+initramfsFile, initramfsFile); err != nil {
 			log.Warn("failed to create symlink for initramfs: %v", err)
 		}
+
+		if elFamily(distro) != "" {
+			// The BLS entries of the RHEL-family images have their own kernel
+			// command line, which grub2-mkconfig doesn't update: point them
+			// to the new root filesystem.
+			log.Info("Updating the kernel command line of the boot entries...")
+			args := strings.TrimSpace("root=LABEL=cloudimg-rootfs " + newCmdline)
+			if err := runCommand("chroot", "/mnt/target", "grubby", "--update-kernel=ALL", "--args="+args); err != nil {
+				return fmt.Errorf("grubby failed: %w", err)
+			}
+
+			// The rootfs tarball doesn't keep the SELinux labels, have them
+			// restored on the first boot, which then reboots once.
+			log.Info("Scheduling an SELinux relabel on first boot...")
+			if err := os.WriteFile("/mnt/target/.autorelabel", nil, 0644); err != nil {
+				return fmt.Errorf("failed to schedule SELinux relabel: %w", err)
+			}
+		}
 	default:
 		return fmt.Errorf("unsupported distro for initramfs generation: %s", distro)
 	}
@@ -260,6 +303,7 @@ LABEL=UEFI      /boot/efi       vfat    umask=0077        0       1
 	}
 
 	log.Info("Finalization complete.")
+	status.succeed()
 
 	if rebootOnSuccess {
 		log.Title("Go OS Installer finished successfully!")
@@ -298,3 +342,26 @@ func findKernelVersion(modulesDir string) (string, error) {
 
 	return "", fmt.Errorf("no kernel version directory found in %s", modulesDir)
 }
+
+// elFamilies are the RHEL-family distros, by prefix of their name.
+var elFamilies = []string{"rocky", "almalinux", "centos"}
+
+// elFamily returns the RHEL-family distro of a distro name, e.g. "rocky" for
+// "rocky-9", or an empty string for other distros.
+func elFamily(distro string) string {
+	for _, family := range elFamilies {
+		if strings.HasPrefix(distro, family) {
+			return family
+		}
+	}
+	return ""
+}
+
+// family returns the distro the installed distro is based on: its family for
+// a distro imported by 'pvmlab distro import', its name otherwise.
+func (c *InstallerConfig) family() string {
+	if c.DistroFamily != "" {
+		return c.DistroFamily
+	}
+	return c.Distro
+}
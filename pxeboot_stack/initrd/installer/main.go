@@ -2,8 +2,10 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"installer/log"
 	"os"
+	"strings"
 )
 
 func main() {
@@ -11,6 +13,7 @@ func main() {
 	defer func() {
 		if r := recover(); r != nil {
 			log.Panic("%v", r)
+			status.fail(fmt.Errorf("panic: %v", r))
 			log.Title("Dropping to debug shell...")
 			dropToShell()
 		}
@@ -18,68 +21,64 @@ func main() {
 
 	log.Title("Go OS Installer started!")
 
-	log.Step("Phase 1: Network Setup")
+	status.start(1, "Network Setup")
 	netConfig, err := setupNetworking()
 	if err != nil {
-		log.Error("Failed to setup networking: %v", err)
-		dropToShell()
+		fail("Failed to setup networking: %v", err)
 		return
 	}
 
-	log.Step("Phase 2: Fetch Installer Configuration")
+	// Report to the boot handler serving the config until it tells us where.
+	status.url = strings.Replace(netConfig.ConfigURL, "/config/", "/status/", 1)
+	status.start(2, "Fetch Installer Configuration")
 	if netConfig.ConfigURL == "" {
-		log.Error("config_url not found in kernel command line")
-		dropToShell()
+		fail("config_url not found in kernel command line")
 		return
 	}
 	log.Title("Config URL: %s", netConfig.ConfigURL)
 	configBytes, err := fetchURL(netConfig.ConfigURL)
 	if err != nil {
-		log.Error("Failed to fetch installer config: %v", err)
-		dropToShell()
+		fail("Failed to fetch installer config: %v", err)
 		return
 	}
 	var installerConfig InstallerConfig
 	if err := json.Unmarshal(configBytes, &installerConfig); err != nil {
-		log.Error("Failed to parse installer config: %v", err)
-		dropToShell()
+		fail("Failed to parse installer config: %v", err)
 		return
 	}
+	if installerConfig.StatusURL != "" {
+		status.url = installerConfig.StatusURL
+	}
 
-	log.Step("Phase 3: Fetch Cloud-Init Configuration")
+	status.start(3, "Fetch Cloud-Init Configuration")
 	cloudInit, err := fetchCloudInitData(installerConfig.CloudInitURL)
 	if err != nil {
-		log.Error("Failed to fetch cloud-init data: %v", err)
-		dropToShell()
+		fail("Failed to fetch cloud-init data: %v", err)
 		return
 	}
 
-	log.Step("Phase 4: Disk Preparation")
+	status.start(4, "Disk Preparation")
 	diskPath, err := prepareDisk()
 	if err != nil {
-		log.Error("Failed to prepare disk: %v", err)
-		dropToShell()
+		fail("Failed to prepare disk: %v", err)
 		return
 	}
 
-	log.Step("Phase 5: OS Installation")
+	status.start(5, "OS Installation")
 	if err := installOS(&installerConfig); err != nil {
-		log.Error("Failed to install OS: %v", err)
-		dropToShell()
+		fail("Failed to install OS: %v", err)
 		return
 	}
 
-	log.Step("Phase 6: System Configuration")
+	status.start(6, "System Configuration")
 	if err := configureSystem(cloudInit); err != nil {
-		log.Error("Failed to configure system: %v", err)
-		dropToShell()
+		fail("Failed to configure system: %v", err)
 		return
 	}
 
-	log.Step("Phase 7: Finalization")
-	if err := finalize(installerConfig.RebootOnSuccess, installerConfig.Arch, installerConfig.Distro, diskPath); err != nil {
-		log.Error("Failed to finalize: %v", err)
-		dropToShell()
+	status.start(7, "Finalization")
+	if err := finalize(installerConfig.RebootOnSuccess, installerConfig.Arch, installerConfig.family(), diskPath); err != nil {
+		fail("Failed to finalize: %v", err)
 		return
 	}
 
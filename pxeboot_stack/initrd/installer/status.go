@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"installer/log"
+	"net/http"
+	"time"
+)
+
+// totalPhases is the number of phases of the installation, see main.
+const totalPhases = 7
+
+// statusReporter reports the progress of the installation to the boot
+// handler, so that 'pvmlab vm start --wait' can follow it. Reporting is best
+// effort: a failure to report never fails the installation.
+type statusReporter struct {
+	url       string
+	phase     int
+	phaseName string
+}
+
+var status = &statusReporter{}
+
+// start logs the beginning of a phase and reports it.
+func (s *statusReporter) start(phase int, name string) {
+	log.Step("Phase %d: %s", phase, name)
+	s.phase = phase
+	s.phaseName = name
+	s.report("running", "")
+}
+
+// fail reports that the current phase failed with err.
+func (s *statusReporter) fail(err error) {
+	s.report("failed", err.Error())
+}
+
+// succeed reports that the installation completed.
+func (s *statusReporter) succeed() {
+	s.report("succeeded", "")
+}
+
+func (s *statusReporter) report(state, errMsg string) {
+	if s.url == "" {
+		return
+	}
+	body, err := json.Marshal(map[string]any{
+		"phase":        s.phase,
+		"total_phases": totalPhases,
+		"phase_name":   s.phaseName,
+		"state":        state,
+		"error":        errMsg,
+	})
+	if err != nil {
+		log.Warn("failed to encode install status: %v", err)
+		return
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Warn("failed to report install status: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Warn("failed to report install status: %s", resp.Status)
+	}
+}
+
+// fail logs an installation error, reports it and drops to the debug shell.
+func fail(format string, a ...any) {
+	err := fmt.Errorf(format, a...)
+	log.Error("%v", err)
+	status.fail(err)
+	dropToShell()
+}
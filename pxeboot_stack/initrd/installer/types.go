@@ -5,17 +5,20 @@ package main
 type InstallerConfig struct {
 	CloudInitURL    string `json:"cloud_init_url"`
 	Distro          string `json:"distro"`
+	DistroFamily    string `json:"distro_family,omitempty"`
 	Arch            string `json:"arch"`
 	RootfsURL       string `json:"rootfs_url"`
 	KmodsURL        string `json:"kmods_url"`
 	KernelURL       string `json:"kernel_url"`
 	RebootOnSuccess bool   `json:"reboot_on_success"`
+	StatusURL       string `json:"status_url"`
 }
 // CloudInitData holds the cloud-init configuration
 type CloudInitData struct {
 	MetaData      string
 	UserData      string
 	NetworkConfig string
+	VendorData    string
 }
 
 // NetworkConfig holds network configuration parsed from kernel command line